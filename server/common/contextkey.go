@@ -1,4 +1,10 @@
 package common
 
-const ContextKeyUsername = "username"
-const ContextKeyUserID = "user_id"
+const AuthMethodJWT = "jwt"
+const AuthMethodAPIKey = "api_key"
+const AuthMethodCookie = "cookie"
+const AuthMethodClientCert = "mtls"
+
+const CookieSession = "session"
+const CookieCSRF = "csrf_token"
+const CookieOIDCState = "oidc_state"
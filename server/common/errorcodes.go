@@ -0,0 +1,5 @@
+package common
+
+// Error codes returned in the code field of error responses, for clients to tell failures apart
+const ErrCodeAccountPending = "account_pending"
+const ErrCodeAccountDisabled = "account_disabled"
@@ -5,6 +5,22 @@ const ErrMsgUserNotAuthenticated = "User not authenticated"
 const ErrMsgParseFormDataFail = "Failed to parse form data or file too large"
 const ErrMsgBadRequest = "Bad request"
 const ErrMsgInvalidCredentials = "Invalid credentials"
+const ErrMsgInvalidResetToken = "Invalid or expired password reset token"
+const ErrMsgMFAAlreadyEnabled = "Two-factor authentication is already enabled"
+const ErrMsgMFANotEnrolled = "Start two-factor authentication enrollment first"
+const ErrMsgMFANotEnabled = "Two-factor authentication is not enabled"
+const ErrMsgInvalidMFACode = "Invalid two-factor authentication code"
+const ErrMsgInvalidMFAToken = "Invalid or expired MFA token, sign in again"
+const ErrMsgAccountPending = "Account not verified yet, use the verification token sent to you"
+const ErrMsgAccountDisabled = "Account disabled"
+const ErrMsgInvalidVerificationToken = "Invalid or expired verification token"
+const ErrMsgOIDCProviderNotFound = "Unknown identity provider"
+const ErrMsgOIDCLoginFailed = "Single sign-on failed, sign in again"
+const ErrMsgTooManyLoginAttempts = "Too many failed login attempts, try again later"
 const ErrMsgReadFileFail = "Failed to read file"
 const ErrMsgInternalServerError = "Internal server error"
 const ErrMsgUserExists = "Username already exists"
+const ErrMsgGenerateTokenFail = "Failed to generate token"
+const ErrMsgInvalidRefreshToken = "Invalid refresh token"
+const ErrMsgForbidden = "Forbidden"
+const ErrMsgNotFound = "Not found"
@@ -4,12 +4,55 @@ import "fmt"
 
 var ErrFileTooLarge = fmt.Errorf("file too large")
 var ErrFileContentType = fmt.Errorf("invalid file type")
+var ErrContentTypeMismatch = fmt.Errorf("declared content type doesn't match the file content")
+var ErrInvalidImage = fmt.Errorf("invalid image")
 var ErrReadFileFromFormFailed = fmt.Errorf("failed to read file from form")
 var ErrSaveFileFail = fmt.Errorf("failed to save file")
+var ErrFileNotFound = fmt.Errorf("file not found")
 var ErrInvalidJSON = fmt.Errorf("invalid JSON format")
 var ErrInvalidRequest = fmt.Errorf("invalid request")
 var ErrInvalidCredentials = fmt.Errorf("invalid credentials")
+var ErrLoginLocked = fmt.Errorf("too many failed login attempts")
 
 var ErrUserExists = fmt.Errorf("user already exists")
 
 var ErrUserCreationFailed = fmt.Errorf("failed to create user")
+
+var ErrRevokeTokenFailed = fmt.Errorf("failed to revoke token")
+
+var ErrRefreshTokenInvalid = fmt.Errorf("invalid refresh token")
+var ErrRefreshTokenExpired = fmt.Errorf("refresh token has expired")
+var ErrRefreshTokenReused = fmt.Errorf("refresh token reuse detected")
+
+var ErrAPIKeyInvalid = fmt.Errorf("invalid API key")
+var ErrAPIKeyRevoked = fmt.Errorf("API key has been revoked")
+var ErrAPIKeyExpired = fmt.Errorf("API key has expired")
+var ErrAPIKeyNotFound = fmt.Errorf("API key not found")
+var ErrInvalidScope = fmt.Errorf("invalid scope")
+var ErrInsufficientScope = fmt.Errorf("insufficient scope")
+
+var ErrInvalidRole = fmt.Errorf("invalid role")
+var ErrInsufficientRole = fmt.Errorf("insufficient role")
+var ErrUserNotFound = fmt.Errorf("user not found")
+var ErrInvalidStatus = fmt.Errorf("invalid account status")
+var ErrAccountPending = fmt.Errorf("account is pending verification")
+var ErrAccountDisabled = fmt.Errorf("account is disabled")
+var ErrVerificationTokenInvalid = fmt.Errorf("invalid verification token")
+var ErrVerificationTokenExpired = fmt.Errorf("verification token has expired")
+
+var ErrResetTokenInvalid = fmt.Errorf("invalid password reset token")
+var ErrResetTokenExpired = fmt.Errorf("password reset token has expired")
+var ErrSignedInUserRequired = fmt.Errorf("signed in user required")
+var ErrCSRFTokenMismatch = fmt.Errorf("CSRF token missing or mismatched")
+var ErrSessionNotFound = fmt.Errorf("session not found")
+var ErrSessionRevoked = fmt.Errorf("session has been revoked")
+
+var ErrMFAAlreadyEnabled = fmt.Errorf("two-factor authentication already enabled")
+var ErrMFANotEnrolled = fmt.Errorf("two-factor authentication not enrolled")
+var ErrInvalidMFACode = fmt.Errorf("invalid two-factor authentication code")
+
+var ErrOIDCProviderNotFound = fmt.Errorf("identity provider not found")
+var ErrOIDCProviderError = fmt.Errorf("identity provider returned an error")
+var ErrOIDCStateInvalid = fmt.Errorf("invalid or expired login state")
+var ErrOIDCExchangeFailed = fmt.Errorf("authorization code exchange failed")
+var ErrOIDCIDTokenInvalid = fmt.Errorf("invalid ID token")
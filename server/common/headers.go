@@ -4,5 +4,12 @@ const HeaderAuthorization = "Authorization"
 const HeaderContentType = "Content-Type"
 const HeaderContentLength = "Content-Length"
 const HeaderUserAgent = "User-Agent"
+const HeaderCacheControl = "Cache-Control"
+const HeaderRetryAfter = "Retry-After"
+const HeaderCSRFToken = "X-CSRF-Token"
+const HeaderContentDisposition = "Content-Disposition"
+const HeaderETag = "ETag"
+const HeaderContentTypeOptions = "X-Content-Type-Options"
 
 const HeaderValueContentTypeJSON = "application/json"
+const HeaderValueContentTypeZIP = "application/zip"
@@ -0,0 +1,13 @@
+package common
+
+const ScopeFilesRead = "files:read"
+const ScopeFilesWrite = "files:write"
+
+// ScopeKeysManage is required to manage API keys, it can't be granted to an API key
+const ScopeKeysManage = "keys:manage"
+
+// ScopeTokensIntrospect allows introspecting tokens, the owner of the API key must also be an admin
+const ScopeTokensIntrospect = "tokens:introspect"
+
+// APIKeyScopes are the scopes which can be granted to an API key
+var APIKeyScopes = []string{ScopeFilesRead, ScopeFilesWrite, ScopeTokensIntrospect}
@@ -1,3 +1,26 @@
 package common
 
 const MsgFileUploadSuccess = "File uploaded successfully"
+const MsgFileTrashed = "File moved to trash"
+const MsgFileRestored = "File restored from trash"
+const MsgFileDeleted = "File deleted permanently"
+const MsgLogoutSuccess = "Logged out successfully"
+const MsgAPIKeyCreated = "API key created"
+const MsgAPIKeyRevoked = "API key revoked"
+const MsgUserRoleUpdated = "User role updated"
+const MsgUserUnlocked = "User unlocked"
+const MsgPasswordChanged = "Password changed, other sessions were signed out"
+const MsgPasswordResetRequested = "If the account exists, a password reset token has been sent"
+const MsgPasswordReset = "Password reset, sign in with the new password"
+const MsgMFARequired = "Two-factor authentication code required"
+const MsgTOTPEnrollStarted = "Add the secret to your authenticator app, then confirm with a code"
+const MsgTOTPEnabled = "Two-factor authentication enabled, store the recovery codes safely"
+const MsgTOTPDisabled = "Two-factor authentication disabled"
+const MsgRecoveryCodesRegenerated = "New recovery codes generated, the previous ones no longer work"
+const MsgUserStatusUpdated = "User status updated"
+const MsgVerificationSent = "If the account is waiting for verification, a verification token has been sent"
+const MsgAccountVerified = "Account verified, you can sign in now"
+const MsgRegisteredPendingVerification = "User registered, use the verification token sent to you to activate the account"
+const MsgSessionRevoked = "Session signed out"
+const MsgSessionsRevoked = "All sessions signed out"
+const MsgAccountDeleted = "Account deleted with all its files"
@@ -2,7 +2,12 @@ package database
 
 import (
 	"database/sql"
+	"fmt"
 	"os"
+	"path/filepath"
+	"strings"
+
+	"elotuschallenge/storage"
 
 	"github.com/rs/zerolog/log"
 	_ "modernc.org/sqlite"
@@ -46,6 +51,9 @@ func createTables() error {
 		id INTEGER PRIMARY KEY AUTOINCREMENT,
 		username VARCHAR(50) UNIQUE NOT NULL,
 		password_hash VARCHAR(255) NOT NULL,
+		role VARCHAR(20) NOT NULL DEFAULT 'user',
+		status VARCHAR(20) NOT NULL DEFAULT 'active',
+		token_version INTEGER NOT NULL DEFAULT 0,
 		created_at DATETIME DEFAULT CURRENT_TIMESTAMP
 	);`
 
@@ -58,12 +66,31 @@ func createTables() error {
 		content_type VARCHAR(100) NOT NULL,
 		size INTEGER NOT NULL,
 		user_id INTEGER NOT NULL,
-		upload_path VARCHAR(500) NOT NULL,
+		storage_backend VARCHAR(50) NOT NULL DEFAULT 'local',
+		storage_key VARCHAR(500) NOT NULL,
+		sha256 VARCHAR(64),
 		user_agent VARCHAR(500),
 		ip_address VARCHAR(45),
 		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		deleted_at DATETIME,
 		FOREIGN KEY (user_id) REFERENCES users(id)
 	);`
+	// Listings are sorted by upload time, size or name with the ID breaking ties
+	fileCreatedIndex := `CREATE INDEX IF NOT EXISTS idx_files_user_created ON files(user_id, created_at, id);`
+	fileSizeIndex := `CREATE INDEX IF NOT EXISTS idx_files_user_size ON files(user_id, size, id);`
+	fileNameIndex := `CREATE INDEX IF NOT EXISTS idx_files_user_name ON files(user_id, original_name, id);`
+	fileContentTypeIndex := `CREATE INDEX IF NOT EXISTS idx_files_user_content_type ON files(user_id, content_type, created_at, id);`
+
+	// Stored file content addressed by SHA-256 digest, shared by the files with that content
+	blobTable := `
+	CREATE TABLE IF NOT EXISTS blobs (
+		sha256 VARCHAR(64) PRIMARY KEY,
+		size INTEGER NOT NULL,
+		storage_backend VARCHAR(50) NOT NULL,
+		storage_key VARCHAR(500) NOT NULL,
+		ref_count INTEGER NOT NULL DEFAULT 1,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);`
 
 	// Optional: Token blacklist for revocation
 	tokenTable := `
@@ -74,18 +101,301 @@ func createTables() error {
 		expires_at DATETIME NOT NULL
 	);`
 
+	// Refresh tokens, rotated on each use and grouped by family for reuse detection
+	refreshTokenTable := `
+	CREATE TABLE IF NOT EXISTS refresh_tokens (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		token_hash VARCHAR(255) UNIQUE NOT NULL,
+		family_id VARCHAR(64) NOT NULL,
+		user_id INTEGER NOT NULL,
+		expires_at DATETIME NOT NULL,
+		used_at DATETIME,
+		revoked_at DATETIME,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY (user_id) REFERENCES users(id)
+	);`
+	refreshTokenFamilyIndex := `CREATE INDEX IF NOT EXISTS idx_refresh_tokens_family ON refresh_tokens(family_id);`
+
+	// Personal API keys, identified by prefix and stored hashed
+	apiKeyTable := `
+	CREATE TABLE IF NOT EXISTS api_keys (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		user_id INTEGER NOT NULL,
+		name VARCHAR(100) NOT NULL,
+		prefix VARCHAR(32) UNIQUE NOT NULL,
+		key_hash VARCHAR(255) NOT NULL,
+		scopes VARCHAR(500) NOT NULL,
+		expires_at DATETIME,
+		last_used_at DATETIME,
+		revoked_at DATETIME,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY (user_id) REFERENCES users(id)
+	);`
+
+	// Failed login counters keyed by username or client IP
+	loginAttemptTable := `
+	CREATE TABLE IF NOT EXISTS login_attempts (
+		attempt_key VARCHAR(100) PRIMARY KEY,
+		failures INTEGER NOT NULL DEFAULT 0,
+		last_failure_at DATETIME NOT NULL,
+		locked_until DATETIME
+	);`
+
+	// Single-use password reset tokens, stored hashed
+	passwordResetTable := `
+	CREATE TABLE IF NOT EXISTS password_reset_tokens (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		user_id INTEGER NOT NULL,
+		token_hash VARCHAR(255) UNIQUE NOT NULL,
+		expires_at DATETIME NOT NULL,
+		used_at DATETIME,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY (user_id) REFERENCES users(id)
+	);`
+
+	// Messages to users written by the outbox notifier, delivered by an external process
+	outboxTable := `
+	CREATE TABLE IF NOT EXISTS outbox (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		recipient VARCHAR(100) NOT NULL,
+		kind VARCHAR(50) NOT NULL,
+		subject VARCHAR(255) NOT NULL,
+		body TEXT NOT NULL,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		sent_at DATETIME
+	);`
+
+	// Single-use account verification tokens, stored hashed
+	verificationTable := `
+	CREATE TABLE IF NOT EXISTS verification_tokens (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		user_id INTEGER NOT NULL,
+		token_hash VARCHAR(255) UNIQUE NOT NULL,
+		expires_at DATETIME NOT NULL,
+		used_at DATETIME,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY (user_id) REFERENCES users(id)
+	);`
+
+	// TOTP secrets, enabled once the user confirmed a code; last_used_step prevents replaying a code
+	totpTable := `
+	CREATE TABLE IF NOT EXISTS totp_secrets (
+		user_id INTEGER PRIMARY KEY,
+		secret VARCHAR(64) NOT NULL,
+		enabled_at DATETIME,
+		last_used_step INTEGER NOT NULL DEFAULT 0,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY (user_id) REFERENCES users(id)
+	);`
+
+	// Single-use MFA recovery codes, stored hashed
+	recoveryCodeTable := `
+	CREATE TABLE IF NOT EXISTS mfa_recovery_codes (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		user_id INTEGER NOT NULL,
+		code_hash VARCHAR(255) NOT NULL,
+		used_at DATETIME,
+		FOREIGN KEY (user_id) REFERENCES users(id)
+	);`
+	recoveryCodeUserIndex := `CREATE INDEX IF NOT EXISTS idx_mfa_recovery_codes_user ON mfa_recovery_codes(user_id);`
+
+	// Pending OpenID Connect logins, removed once the provider redirected back
+	oidcStateTable := `
+	CREATE TABLE IF NOT EXISTS oidc_states (
+		state_hash VARCHAR(255) PRIMARY KEY,
+		provider VARCHAR(50) NOT NULL,
+		code_verifier VARCHAR(128) NOT NULL,
+		nonce VARCHAR(128) NOT NULL,
+		use_cookies BOOLEAN NOT NULL DEFAULT 0,
+		expires_at DATETIME NOT NULL,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);`
+
+	// Accounts of external identity providers linked to users, by issuer and subject
+	userIdentityTable := `
+	CREATE TABLE IF NOT EXISTS user_identities (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		user_id INTEGER NOT NULL,
+		issuer VARCHAR(255) NOT NULL,
+		subject VARCHAR(255) NOT NULL,
+		email VARCHAR(255),
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		UNIQUE (issuer, subject),
+		FOREIGN KEY (user_id) REFERENCES users(id)
+	);`
+
+	// Signed in sessions, one per login, with the latest access token issued in them
+	sessionTable := `
+	CREATE TABLE IF NOT EXISTS sessions (
+		id VARCHAR(64) PRIMARY KEY,
+		user_id INTEGER NOT NULL,
+		token_id VARCHAR(64) NOT NULL,
+		user_agent VARCHAR(500),
+		ip_address VARCHAR(45),
+		expires_at DATETIME NOT NULL,
+		revoked_at DATETIME,
+		last_seen_at DATETIME NOT NULL,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY (user_id) REFERENCES users(id)
+	);`
+	sessionUserIndex := `CREATE INDEX IF NOT EXISTS idx_sessions_user ON sessions(user_id);`
+
 	// Execute table creation
-	tables := []string{userTable, fileTable, tokenTable}
+	tables := []string{userTable, fileTable, fileCreatedIndex, fileSizeIndex, fileNameIndex, fileContentTypeIndex, blobTable,
+		tokenTable, refreshTokenTable, refreshTokenFamilyIndex, apiKeyTable, loginAttemptTable, passwordResetTable, outboxTable, verificationTable, totpTable, recoveryCodeTable, recoveryCodeUserIndex,
+		oidcStateTable, userIdentityTable, sessionTable, sessionUserIndex}
 	for _, table := range tables {
 		if _, err := DB.Exec(table); err != nil {
 			return err
 		}
 	}
 
+	// Add columns introduced after the tables were first created
+	if err := migrateColumns(); err != nil {
+		return err
+	}
+
 	log.Info().Msg("Database tables created successfully")
 	return nil
 }
 
+// columnMigrations lists columns added to existing tables, they are added when missing
+var columnMigrations = []struct {
+	table      string
+	column     string
+	definition string
+}{
+	{"users", "role", "VARCHAR(20) NOT NULL DEFAULT 'user'"},
+	{"users", "token_version", "INTEGER NOT NULL DEFAULT 0"},
+	{"users", "status", "VARCHAR(20) NOT NULL DEFAULT 'active'"},
+	{"files", "deleted_at", "DATETIME"},
+	{"files", "storage_backend", "VARCHAR(50) NOT NULL DEFAULT 'local'"},
+	{"files", "storage_key", "VARCHAR(500) NOT NULL DEFAULT ''"},
+	{"files", "sha256", "VARCHAR(64)"},
+}
+
+// migrateColumns adds the columns of columnMigrations missing in databases created by older versions
+func migrateColumns() error {
+	for _, migration := range columnMigrations {
+		exists, err := columnExists(migration.table, migration.column)
+		if err != nil {
+			return err
+		}
+		if exists {
+			continue
+		}
+
+		query := fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", migration.table, migration.column, migration.definition)
+		if _, err := DB.Exec(query); err != nil {
+			return err
+		}
+		log.Info().Str("table", migration.table).Str("column", migration.column).Msg("Database column added")
+	}
+	return nil
+}
+
+// MigrateFileStorage moves files of databases created by older versions, which stored the path of each file
+// on disk, to keys of the local storage. The upload_path column is only dropped once every file is found in the
+// storage, otherwise an error tells which file to move under the storage root or delete.
+func MigrateFileStorage(local *storage.LocalStorage) error {
+	exists, err := columnExists("files", "upload_path")
+	if err != nil || !exists {
+		return err
+	}
+
+	absRoot, err := filepath.Abs(local.Root())
+	if err != nil {
+		return err
+	}
+
+	rows, err := DB.Query("SELECT id, upload_path FROM files WHERE storage_key = ''")
+	if err != nil {
+		return err
+	}
+	keys := map[int]string{}
+	for rows.Next() {
+		var id int
+		var uploadPath string
+		if err := rows.Scan(&id, &uploadPath); err != nil {
+			rows.Close()
+			return err
+		}
+		key, err := legacyStorageKey(absRoot, uploadPath)
+		if err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to migrate file %d: %w", id, err)
+		}
+		keys[id] = key
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for id, key := range keys {
+		if _, err := local.Stat(key); err != nil {
+			return fmt.Errorf("failed to migrate file %d, %s not found in storage %s: %w", id, key, absRoot, err)
+		}
+	}
+
+	tx, err := DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for id, key := range keys {
+		if _, err := tx.Exec("UPDATE files SET storage_backend = 'local', storage_key = ? WHERE id = ?", key, id); err != nil {
+			return err
+		}
+	}
+	if _, err := tx.Exec("ALTER TABLE files DROP COLUMN upload_path"); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	log.Info().Int("files", len(keys)).Msg("Files moved to storage keys")
+	return nil
+}
+
+// legacyStorageKey returns the key of a file stored at uploadPath, relative paths are resolved from the working
+// directory like they were when the file was written
+func legacyStorageKey(absRoot, uploadPath string) (string, error) {
+	path, err := filepath.Abs(uploadPath)
+	if err != nil {
+		return "", err
+	}
+	key, err := filepath.Rel(absRoot, path)
+	if err != nil || key == "." || key == ".." || strings.HasPrefix(key, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("%s is outside the storage root %s, set TEMP_DIR to its directory or move it there", uploadPath, absRoot)
+	}
+	return filepath.ToSlash(key), nil
+}
+
+// columnExists checks if a table has a column
+func columnExists(table string, column string) (bool, error) {
+	rows, err := DB.Query(fmt.Sprintf("PRAGMA table_info(%s)", table))
+	if err != nil {
+		return false, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var cid, notNull, primaryKey int
+		var name, columnType string
+		var defaultValue sql.NullString
+		if err := rows.Scan(&cid, &name, &columnType, &notNull, &defaultValue, &primaryKey); err != nil {
+			return false, err
+		}
+		if name == column {
+			return true, nil
+		}
+	}
+	return false, rows.Err()
+}
+
 // CloseDB closes the database connection
 func CloseDB() {
 	if DB != nil {
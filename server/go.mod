@@ -5,6 +5,7 @@ go 1.24.4
 require (
 	github.com/rs/zerolog v1.34.0
 	golang.org/x/crypto v0.40.0
+	golang.org/x/image v0.29.0
 	modernc.org/sqlite v1.34.4
 )
 
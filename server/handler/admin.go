@@ -0,0 +1,145 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"elotuschallenge/common"
+	"elotuschallenge/internal"
+	"elotuschallenge/middleware"
+	"elotuschallenge/transfer"
+)
+
+// HandleAdminUsers lists (GET) all users, admin only
+func HandleAdminUsers(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		handleError(w, http.StatusMethodNotAllowed, common.ErrMsgMethodNotAllowed, nil)
+		return
+	}
+
+	users, err := internal.UserService.GetUsers()
+	if err != nil {
+		handleError(w, http.StatusInternalServerError, common.ErrMsgInternalServerError, err)
+		return
+	}
+
+	w.Header().Set(common.HeaderContentType, common.HeaderValueContentTypeJSON)
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(transfer.NewSuccessResponse("", transfer.UserListData{Users: users}))
+}
+
+// HandleAdminUserRole changes (PUT) the role of a user, admin only
+func HandleAdminUserRole(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPut {
+		handleError(w, http.StatusMethodNotAllowed, common.ErrMsgMethodNotAllowed, nil)
+		return
+	}
+
+	userID, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		handleError(w, http.StatusBadRequest, common.ErrMsgBadRequest, fmt.Errorf("%w: invalid user id", common.ErrInvalidRequest))
+		return
+	}
+
+	var req transfer.SetRoleRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		handleError(w, http.StatusBadRequest, common.ErrMsgBadRequest, fmt.Errorf("%w: %w", common.ErrInvalidJSON, err))
+		return
+	}
+
+	if err := internal.UserService.SetUserRole(userID, req.Role); err != nil {
+		if errors.Is(err, common.ErrInvalidRole) {
+			handleError(w, http.StatusBadRequest, common.ErrMsgBadRequest, err)
+			return
+		}
+		if errors.Is(err, common.ErrUserNotFound) {
+			handleError(w, http.StatusNotFound, common.ErrMsgNotFound, err)
+			return
+		}
+		handleError(w, http.StatusInternalServerError, common.ErrMsgInternalServerError, err)
+		return
+	}
+
+	middleware.AddLogEntries(r, "target_user_id", userID, "new_role", req.Role)
+
+	w.Header().Set(common.HeaderContentType, common.HeaderValueContentTypeJSON)
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(transfer.NewSuccessResponse(common.MsgUserRoleUpdated, nil))
+}
+
+// HandleAdminUserStatus changes (PUT) the account status of a user, e.g. to disable it, admin only
+func HandleAdminUserStatus(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPut {
+		handleError(w, http.StatusMethodNotAllowed, common.ErrMsgMethodNotAllowed, nil)
+		return
+	}
+
+	userID, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		handleError(w, http.StatusBadRequest, common.ErrMsgBadRequest, fmt.Errorf("%w: invalid user id", common.ErrInvalidRequest))
+		return
+	}
+
+	var req transfer.SetStatusRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		handleError(w, http.StatusBadRequest, common.ErrMsgBadRequest, fmt.Errorf("%w: %w", common.ErrInvalidJSON, err))
+		return
+	}
+
+	if err := internal.UserService.SetUserStatus(userID, req.Status); err != nil {
+		if errors.Is(err, common.ErrInvalidStatus) {
+			handleError(w, http.StatusBadRequest, common.ErrMsgBadRequest, err)
+			return
+		}
+		if errors.Is(err, common.ErrUserNotFound) {
+			handleError(w, http.StatusNotFound, common.ErrMsgNotFound, err)
+			return
+		}
+		handleError(w, http.StatusInternalServerError, common.ErrMsgInternalServerError, err)
+		return
+	}
+
+	middleware.AddLogEntries(r, "target_user_id", userID, "new_status", req.Status)
+
+	w.Header().Set(common.HeaderContentType, common.HeaderValueContentTypeJSON)
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(transfer.NewSuccessResponse(common.MsgUserStatusUpdated, nil))
+}
+
+// HandleAdminUserUnlock clears (POST) the login lockout of a user, admin only
+func HandleAdminUserUnlock(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		handleError(w, http.StatusMethodNotAllowed, common.ErrMsgMethodNotAllowed, nil)
+		return
+	}
+
+	userID, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		handleError(w, http.StatusBadRequest, common.ErrMsgBadRequest, fmt.Errorf("%w: invalid user id", common.ErrInvalidRequest))
+		return
+	}
+
+	user, err := internal.UserService.GetUserByID(userID)
+	if err != nil {
+		handleError(w, http.StatusInternalServerError, common.ErrMsgInternalServerError, err)
+		return
+	}
+	if user == nil {
+		handleError(w, http.StatusNotFound, common.ErrMsgNotFound, common.ErrUserNotFound)
+		return
+	}
+
+	if err := internal.LoginThrottleService.UnlockUser(user.Username); err != nil {
+		handleError(w, http.StatusInternalServerError, common.ErrMsgInternalServerError, err)
+		return
+	}
+
+	middleware.AddLogEntries(r, "target_user_id", userID)
+
+	w.Header().Set(common.HeaderContentType, common.HeaderValueContentTypeJSON)
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(transfer.NewSuccessResponse(common.MsgUserUnlocked, nil))
+}
@@ -0,0 +1,123 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"elotuschallenge/common"
+	"elotuschallenge/internal"
+	"elotuschallenge/middleware"
+	"elotuschallenge/transfer"
+)
+
+// HandleAPIKeys lists (GET) or creates (POST) API keys of the authenticated user
+func HandleAPIKeys(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodPost {
+		handleError(w, http.StatusMethodNotAllowed, common.ErrMsgMethodNotAllowed, nil)
+		return
+	}
+
+	principal, ok := middleware.GetPrincipal(r)
+	if !ok {
+		handleError(w, http.StatusUnauthorized, common.ErrMsgUserNotAuthenticated, nil)
+		return
+	}
+
+	// API keys can't be used to manage API keys
+	if !principal.HasScope(common.ScopeKeysManage) {
+		middleware.ResponseForbidden(w, r, fmt.Errorf("%w: %s", common.ErrInsufficientScope, common.ScopeKeysManage))
+		return
+	}
+
+	if r.Method == http.MethodGet {
+		keys, err := internal.APIKeyService.ListAPIKeys(principal.ID)
+		if err != nil {
+			handleError(w, http.StatusInternalServerError, common.ErrMsgInternalServerError, err)
+			return
+		}
+
+		w.Header().Set(common.HeaderContentType, common.HeaderValueContentTypeJSON)
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(transfer.NewSuccessResponse("", transfer.APIKeyListData{APIKeys: keys}))
+		return
+	}
+
+	// Parse request body
+	var req transfer.CreateAPIKeyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		handleError(w, http.StatusBadRequest, common.ErrMsgBadRequest, fmt.Errorf("%w: %w", common.ErrInvalidJSON, err))
+		return
+	}
+	if req.ExpiresInSeconds < 0 {
+		handleError(w, http.StatusBadRequest, common.ErrMsgBadRequest, fmt.Errorf("%w: expires_in_seconds must not be negative", common.ErrInvalidRequest))
+		return
+	}
+
+	var expiresAt *time.Time
+	if req.ExpiresInSeconds > 0 {
+		expiry := time.Now().Add(time.Duration(req.ExpiresInSeconds) * time.Second)
+		expiresAt = &expiry
+	}
+
+	plainKey, apiKey, err := internal.APIKeyService.CreateAPIKey(principal.ID, req.Name, req.Scopes, expiresAt)
+	if err != nil {
+		if errors.Is(err, common.ErrInvalidRequest) || errors.Is(err, common.ErrInvalidScope) {
+			handleError(w, http.StatusBadRequest, common.ErrMsgBadRequest, err)
+			return
+		}
+		handleError(w, http.StatusInternalServerError, common.ErrMsgInternalServerError, err)
+		return
+	}
+
+	middleware.AddLogEntries(r, "api_key_id", apiKey.ID, "api_key_prefix", apiKey.Prefix)
+
+	w.Header().Set(common.HeaderContentType, common.HeaderValueContentTypeJSON)
+	w.WriteHeader(http.StatusCreated)
+
+	data := transfer.CreateAPIKeyData{Key: plainKey, APIKey: apiKey}
+	json.NewEncoder(w).Encode(transfer.NewSuccessResponse(common.MsgAPIKeyCreated, data))
+}
+
+// HandleAPIKey revokes (DELETE) one API key of the authenticated user
+func HandleAPIKey(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		handleError(w, http.StatusMethodNotAllowed, common.ErrMsgMethodNotAllowed, nil)
+		return
+	}
+
+	principal, ok := middleware.GetPrincipal(r)
+	if !ok {
+		handleError(w, http.StatusUnauthorized, common.ErrMsgUserNotAuthenticated, nil)
+		return
+	}
+
+	if !principal.HasScope(common.ScopeKeysManage) {
+		middleware.ResponseForbidden(w, r, fmt.Errorf("%w: %s", common.ErrInsufficientScope, common.ScopeKeysManage))
+		return
+	}
+
+	keyID, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		handleError(w, http.StatusBadRequest, common.ErrMsgBadRequest, fmt.Errorf("%w: invalid key id", common.ErrInvalidRequest))
+		return
+	}
+
+	if err := internal.APIKeyService.RevokeAPIKey(principal.ID, keyID); err != nil {
+		if errors.Is(err, common.ErrAPIKeyNotFound) {
+			handleError(w, http.StatusNotFound, common.ErrMsgNotFound, err)
+			return
+		}
+		handleError(w, http.StatusInternalServerError, common.ErrMsgInternalServerError, err)
+		return
+	}
+
+	middleware.AddLogEntries(r, "api_key_id", keyID)
+
+	w.Header().Set(common.HeaderContentType, common.HeaderValueContentTypeJSON)
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(transfer.NewSuccessResponse(common.MsgAPIKeyRevoked, nil))
+}
@@ -0,0 +1,295 @@
+package handler
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"elotuschallenge/common"
+	"elotuschallenge/internal"
+	"elotuschallenge/middleware"
+	"elotuschallenge/models"
+	"elotuschallenge/transfer"
+)
+
+// defaultDownloadName is used when nothing is left of the original name once made safe
+const defaultDownloadName = "download"
+
+// HandleFiles lists (GET) the files of the authenticated user a page at a time. The query may filter by
+// content_type, created_after / created_before (RFC 3339) and a name substring, sort by created_at, size or
+// name in order asc or desc (default created_at desc), and continue after the next_cursor of the previous page.
+func HandleFiles(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		handleError(w, http.StatusMethodNotAllowed, common.ErrMsgMethodNotAllowed, nil)
+		return
+	}
+
+	principal, ok := middleware.GetPrincipal(r)
+	if !ok {
+		handleError(w, http.StatusUnauthorized, common.ErrMsgUserNotAuthenticated, nil)
+		return
+	}
+
+	// API keys need the files:read scope
+	if !principal.HasScope(common.ScopeFilesRead) {
+		middleware.ResponseForbidden(w, r, fmt.Errorf("%w: %s", common.ErrInsufficientScope, common.ScopeFilesRead))
+		return
+	}
+
+	writeFileList(w, r, principal, false)
+}
+
+// HandleTrash lists (GET) the trashed files of the authenticated user with the filters, sorting and
+// pagination of HandleFiles
+func HandleTrash(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		handleError(w, http.StatusMethodNotAllowed, common.ErrMsgMethodNotAllowed, nil)
+		return
+	}
+
+	principal, ok := middleware.GetPrincipal(r)
+	if !ok {
+		handleError(w, http.StatusUnauthorized, common.ErrMsgUserNotAuthenticated, nil)
+		return
+	}
+
+	if !principal.HasScope(common.ScopeFilesRead) {
+		middleware.ResponseForbidden(w, r, fmt.Errorf("%w: %s", common.ErrInsufficientScope, common.ScopeFilesRead))
+		return
+	}
+
+	writeFileList(w, r, principal, true)
+}
+
+// writeFileList responds with a page of the files or the trash of the principal as asked by the query string
+func writeFileList(w http.ResponseWriter, r *http.Request, principal *middleware.Principal, trashed bool) {
+	query, err := parseFileQuery(r.URL.Query())
+	if err != nil {
+		handleError(w, http.StatusBadRequest, common.ErrMsgBadRequest, err)
+		return
+	}
+	query.UserID = principal.ID
+	query.Trashed = trashed
+
+	page, err := internal.FileService.ListFiles(query, r.URL.Query().Get("cursor"))
+	if err != nil {
+		if errors.Is(err, common.ErrInvalidRequest) {
+			handleError(w, http.StatusBadRequest, common.ErrMsgBadRequest, err)
+			return
+		}
+		handleError(w, http.StatusInternalServerError, common.ErrMsgInternalServerError, err)
+		return
+	}
+
+	middleware.AddLogEntries(r, "file_count", len(page.Files), "sort", query.SortBy, "trashed", trashed)
+
+	data := transfer.FileListData{Files: page.Files, NextCursor: page.NextCursor}
+	if data.Files == nil {
+		data.Files = []*models.FileMetadata{}
+	}
+
+	w.Header().Set(common.HeaderContentType, common.HeaderValueContentTypeJSON)
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(transfer.NewSuccessResponse("", data))
+}
+
+// HandleFile moves (DELETE) a file of the authenticated user to the trash, it can be restored until it is purged
+func HandleFile(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		handleError(w, http.StatusMethodNotAllowed, common.ErrMsgMethodNotAllowed, nil)
+		return
+	}
+	changeFile(w, r, internal.FileService.TrashFile, "file_trashed", common.MsgFileTrashed)
+}
+
+// HandleTrashedFile permanently deletes (DELETE) a file from the trash of the authenticated user
+func HandleTrashedFile(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		handleError(w, http.StatusMethodNotAllowed, common.ErrMsgMethodNotAllowed, nil)
+		return
+	}
+	changeFile(w, r, internal.FileService.DeleteFile, "file_deleted", common.MsgFileDeleted)
+}
+
+// HandleTrashRestore restores (POST) a file from the trash of the authenticated user
+func HandleTrashRestore(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		handleError(w, http.StatusMethodNotAllowed, common.ErrMsgMethodNotAllowed, nil)
+		return
+	}
+	changeFile(w, r, internal.FileService.RestoreFile, "file_restored", common.MsgFileRestored)
+}
+
+// changeFile applies a change to the file of the path owned by the authenticated user, files of other users
+// are reported as not found
+func changeFile(w http.ResponseWriter, r *http.Request, change func(userID int, fileID int) error, logKey string, msg string) {
+	principal, ok := middleware.GetPrincipal(r)
+	if !ok {
+		handleError(w, http.StatusUnauthorized, common.ErrMsgUserNotAuthenticated, nil)
+		return
+	}
+
+	// API keys need the files:write scope
+	if !principal.HasScope(common.ScopeFilesWrite) {
+		middleware.ResponseForbidden(w, r, fmt.Errorf("%w: %s", common.ErrInsufficientScope, common.ScopeFilesWrite))
+		return
+	}
+
+	fileID, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		handleError(w, http.StatusBadRequest, common.ErrMsgBadRequest, fmt.Errorf("%w: invalid file id", common.ErrInvalidRequest))
+		return
+	}
+
+	if err := change(principal.ID, fileID); err != nil {
+		if errors.Is(err, common.ErrFileNotFound) {
+			handleError(w, http.StatusNotFound, common.ErrMsgNotFound, err)
+			return
+		}
+		handleError(w, http.StatusInternalServerError, common.ErrMsgInternalServerError, err)
+		return
+	}
+
+	middleware.AddLogEntries(r, "file_id", fileID, logKey, true)
+
+	w.Header().Set(common.HeaderContentType, common.HeaderValueContentTypeJSON)
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(transfer.NewSuccessResponse(msg, nil))
+}
+
+// parseFileQuery reads the filters, order and page size of a file listing from the query string
+func parseFileQuery(values url.Values) (models.FileQuery, error) {
+	query := models.FileQuery{
+		ContentType:  strings.TrimSpace(values.Get("content_type")),
+		NameContains: strings.TrimSpace(values.Get("name")),
+		SortBy:       values.Get("sort"),
+		Descending:   true,
+	}
+
+	switch order := values.Get("order"); order {
+	case "", "desc":
+	case "asc":
+		query.Descending = false
+	default:
+		return query, fmt.Errorf("%w: order must be asc or desc, got %q", common.ErrInvalidRequest, order)
+	}
+
+	if limit := values.Get("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n < 1 {
+			return query, fmt.Errorf("%w: limit must be a positive number, got %q", common.ErrInvalidRequest, limit)
+		}
+		query.Limit = n
+	}
+
+	var err error
+	if query.CreatedAfter, err = parseQueryTime(values, "created_after"); err != nil {
+		return query, err
+	}
+	if query.CreatedBefore, err = parseQueryTime(values, "created_before"); err != nil {
+		return query, err
+	}
+	return query, nil
+}
+
+// parseQueryTime reads an optional RFC 3339 time from the query string
+func parseQueryTime(values url.Values, param string) (*time.Time, error) {
+	value := values.Get(param)
+	if value == "" {
+		return nil, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s must be an RFC 3339 time, got %q", common.ErrInvalidRequest, param, value)
+	}
+	return &t, nil
+}
+
+// HandleFileContent streams (GET, HEAD) the content of a file of the authenticated user with its stored
+// content type. Byte ranges and conditional requests on the ETag and upload time are answered by
+// http.ServeContent.
+func HandleFileContent(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		handleError(w, http.StatusMethodNotAllowed, common.ErrMsgMethodNotAllowed, nil)
+		return
+	}
+
+	principal, ok := middleware.GetPrincipal(r)
+	if !ok {
+		handleError(w, http.StatusUnauthorized, common.ErrMsgUserNotAuthenticated, nil)
+		return
+	}
+
+	// API keys need the files:read scope
+	if !principal.HasScope(common.ScopeFilesRead) {
+		middleware.ResponseForbidden(w, r, fmt.Errorf("%w: %s", common.ErrInsufficientScope, common.ScopeFilesRead))
+		return
+	}
+
+	fileID, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		handleError(w, http.StatusBadRequest, common.ErrMsgBadRequest, fmt.Errorf("%w: invalid file id", common.ErrInvalidRequest))
+		return
+	}
+
+	// Files of other users are reported as not found
+	file, metadata, err := internal.FileService.OpenUserFile(principal.ID, fileID)
+	if err != nil {
+		if errors.Is(err, common.ErrFileNotFound) {
+			handleError(w, http.StatusNotFound, common.ErrMsgNotFound, err)
+			return
+		}
+		handleError(w, http.StatusInternalServerError, common.ErrMsgInternalServerError, err)
+		return
+	}
+	defer file.Close()
+
+	middleware.AddLogEntries(r, "file_id", metadata.ID, "range", r.Header.Get("Range"))
+
+	// The stored type is sent as is so browsers don't sniff it, and files are downloaded rather than rendered
+	// since uploaded SVGs may carry scripts
+	w.Header().Set(common.HeaderContentType, metadata.ContentType)
+	w.Header().Set(common.HeaderContentTypeOptions, "nosniff")
+	w.Header().Set(common.HeaderContentDisposition, contentDisposition(metadata.OriginalName))
+	w.Header().Set(common.HeaderCacheControl, "private, no-cache")
+	w.Header().Set(common.HeaderETag, fileETag(metadata))
+
+	http.ServeContent(w, r, metadata.OriginalName, metadata.CreatedAt, file)
+}
+
+// fileETag returns a strong ETag of a file, stored files never change so their identity is enough
+func fileETag(metadata *models.FileMetadata) string {
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%d:%s:%d", metadata.ID, metadata.Filename, metadata.Size)))
+	return `"` + hex.EncodeToString(sum[:16]) + `"`
+}
+
+// contentDisposition builds an attachment header with the original name of a file, stripped of paths and
+// control characters; names which aren't plain ASCII are encoded as RFC 2231 filename*
+func contentDisposition(originalName string) string {
+	name := filepath.Base(strings.ReplaceAll(originalName, `\`, "/"))
+	name = strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) || r == '"' {
+			return -1
+		}
+		return r
+	}, name)
+	name = strings.TrimSpace(name)
+	if name == "" || name == "." || name == "/" {
+		name = defaultDownloadName
+	}
+
+	if header := mime.FormatMediaType("attachment", map[string]string{"filename": name}); header != "" {
+		return header
+	}
+	return mime.FormatMediaType("attachment", map[string]string{"filename": defaultDownloadName})
+}
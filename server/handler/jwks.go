@@ -0,0 +1,23 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"elotuschallenge/common"
+	"elotuschallenge/internal"
+)
+
+// HandleJWKS publishes the public keys verifying our tokens as a JSON Web Key Set
+func HandleJWKS(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		handleError(w, http.StatusMethodNotAllowed, common.ErrMsgMethodNotAllowed, nil)
+		return
+	}
+
+	w.Header().Set(common.HeaderContentType, common.HeaderValueContentTypeJSON)
+	w.Header().Set(common.HeaderCacheControl, "public, max-age=300")
+	w.WriteHeader(http.StatusOK)
+
+	json.NewEncoder(w).Encode(internal.TokenManager.PublicKeys())
+}
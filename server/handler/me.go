@@ -0,0 +1,120 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"elotuschallenge/common"
+	"elotuschallenge/internal"
+	"elotuschallenge/middleware"
+	"elotuschallenge/transfer"
+)
+
+// Me handler, returns (GET) the authenticated user as seen by AuthUser or deletes (DELETE) their account
+func HandleMe(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodDelete {
+		handleError(w, http.StatusMethodNotAllowed, common.ErrMsgMethodNotAllowed, nil)
+		return
+	}
+
+	principal, ok := middleware.GetPrincipal(r)
+	if !ok {
+		handleError(w, http.StatusUnauthorized, common.ErrMsgUserNotAuthenticated, nil)
+		return
+	}
+
+	if r.Method == http.MethodDelete {
+		deleteAccount(w, r, principal)
+		return
+	}
+
+	w.Header().Set(common.HeaderContentType, common.HeaderValueContentTypeJSON)
+	w.WriteHeader(http.StatusOK)
+
+	data := transfer.MeData{
+		User: transfer.UserInfo{
+			ID:       principal.ID,
+			Username: principal.Username,
+			Role:     principal.Role(),
+		},
+		AuthMethod: principal.AuthMethod,
+		Scopes:     principal.Scopes,
+	}
+	json.NewEncoder(w).Encode(transfer.NewSuccessResponse("", data))
+}
+
+// deleteAccount deletes the account of the authenticated user with all their files and signs them out
+func deleteAccount(w http.ResponseWriter, r *http.Request, principal *middleware.Principal) {
+	// API keys can't delete the account of their owner
+	if principal.IsAPIKey() {
+		middleware.ResponseForbidden(w, r, common.ErrSignedInUserRequired)
+		return
+	}
+
+	if err := internal.AccountService.DeleteAccount(principal.ID); err != nil {
+		if errors.Is(err, common.ErrUserNotFound) {
+			handleError(w, http.StatusNotFound, common.ErrMsgNotFound, err)
+			return
+		}
+		handleError(w, http.StatusInternalServerError, common.ErrMsgInternalServerError, err)
+		return
+	}
+
+	// Sessions were deleted with the account, the token of the request is revoked as well in case it has none
+	token := internal.TokenManager.ExtractTokenFromHeader(r.Header.Get(common.HeaderAuthorization))
+	if principal.AuthMethod == common.AuthMethodCookie {
+		token = middleware.SessionToken(r)
+		middleware.ClearSessionCookies(w)
+	}
+	if err := internal.TokenManager.RevokeToken(token); err != nil {
+		middleware.AddLogEntries(r, "revoke_error", fmt.Errorf("%w: %w", common.ErrRevokeTokenFailed, err).Error())
+	}
+	middleware.AddLogEntries(r, "account_deleted", true)
+
+	w.Header().Set(common.HeaderContentType, common.HeaderValueContentTypeJSON)
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(transfer.NewSuccessResponse(common.MsgAccountDeleted, nil))
+}
+
+// HandleMeExport streams a ZIP archive with the personal data of the authenticated user and all their files
+func HandleMeExport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		handleError(w, http.StatusMethodNotAllowed, common.ErrMsgMethodNotAllowed, nil)
+		return
+	}
+
+	principal, ok := middleware.GetPrincipal(r)
+	if !ok {
+		handleError(w, http.StatusUnauthorized, common.ErrMsgUserNotAuthenticated, nil)
+		return
+	}
+
+	// The export holds the whole account, API keys only get what their scopes allow
+	if principal.IsAPIKey() {
+		middleware.ResponseForbidden(w, r, common.ErrSignedInUserRequired)
+		return
+	}
+
+	export, err := internal.AccountService.ExportAccount(principal.ID)
+	if err != nil {
+		if errors.Is(err, common.ErrUserNotFound) {
+			handleError(w, http.StatusNotFound, common.ErrMsgNotFound, err)
+			return
+		}
+		handleError(w, http.StatusInternalServerError, common.ErrMsgInternalServerError, err)
+		return
+	}
+
+	w.Header().Set(common.HeaderContentType, common.HeaderValueContentTypeZIP)
+	w.Header().Set(common.HeaderContentDisposition, `attachment; filename="account-export.zip"`)
+	w.Header().Set(common.HeaderCacheControl, "no-store")
+	w.WriteHeader(http.StatusOK)
+
+	// The status is sent already, a failure halfway leaves a truncated archive the client can't open
+	middleware.AddLogEntries(r, "exported_files", len(export.Files))
+	if err := internal.AccountService.WriteExportArchive(export, w); err != nil {
+		middleware.AddLogEntries(r, "export_error", err.Error())
+	}
+}
@@ -0,0 +1,352 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"elotuschallenge/common"
+	"elotuschallenge/internal"
+	"elotuschallenge/middleware"
+	"elotuschallenge/models"
+	"elotuschallenge/services"
+	"elotuschallenge/transfer"
+	"elotuschallenge/utils"
+)
+
+// HandleTOTPEnroll starts TOTP enrollment (POST) for the authenticated user
+func HandleTOTPEnroll(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		handleError(w, http.StatusMethodNotAllowed, common.ErrMsgMethodNotAllowed, nil)
+		return
+	}
+
+	principal, ok := middleware.GetPrincipal(r)
+	if !ok {
+		handleError(w, http.StatusUnauthorized, common.ErrMsgUserNotAuthenticated, nil)
+		return
+	}
+
+	// API keys can't change how their owner signs in
+	if principal.IsAPIKey() {
+		middleware.ResponseForbidden(w, r, common.ErrSignedInUserRequired)
+		return
+	}
+
+	secret, uri, err := internal.MFAService.EnrollTOTP(principal.ID, principal.Username)
+	if err != nil {
+		if errors.Is(err, common.ErrMFAAlreadyEnabled) {
+			handleError(w, http.StatusConflict, common.ErrMsgMFAAlreadyEnabled, err)
+			return
+		}
+		handleError(w, http.StatusInternalServerError, common.ErrMsgInternalServerError, err)
+		return
+	}
+
+	w.Header().Set(common.HeaderContentType, common.HeaderValueContentTypeJSON)
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(transfer.NewSuccessResponse(common.MsgTOTPEnrollStarted, transfer.TOTPEnrollData{Secret: secret, URI: uri}))
+}
+
+// HandleTOTPConfirm enables TOTP (POST) with a code of the enrolled authenticator and returns recovery codes
+func HandleTOTPConfirm(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		handleError(w, http.StatusMethodNotAllowed, common.ErrMsgMethodNotAllowed, nil)
+		return
+	}
+
+	principal, ok := middleware.GetPrincipal(r)
+	if !ok {
+		handleError(w, http.StatusUnauthorized, common.ErrMsgUserNotAuthenticated, nil)
+		return
+	}
+
+	if principal.IsAPIKey() {
+		middleware.ResponseForbidden(w, r, common.ErrSignedInUserRequired)
+		return
+	}
+
+	// Parse request body
+	var req transfer.TOTPConfirmRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		handleError(w, http.StatusBadRequest, common.ErrMsgBadRequest, fmt.Errorf("%w: %w", common.ErrInvalidJSON, err))
+		return
+	}
+
+	recoveryCodes, err := internal.MFAService.ConfirmTOTP(principal.ID, req.Code)
+	if err != nil {
+		switch {
+		case errors.Is(err, common.ErrInvalidMFACode):
+			handleError(w, http.StatusBadRequest, common.ErrMsgInvalidMFACode, err)
+		case errors.Is(err, common.ErrMFANotEnrolled):
+			handleError(w, http.StatusBadRequest, common.ErrMsgMFANotEnrolled, err)
+		case errors.Is(err, common.ErrMFAAlreadyEnabled):
+			handleError(w, http.StatusConflict, common.ErrMsgMFAAlreadyEnabled, err)
+		default:
+			handleError(w, http.StatusInternalServerError, common.ErrMsgInternalServerError, err)
+		}
+		return
+	}
+
+	middleware.AddLogEntries(r, "mfa_enabled", true)
+
+	w.Header().Set(common.HeaderContentType, common.HeaderValueContentTypeJSON)
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(transfer.NewSuccessResponse(common.MsgTOTPEnabled, transfer.TOTPConfirmData{RecoveryCodes: recoveryCodes}))
+}
+
+// HandleTOTPDisable turns 2FA off (POST) for the authenticated user after checking the password and a code
+func HandleTOTPDisable(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		handleError(w, http.StatusMethodNotAllowed, common.ErrMsgMethodNotAllowed, nil)
+		return
+	}
+
+	principal, ok := verifyMFAReauth(w, r)
+	if !ok {
+		return
+	}
+
+	if err := internal.MFAService.DisableTOTP(principal.ID); err != nil {
+		handleMFAReauthError(w, err)
+		return
+	}
+
+	middleware.AddLogEntries(r, "mfa_disabled", true)
+
+	w.Header().Set(common.HeaderContentType, common.HeaderValueContentTypeJSON)
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(transfer.NewSuccessResponse(common.MsgTOTPDisabled, nil))
+}
+
+// HandleRecoveryCodesRegenerate replaces the recovery codes (POST) of the authenticated user after checking
+// the password and a code
+func HandleRecoveryCodesRegenerate(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		handleError(w, http.StatusMethodNotAllowed, common.ErrMsgMethodNotAllowed, nil)
+		return
+	}
+
+	principal, ok := verifyMFAReauth(w, r)
+	if !ok {
+		return
+	}
+
+	recoveryCodes, err := internal.MFAService.RegenerateRecoveryCodes(principal.ID)
+	if err != nil {
+		handleMFAReauthError(w, err)
+		return
+	}
+
+	middleware.AddLogEntries(r, "mfa_recovery_codes_regenerated", true)
+
+	w.Header().Set(common.HeaderContentType, common.HeaderValueContentTypeJSON)
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(transfer.NewSuccessResponse(common.MsgRecoveryCodesRegenerated, transfer.TOTPConfirmData{RecoveryCodes: recoveryCodes}))
+}
+
+// HandleLoginMFA exchanges the MFA token from /api/login and a TOTP or recovery code for tokens
+func HandleLoginMFA(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		handleError(w, http.StatusMethodNotAllowed, common.ErrMsgMethodNotAllowed, nil)
+		return
+	}
+
+	// Parse request body
+	var req transfer.LoginMFARequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		handleError(w, http.StatusBadRequest, common.ErrMsgBadRequest, fmt.Errorf("%w: %w", common.ErrInvalidJSON, err))
+		return
+	}
+	if strings.TrimSpace(req.Code) == "" && strings.TrimSpace(req.RecoveryCode) == "" {
+		handleError(w, http.StatusBadRequest, common.ErrMsgBadRequest, fmt.Errorf("%w: code or recovery_code is required", common.ErrInvalidRequest))
+		return
+	}
+
+	claims, err := internal.TokenManager.ValidatePurposeToken(req.MFAToken, services.TokenPurposeMFA)
+	if err != nil {
+		handleError(w, http.StatusUnauthorized, common.ErrMsgInvalidMFAToken, err)
+		return
+	}
+	revoked, err := internal.TokenManager.IsTokenRevoked(req.MFAToken)
+	if err != nil {
+		handleError(w, http.StatusInternalServerError, common.ErrMsgInternalServerError, err)
+		return
+	}
+	if revoked {
+		handleError(w, http.StatusUnauthorized, common.ErrMsgInvalidMFAToken, fmt.Errorf("MFA token of user %d already used", claims.UserID))
+		return
+	}
+
+	// Codes are guessed against the same lockout as passwords
+	clientIP := utils.GetClientIP(r)
+	if retryAfter, err := internal.LoginThrottleService.CheckLogin(claims.Username, clientIP); err != nil {
+		if errors.Is(err, common.ErrLoginLocked) {
+			responseLoginLocked(w, retryAfter, err)
+			return
+		}
+		handleError(w, http.StatusInternalServerError, common.ErrMsgInternalServerError, err)
+		return
+	}
+
+	if strings.TrimSpace(req.RecoveryCode) != "" {
+		err = internal.MFAService.UseRecoveryCode(claims.UserID, req.RecoveryCode)
+	} else {
+		err = internal.MFAService.VerifyTOTP(claims.UserID, req.Code)
+	}
+	if err != nil {
+		if !errors.Is(err, common.ErrInvalidMFACode) {
+			handleError(w, http.StatusInternalServerError, common.ErrMsgInternalServerError, err)
+			return
+		}
+
+		lockout, errRecord := internal.LoginThrottleService.RecordFailure(claims.Username, clientIP)
+		if errRecord != nil {
+			handleError(w, http.StatusInternalServerError, common.ErrMsgInternalServerError, errRecord)
+			return
+		}
+		if lockout > 0 {
+			responseLoginLocked(w, lockout, fmt.Errorf("%w: %w", common.ErrLoginLocked, err))
+			return
+		}
+		handleError(w, http.StatusUnauthorized, common.ErrMsgInvalidMFACode, fmt.Errorf("%w: user %d from %s", err, claims.UserID, clientIP))
+		return
+	}
+
+	// The MFA token is single-use
+	if err := internal.TokenManager.RevokeToken(req.MFAToken); err != nil {
+		handleError(w, http.StatusInternalServerError, common.ErrMsgInternalServerError, err)
+		return
+	}
+
+	user, err := internal.UserService.GetUserByID(claims.UserID)
+	if err != nil {
+		handleError(w, http.StatusInternalServerError, common.ErrMsgInternalServerError, err)
+		return
+	}
+	if user == nil || claims.TokenVersion < user.TokenVersion {
+		handleError(w, http.StatusUnauthorized, common.ErrMsgInvalidMFAToken, fmt.Errorf("MFA token of user %d no longer valid", claims.UserID))
+		return
+	}
+	if err := services.CheckAccountStatus(user); err != nil {
+		middleware.ResponseAccountInactive(w, r, err)
+		return
+	}
+
+	completeLogin(w, r, user, req.UseCookies)
+}
+
+// verifyMFAReauth checks the password and the TOTP or recovery code in the body against the signed in user.
+// Wrong guesses count like failed logins. It writes the error response and returns false when the check fails.
+func verifyMFAReauth(w http.ResponseWriter, r *http.Request) (*middleware.Principal, bool) {
+	principal, ok := middleware.GetPrincipal(r)
+	if !ok {
+		handleError(w, http.StatusUnauthorized, common.ErrMsgUserNotAuthenticated, nil)
+		return nil, false
+	}
+
+	// API keys can't change how their owner signs in
+	if principal.IsAPIKey() {
+		middleware.ResponseForbidden(w, r, common.ErrSignedInUserRequired)
+		return nil, false
+	}
+
+	// Parse request body
+	var req transfer.MFAReauthRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		handleError(w, http.StatusBadRequest, common.ErrMsgBadRequest, fmt.Errorf("%w: %w", common.ErrInvalidJSON, err))
+		return nil, false
+	}
+	if strings.TrimSpace(req.Password) == "" {
+		handleError(w, http.StatusBadRequest, common.ErrMsgBadRequest, fmt.Errorf("%w: password is required", common.ErrInvalidRequest))
+		return nil, false
+	}
+	if strings.TrimSpace(req.Code) == "" && strings.TrimSpace(req.RecoveryCode) == "" {
+		handleError(w, http.StatusBadRequest, common.ErrMsgBadRequest, fmt.Errorf("%w: code or recovery_code is required", common.ErrInvalidRequest))
+		return nil, false
+	}
+
+	clientIP := utils.GetClientIP(r)
+	if retryAfter, err := internal.LoginThrottleService.CheckLogin(principal.Username, clientIP); err != nil {
+		if errors.Is(err, common.ErrLoginLocked) {
+			responseLoginLocked(w, retryAfter, err)
+			return nil, false
+		}
+		handleError(w, http.StatusInternalServerError, common.ErrMsgInternalServerError, err)
+		return nil, false
+	}
+
+	_, err := internal.PasswordService.VerifyPassword(principal.ID, req.Password)
+	if err == nil {
+		enabled, errEnabled := internal.MFAService.IsMFAEnabled(principal.ID)
+		switch {
+		case errEnabled != nil:
+			err = errEnabled
+		case !enabled:
+			handleError(w, http.StatusBadRequest, common.ErrMsgMFANotEnabled, common.ErrMFANotEnrolled)
+			return nil, false
+		case strings.TrimSpace(req.RecoveryCode) != "":
+			err = internal.MFAService.UseRecoveryCode(principal.ID, req.RecoveryCode)
+		default:
+			err = internal.MFAService.VerifyTOTP(principal.ID, req.Code)
+		}
+	}
+	if err != nil {
+		if !errors.Is(err, common.ErrInvalidCredentials) && !errors.Is(err, common.ErrInvalidMFACode) {
+			handleMFAReauthError(w, err)
+			return nil, false
+		}
+
+		lockout, errRecord := internal.LoginThrottleService.RecordFailure(principal.Username, clientIP)
+		if errRecord != nil {
+			handleError(w, http.StatusInternalServerError, common.ErrMsgInternalServerError, errRecord)
+			return nil, false
+		}
+		if lockout > 0 {
+			responseLoginLocked(w, lockout, fmt.Errorf("%w: %w", common.ErrLoginLocked, err))
+			return nil, false
+		}
+		if errors.Is(err, common.ErrInvalidMFACode) {
+			handleError(w, http.StatusUnauthorized, common.ErrMsgInvalidMFACode, err)
+			return nil, false
+		}
+		handleError(w, http.StatusUnauthorized, common.ErrMsgInvalidCredentials, err)
+		return nil, false
+	}
+
+	return principal, true
+}
+
+// handleMFAReauthError responds to errors of the services behind verifyMFAReauth
+func handleMFAReauthError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, common.ErrMFANotEnrolled):
+		handleError(w, http.StatusBadRequest, common.ErrMsgMFANotEnabled, err)
+	case errors.Is(err, common.ErrUserNotFound):
+		handleError(w, http.StatusUnauthorized, common.ErrMsgUserNotAuthenticated, err)
+	default:
+		handleError(w, http.StatusInternalServerError, common.ErrMsgInternalServerError, err)
+	}
+}
+
+// writeMFARequiredResponse responds with a short-lived token which is only accepted by /api/login/mfa
+func writeMFARequiredResponse(w http.ResponseWriter, user *models.User) {
+	mfaToken, err := internal.TokenManager.IssueTokenWithExpiration(services.Claims{
+		UserID:       user.ID,
+		Username:     user.Username,
+		TokenVersion: user.TokenVersion,
+		Purpose:      services.TokenPurposeMFA,
+	}, internal.MFATokenExpirationSeconds)
+	if err != nil {
+		handleError(w, http.StatusInternalServerError, common.ErrMsgGenerateTokenFail, err)
+		return
+	}
+
+	w.Header().Set(common.HeaderContentType, common.HeaderValueContentTypeJSON)
+	w.WriteHeader(http.StatusOK)
+
+	data := transfer.MFARequiredData{MFARequired: true, MFAToken: mfaToken}
+	json.NewEncoder(w).Encode(transfer.NewSuccessResponse(common.MsgMFARequired, data))
+}
@@ -0,0 +1,130 @@
+package handler
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"elotuschallenge/common"
+	"elotuschallenge/internal"
+	"elotuschallenge/middleware"
+	"elotuschallenge/services"
+	"elotuschallenge/transfer"
+)
+
+// OIDC providers handler, lists the identity providers users can sign in with
+func HandleOIDCProviders(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		handleError(w, http.StatusMethodNotAllowed, common.ErrMsgMethodNotAllowed, nil)
+		return
+	}
+
+	w.Header().Set(common.HeaderContentType, common.HeaderValueContentTypeJSON)
+	w.WriteHeader(http.StatusOK)
+
+	data := transfer.OIDCProvidersData{Providers: internal.OIDCService.Providers()}
+	json.NewEncoder(w).Encode(transfer.NewSuccessResponse("", data))
+}
+
+// OIDC login handler, redirects the browser to the provider's authorization endpoint.
+// With use_cookies=true the callback sets a session cookie instead of returning tokens.
+// The state is also kept in a cookie so only the browser which started the login can complete it.
+func HandleOIDCLogin(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		handleError(w, http.StatusMethodNotAllowed, common.ErrMsgMethodNotAllowed, nil)
+		return
+	}
+
+	useCookies, _ := strconv.ParseBool(r.URL.Query().Get("use_cookies"))
+	authURL, state, err := internal.OIDCService.StartLogin(r.PathValue("provider"), useCookies)
+	if err != nil {
+		if errors.Is(err, common.ErrOIDCProviderNotFound) {
+			handleError(w, http.StatusNotFound, common.ErrMsgOIDCProviderNotFound, err)
+			return
+		}
+		handleError(w, http.StatusBadGateway, common.ErrMsgOIDCLoginFailed, err)
+		return
+	}
+
+	setOIDCStateCookie(w, r.PathValue("provider"), state, int(services.OIDCStateExpiration.Seconds()))
+	http.Redirect(w, r, authURL, http.StatusFound)
+}
+
+// OIDC callback handler, the provider redirects here with the authorization code. The ID token identifies
+// the user, who then gets our own tokens like after a password login.
+func HandleOIDCCallback(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		handleError(w, http.StatusMethodNotAllowed, common.ErrMsgMethodNotAllowed, nil)
+		return
+	}
+
+	// The state cookie is single use like the state itself
+	stateCookie, _ := r.Cookie(common.CookieOIDCState)
+	setOIDCStateCookie(w, r.PathValue("provider"), "", -1)
+
+	query := r.URL.Query()
+	if providerError := query.Get("error"); providerError != "" {
+		handleError(w, http.StatusUnauthorized, common.ErrMsgOIDCLoginFailed,
+			fmt.Errorf("%w: %s %s", common.ErrOIDCProviderError, providerError, query.Get("error_description")))
+		return
+	}
+	if query.Get("state") == "" || query.Get("code") == "" {
+		handleError(w, http.StatusBadRequest, common.ErrMsgBadRequest, fmt.Errorf("%w: state and code are required", common.ErrInvalidRequest))
+		return
+	}
+	// A callback URL sent to another browser must not sign it in to the account used at the provider
+	if stateCookie == nil || subtle.ConstantTimeCompare([]byte(stateCookie.Value), []byte(query.Get("state"))) != 1 {
+		handleError(w, http.StatusUnauthorized, common.ErrMsgOIDCLoginFailed,
+			fmt.Errorf("%w: login was started by another browser", common.ErrOIDCStateInvalid))
+		return
+	}
+
+	login, err := internal.OIDCService.CompleteLogin(r.PathValue("provider"), query.Get("state"), query.Get("code"))
+	if err != nil {
+		switch {
+		case errors.Is(err, common.ErrOIDCProviderNotFound):
+			handleError(w, http.StatusNotFound, common.ErrMsgOIDCProviderNotFound, err)
+		case errors.Is(err, common.ErrOIDCStateInvalid), errors.Is(err, common.ErrOIDCExchangeFailed), errors.Is(err, common.ErrOIDCIDTokenInvalid):
+			handleError(w, http.StatusUnauthorized, common.ErrMsgOIDCLoginFailed, err)
+		default:
+			handleError(w, http.StatusInternalServerError, common.ErrMsgInternalServerError, err)
+		}
+		return
+	}
+
+	user := login.User
+	if err := services.CheckAccountStatus(user); err != nil {
+		middleware.ResponseAccountInactive(w, r, err)
+		return
+	}
+
+	// Two-factor authentication enabled on the account is still required
+	mfaEnabled, err := internal.MFAService.IsMFAEnabled(user.ID)
+	if err != nil {
+		handleError(w, http.StatusInternalServerError, common.ErrMsgInternalServerError, err)
+		return
+	}
+	if mfaEnabled {
+		writeMFARequiredResponse(w, user)
+		return
+	}
+
+	completeLogin(w, r, user, login.UseCookies)
+}
+
+// setOIDCStateCookie stores the login state for the callback of the provider, a negative maxAge clears it.
+// SameSite=Lax lets the browser send it on the redirect back from the provider.
+func setOIDCStateCookie(w http.ResponseWriter, provider, state string, maxAge int) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     common.CookieOIDCState,
+		Value:    state,
+		Path:     "/api/oidc/" + provider + "/callback",
+		MaxAge:   maxAge,
+		HttpOnly: true,
+		Secure:   internal.SessionCookieSecure,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
@@ -0,0 +1,162 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"elotuschallenge/common"
+	"elotuschallenge/internal"
+	"elotuschallenge/middleware"
+	"elotuschallenge/transfer"
+	"elotuschallenge/utils"
+)
+
+// HandleChangePassword changes the password of the authenticated user and signs out all other sessions.
+// It responds with new tokens so the current client stays signed in.
+func HandleChangePassword(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		handleError(w, http.StatusMethodNotAllowed, common.ErrMsgMethodNotAllowed, nil)
+		return
+	}
+
+	principal, ok := middleware.GetPrincipal(r)
+	if !ok {
+		handleError(w, http.StatusUnauthorized, common.ErrMsgUserNotAuthenticated, nil)
+		return
+	}
+
+	// API keys can't change the password of their owner
+	if principal.IsAPIKey() {
+		middleware.ResponseForbidden(w, r, common.ErrSignedInUserRequired)
+		return
+	}
+
+	// Parse request body
+	var req transfer.ChangePasswordRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		handleError(w, http.StatusBadRequest, common.ErrMsgBadRequest, fmt.Errorf("%w: %w", common.ErrInvalidJSON, err))
+		return
+	}
+	if strings.TrimSpace(req.CurrentPassword) == "" {
+		handleError(w, http.StatusBadRequest, common.ErrMsgBadRequest, fmt.Errorf("%w: current_password is required", common.ErrInvalidRequest))
+		return
+	}
+	if err := validatePassword(req.NewPassword); err != nil {
+		handleError(w, http.StatusBadRequest, common.ErrMsgBadRequest, fmt.Errorf("%w: %w", common.ErrInvalidRequest, err))
+		return
+	}
+
+	// Guesses of the current password count like failed logins, a stolen token can't be used to brute force it
+	clientIP := utils.GetClientIP(r)
+	if retryAfter, err := internal.LoginThrottleService.CheckLogin(principal.Username, clientIP); err != nil {
+		if errors.Is(err, common.ErrLoginLocked) {
+			responseLoginLocked(w, retryAfter, err)
+			return
+		}
+		handleError(w, http.StatusInternalServerError, common.ErrMsgInternalServerError, err)
+		return
+	}
+
+	user, err := internal.PasswordService.ChangePassword(principal.ID, req.CurrentPassword, req.NewPassword)
+	if err != nil {
+		if errors.Is(err, common.ErrInvalidCredentials) {
+			lockout, errRecord := internal.LoginThrottleService.RecordFailure(principal.Username, clientIP)
+			if errRecord != nil {
+				handleError(w, http.StatusInternalServerError, common.ErrMsgInternalServerError, errRecord)
+				return
+			}
+			if lockout > 0 {
+				responseLoginLocked(w, lockout, fmt.Errorf("%w: %w", common.ErrLoginLocked, err))
+				return
+			}
+			handleError(w, http.StatusUnauthorized, common.ErrMsgInvalidCredentials, err)
+			return
+		}
+		if errors.Is(err, common.ErrUserNotFound) {
+			handleError(w, http.StatusUnauthorized, common.ErrMsgUserNotAuthenticated, err)
+			return
+		}
+		handleError(w, http.StatusInternalServerError, common.ErrMsgInternalServerError, err)
+		return
+	}
+
+	// Every session was signed out, including the current one, the client continues in a new session.
+	// Browsers get a new session cookie.
+	middleware.AddLogEntries(r, "password_changed", true)
+	completeLogin(w, r, user, principal.AuthMethod == common.AuthMethodCookie)
+}
+
+// HandlePasswordResetRequest sends a password reset token to the user. It always responds
+// the same way so it can't be used to find out which usernames exist.
+func HandlePasswordResetRequest(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		handleError(w, http.StatusMethodNotAllowed, common.ErrMsgMethodNotAllowed, nil)
+		return
+	}
+
+	// Parse request body
+	var req transfer.PasswordResetRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		handleError(w, http.StatusBadRequest, common.ErrMsgBadRequest, fmt.Errorf("%w: %w", common.ErrInvalidJSON, err))
+		return
+	}
+	if strings.TrimSpace(req.Username) == "" {
+		handleError(w, http.StatusBadRequest, common.ErrMsgBadRequest, fmt.Errorf("%w: username is required", common.ErrInvalidRequest))
+		return
+	}
+
+	if err := internal.PasswordService.RequestPasswordReset(req.Username); err != nil {
+		handleError(w, http.StatusInternalServerError, common.ErrMsgInternalServerError, err)
+		return
+	}
+
+	w.Header().Set(common.HeaderContentType, common.HeaderValueContentTypeJSON)
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(transfer.NewSuccessResponse(common.MsgPasswordResetRequested, nil))
+}
+
+// HandlePasswordReset sets a new password with a reset token, all sessions of the user are signed out
+func HandlePasswordReset(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		handleError(w, http.StatusMethodNotAllowed, common.ErrMsgMethodNotAllowed, nil)
+		return
+	}
+
+	// Parse request body
+	var req transfer.ResetPasswordRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		handleError(w, http.StatusBadRequest, common.ErrMsgBadRequest, fmt.Errorf("%w: %w", common.ErrInvalidJSON, err))
+		return
+	}
+	if strings.TrimSpace(req.Token) == "" {
+		handleError(w, http.StatusBadRequest, common.ErrMsgBadRequest, fmt.Errorf("%w: token is required", common.ErrInvalidRequest))
+		return
+	}
+	if err := validatePassword(req.NewPassword); err != nil {
+		handleError(w, http.StatusBadRequest, common.ErrMsgBadRequest, fmt.Errorf("%w: %w", common.ErrInvalidRequest, err))
+		return
+	}
+
+	user, err := internal.PasswordService.ResetPassword(req.Token, req.NewPassword)
+	if err != nil {
+		if errors.Is(err, common.ErrResetTokenInvalid) || errors.Is(err, common.ErrResetTokenExpired) {
+			handleError(w, http.StatusBadRequest, common.ErrMsgInvalidResetToken, err)
+			return
+		}
+		handleError(w, http.StatusInternalServerError, common.ErrMsgInternalServerError, err)
+		return
+	}
+
+	// The owner proved access to the account, clear any login lockout
+	if err := internal.LoginThrottleService.UnlockUser(user.Username); err != nil {
+		handleError(w, http.StatusInternalServerError, common.ErrMsgInternalServerError, err)
+		return
+	}
+
+	w.Header().Set(common.HeaderContentType, common.HeaderValueContentTypeJSON)
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(transfer.NewSuccessResponse(common.MsgPasswordReset, nil))
+}
@@ -0,0 +1,108 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"elotuschallenge/common"
+	"elotuschallenge/internal"
+	"elotuschallenge/middleware"
+	"elotuschallenge/transfer"
+)
+
+// HandleSessions lists (GET) or signs out (DELETE) all active sessions of the authenticated user
+func HandleSessions(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodDelete {
+		handleError(w, http.StatusMethodNotAllowed, common.ErrMsgMethodNotAllowed, nil)
+		return
+	}
+
+	principal, ok := middleware.GetPrincipal(r)
+	if !ok {
+		handleError(w, http.StatusUnauthorized, common.ErrMsgUserNotAuthenticated, nil)
+		return
+	}
+
+	// API keys aren't sessions and can't sign out their owner
+	if principal.IsAPIKey() {
+		middleware.ResponseForbidden(w, r, common.ErrSignedInUserRequired)
+		return
+	}
+
+	if r.Method == http.MethodGet {
+		sessions, err := internal.SessionService.ListSessions(principal.ID)
+		if err != nil {
+			handleError(w, http.StatusInternalServerError, common.ErrMsgInternalServerError, err)
+			return
+		}
+
+		data := transfer.SessionListData{Sessions: make([]transfer.SessionInfo, 0, len(sessions))}
+		for _, session := range sessions {
+			data.Sessions = append(data.Sessions, transfer.NewSessionInfo(session, principal.SessionID))
+		}
+
+		w.Header().Set(common.HeaderContentType, common.HeaderValueContentTypeJSON)
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(transfer.NewSuccessResponse("", data))
+		return
+	}
+
+	if err := internal.SessionService.RevokeUserSessions(principal.ID); err != nil {
+		handleError(w, http.StatusInternalServerError, common.ErrMsgInternalServerError, err)
+		return
+	}
+
+	middleware.AddLogEntries(r, "sessions_revoked", "all")
+	clearRevokedSessionCookies(w, principal)
+
+	w.Header().Set(common.HeaderContentType, common.HeaderValueContentTypeJSON)
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(transfer.NewSuccessResponse(common.MsgSessionsRevoked, nil))
+}
+
+// HandleSession signs out (DELETE) one session of the authenticated user, e.g. on a lost device
+func HandleSession(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		handleError(w, http.StatusMethodNotAllowed, common.ErrMsgMethodNotAllowed, nil)
+		return
+	}
+
+	principal, ok := middleware.GetPrincipal(r)
+	if !ok {
+		handleError(w, http.StatusUnauthorized, common.ErrMsgUserNotAuthenticated, nil)
+		return
+	}
+
+	if principal.IsAPIKey() {
+		middleware.ResponseForbidden(w, r, common.ErrSignedInUserRequired)
+		return
+	}
+
+	// Sessions of other users are reported as not found
+	sessionID := r.PathValue("id")
+	if err := internal.SessionService.RevokeSession(principal.ID, sessionID); err != nil {
+		if errors.Is(err, common.ErrSessionNotFound) {
+			handleError(w, http.StatusNotFound, common.ErrMsgNotFound, err)
+			return
+		}
+		handleError(w, http.StatusInternalServerError, common.ErrMsgInternalServerError, err)
+		return
+	}
+
+	middleware.AddLogEntries(r, "sessions_revoked", sessionID)
+	if principal.SessionID == sessionID {
+		clearRevokedSessionCookies(w, principal)
+	}
+
+	w.Header().Set(common.HeaderContentType, common.HeaderValueContentTypeJSON)
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(transfer.NewSuccessResponse(common.MsgSessionRevoked, nil))
+}
+
+// clearRevokedSessionCookies removes the session cookie of a browser whose own session was signed out
+func clearRevokedSessionCookies(w http.ResponseWriter, principal *middleware.Principal) {
+	if principal.SessionID != "" && principal.AuthMethod == common.AuthMethodCookie {
+		middleware.ClearSessionCookies(w)
+	}
+}
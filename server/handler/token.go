@@ -0,0 +1,255 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"elotuschallenge/common"
+	"elotuschallenge/internal"
+	"elotuschallenge/middleware"
+	"elotuschallenge/models"
+	"elotuschallenge/services"
+	"elotuschallenge/transfer"
+	"elotuschallenge/utils"
+)
+
+// Refresh token handler, exchanges a refresh token for a new access token and a rotated refresh token
+func HandleRefreshToken(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		handleError(w, http.StatusMethodNotAllowed, common.ErrMsgMethodNotAllowed, nil)
+		return
+	}
+
+	// Parse request body
+	var req transfer.RefreshTokenRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		handleError(w, http.StatusBadRequest, common.ErrMsgBadRequest, fmt.Errorf("%w: %w", common.ErrInvalidJSON, err))
+		return
+	}
+	if strings.TrimSpace(req.RefreshToken) == "" {
+		handleError(w, http.StatusBadRequest, common.ErrMsgBadRequest, fmt.Errorf("%w: refresh_token is required", common.ErrInvalidRequest))
+		return
+	}
+
+	// Rotate refresh token, reused or expired tokens are rejected
+	refreshToken, consumed, err := internal.RefreshTokenService.RotateRefreshToken(req.RefreshToken)
+	if err != nil {
+		handleError(w, http.StatusUnauthorized, common.ErrMsgInvalidRefreshToken, err)
+		return
+	}
+
+	user, err := internal.UserService.GetUserByID(consumed.UserID)
+	if err != nil {
+		handleError(w, http.StatusInternalServerError, common.ErrMsgInternalServerError, err)
+		return
+	}
+	if user == nil {
+		handleError(w, http.StatusUnauthorized, common.ErrMsgInvalidRefreshToken, fmt.Errorf("%w: user %d not found", common.ErrRefreshTokenInvalid, consumed.UserID))
+		return
+	}
+	if err := services.CheckAccountStatus(user); err != nil {
+		middleware.ResponseAccountInactive(w, r, err)
+		return
+	}
+
+	// The consumed token's family is the session the client signed in with
+	writeLoginResponse(w, r, user, consumed.FamilyID, refreshToken)
+}
+
+// Token introspection handler (RFC 7662), tells trusted clients whether a token is active and what it carries.
+// Revoked, expired or otherwise rejected tokens are reported as inactive without telling why.
+func HandleTokenIntrospect(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		handleError(w, http.StatusMethodNotAllowed, common.ErrMsgMethodNotAllowed, nil)
+		return
+	}
+
+	// Trusted clients are admins, or API keys of admins granted the introspection scope
+	principal, ok := middleware.GetPrincipal(r)
+	if !ok {
+		handleError(w, http.StatusUnauthorized, common.ErrMsgUserNotAuthenticated, nil)
+		return
+	}
+	if !principal.HasRole(models.RoleAdmin) {
+		middleware.ResponseForbidden(w, r, fmt.Errorf("%w: %s required, got %q", common.ErrInsufficientRole, models.RoleAdmin, principal.Roles))
+		return
+	}
+	if !principal.HasScope(common.ScopeTokensIntrospect) {
+		middleware.ResponseForbidden(w, r, fmt.Errorf("%w: %s", common.ErrInsufficientScope, common.ScopeTokensIntrospect))
+		return
+	}
+
+	// The token is sent form encoded, the token_type_hint parameter is ignored since we can tell tokens apart
+	if err := r.ParseForm(); err != nil {
+		handleError(w, http.StatusBadRequest, common.ErrMsgBadRequest, fmt.Errorf("%w: %w", common.ErrInvalidRequest, err))
+		return
+	}
+	token := strings.TrimSpace(r.PostForm.Get("token"))
+	if token == "" {
+		handleError(w, http.StatusBadRequest, common.ErrMsgBadRequest, fmt.Errorf("%w: token is required", common.ErrInvalidRequest))
+		return
+	}
+
+	response, err := introspectToken(token)
+	middleware.AddLogEntries(r, "token_active", response.Active)
+	if err != nil {
+		middleware.AddLogEntries(r, "inactive_reason", services.TokenErrorReason(err), "inactive_error", err.Error())
+	}
+
+	w.Header().Set(common.HeaderContentType, common.HeaderValueContentTypeJSON)
+	w.Header().Set(common.HeaderCacheControl, "no-store")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(response)
+}
+
+// introspectToken checks a token like AuthUser does, the error tells why an inactive token was rejected
+func introspectToken(token string) (transfer.IntrospectionResponse, error) {
+	if internal.APIKeyService.IsAPIKey(token) {
+		apiKey, user, err := middleware.AuthenticateAPIKey(token)
+		if err != nil {
+			return transfer.IntrospectionResponse{}, err
+		}
+
+		response := transfer.IntrospectionResponse{
+			Active:    true,
+			TokenType: common.AuthMethodAPIKey,
+			Scope:     strings.Join(apiKey.Scopes, " "),
+			Subject:   strconv.Itoa(user.ID),
+			Username:  user.Username,
+			Role:      user.Role,
+			IssuedAt:  apiKey.CreatedAt.Unix(),
+		}
+		if apiKey.ExpiresAt != nil {
+			response.ExpiresAt = apiKey.ExpiresAt.Unix()
+		}
+		return response, nil
+	}
+
+	claims, user, err := middleware.AuthenticateJWT(token)
+	if err != nil {
+		return transfer.IntrospectionResponse{}, err
+	}
+	return transfer.IntrospectionResponse{
+		Active:    true,
+		TokenType: "access_token",
+		Subject:   strconv.Itoa(user.ID),
+		Username:  user.Username,
+		Role:      user.Role,
+		Issuer:    claims.Issuer,
+		Audience:  claims.Audience,
+		ID:        claims.ID,
+		IssuedAt:  claims.IssuedAt,
+		NotBefore: claims.NotBefore,
+		ExpiresAt: claims.ExpiresAt,
+	}, nil
+}
+
+// startSession signs the user in with a new session, browser clients asking for cookies get a session cookie
+// instead of the tokens
+func startSession(w http.ResponseWriter, r *http.Request, user *models.User, useCookies bool) {
+	sessionID, err := internal.SessionService.NewSessionID()
+	if err != nil {
+		handleError(w, http.StatusInternalServerError, common.ErrMsgGenerateTokenFail, err)
+		return
+	}
+	middleware.AddLogEntries(r, "session_id", sessionID)
+	if useCookies {
+		writeSessionLoginResponse(w, r, user, sessionID)
+		return
+	}
+
+	// The session starts a new refresh token family
+	refreshToken, err := internal.RefreshTokenService.IssueRefreshToken(user.ID, sessionID)
+	if err != nil {
+		handleError(w, http.StatusInternalServerError, common.ErrMsgGenerateTokenFail, err)
+		return
+	}
+
+	writeLoginResponse(w, r, user, sessionID, refreshToken)
+}
+
+// writeLoginResponse generates an access token in the session and responds with it and the refresh token
+func writeLoginResponse(w http.ResponseWriter, r *http.Request, user *models.User, sessionID, refreshToken string) {
+	token, err := issueAccessToken(r, user, sessionID, internal.RefreshTokenExpirationSeconds)
+	if err != nil {
+		handleError(w, http.StatusInternalServerError, common.ErrMsgGenerateTokenFail, err)
+		return
+	}
+
+	writeLoginData(w, transfer.LoginResponse{
+		Token:        token,
+		RefreshToken: refreshToken,
+		User:         loginUserInfo(user),
+	})
+}
+
+// writeSessionLoginResponse generates an access token in the session and sets it as a session cookie,
+// the token is kept out of the body so scripts can't read it, only the CSRF token is returned
+func writeSessionLoginResponse(w http.ResponseWriter, r *http.Request, user *models.User, sessionID string) {
+	token, err := issueAccessToken(r, user, sessionID, internal.SessionExpirationSeconds)
+	if err != nil {
+		handleError(w, http.StatusInternalServerError, common.ErrMsgGenerateTokenFail, err)
+		return
+	}
+
+	csrfToken := middleware.SetSessionCookies(w, token)
+	writeLoginData(w, transfer.LoginResponse{
+		CSRFToken: csrfToken,
+		User:      loginUserInfo(user),
+	})
+}
+
+// issueAccessToken generates a JWT carrying the user's role, token version and session, and records it as the
+// latest token of the session, which lasts sessionSeconds from now
+func issueAccessToken(r *http.Request, user *models.User, sessionID string, sessionSeconds int64) (string, error) {
+	tokenID, err := utils.GenerateSecureToken(16)
+	if err != nil {
+		return "", err
+	}
+
+	token, err := internal.TokenManager.IssueToken(services.Claims{
+		UserID:       user.ID,
+		Username:     user.Username,
+		Role:         user.Role,
+		TokenVersion: user.TokenVersion,
+		SessionID:    sessionID,
+		ID:           tokenID,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	err = internal.SessionService.RecordToken(&models.Session{
+		ID:        sessionID,
+		UserID:    user.ID,
+		TokenID:   tokenID,
+		UserAgent: r.Header.Get(common.HeaderUserAgent),
+		IPAddress: utils.GetClientIP(r),
+		ExpiresAt: time.Now().Add(time.Duration(sessionSeconds) * time.Second),
+	})
+	if err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+func loginUserInfo(user *models.User) transfer.UserInfo {
+	return transfer.UserInfo{
+		ID:       user.ID,
+		Username: user.Username,
+		Role:     user.Role,
+	}
+}
+
+func writeLoginData(w http.ResponseWriter, auth transfer.LoginResponse) {
+	// Respond with success
+	w.Header().Set(common.HeaderContentType, common.HeaderValueContentTypeJSON)
+	w.WriteHeader(http.StatusOK)
+
+	response := transfer.NewSuccessResponse("", transfer.LoginData{Auth: auth})
+	json.NewEncoder(w).Encode(response)
+}
@@ -2,43 +2,22 @@ package handler
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
-	"strings"
 
 	"elotuschallenge/common"
 	"elotuschallenge/internal"
 	"elotuschallenge/middleware"
 	"elotuschallenge/transfer"
 	"elotuschallenge/utils"
+	"elotuschallenge/validation"
 )
 
 const (
 	MaxFileSize = 8 << 20 // 8 MB in bytes
 )
 
-// IsImageContentType checks if the content type is a valid image type
-func IsImageContentType(contentType string) bool {
-	validImageTypes := []string{
-		"image/jpeg",
-		"image/jpg",
-		"image/png",
-		"image/gif",
-		"image/webp",
-		"image/bmp",
-		"image/tiff",
-		"image/svg+xml",
-	}
-
-	contentType = strings.ToLower(contentType)
-	for _, validType := range validImageTypes {
-		if contentType == validType {
-			return true
-		}
-	}
-	return false
-}
-
 func HandleUpload(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		handleError(w, http.StatusMethodNotAllowed, common.ErrMsgMethodNotAllowed, nil)
@@ -46,12 +25,18 @@ func HandleUpload(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Get authenticated user from context
-	userID, ok := r.Context().Value("user_id").(int)
+	principal, ok := middleware.GetPrincipal(r)
 	if !ok {
 		handleError(w, http.StatusUnauthorized, common.ErrMsgUserNotAuthenticated, nil)
 		return
 	}
 
+	// API keys need the files:write scope
+	if !principal.HasScope(common.ScopeFilesWrite) {
+		middleware.ResponseForbidden(w, r, fmt.Errorf("%w: %s", common.ErrInsufficientScope, common.ScopeFilesWrite))
+		return
+	}
+
 	// Parse multipart form with size limit
 	err := r.ParseMultipartForm(MaxFileSize)
 	if err != nil {
@@ -75,26 +60,22 @@ func HandleUpload(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Detect content type
-	contentType := fileHeader.Header.Get(common.HeaderContentType)
-	if contentType == "" {
-		// If content type is not provided, try to detect it from the file content
-		buffer := make([]byte, 512)
-		_, err := file.Read(buffer)
-		if err != nil {
-			handleError(w, http.StatusInternalServerError, common.ErrMsgReadFileFail, err)
+	// The type is sniffed from the content, which must match the declared type and decode as an image
+	upload := &validation.Upload{
+		Filename:     fileHeader.Filename,
+		DeclaredType: fileHeader.Header.Get(common.HeaderContentType),
+		Size:         fileHeader.Size,
+		Content:      file,
+	}
+	if err := internal.UploadValidator.Validate(upload); err != nil {
+		if errors.Is(err, common.ErrFileContentType) || errors.Is(err, common.ErrContentTypeMismatch) || errors.Is(err, common.ErrInvalidImage) {
+			handleError(w, http.StatusBadRequest, common.ErrMsgBadRequest, err)
 			return
 		}
-		contentType = http.DetectContentType(buffer)
-
-	}
-
-	// Validate content type is an image
-	if !IsImageContentType(contentType) {
-		err := fmt.Errorf("%w: %s", common.ErrFileContentType, contentType)
-		handleError(w, http.StatusBadRequest, common.ErrMsgBadRequest, err)
+		handleError(w, http.StatusInternalServerError, common.ErrMsgReadFileFail, err)
 		return
 	}
+	contentType := upload.DetectedType
 
 	// Get client information
 	clientIP := utils.GetClientIP(r)
@@ -106,7 +87,7 @@ func HandleUpload(w http.ResponseWriter, r *http.Request) {
 		fileHeader.Filename,
 		contentType,
 		fileHeader.Size,
-		userID,
+		principal.ID,
 		userAgent,
 		clientIP,
 	)
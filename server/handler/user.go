@@ -2,12 +2,20 @@ package handler
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"math"
 	"net/http"
+	"strconv"
 	"strings"
+	"time"
 
 	"elotuschallenge/common"
 	"elotuschallenge/internal"
+	"elotuschallenge/middleware"
+	"elotuschallenge/models"
+	"elotuschallenge/services"
 	"elotuschallenge/transfer"
 	"elotuschallenge/utils"
 
@@ -78,6 +86,15 @@ func HandleRegister(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Pending accounts get a verification token, it can be sent again from /api/verify/resend
+	message := "User registered successfully"
+	if createdUser.Status == models.StatusPending {
+		message = common.MsgRegisteredPendingVerification
+		if err := internal.VerificationService.SendVerification(createdUser); err != nil {
+			log.Error().Err(err).Int("user_id", createdUser.ID).Msg("Failed to send verification token")
+		}
+	}
+
 	// Respond with success
 	w.Header().Set(common.HeaderContentType, common.HeaderValueContentTypeJSON)
 	w.WriteHeader(http.StatusCreated)
@@ -86,10 +103,12 @@ func HandleRegister(w http.ResponseWriter, r *http.Request) {
 		User: transfer.UserInfo{
 			ID:       createdUser.ID,
 			Username: createdUser.Username,
+			Role:     createdUser.Role,
+			Status:   createdUser.Status,
 		},
 	}
 
-	response := transfer.NewSuccessResponse("User registered successfully", data)
+	response := transfer.NewSuccessResponse(message, data)
 	json.NewEncoder(w).Encode(response)
 }
 
@@ -113,35 +132,116 @@ func HandleLogin(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Reject guesses while the username or the client IP is locked out
+	clientIP := utils.GetClientIP(r)
+	if retryAfter, err := internal.LoginThrottleService.CheckLogin(req.Username, clientIP); err != nil {
+		if errors.Is(err, common.ErrLoginLocked) {
+			responseLoginLocked(w, retryAfter, err)
+			return
+		}
+		handleError(w, http.StatusInternalServerError, common.ErrMsgInternalServerError, err)
+		return
+	}
+
 	// Authenticate user
 	user, err := internal.UserService.LoginUser(req.Username, req.Password)
 	if err != nil {
-		handleError(w, http.StatusUnauthorized, common.ErrMsgInvalidCredentials, fmt.Errorf("%w: %v", common.ErrInvalidCredentials, err))
+		if services.AccountStatusErrorCode(err) != "" {
+			middleware.ResponseAccountInactive(w, r, err)
+			return
+		}
+		if !errors.Is(err, common.ErrInvalidCredentials) {
+			handleError(w, http.StatusInternalServerError, common.ErrMsgInternalServerError, err)
+			return
+		}
+
+		lockout, errRecord := internal.LoginThrottleService.RecordFailure(req.Username, clientIP)
+		if errRecord != nil {
+			handleError(w, http.StatusInternalServerError, common.ErrMsgInternalServerError, errRecord)
+			return
+		}
+		if lockout > 0 {
+			responseLoginLocked(w, lockout, fmt.Errorf("%w: %w", common.ErrLoginLocked, err))
+			return
+		}
+		handleError(w, http.StatusUnauthorized, common.ErrMsgInvalidCredentials, fmt.Errorf("%w: username %q from %s", err, req.Username, clientIP))
 		return
 	}
 
-	// Generate JWT token using standalone JWT service
-	token, err := internal.TokenManager.GenerateToken(user.ID, user.Username)
+	// Users with two-factor authentication get a short-lived token to exchange at /api/login/mfa,
+	// their failure counter is cleared only once the second factor is verified
+	mfaEnabled, err := internal.MFAService.IsMFAEnabled(user.ID)
 	if err != nil {
-		handleError(w, http.StatusInternalServerError, "Failed to generate token", err)
+		handleError(w, http.StatusInternalServerError, common.ErrMsgInternalServerError, err)
+		return
+	}
+	if mfaEnabled {
+		writeMFARequiredResponse(w, user)
 		return
 	}
 
+	completeLogin(w, r, user, req.UseCookies)
+}
+
+// completeLogin clears the failed login counter and starts a new session for the user
+func completeLogin(w http.ResponseWriter, r *http.Request, user *models.User, useCookies bool) {
+	if err := internal.LoginThrottleService.RecordSuccess(user.Username); err != nil {
+		handleError(w, http.StatusInternalServerError, common.ErrMsgInternalServerError, err)
+		return
+	}
+	startSession(w, r, user, useCookies)
+}
+
+// Logout handler, revokes the token used to authenticate the request
+func HandleLogout(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		handleError(w, http.StatusMethodNotAllowed, common.ErrMsgMethodNotAllowed, nil)
+		return
+	}
+
+	principal, ok := middleware.GetPrincipal(r)
+	if !ok {
+		handleError(w, http.StatusUnauthorized, common.ErrMsgUserNotAuthenticated, nil)
+		return
+	}
+
+	// Request body is optional, it may carry the refresh token to revoke as well
+	var req transfer.LogoutRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+		handleError(w, http.StatusBadRequest, common.ErrMsgBadRequest, fmt.Errorf("%w: %w", common.ErrInvalidJSON, err))
+		return
+	}
+
+	if req.RefreshToken != "" {
+		if err := internal.RefreshTokenService.RevokeRefreshToken(req.RefreshToken, principal.ID); err != nil {
+			handleError(w, http.StatusBadRequest, common.ErrMsgBadRequest, fmt.Errorf("%w: %w", common.ErrRevokeTokenFailed, err))
+			return
+		}
+	}
+
+	token := internal.TokenManager.ExtractTokenFromHeader(r.Header.Get(common.HeaderAuthorization))
+	if principal.AuthMethod == common.AuthMethodCookie {
+		token = middleware.SessionToken(r)
+		middleware.ClearSessionCookies(w)
+	}
+	if err := internal.TokenManager.RevokeToken(token); err != nil {
+		handleError(w, http.StatusInternalServerError, common.ErrMsgInternalServerError, fmt.Errorf("%w: %w", common.ErrRevokeTokenFailed, err))
+		return
+	}
+
+	// Signing out ends the session too, so it leaves the session list along with its refresh tokens
+	if principal.SessionID != "" {
+		if err := internal.SessionService.RevokeSession(principal.ID, principal.SessionID); err != nil && !errors.Is(err, common.ErrSessionNotFound) {
+			handleError(w, http.StatusInternalServerError, common.ErrMsgInternalServerError, fmt.Errorf("%w: %w", common.ErrRevokeTokenFailed, err))
+			return
+		}
+	}
+
 	// Respond with success
 	w.Header().Set(common.HeaderContentType, common.HeaderValueContentTypeJSON)
 	w.WriteHeader(http.StatusOK)
 
-	data := transfer.LoginData{
-		Auth: transfer.LoginResponse{
-			Token: token,
-			User: transfer.UserInfo{
-				ID:       user.ID,
-				Username: user.Username,
-			},
-		},
-	}
-
-	response := transfer.NewSuccessResponse("", data)
+	response := transfer.NewSuccessResponse(common.MsgLogoutSuccess, nil)
 	json.NewEncoder(w).Encode(response)
 }
 
@@ -167,11 +267,23 @@ func validateRegisterRequest(req *transfer.RegisterRequest) error {
 	if len(req.Username) > 50 {
 		return fmt.Errorf("username must be less than 50 characters")
 	}
-	if strings.TrimSpace(req.Password) == "" {
+	return validatePassword(req.Password)
+}
+
+// validatePassword checks the strength of a new password
+func validatePassword(password string) error {
+	if strings.TrimSpace(password) == "" {
 		return fmt.Errorf("password is required")
 	}
-	if len(req.Password) < 6 {
+	if len(password) < 6 {
 		return fmt.Errorf("password must be at least 6 characters long")
 	}
 	return nil
 }
+
+// responseLoginLocked tells the client how many seconds to wait before trying to login again
+func responseLoginLocked(w http.ResponseWriter, retryAfter time.Duration, err error) {
+	seconds := int64(math.Ceil(retryAfter.Seconds()))
+	w.Header().Set(common.HeaderRetryAfter, strconv.FormatInt(seconds, 10))
+	handleError(w, http.StatusTooManyRequests, common.ErrMsgTooManyLoginAttempts, err)
+}
@@ -0,0 +1,90 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"elotuschallenge/common"
+	"elotuschallenge/internal"
+	"elotuschallenge/middleware"
+	"elotuschallenge/services"
+	"elotuschallenge/transfer"
+)
+
+// HandleVerifyAccount activates (POST) a pending account with its verification token
+func HandleVerifyAccount(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		handleError(w, http.StatusMethodNotAllowed, common.ErrMsgMethodNotAllowed, nil)
+		return
+	}
+
+	// Parse request body
+	var req transfer.VerifyAccountRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		handleError(w, http.StatusBadRequest, common.ErrMsgBadRequest, fmt.Errorf("%w: %w", common.ErrInvalidJSON, err))
+		return
+	}
+	if strings.TrimSpace(req.Token) == "" {
+		handleError(w, http.StatusBadRequest, common.ErrMsgBadRequest, fmt.Errorf("%w: token is required", common.ErrInvalidRequest))
+		return
+	}
+
+	user, err := internal.VerificationService.VerifyAccount(req.Token)
+	if err != nil {
+		if errors.Is(err, common.ErrVerificationTokenInvalid) || errors.Is(err, common.ErrVerificationTokenExpired) {
+			handleError(w, http.StatusBadRequest, common.ErrMsgInvalidVerificationToken, err)
+			return
+		}
+		if services.AccountStatusErrorCode(err) != "" {
+			middleware.ResponseAccountInactive(w, r, err)
+			return
+		}
+		handleError(w, http.StatusInternalServerError, common.ErrMsgInternalServerError, err)
+		return
+	}
+
+	w.Header().Set(common.HeaderContentType, common.HeaderValueContentTypeJSON)
+	w.WriteHeader(http.StatusOK)
+
+	data := transfer.RegisterData{
+		User: transfer.UserInfo{
+			ID:       user.ID,
+			Username: user.Username,
+			Role:     user.Role,
+			Status:   user.Status,
+		},
+	}
+	json.NewEncoder(w).Encode(transfer.NewSuccessResponse(common.MsgAccountVerified, data))
+}
+
+// HandleResendVerification sends (POST) a new verification token to a pending account. It always
+// responds the same way so it can't be used to find out which usernames exist.
+func HandleResendVerification(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		handleError(w, http.StatusMethodNotAllowed, common.ErrMsgMethodNotAllowed, nil)
+		return
+	}
+
+	// Parse request body
+	var req transfer.ResendVerificationRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		handleError(w, http.StatusBadRequest, common.ErrMsgBadRequest, fmt.Errorf("%w: %w", common.ErrInvalidJSON, err))
+		return
+	}
+	if strings.TrimSpace(req.Username) == "" {
+		handleError(w, http.StatusBadRequest, common.ErrMsgBadRequest, fmt.Errorf("%w: username is required", common.ErrInvalidRequest))
+		return
+	}
+
+	if err := internal.VerificationService.ResendVerification(req.Username); err != nil {
+		handleError(w, http.StatusInternalServerError, common.ErrMsgInternalServerError, err)
+		return
+	}
+
+	w.Header().Set(common.HeaderContentType, common.HeaderValueContentTypeJSON)
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(transfer.NewSuccessResponse(common.MsgVerificationSent, nil))
+}
@@ -1,24 +1,73 @@
 package internal
 
 import (
+	"fmt"
+	"net/http"
 	"os"
 	"strconv"
+	"strings"
+	"time"
 
+	"elotuschallenge/database"
 	"elotuschallenge/repository"
 	"elotuschallenge/services"
+	"elotuschallenge/storage"
+	"elotuschallenge/validation"
+
+	"github.com/rs/zerolog/log"
+	"golang.org/x/crypto/bcrypt"
 )
 
 var (
-	UserService  services.IUserService
-	TokenManager services.ITokenManager
-	FileService  services.IFileService
+	UserService          services.IUserService
+	TokenManager         services.ITokenManager
+	RefreshTokenService  services.IRefreshTokenService
+	FileService          services.IFileService
+	APIKeyService        services.IAPIKeyService
+	LoginThrottleService services.ILoginThrottleService
+	PasswordService      services.IPasswordService
+	Notifier             services.INotifier
+	MFAService           services.IMFAService
+	VerificationService  services.IVerificationService
+	OIDCService          services.IOIDCService
+	SessionService       services.ISessionService
+	AccountService       services.IAccountService
+	BlobService          services.IBlobService
+	FileStorage          *storage.Backends
+	UploadValidator      *validation.Pipeline
 )
 
+// MFATokenExpirationSeconds is how long the token returned by login stays valid for entering the second factor
+var MFATokenExpirationSeconds = int64(300)
+
+// SessionCookieSecure marks session cookies Secure so browsers only send them over HTTPS
+var SessionCookieSecure = true
+
+// SessionExpirationSeconds is the lifetime of session cookies, it matches the access token expiration
+var SessionExpirationSeconds = int64(86400)
+
+// RefreshTokenExpirationSeconds is the lifetime of refresh tokens, sessions signed in with them last as long
+var RefreshTokenExpirationSeconds = int64(2592000)
+
+// sweepIntervalSeconds is how often expired rows are removed by background sweepers
+var sweepIntervalSeconds = int64(600)
+
 // InitServices initializes all services with their dependencies
 func InitServices() {
 	// Initialize repositories
 	userRepo := repository.NewSQLiteUserRepository()
 	fileRepo := repository.NewSQLiteFileRepository()
+	blobRepo := repository.NewSQLiteBlobRepository()
+	revokedTokenRepo := repository.NewSQLiteRevokedTokenRepository()
+	refreshTokenRepo := repository.NewSQLiteRefreshTokenRepository()
+	apiKeyRepo := repository.NewSQLiteAPIKeyRepository()
+	loginAttemptRepo := repository.NewSQLiteLoginAttemptRepository()
+	passwordResetRepo := repository.NewSQLitePasswordResetRepository()
+	outboxRepo := repository.NewSQLiteOutboxRepository()
+	mfaRepo := repository.NewSQLiteMFARepository()
+	verificationRepo := repository.NewSQLiteVerificationRepository()
+	oidcRepo := repository.NewSQLiteOIDCRepository()
+	sessionRepo := repository.NewSQLiteSessionRepository()
 
 	// Get JWT secret from environment or use default for development
 	jwtSecret := os.Getenv("JWT_SECRET")
@@ -26,11 +75,22 @@ func InitServices() {
 		jwtSecret = "elotus-challenge-default"
 	}
 
-	// Get temp directory from environment or use default
+	// Load signing keys from JWT_KEYS_PATH when set, otherwise use JWT_ALGORITHM with
+	// JWT_SECRET for HS256 or the key in JWT_PRIVATE_KEY_FILE for asymmetric algorithms
+	keyring, err := loadKeyring(jwtSecret)
+	if err != nil {
+		log.Panic().Err(err).Msg("Failed to load signing keys")
+	}
+
+	// Get temp directory from environment or use default, files of the local storage backend are stored there
 	tempDir := os.Getenv("TEMP_DIR")
 	if tempDir == "" {
 		tempDir = "./tmp"
 	}
+	FileStorage, err = loadStorage(tempDir)
+	if err != nil {
+		log.Panic().Err(err).Msg("Failed to initialize file storage")
+	}
 
 	// Get token expiration from environment or use default (24 hours)
 	tokenExpirationSeconds := int64(86400) // Default: 24 hours
@@ -40,8 +100,302 @@ func InitServices() {
 		}
 	}
 
+	// Get refresh token expiration from environment or use default (30 days)
+	RefreshTokenExpirationSeconds = int64(2592000) // Default: 30 days
+	if refreshExpEnv := os.Getenv("REFRESH_TOKEN_EXPIRATION_SECONDS"); refreshExpEnv != "" {
+		if expSeconds, err := strconv.ParseInt(refreshExpEnv, 10, 64); err == nil && expSeconds > 0 {
+			RefreshTokenExpirationSeconds = expSeconds
+		}
+	}
+
+	// Get sweep interval from environment or use default (10 minutes)
+	if sweepEnv := os.Getenv("TOKEN_SWEEP_INTERVAL_SECONDS"); sweepEnv != "" {
+		if seconds, err := strconv.ParseInt(sweepEnv, 10, 64); err == nil && seconds > 0 {
+			sweepIntervalSeconds = seconds
+		}
+	}
+
+	// Get expected issuer, audience and clock skew leeway of tokens
+	issuer := os.Getenv("JWT_ISSUER")
+	if issuer == "" {
+		issuer = "elotus-challenge"
+	}
+
+	var audience []string
+	for _, value := range strings.Split(os.Getenv("JWT_AUDIENCE"), ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			audience = append(audience, value)
+		}
+	}
+
+	leewaySeconds := int64(30) // Default: 30 seconds
+	if leewayEnv := os.Getenv("JWT_LEEWAY_SECONDS"); leewayEnv != "" {
+		if seconds, err := strconv.ParseInt(leewayEnv, 10, 64); err == nil && seconds >= 0 {
+			leewaySeconds = seconds
+		}
+	}
+
+	// Session cookies live as long as the access token they carry, COOKIE_SECURE=false allows plain HTTP in development
+	SessionExpirationSeconds = tokenExpirationSeconds
+	SessionCookieSecure = true
+	if secure, err := strconv.ParseBool(os.Getenv("COOKIE_SECURE")); err == nil {
+		SessionCookieSecure = secure
+	}
+
+	tokenConfig := services.TokenManagerConfig{
+		ExpirationSeconds: tokenExpirationSeconds,
+		Issuer:            issuer,
+		Audience:          audience,
+		LeewaySeconds:     leewaySeconds,
+	}
+
+	// Get password reset token expiration from environment or use default (1 hour)
+	passwordResetExpirationSeconds := int64(envInt("PASSWORD_RESET_EXPIRATION_SECONDS", 3600))
+
+	// New accounts must be verified before signing in when REQUIRE_ACCOUNT_VERIFICATION is true
+	requireVerification, _ := strconv.ParseBool(os.Getenv("REQUIRE_ACCOUNT_VERIFICATION"))
+	verificationExpirationSeconds := int64(envInt("VERIFICATION_EXPIRATION_SECONDS", 86400))
+
+	// Get how long deleted files stay in the trash before they are purged or use default (30 days)
+	fileTrashRetentionSeconds := int64(envInt("FILE_TRASH_RETENTION_SECONDS", 2592000))
+
+	// Uploads are sniffed, matched against their declared type and decoded up to UPLOAD_MAX_IMAGE_PIXELS,
+	// UPLOAD_MAX_CONCURRENT_DECODES bounds the memory taken by decoding
+	UploadValidator = validation.NewPipeline(
+		validation.SniffContentType(validation.ImageContentTypes),
+		validation.MatchDeclaredType,
+		validation.DecodeImage(envInt("UPLOAD_MAX_IMAGE_PIXELS", 16000000), envInt("UPLOAD_MAX_CONCURRENT_DECODES", 4)),
+	)
+
+	// Get MFA token expiration and the issuer shown in authenticator apps
+	MFATokenExpirationSeconds = int64(envInt("MFA_TOKEN_EXPIRATION_SECONDS", 300))
+	totpIssuer := os.Getenv("TOTP_ISSUER")
+	if totpIssuer == "" {
+		totpIssuer = "elotus-challenge"
+	}
+
+	// TOTP secrets are encrypted with MFA_ENCRYPTION_KEY, derived from JWT_SECRET when unset
+	mfaEncryptionKey := os.Getenv("MFA_ENCRYPTION_KEY")
+	if mfaEncryptionKey == "" {
+		log.Warn().Msg("MFA_ENCRYPTION_KEY is not set, TOTP secrets are encrypted with a key derived from JWT_SECRET")
+		mfaEncryptionKey = "totp-secret-encryption:" + jwtSecret
+	}
+	mfaSecretBox, err := services.NewSecretBox(mfaEncryptionKey)
+	if err != nil {
+		log.Panic().Err(err).Msg("Invalid MFA_ENCRYPTION_KEY")
+	}
+
+	// Get login lockout thresholds from environment or use defaults
+	loginThrottleConfig := services.LoginThrottleConfig{
+		MaxUserFailures:      envInt("LOGIN_MAX_FAILURES", 5),
+		MaxIPFailures:        envInt("LOGIN_MAX_IP_FAILURES", 20),
+		LockoutSeconds:       int64(envInt("LOGIN_LOCKOUT_SECONDS", 30)),
+		MaxLockoutSeconds:    int64(envInt("LOGIN_MAX_LOCKOUT_SECONDS", 900)),
+		FailureWindowSeconds: int64(envInt("LOGIN_FAILURE_WINDOW_SECONDS", 900)),
+	}
+
+	// Get password hashing algorithm and cost parameters, existing hashes are upgraded on login
+	hasherConfig := services.PasswordHasherConfig{
+		Algorithm: os.Getenv("PASSWORD_HASH_ALGORITHM"),
+		Argon2id: services.Argon2idParams{
+			Memory:      uint32(envInt("ARGON2_MEMORY_KIB", int(services.DefaultArgon2idParams.Memory))),
+			Iterations:  uint32(envInt("ARGON2_ITERATIONS", int(services.DefaultArgon2idParams.Iterations))),
+			Parallelism: uint8(envInt("ARGON2_PARALLELISM", int(services.DefaultArgon2idParams.Parallelism))),
+			SaltLength:  services.DefaultArgon2idParams.SaltLength,
+			KeyLength:   services.DefaultArgon2idParams.KeyLength,
+		},
+		BcryptCost: envInt("BCRYPT_COST", bcrypt.DefaultCost),
+	}
+	if hasherConfig.Algorithm == "" {
+		hasherConfig.Algorithm = services.HashAlgorithmArgon2id
+	}
+	passwordHasher, err := services.NewPasswordHasher(hasherConfig)
+	if err != nil {
+		log.Panic().Err(err).Msg("Invalid password hashing configuration")
+	}
+
 	// Initialize services with repositories
-	UserService = services.NewUserService(userRepo)
-	TokenManager = services.NewTokenManager(jwtSecret, tokenExpirationSeconds)
-	FileService = services.NewFileService(fileRepo, tempDir)
+	UserService = services.NewUserService(userRepo, passwordHasher, requireVerification)
+	TokenManager = services.NewTokenManager(keyring, tokenConfig, revokedTokenRepo)
+	RefreshTokenService = services.NewRefreshTokenService(refreshTokenRepo, RefreshTokenExpirationSeconds)
+	SessionService = services.NewSessionService(sessionRepo, refreshTokenRepo)
+	BlobService = services.NewBlobService(blobRepo, FileStorage, tempDir)
+	AccountService = services.NewAccountService(userRepo, fileRepo, apiKeyRepo, sessionRepo, oidcRepo, FileStorage, BlobService)
+	FileService = services.NewFileService(fileRepo, BlobService, FileStorage, fileTrashRetentionSeconds)
+	APIKeyService = services.NewAPIKeyService(apiKeyRepo)
+	LoginThrottleService = services.NewLoginThrottleService(loginAttemptRepo, loginThrottleConfig)
+	Notifier = services.NewOutboxNotifier(outboxRepo)
+	PasswordService = services.NewPasswordService(userRepo, passwordResetRepo, apiKeyRepo, passwordHasher, Notifier,
+		SessionService, passwordResetExpirationSeconds)
+	MFAService = services.NewMFAService(mfaRepo, mfaSecretBox, totpIssuer)
+	VerificationService = services.NewVerificationService(userRepo, verificationRepo, Notifier, verificationExpirationSeconds)
+	OIDCService = services.NewOIDCService(loadOIDCProviders(), oidcRepo, userRepo, &http.Client{Timeout: 10 * time.Second})
+}
+
+// StartBackgroundJobs starts the periodic cleanup jobs and returns a function stopping them
+func StartBackgroundJobs() (stop func()) {
+	interval := time.Duration(sweepIntervalSeconds) * time.Second
+	stopRevokedTokens := services.StartSweeper("revoked_tokens", interval, TokenManager.PurgeExpiredRevocations)
+	stopRefreshTokens := services.StartSweeper("refresh_tokens", interval, RefreshTokenService.PurgeExpiredRefreshTokens)
+	stopLoginAttempts := services.StartSweeper("login_attempts", interval, LoginThrottleService.PurgeStaleAttempts)
+	stopResetTokens := services.StartSweeper("password_reset_tokens", interval, PasswordService.PurgeExpiredResetTokens)
+	stopVerificationTokens := services.StartSweeper("verification_tokens", interval, VerificationService.PurgeExpiredVerificationTokens)
+	stopOIDCStates := services.StartSweeper("oidc_states", interval, OIDCService.PurgeExpiredStates)
+	stopSessions := services.StartSweeper("sessions", interval, SessionService.PurgeExpiredSessions)
+	stopTrash := services.StartSweeper("trashed_files", interval, FileService.PurgeTrash)
+
+	return func() {
+		stopRevokedTokens()
+		stopRefreshTokens()
+		stopLoginAttempts()
+		stopResetTokens()
+		stopVerificationTokens()
+		stopOIDCStates()
+		stopSessions()
+		stopTrash()
+	}
+}
+
+// MigrateFileStorage moves files of databases created by older versions, which stored the path of each file,
+// to keys of the local storage
+func MigrateFileStorage() error {
+	backend, err := FileStorage.Backend(storage.LocalBackendID)
+	if err != nil {
+		return err
+	}
+	local, ok := backend.(*storage.LocalStorage)
+	if !ok {
+		return fmt.Errorf("unexpected local storage %T", backend)
+	}
+	return database.MigrateFileStorage(local)
+}
+
+// EncryptTOTPSecrets encrypts TOTP secrets which databases of older versions stored in plaintext
+func EncryptTOTPSecrets() error {
+	return MFAService.EncryptStoredSecrets()
+}
+
+// BootstrapAdmin makes sure the account in ADMIN_USERNAME exists and has the admin role
+func BootstrapAdmin() error {
+	username := os.Getenv("ADMIN_USERNAME")
+	if username == "" {
+		return nil
+	}
+
+	password := os.Getenv("ADMIN_PASSWORD")
+	if password == "" {
+		return fmt.Errorf("ADMIN_PASSWORD is required with ADMIN_USERNAME")
+	}
+
+	_, err := UserService.EnsureAdmin(username, password)
+	return err
+}
+
+// ReloadSigningKeys reloads the keyring from JWT_KEYS_PATH so keys can be rotated without downtime
+func ReloadSigningKeys() error {
+	keysPath := os.Getenv("JWT_KEYS_PATH")
+	if keysPath == "" {
+		return nil
+	}
+
+	keyring, err := services.LoadKeyring(keysPath)
+	if err != nil {
+		return err
+	}
+	TokenManager.SetKeyring(keyring)
+
+	log.Info().Str("path", keysPath).Str("active_kid", keyring.ActiveKey().ID).Msg("Signing keys reloaded")
+	return nil
+}
+
+// loadKeyring builds the signing keyring from the environment
+func loadKeyring(jwtSecret string) (*services.Keyring, error) {
+	if keysPath := os.Getenv("JWT_KEYS_PATH"); keysPath != "" {
+		return services.LoadKeyring(keysPath)
+	}
+
+	algorithm := os.Getenv("JWT_ALGORITHM")
+	if algorithm == "" || algorithm == services.AlgorithmHS256 {
+		return services.NewStaticKeyring(jwtSecret), nil
+	}
+
+	privateKeyFile := os.Getenv("JWT_PRIVATE_KEY_FILE")
+	if privateKeyFile == "" {
+		return nil, fmt.Errorf("JWT_PRIVATE_KEY_FILE is required for %s", algorithm)
+	}
+	return services.NewPrivateKeyKeyring(algorithm, privateKeyFile)
+}
+
+// loadOIDCProviders reads the providers listed in OIDC_PROVIDERS, each configured with
+// OIDC_<NAME>_ISSUER, OIDC_<NAME>_CLIENT_ID, OIDC_<NAME>_CLIENT_SECRET, OIDC_<NAME>_REDIRECT_URL and OIDC_<NAME>_SCOPES
+func loadOIDCProviders() []services.OIDCProviderConfig {
+	var providers []services.OIDCProviderConfig
+	for _, name := range strings.Split(os.Getenv("OIDC_PROVIDERS"), ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+
+		prefix := "OIDC_" + strings.ToUpper(strings.ReplaceAll(name, "-", "_")) + "_"
+		provider := services.OIDCProviderConfig{
+			Name:         name,
+			Issuer:       os.Getenv(prefix + "ISSUER"),
+			ClientID:     os.Getenv(prefix + "CLIENT_ID"),
+			ClientSecret: os.Getenv(prefix + "CLIENT_SECRET"),
+			RedirectURL:  os.Getenv(prefix + "REDIRECT_URL"),
+			Scopes:       strings.Fields(os.Getenv(prefix + "SCOPES")),
+		}
+		if provider.Issuer == "" || provider.ClientID == "" || provider.RedirectURL == "" {
+			log.Panic().Str("provider", name).Msgf("%sISSUER, %sCLIENT_ID and %sREDIRECT_URL are required", prefix, prefix, prefix)
+		}
+		if len(provider.Scopes) == 0 {
+			provider.Scopes = []string{"openid", "profile", "email"}
+		}
+		providers = append(providers, provider)
+	}
+	return providers
+}
+
+// loadStorage creates the storage backends, new files are stored in the backend named by STORAGE_BACKEND
+// (local or s3, default local). The S3 bucket is configured with S3_ENDPOINT, S3_REGION, S3_BUCKET,
+// S3_ACCESS_KEY_ID and S3_SECRET_ACCESS_KEY; files stored in the other backend stay readable while it is configured.
+func loadStorage(tempDir string) (*storage.Backends, error) {
+	local, err := storage.NewLocalStorage(tempDir)
+	if err != nil {
+		return nil, err
+	}
+
+	backend := os.Getenv("STORAGE_BACKEND")
+	if backend == "" {
+		backend = storage.LocalBackendID
+	}
+	if backend != storage.LocalBackendID && backend != storage.S3BackendID {
+		return nil, fmt.Errorf("STORAGE_BACKEND must be %s or %s, got %q", storage.LocalBackendID, storage.S3BackendID, backend)
+	}
+	if backend == storage.LocalBackendID && os.Getenv("S3_ENDPOINT") == "" {
+		return storage.NewBackends(local), nil
+	}
+
+	s3, err := storage.NewS3Storage(storage.S3Config{
+		Endpoint:        os.Getenv("S3_ENDPOINT"),
+		Region:          os.Getenv("S3_REGION"),
+		Bucket:          os.Getenv("S3_BUCKET"),
+		AccessKeyID:     os.Getenv("S3_ACCESS_KEY_ID"),
+		SecretAccessKey: os.Getenv("S3_SECRET_ACCESS_KEY"),
+	})
+	if err != nil {
+		return nil, err
+	}
+	if backend == storage.S3BackendID {
+		return storage.NewBackends(s3, local), nil
+	}
+	return storage.NewBackends(local, s3), nil
+}
+
+// envInt reads a positive integer from the environment, falling back to the default when unset or invalid
+func envInt(name string, defaultValue int) int {
+	if value, err := strconv.Atoi(os.Getenv(name)); err == nil && value > 0 {
+		return value
+	}
+	return defaultValue
 }
@@ -3,11 +3,15 @@ package main
 import (
 	"net/http"
 	"os"
+	"os/signal"
+	"strings"
+	"syscall"
 
 	"elotuschallenge/database"
 	"elotuschallenge/handler"
 	"elotuschallenge/internal"
 	"elotuschallenge/middleware"
+	"elotuschallenge/models"
 
 	"github.com/rs/zerolog/log"
 )
@@ -22,17 +26,62 @@ func main() {
 	// Initialize services
 	internal.InitServices()
 
+	// Move files of older versions to the local storage
+	if err := internal.MigrateFileStorage(); err != nil {
+		log.Fatal().Err(err).Msg("Failed to migrate files to the local storage")
+	}
+
+	// Encrypt TOTP secrets of older versions
+	if err := internal.EncryptTOTPSecrets(); err != nil {
+		log.Fatal().Err(err).Msg("Failed to encrypt TOTP secrets")
+	}
+
+	// Create the admin account from ADMIN_USERNAME and ADMIN_PASSWORD
+	if err := internal.BootstrapAdmin(); err != nil {
+		log.Fatal().Err(err).Msg("Failed to bootstrap admin account")
+	}
+
+	// Start background cleanup jobs
+	stopBackgroundJobs := internal.StartBackgroundJobs()
+	defer stopBackgroundJobs()
+
+	// Reload signing keys on SIGHUP
+	go reloadKeysOnSignal()
+
 	// Get port from environment or use default
 	port := os.Getenv("PORT")
 	if port == "" {
 		port = "8080"
 	}
 
+	// Limit the authentication methods to AUTH_METHODS, tried in the given order
+	if methods := os.Getenv("AUTH_METHODS"); methods != "" {
+		chain, err := middleware.AuthenticatorsByName(strings.Split(methods, ","))
+		if err != nil {
+			log.Fatal().Err(err).Msg("Invalid AUTH_METHODS")
+		}
+		middleware.SetAuthenticators(chain...)
+	}
+
 	// Set up routes
 	setupRoutes()
 
 	log.Info().Str("port", port).Msg("Server is starting...")
 
+	// Serve HTTPS when TLS_CERT_FILE and TLS_KEY_FILE are set, which is required for client certificates
+	certFile, keyFile := os.Getenv("TLS_CERT_FILE"), os.Getenv("TLS_KEY_FILE")
+	if certFile != "" && keyFile != "" {
+		tlsConfig, err := internal.ServerTLSConfig()
+		if err != nil {
+			log.Fatal().Err(err).Msg("Invalid TLS configuration")
+		}
+		server := &http.Server{Addr: ":" + port, TLSConfig: tlsConfig}
+		if err := server.ListenAndServeTLS(certFile, keyFile); err != nil {
+			log.Fatal().Err(err).Msg("Failed to start server")
+		}
+		return
+	}
+
 	// Start server
 	if err := http.ListenAndServe(":"+port, nil); err != nil {
 		log.Fatal().Err(err).Msg("Failed to start server")
@@ -43,16 +92,64 @@ func main() {
 func setupRoutes() {
 	// API routes
 	http.HandleFunc("/api/register", handler.HandleRegister)
+	http.HandleFunc("/api/verify", handler.HandleVerifyAccount)
+	http.HandleFunc("/api/verify/resend", handler.HandleResendVerification)
 	http.HandleFunc("/api/login", handler.HandleLogin)
+	http.HandleFunc("/api/login/mfa", handler.HandleLoginMFA)
+	http.HandleFunc("/api/token/refresh", handler.HandleRefreshToken)
+	http.HandleFunc("/api/token/introspect", middleware.AuthUser(handler.HandleTokenIntrospect))
+	http.HandleFunc("/api/me", middleware.AuthUser(handler.HandleMe))
+	http.HandleFunc("/api/me/export", middleware.AuthUser(handler.HandleMeExport))
+	http.HandleFunc("/api/oidc/providers", handler.HandleOIDCProviders)
+	http.HandleFunc("/api/oidc/{provider}/login", handler.HandleOIDCLogin)
+	http.HandleFunc("/api/oidc/{provider}/callback", handler.HandleOIDCCallback)
+	http.HandleFunc("/api/logout", middleware.AuthUser(handler.HandleLogout))
+	http.HandleFunc("/api/sessions", middleware.AuthUser(handler.HandleSessions))
+	http.HandleFunc("/api/sessions/{id}", middleware.AuthUser(handler.HandleSession))
+	http.HandleFunc("/api/password", middleware.AuthUser(handler.HandleChangePassword))
+	http.HandleFunc("/api/password/reset/request", handler.HandlePasswordResetRequest)
+	http.HandleFunc("/api/password/reset", handler.HandlePasswordReset)
+	http.HandleFunc("/api/mfa/totp/enroll", middleware.AuthUser(handler.HandleTOTPEnroll))
+	http.HandleFunc("/api/mfa/totp/confirm", middleware.AuthUser(handler.HandleTOTPConfirm))
+	http.HandleFunc("/api/mfa/totp/disable", middleware.AuthUser(handler.HandleTOTPDisable))
+	http.HandleFunc("/api/mfa/recovery-codes", middleware.AuthUser(handler.HandleRecoveryCodesRegenerate))
 	http.HandleFunc("/api/upload", middleware.AuthUser(handler.HandleUpload))
+	http.HandleFunc("/api/files", middleware.AuthUser(handler.HandleFiles))
+	http.HandleFunc("/api/files/{id}", middleware.AuthUser(handler.HandleFile))
+	http.HandleFunc("/api/files/{id}/content", middleware.AuthUser(handler.HandleFileContent))
+	http.HandleFunc("/api/trash", middleware.AuthUser(handler.HandleTrash))
+	http.HandleFunc("/api/trash/{id}", middleware.AuthUser(handler.HandleTrashedFile))
+	http.HandleFunc("/api/trash/{id}/restore", middleware.AuthUser(handler.HandleTrashRestore))
+	http.HandleFunc("/api/keys", middleware.AuthUser(handler.HandleAPIKeys))
+	http.HandleFunc("/api/keys/{id}", middleware.AuthUser(handler.HandleAPIKey))
+
+	// Admin routes
+	http.HandleFunc("/api/admin/users", middleware.AuthUser(middleware.RequireRole(models.RoleAdmin, handler.HandleAdminUsers)))
+	http.HandleFunc("/api/admin/users/{id}/role", middleware.AuthUser(middleware.RequireRole(models.RoleAdmin, handler.HandleAdminUserRole)))
+	http.HandleFunc("/api/admin/users/{id}/status", middleware.AuthUser(middleware.RequireRole(models.RoleAdmin, handler.HandleAdminUserStatus)))
+	http.HandleFunc("/api/admin/users/{id}/unlock", middleware.AuthUser(middleware.RequireRole(models.RoleAdmin, handler.HandleAdminUserUnlock)))
 
 	// Form routes (static files)
 	http.HandleFunc("/form/register", handler.HandleStatic)
 	http.HandleFunc("/form/login", handler.HandleStatic)
 	http.HandleFunc("/form/upload", handler.HandleStatic)
 
+	// Public keys for verifying tokens
+	http.HandleFunc("/.well-known/jwks.json", handler.HandleJWKS)
+
 	// Health check
 	http.HandleFunc("/health", handler.HandleHealth)
 
 	log.Info().Msg("Routes configured")
 }
+
+// reloadKeysOnSignal reloads the JWT signing keys every time the process receives SIGHUP
+func reloadKeysOnSignal() {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP)
+	for range signals {
+		if err := internal.ReloadSigningKeys(); err != nil {
+			log.Error().Err(err).Msg("Failed to reload signing keys, keeping current keys")
+		}
+	}
+}
@@ -3,11 +3,14 @@ package middleware
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 
 	"elotuschallenge/common"
 	"elotuschallenge/internal"
+	"elotuschallenge/models"
+	"elotuschallenge/services"
 	"elotuschallenge/transfer"
 	"elotuschallenge/utils"
 
@@ -16,54 +19,44 @@ import (
 
 const ErrMsgUnauthorized = "Unauthorized access"
 
-var ErrNoAuthorizationHeader = fmt.Errorf("authorization header required")
+var ErrNoCredentials = fmt.Errorf("authorization header or other credentials required")
 var ErrInvalidAuthorizationFormat = fmt.Errorf("invalid authorization format")
 var ErrMalformedToken = fmt.Errorf("malformed token")
 var ErrInvalidToken = fmt.Errorf("invalid token")
+var ErrRevokedToken = fmt.Errorf("token has been revoked")
 
-// AuthUser validates JWT tokens for protected routes
+// AuthUser authenticates requests of protected routes with the first authenticator of the chain finding
+// its credential, see SetAuthenticators
 func AuthUser(next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		// Get Authorization header
-		authHeader := r.Header.Get(common.HeaderAuthorization)
-		if authHeader == "" {
-			ResponseUnauthorized(w, r, ErrNoAuthorizationHeader)
+		principal, errAuth := authenticate(r)
+		if errAuth != nil {
+			responseAuthError(w, r, errAuth)
 			return
 		}
 
-		// Check if header has valid Bearer format
-		if !internal.TokenManager.HasValidBearerFormat(authHeader) {
-			ResponseUnauthorized(w, r, ErrInvalidAuthorizationFormat)
-			return
-		}
-
-		// Extract token from Bearer format
-		token := internal.TokenManager.ExtractTokenFromHeader(authHeader)
-		if token == "" {
-			ResponseUnauthorized(w, r, ErrMalformedToken)
-			return
+		// Keep the session inventory up to date with the client's last activity
+		if principal.SessionID != "" {
+			err := internal.SessionService.TouchSession(principal.SessionID, r.Header.Get(common.HeaderUserAgent), utils.GetClientIP(r))
+			if err != nil {
+				log.Error().Err(err).Str("session_id", principal.SessionID).Msg("Failed to record session activity")
+			}
 		}
 
-		// Validate JWT token
-		claims, errValidate := internal.TokenManager.ValidateToken(token)
-		if errValidate != nil {
-			ResponseUnauthorized(w, r, fmt.Errorf("%w: %w", ErrInvalidToken, errValidate))
-			return
-		}
-
-		// Add user info to request context
-		ctx := context.WithValue(r.Context(), common.ContextKeyUserID, claims.UserID)
-		ctx = context.WithValue(ctx, common.ContextKeyUsername, claims.Username)
+		// Add the principal to request context
+		ctx := WithPrincipal(r.Context(), principal)
 
 		// Create a mutable log context with initial fields
 		logContext := &LogContext{
 			Fields: map[string]interface{}{
-				"path":       r.URL.Path,
-				"method":     r.Method,
-				"client_ip":  utils.GetClientIP(r),
-				"user_agent": r.Header.Get(common.HeaderUserAgent),
-				"user_id":    claims.UserID,
-				"username":   claims.Username,
+				"path":        r.URL.Path,
+				"method":      r.Method,
+				"client_ip":   utils.GetClientIP(r),
+				"user_agent":  r.Header.Get(common.HeaderUserAgent),
+				"user_id":     principal.ID,
+				"username":    principal.Username,
+				"role":        principal.Role(),
+				"auth_method": principal.AuthMethod,
 			},
 		}
 		ctx = context.WithValue(ctx, logContextKey, logContext)
@@ -81,6 +74,105 @@ func AuthUser(next http.HandlerFunc) http.HandlerFunc {
 	}
 }
 
+// AuthenticateJWT validates a JWT and checks it hasn't been revoked before its expiration, then loads its user
+func AuthenticateJWT(token string) (*services.Claims, *models.User, error) {
+	claims, err := internal.TokenManager.ValidateToken(token)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: %w", ErrInvalidToken, err)
+	}
+
+	revoked, err := internal.TokenManager.IsTokenRevoked(token)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: %w", ErrInvalidToken, err)
+	}
+	if revoked {
+		return nil, nil, ErrRevokedToken
+	}
+
+	// Tokens of sessions signed out remotely are rejected, tokens issued outside a session carry no session ID
+	if claims.SessionID != "" {
+		active, err := internal.SessionService.IsSessionActive(claims.SessionID)
+		if err != nil {
+			return nil, nil, fmt.Errorf("%w: %w", ErrInvalidToken, err)
+		}
+		if !active {
+			return nil, nil, fmt.Errorf("%w: %w: %s", ErrRevokedToken, common.ErrSessionRevoked, claims.SessionID)
+		}
+	}
+
+	user, err := internal.UserService.GetUserByID(claims.UserID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: %w", ErrInvalidToken, err)
+	}
+	// Tokens of deleted accounts are all rejected, including those carrying no session ID
+	if user == nil {
+		return nil, nil, fmt.Errorf("%w: user %d not found", ErrInvalidToken, claims.UserID)
+	}
+	// Tokens issued before the user's password changed are revoked all at once
+	if claims.TokenVersion < user.TokenVersion {
+		return nil, nil, fmt.Errorf("%w: token version %d is older than %d", ErrRevokedToken, claims.TokenVersion, user.TokenVersion)
+	}
+	if err := services.CheckAccountStatus(user); err != nil {
+		return nil, nil, err
+	}
+	return claims, user, nil
+}
+
+// AuthenticateAPIKey validates an API key and loads its owner
+func AuthenticateAPIKey(token string) (*models.APIKey, *models.User, error) {
+	apiKey, err := internal.APIKeyService.AuthenticateAPIKey(token)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: %w", ErrInvalidToken, err)
+	}
+
+	user, err := internal.UserService.GetUserByID(apiKey.UserID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: %w", ErrInvalidToken, err)
+	}
+	if user == nil {
+		return nil, nil, fmt.Errorf("%w: owner of API key %d not found", ErrInvalidToken, apiKey.ID)
+	}
+	if err := services.CheckAccountStatus(user); err != nil {
+		return nil, nil, err
+	}
+	return apiKey, user, nil
+}
+
+// responseAuthError rejects pending and disabled accounts with their error code, missing CSRF tokens as forbidden
+// and other failures as unauthorized
+func responseAuthError(w http.ResponseWriter, r *http.Request, err error) {
+	if code := services.AccountStatusErrorCode(err); code != "" {
+		ResponseAccountInactive(w, r, err)
+		return
+	}
+	if errors.Is(err, common.ErrCSRFTokenMismatch) {
+		ResponseForbidden(w, r, err)
+		return
+	}
+	ResponseUnauthorized(w, r, err)
+}
+
+// ResponseAccountInactive sends a forbidden response telling whether the account is pending or disabled
+func ResponseAccountInactive(resp http.ResponseWriter, req *http.Request, accountError error) {
+	resp.Header().Set(common.HeaderContentType, common.HeaderValueContentTypeJSON)
+	resp.WriteHeader(http.StatusForbidden)
+
+	code := services.AccountStatusErrorCode(accountError)
+	message := common.ErrMsgAccountDisabled
+	if code == common.ErrCodeAccountPending {
+		message = common.ErrMsgAccountPending
+	}
+
+	response := transfer.NewErrorResponse(message)
+	response.Code = code
+	json.NewEncoder(resp).Encode(response)
+
+	log.Error().
+		Str("client_ip", utils.GetClientIP(req)).
+		Str("code", code).
+		Err(accountError).Msg("Inactive account rejected")
+}
+
 // ResponseUnauthorized sends a uniform unauthorized response
 func ResponseUnauthorized(resp http.ResponseWriter, req *http.Request, authorizeError error) {
 	resp.Header().Set(common.HeaderContentType, common.HeaderValueContentTypeJSON)
@@ -89,11 +181,14 @@ func ResponseUnauthorized(resp http.ResponseWriter, req *http.Request, authorize
 	response := transfer.NewErrorResponse(ErrMsgUnauthorized)
 	json.NewEncoder(resp).Encode(response)
 	var logMsg string
+	var reason string
 	if authorizeError != nil {
 		logMsg = authorizeError.Error()
+		reason = services.TokenErrorReason(authorizeError)
 	}
 
 	log.Error().
 		Str("client_ip", utils.GetClientIP(req)).
+		Str("reason", reason).
 		Str("error", logMsg).Msg("Unauthorized request")
 }
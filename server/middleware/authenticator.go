@@ -0,0 +1,246 @@
+package middleware
+
+import (
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+
+	"elotuschallenge/common"
+	"elotuschallenge/internal"
+	"elotuschallenge/models"
+	"elotuschallenge/services"
+)
+
+// Authenticator authenticates requests carrying one kind of credential.
+// Authenticate returns nil without error when the request doesn't carry the credential, so the next authenticator
+// of the chain is tried; an error rejects the request, an invalid credential is never passed over for another one.
+type Authenticator interface {
+	Name() string
+	Authenticate(r *http.Request) (*Principal, error)
+}
+
+var (
+	authenticatorsMu sync.RWMutex
+	authenticators   = DefaultAuthenticators()
+)
+
+// DefaultAuthenticators returns the chain used by AuthUser unless configured otherwise:
+// API keys and JWTs in the Authorization header, then the session cookie, then TLS client certificates
+func DefaultAuthenticators() []Authenticator {
+	return []Authenticator{APIKeyAuthenticator{}, JWTAuthenticator{}, CookieAuthenticator{}, ClientCertAuthenticator{}}
+}
+
+// SetAuthenticators replaces the chain AuthUser tries in order, it is meant to be called on startup
+func SetAuthenticators(chain ...Authenticator) {
+	authenticatorsMu.Lock()
+	defer authenticatorsMu.Unlock()
+	authenticators = chain
+}
+
+// Authenticators returns the current authenticator chain
+func Authenticators() []Authenticator {
+	authenticatorsMu.RLock()
+	defer authenticatorsMu.RUnlock()
+	return authenticators
+}
+
+// AuthenticatorsByName builds a chain from the names of the default authenticators, e.g. from AUTH_METHODS
+func AuthenticatorsByName(names []string) ([]Authenticator, error) {
+	available := map[string]Authenticator{}
+	for _, authenticator := range DefaultAuthenticators() {
+		available[authenticator.Name()] = authenticator
+	}
+
+	var chain []Authenticator
+	for _, name := range names {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		authenticator, ok := available[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown authentication method %q", name)
+		}
+		chain = append(chain, authenticator)
+	}
+	if len(chain) == 0 {
+		return nil, fmt.Errorf("no authentication method configured")
+	}
+	return chain, nil
+}
+
+// authenticate runs the authenticator chain, the first authenticator finding its credential decides
+func authenticate(r *http.Request) (*Principal, error) {
+	for _, authenticator := range Authenticators() {
+		principal, err := authenticator.Authenticate(r)
+		if err != nil {
+			return nil, err
+		}
+		if principal != nil {
+			return principal, nil
+		}
+	}
+	return nil, ErrNoCredentials
+}
+
+// JWTAuthenticator accepts access tokens in the Authorization: Bearer header
+type JWTAuthenticator struct{}
+
+func (JWTAuthenticator) Name() string { return common.AuthMethodJWT }
+
+func (JWTAuthenticator) Authenticate(r *http.Request) (*Principal, error) {
+	token, err := bearerToken(r)
+	if token == "" || err != nil {
+		return nil, err
+	}
+	if internal.APIKeyService.IsAPIKey(token) {
+		return nil, nil
+	}
+
+	claims, user, err := AuthenticateJWT(token)
+	if err != nil {
+		return nil, err
+	}
+	return claimsPrincipal(claims, user, common.AuthMethodJWT), nil
+}
+
+// APIKeyAuthenticator accepts API keys in the Authorization: Bearer header
+type APIKeyAuthenticator struct{}
+
+func (APIKeyAuthenticator) Name() string { return common.AuthMethodAPIKey }
+
+func (APIKeyAuthenticator) Authenticate(r *http.Request) (*Principal, error) {
+	token, err := bearerToken(r)
+	if token == "" || err != nil || !internal.APIKeyService.IsAPIKey(token) {
+		// Malformed headers are reported by the JWT authenticator
+		return nil, nil
+	}
+
+	apiKey, user, err := AuthenticateAPIKey(token)
+	if err != nil {
+		return nil, err
+	}
+	return &Principal{
+		ID:         user.ID,
+		Username:   user.Username,
+		Roles:      []string{user.Role},
+		Scopes:     apiKey.Scopes,
+		AuthMethod: common.AuthMethodAPIKey,
+		TokenID:    apiKey.Prefix,
+	}, nil
+}
+
+// CookieAuthenticator accepts the session cookie of browsers when there is no Authorization header.
+// Cookies are sent by the browser on cross-site requests too, state-changing requests must prove they come
+// from our pages by echoing the CSRF cookie.
+type CookieAuthenticator struct{}
+
+func (CookieAuthenticator) Name() string { return common.AuthMethodCookie }
+
+func (CookieAuthenticator) Authenticate(r *http.Request) (*Principal, error) {
+	if r.Header.Get(common.HeaderAuthorization) != "" {
+		return nil, nil
+	}
+	token := SessionToken(r)
+	if token == "" {
+		return nil, nil
+	}
+
+	claims, user, err := AuthenticateJWT(token)
+	if err != nil {
+		return nil, err
+	}
+	if !hasValidCSRFToken(r, token) {
+		return nil, common.ErrCSRFTokenMismatch
+	}
+	return claimsPrincipal(claims, user, common.AuthMethodCookie), nil
+}
+
+// ClientCertAuthenticator accepts TLS client certificates verified against TLS_CLIENT_CA_FILE,
+// the subject common name is the username of the account. Browsers present certificates on cross-site
+// requests too, so state-changing requests must carry the X-CSRF-Token header like with cookies.
+type ClientCertAuthenticator struct{}
+
+func (ClientCertAuthenticator) Name() string { return common.AuthMethodClientCert }
+
+func (ClientCertAuthenticator) Authenticate(r *http.Request) (*Principal, error) {
+	if r.TLS == nil || len(r.TLS.PeerCertificates) == 0 {
+		return nil, nil
+	}
+
+	// Chains are only verified when the server is configured with client CAs, unverified certificates prove nothing
+	if len(r.TLS.VerifiedChains) == 0 {
+		return nil, fmt.Errorf("%w: client certificate not verified", ErrInvalidToken)
+	}
+	cert := r.TLS.VerifiedChains[0][0]
+
+	user, err := clientCertUser(cert)
+	if err != nil {
+		return nil, err
+	}
+	if !hasCSRFHeader(r) {
+		return nil, common.ErrCSRFTokenMismatch
+	}
+	return &Principal{
+		ID:         user.ID,
+		Username:   user.Username,
+		Roles:      []string{user.Role},
+		AuthMethod: common.AuthMethodClientCert,
+		TokenID:    cert.SerialNumber.Text(16),
+	}, nil
+}
+
+// bearerToken returns the token of the Authorization header, empty when there is no header
+func bearerToken(r *http.Request) (string, error) {
+	authHeader := r.Header.Get(common.HeaderAuthorization)
+	if authHeader == "" {
+		return "", nil
+	}
+
+	// Check if header has valid Bearer format
+	if !internal.TokenManager.HasValidBearerFormat(authHeader) {
+		return "", ErrInvalidAuthorizationFormat
+	}
+
+	// Extract token from Bearer format
+	token := internal.TokenManager.ExtractTokenFromHeader(authHeader)
+	if token == "" {
+		return "", ErrMalformedToken
+	}
+	return token, nil
+}
+
+// claimsPrincipal builds the principal of a validated access token. The role comes from the user, not the
+// token, so a role change applies to tokens already issued.
+func claimsPrincipal(claims *services.Claims, user *models.User, authMethod string) *Principal {
+	return &Principal{
+		ID:         user.ID,
+		Username:   user.Username,
+		Roles:      []string{user.Role},
+		AuthMethod: authMethod,
+		SessionID:  claims.SessionID,
+		TokenID:    claims.ID,
+	}
+}
+
+// clientCertUser loads the active account named by the common name of a client certificate
+func clientCertUser(cert *x509.Certificate) (*models.User, error) {
+	username := cert.Subject.CommonName
+	if username == "" {
+		return nil, fmt.Errorf("%w: client certificate has no common name", ErrInvalidToken)
+	}
+
+	user, err := internal.UserService.GetUserByUsername(username)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidToken, err)
+	}
+	if user == nil {
+		return nil, fmt.Errorf("%w: no user %q for client certificate", ErrInvalidToken, username)
+	}
+	if err := services.CheckAccountStatus(user); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
@@ -12,10 +12,6 @@ func GetLogContext(r *http.Request) *LogContext {
 	return &LogContext{Fields: make(map[string]interface{})}
 }
 
-const (
-	logContextKey = "logContext"
-)
-
 // LogContext holds fields that can be appended to during request processing
 type LogContext struct {
 	Fields map[string]interface{}
@@ -0,0 +1,81 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+
+	"elotuschallenge/common"
+)
+
+// contextKey is the type of the request context keys of this package, values stored under it can't collide
+// with keys of other packages
+type contextKey int
+
+const (
+	principalContextKey contextKey = iota
+	logContextKey
+)
+
+// Principal is the identity an authenticator established for a request
+type Principal struct {
+	ID         int
+	Username   string
+	Roles      []string
+	Scopes     []string // Only API keys are limited to scopes
+	AuthMethod string
+	SessionID  string // Empty for credentials which aren't tied to a session
+	TokenID    string // jti of tokens, prefix of API keys, serial number of client certificates
+}
+
+// Role returns the primary role of the principal, empty when it has none
+func (p *Principal) Role() string {
+	if len(p.Roles) == 0 {
+		return ""
+	}
+	return p.Roles[0]
+}
+
+// HasRole checks if the principal was granted the role
+func (p *Principal) HasRole(role string) bool {
+	for _, granted := range p.Roles {
+		if granted == role {
+			return true
+		}
+	}
+	return false
+}
+
+// HasScope checks if the principal may perform actions requiring the scope.
+// Tokens issued by login are not restricted, API keys only have the scopes granted to them.
+func (p *Principal) HasScope(scope string) bool {
+	if p.AuthMethod != common.AuthMethodAPIKey {
+		return true
+	}
+	for _, granted := range p.Scopes {
+		if granted == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// IsAPIKey checks if the principal authenticated with an API key rather than as a signed in user
+func (p *Principal) IsAPIKey() bool {
+	return p.AuthMethod == common.AuthMethodAPIKey
+}
+
+// WithPrincipal returns a copy of the context carrying the principal
+func WithPrincipal(ctx context.Context, principal *Principal) context.Context {
+	return context.WithValue(ctx, principalContextKey, principal)
+}
+
+// PrincipalFromContext returns the principal stored by AuthUser, false when the context carries none
+func PrincipalFromContext(ctx context.Context) (*Principal, bool) {
+	principal, ok := ctx.Value(principalContextKey).(*Principal)
+	return principal, ok && principal != nil
+}
+
+// GetPrincipal returns the principal of an authenticated request, false when the route isn't behind AuthUser
+func GetPrincipal(r *http.Request) (*Principal, bool) {
+	return PrincipalFromContext(r.Context())
+}
@@ -0,0 +1,31 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+
+	"elotuschallenge/common"
+)
+
+// RequireRole allows only users with the role, it wraps handlers after AuthUser.
+// Roles apply to users signed in with a token, API keys are limited to their scopes.
+func RequireRole(role string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		principal, ok := GetPrincipal(r)
+		if !ok {
+			ResponseUnauthorized(w, r, ErrNoCredentials)
+			return
+		}
+		if principal.IsAPIKey() {
+			ResponseForbidden(w, r, fmt.Errorf("%w: %s requires a signed in user", common.ErrInsufficientRole, role))
+			return
+		}
+
+		if !principal.HasRole(role) {
+			ResponseForbidden(w, r, fmt.Errorf("%w: %s required, got %q", common.ErrInsufficientRole, role, principal.Roles))
+			return
+		}
+
+		next(w, r)
+	}
+}
@@ -0,0 +1,33 @@
+package middleware
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"elotuschallenge/common"
+	"elotuschallenge/transfer"
+	"elotuschallenge/utils"
+
+	"github.com/rs/zerolog/log"
+)
+
+// HasScope checks if the authenticated request may perform actions requiring the scope.
+// Tokens issued by login are not restricted, API keys only have the scopes granted to them.
+func HasScope(r *http.Request, scope string) bool {
+	principal, ok := GetPrincipal(r)
+	return ok && principal.HasScope(scope)
+}
+
+// ResponseForbidden sends a uniform forbidden response
+func ResponseForbidden(resp http.ResponseWriter, req *http.Request, forbiddenError error) {
+	resp.Header().Set(common.HeaderContentType, common.HeaderValueContentTypeJSON)
+	resp.WriteHeader(http.StatusForbidden)
+
+	response := transfer.NewErrorResponse(common.ErrMsgForbidden)
+	json.NewEncoder(resp).Encode(response)
+
+	log.Error().
+		Str("client_ip", utils.GetClientIP(req)).
+		Str("path", req.URL.Path).
+		Err(forbiddenError).Msg("Forbidden request")
+}
@@ -0,0 +1,97 @@
+package middleware
+
+import (
+	"crypto/subtle"
+	"net/http"
+
+	"elotuschallenge/common"
+	"elotuschallenge/internal"
+	"elotuschallenge/utils"
+)
+
+// SetSessionCookies stores the access token in an HttpOnly session cookie, along with the
+// CSRF token readable by scripts which must be echoed in the X-CSRF-Token header
+func SetSessionCookies(w http.ResponseWriter, token string) string {
+	csrfToken := CSRFToken(token)
+	http.SetCookie(w, &http.Cookie{
+		Name:     common.CookieSession,
+		Value:    token,
+		Path:     "/",
+		MaxAge:   int(internal.SessionExpirationSeconds),
+		HttpOnly: true,
+		Secure:   internal.SessionCookieSecure,
+		SameSite: http.SameSiteStrictMode,
+	})
+	http.SetCookie(w, &http.Cookie{
+		Name:     common.CookieCSRF,
+		Value:    csrfToken,
+		Path:     "/",
+		MaxAge:   int(internal.SessionExpirationSeconds),
+		Secure:   internal.SessionCookieSecure,
+		SameSite: http.SameSiteStrictMode,
+	})
+	return csrfToken
+}
+
+// ClearSessionCookies expires the session and CSRF cookies
+func ClearSessionCookies(w http.ResponseWriter) {
+	for _, name := range []string{common.CookieSession, common.CookieCSRF} {
+		http.SetCookie(w, &http.Cookie{
+			Name:     name,
+			Value:    "",
+			Path:     "/",
+			MaxAge:   -1,
+			HttpOnly: name == common.CookieSession,
+			Secure:   internal.SessionCookieSecure,
+			SameSite: http.SameSiteStrictMode,
+		})
+	}
+}
+
+// CSRFToken derives the CSRF token bound to a session token, so a token from another session is rejected
+func CSRFToken(sessionToken string) string {
+	return utils.HashToken("csrf:" + sessionToken)
+}
+
+// SessionToken returns the access token of the session cookie, or empty when there is none
+func SessionToken(r *http.Request) string {
+	cookie, err := r.Cookie(common.CookieSession)
+	if err != nil {
+		return ""
+	}
+	return cookie.Value
+}
+
+// hasValidCSRFToken checks the double-submitted CSRF token of state-changing requests authenticated by cookie,
+// the header must match both the CSRF cookie and the token derived from the session
+func hasValidCSRFToken(r *http.Request, sessionToken string) bool {
+	if isSafeMethod(r.Method) {
+		return true
+	}
+
+	headerToken := r.Header.Get(common.HeaderCSRFToken)
+	cookie, err := r.Cookie(common.CookieCSRF)
+	if headerToken == "" || err != nil {
+		return false
+	}
+
+	expected := CSRFToken(sessionToken)
+	return subtle.ConstantTimeCompare([]byte(headerToken), []byte(cookie.Value)) == 1 &&
+		subtle.ConstantTimeCompare([]byte(headerToken), []byte(expected)) == 1
+}
+
+// hasCSRFHeader checks that state-changing requests authenticated by client certificate carry the CSRF header.
+// There is no session to bind a token to, but cross-site pages can't set custom headers without a CORS
+// preflight, which the server never allows.
+func hasCSRFHeader(r *http.Request) bool {
+	return isSafeMethod(r.Method) || r.Header.Get(common.HeaderCSRFToken) != ""
+}
+
+// isSafeMethod tells whether the method doesn't change state, these requests need no CSRF protection
+func isSafeMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return true
+	}
+	return false
+}
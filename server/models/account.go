@@ -0,0 +1,20 @@
+package models
+
+import "time"
+
+// AccountExport is the personal data of a user handed out by the data export
+type AccountExport struct {
+	ExportedAt time.Time       `json:"exported_at"`
+	User       *User           `json:"user"`
+	Identities []*UserIdentity `json:"identities"`
+	APIKeys    []*APIKey       `json:"api_keys"`
+	Sessions   []*Session      `json:"sessions"`
+	Files      []*ExportedFile `json:"files"`
+}
+
+// ExportedFile is the metadata of an uploaded file, ArchivePath is where its content is found in the export
+// archive and empty when the file is missing from storage
+type ExportedFile struct {
+	*FileMetadata
+	ArchivePath string `json:"archive_path,omitempty"`
+}
@@ -0,0 +1,14 @@
+package models
+
+import "time"
+
+// Blob is stored file content addressed by its SHA-256 digest, shared by all files with the same content.
+// RefCount is the number of files using it; the content is removed with the last of them.
+type Blob struct {
+	SHA256         string    `json:"sha256"`
+	Size           int64     `json:"size"`
+	StorageBackend string    `json:"storage_backend"`
+	StorageKey     string    `json:"-"`
+	RefCount       int       `json:"ref_count"`
+	CreatedAt      time.Time `json:"created_at"`
+}
@@ -6,14 +6,53 @@ import (
 
 // FileMetadata represents file information stored in database
 type FileMetadata struct {
-	ID           int       `json:"id"`
-	Filename     string    `json:"filename"`
-	OriginalName string    `json:"original_name"`
-	ContentType  string    `json:"content_type"`
-	Size         int64     `json:"size"`
-	UserID       int       `json:"user_id"`
-	UploadPath   string    `json:"upload_path"`
-	UserAgent    string    `json:"user_agent"`
-	IPAddress    string    `json:"ip_address"`
-	CreatedAt    time.Time `json:"created_at"`
+	ID             int        `json:"id"`
+	Filename       string     `json:"filename"`
+	OriginalName   string     `json:"original_name"`
+	ContentType    string     `json:"content_type"`
+	Size           int64      `json:"size"`
+	UserID         int        `json:"user_id"`
+	StorageKey     string     `json:"-"`                // Key of the content in the storage backend
+	StorageBackend string     `json:"storage_backend"`  // ID of the storage backend holding the content
+	SHA256         string     `json:"sha256,omitempty"` // Digest of the content, empty for files uploaded before deduplication
+	UserAgent      string     `json:"user_agent"`
+	IPAddress      string     `json:"ip_address"`
+	CreatedAt      time.Time  `json:"created_at"`
+	DeletedAt      *time.Time `json:"deleted_at,omitempty"` // Set while the file is in the trash
+}
+
+// Fields files can be sorted by
+const (
+	FileSortCreatedAt = "created_at"
+	FileSortSize      = "size"
+	FileSortName      = "name"
+)
+
+// FileSorts are the fields files can be sorted by
+var FileSorts = []string{FileSortCreatedAt, FileSortSize, FileSortName}
+
+// FileQuery selects a page of the files of a user, the filters are optional
+type FileQuery struct {
+	UserID        int
+	Trashed       bool // Lists the trash instead of the files in use
+	ContentType   string
+	CreatedAfter  *time.Time // Inclusive
+	CreatedBefore *time.Time // Exclusive
+	NameContains  string
+	SortBy        string
+	Descending    bool
+	Limit         int
+	After         *FileCursor // Position of the last file of the previous page
+}
+
+// FileCursor is the position of a file in a sorted listing, the value of the sort field and the ID breaking ties
+type FileCursor struct {
+	Value string `json:"v"`
+	ID    int    `json:"id"`
+}
+
+// FilePage is a page of a file listing, NextCursor is empty on the last page
+type FilePage struct {
+	Files      []*FileMetadata
+	NextCursor string
 }
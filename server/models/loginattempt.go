@@ -0,0 +1,11 @@
+package models
+
+import "time"
+
+// LoginAttempt tracks failed logins for a username or a client IP
+type LoginAttempt struct {
+	Key           string     `json:"key"`
+	Failures      int        `json:"failures"`
+	LastFailureAt time.Time  `json:"last_failure_at"`
+	LockedUntil   *time.Time `json:"locked_until,omitempty"`
+}
@@ -0,0 +1,12 @@
+package models
+
+import "time"
+
+// TOTPSecret is the TOTP enrollment of a user, it is only used for login once enabled
+type TOTPSecret struct {
+	UserID       int        `json:"user_id"`
+	Secret       string     `json:"-"`
+	EnabledAt    *time.Time `json:"enabled_at,omitempty"`
+	LastUsedStep int64      `json:"-"`
+	CreatedAt    time.Time  `json:"created_at"`
+}
@@ -0,0 +1,18 @@
+package models
+
+import "time"
+
+const NotificationPasswordReset = "password_reset"
+const NotificationPasswordChanged = "password_changed"
+const NotificationVerifyAccount = "verify_account"
+
+// Notification is a message to a user, e.g. a password reset link
+type Notification struct {
+	ID        int        `json:"id"`
+	Recipient string     `json:"recipient"`
+	Kind      string     `json:"kind"`
+	Subject   string     `json:"subject"`
+	Body      string     `json:"body"`
+	CreatedAt time.Time  `json:"created_at"`
+	SentAt    *time.Time `json:"sent_at,omitempty"`
+}
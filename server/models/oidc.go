@@ -0,0 +1,24 @@
+package models
+
+import "time"
+
+// OIDCState is a login started at an OpenID Connect provider, it is consumed when the provider redirects back
+type OIDCState struct {
+	StateHash    string    `json:"-"`
+	Provider     string    `json:"provider"`
+	CodeVerifier string    `json:"-"`
+	Nonce        string    `json:"-"`
+	UseCookies   bool      `json:"use_cookies"`
+	ExpiresAt    time.Time `json:"expires_at"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// UserIdentity links the account of an external identity provider, identified by issuer and subject, to a user
+type UserIdentity struct {
+	ID        int       `json:"id"`
+	UserID    int       `json:"user_id"`
+	Issuer    string    `json:"issuer"`
+	Subject   string    `json:"subject"`
+	Email     string    `json:"email,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
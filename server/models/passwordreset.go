@@ -0,0 +1,13 @@
+package models
+
+import "time"
+
+// PasswordResetToken represents a stored password reset token, only the hash of the token is persisted
+type PasswordResetToken struct {
+	ID        int        `json:"id"`
+	UserID    int        `json:"user_id"`
+	TokenHash string     `json:"-"`
+	ExpiresAt time.Time  `json:"expires_at"`
+	UsedAt    *time.Time `json:"used_at,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+}
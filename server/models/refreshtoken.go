@@ -0,0 +1,15 @@
+package models
+
+import "time"
+
+// RefreshToken represents a stored refresh token, only the hash of the token is persisted
+type RefreshToken struct {
+	ID        int        `json:"id"`
+	TokenHash string     `json:"-"`
+	FamilyID  string     `json:"family_id"`
+	UserID    int        `json:"user_id"`
+	ExpiresAt time.Time  `json:"expires_at"`
+	UsedAt    *time.Time `json:"used_at,omitempty"`
+	RevokedAt *time.Time `json:"revoked_at,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+}
@@ -0,0 +1,17 @@
+package models
+
+import "time"
+
+// Session is a signed in client of a user, it starts with a login and lasts while its tokens are refreshed.
+// The session ID is carried by access tokens in the sid claim and names the refresh token family.
+type Session struct {
+	ID         string     `json:"id"`
+	UserID     int        `json:"user_id"`
+	TokenID    string     `json:"-"` // jti of the latest access token issued in the session
+	UserAgent  string     `json:"user_agent"`
+	IPAddress  string     `json:"ip_address"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+	LastSeenAt time.Time  `json:"last_seen_at"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
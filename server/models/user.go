@@ -2,11 +2,28 @@ package models
 
 import "time"
 
+const RoleUser = "user"
+const RoleAdmin = "admin"
+
+// Roles lists the valid user roles
+var Roles = []string{RoleUser, RoleAdmin}
+
+// Account statuses, pending accounts are waiting for verification
+const StatusPending = "pending"
+const StatusActive = "active"
+const StatusDisabled = "disabled"
+
+// Statuses lists the valid account statuses
+var Statuses = []string{StatusPending, StatusActive, StatusDisabled}
+
 // User represents a user in the system
 type User struct {
 	ID           int       `json:"id"`
 	Username     string    `json:"username"`
 	PasswordHash string    `json:"-"` // Don't expose password hash in JSON
+	Role         string    `json:"role"`
+	Status       string    `json:"status"`
+	TokenVersion int       `json:"-"` // Incremented to revoke all tokens of the user
 	CreatedAt    time.Time `json:"created_at"`
 	UpdatedAt    time.Time `json:"updated_at"`
 }
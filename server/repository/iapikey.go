@@ -0,0 +1,12 @@
+package repository
+
+import "elotuschallenge/models"
+
+type IAPIKey interface {
+	CreateAPIKey(key *models.APIKey) (*models.APIKey, error)
+	GetAPIKeyByPrefix(prefix string) (*models.APIKey, error)
+	GetAPIKeysByUser(userID int) ([]*models.APIKey, error)
+	RevokeAPIKey(keyID int, userID int) (bool, error)
+	RevokeUserAPIKeys(userID int) (int64, error)
+	UpdateLastUsed(keyID int) error
+}
@@ -0,0 +1,10 @@
+package repository
+
+import "elotuschallenge/models"
+
+type IBlob interface {
+	GetBlob(sha256 string) (*models.Blob, error)
+	CreateBlob(blob *models.Blob, checkContent func(blob *models.Blob) error) (*models.Blob, error)
+	AcquireBlob(sha256 string) (*models.Blob, error)
+	ReleaseBlob(sha256 string, removeContent func(blob *models.Blob) error) (*models.Blob, error)
+}
@@ -1,9 +1,17 @@
 package repository
 
-import "elotuschallenge/models"
+import (
+	"elotuschallenge/models"
+	"time"
+)
 
 type IFile interface {
 	CreateFile(file *models.FileMetadata) (*models.FileMetadata, error)
 	GetFileByID(fileID int) (*models.FileMetadata, error)
 	GetFilesByUser(userID int) ([]*models.FileMetadata, error)
+	ListFiles(query models.FileQuery) ([]*models.FileMetadata, error)
+	TrashFile(userID int, fileID int, now time.Time) (bool, error)
+	RestoreFile(userID int, fileID int) (bool, error)
+	DeleteTrashedFile(userID int, fileID int) (*models.FileMetadata, error)
+	DeleteFilesTrashedBefore(before time.Time) ([]*models.FileMetadata, error)
 }
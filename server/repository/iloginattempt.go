@@ -0,0 +1,14 @@
+package repository
+
+import (
+	"elotuschallenge/models"
+	"time"
+)
+
+type ILoginAttempt interface {
+	GetLoginAttempt(key string) (*models.LoginAttempt, error)
+	RecordFailure(key string, now time.Time, windowStart time.Time) (int, error)
+	LockUntil(key string, lockedUntil time.Time) error
+	DeleteLoginAttempt(key string) error
+	DeleteStaleLoginAttempts(now time.Time, windowStart time.Time) (int64, error)
+}
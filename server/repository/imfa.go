@@ -0,0 +1,16 @@
+package repository
+
+import "elotuschallenge/models"
+
+type IMFA interface {
+	GetTOTPSecret(userID int) (*models.TOTPSecret, error)
+	GetTOTPSecrets() ([]*models.TOTPSecret, error)
+	SaveTOTPSecret(userID int, secret string) error
+	UpdateTOTPSecret(userID int, secret string) error
+	DeleteTOTP(userID int) (bool, error)
+	EnableTOTP(userID int) error
+	UpdateTOTPLastUsedStep(userID int, step int64) (bool, error)
+	ReplaceRecoveryCodes(userID int, codeHashes []string) error
+	UseRecoveryCode(userID int, codeHash string) (bool, error)
+	CountRecoveryCodes(userID int) (int, error)
+}
@@ -0,0 +1,15 @@
+package repository
+
+import (
+	"elotuschallenge/models"
+	"time"
+)
+
+type IOIDC interface {
+	CreateState(state *models.OIDCState) error
+	ConsumeState(stateHash string) (*models.OIDCState, error)
+	DeleteExpiredStates(now time.Time) (int64, error)
+	GetIdentity(issuer, subject string) (*models.UserIdentity, error)
+	CreateUserWithIdentity(user *models.User, identity *models.UserIdentity) (*models.User, error)
+	GetUserIdentities(userID int) ([]*models.UserIdentity, error)
+}
@@ -0,0 +1,8 @@
+package repository
+
+import "elotuschallenge/models"
+
+type IOutbox interface {
+	CreateNotification(notification *models.Notification) (*models.Notification, error)
+	GetNotificationsByRecipient(recipient string) ([]*models.Notification, error)
+}
@@ -0,0 +1,14 @@
+package repository
+
+import (
+	"elotuschallenge/models"
+	"time"
+)
+
+type IPasswordReset interface {
+	CreateResetToken(token *models.PasswordResetToken) (*models.PasswordResetToken, error)
+	GetResetTokenByHash(tokenHash string) (*models.PasswordResetToken, error)
+	MarkResetTokenUsed(id int) (bool, error)
+	DeleteUserResetTokens(userID int) error
+	DeleteExpiredResetTokens(now time.Time) (int64, error)
+}
@@ -0,0 +1,15 @@
+package repository
+
+import (
+	"elotuschallenge/models"
+	"time"
+)
+
+type IRefreshToken interface {
+	CreateRefreshToken(token *models.RefreshToken) (*models.RefreshToken, error)
+	GetRefreshTokenByHash(tokenHash string) (*models.RefreshToken, error)
+	MarkRefreshTokenUsed(tokenID int) (bool, error)
+	RevokeFamily(familyID string) error
+	RevokeUserRefreshTokens(userID int) error
+	DeleteExpiredRefreshTokens(now time.Time) (int64, error)
+}
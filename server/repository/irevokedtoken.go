@@ -0,0 +1,9 @@
+package repository
+
+import "time"
+
+type IRevokedToken interface {
+	RevokeToken(tokenHash string, expiresAt time.Time) error
+	IsTokenRevoked(tokenHash string) (bool, error)
+	DeleteExpiredTokens(now time.Time) (int64, error)
+}
@@ -0,0 +1,16 @@
+package repository
+
+import (
+	"elotuschallenge/models"
+	"time"
+)
+
+type ISession interface {
+	SaveSession(session *models.Session) (bool, error)
+	GetSession(sessionID string) (*models.Session, error)
+	GetActiveUserSessions(userID int, now time.Time) ([]*models.Session, error)
+	TouchSession(sessionID, userAgent, ipAddress string, now, seenBefore time.Time) error
+	RevokeSession(userID int, sessionID string) (bool, error)
+	RevokeUserSessions(userID int) error
+	DeleteExpiredSessions(now time.Time) (int64, error)
+}
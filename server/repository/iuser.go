@@ -5,5 +5,12 @@ import "elotuschallenge/models"
 type IUser interface {
 	CreateUser(user *models.User) (*models.User, error)
 	GetUserByUsername(username string) (*models.User, error)
+	GetUserByID(userID int) (*models.User, error)
+	GetUsers() ([]*models.User, error)
+	UpdateUserRole(userID int, role string) (bool, error)
+	UpdatePasswordHash(userID int, passwordHash string) error
+	IncrementTokenVersion(userID int) (int, error)
+	UpdateUserStatus(userID int, status string) (bool, error)
 	UserExists(username string) (bool, error)
+	DeleteUser(userID int) (bool, error)
 }
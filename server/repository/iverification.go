@@ -0,0 +1,14 @@
+package repository
+
+import (
+	"elotuschallenge/models"
+	"time"
+)
+
+type IVerification interface {
+	CreateVerificationToken(token *models.VerificationToken) (*models.VerificationToken, error)
+	GetVerificationTokenByHash(tokenHash string) (*models.VerificationToken, error)
+	MarkVerificationTokenUsed(id int) (bool, error)
+	DeleteUserVerificationTokens(userID int) error
+	DeleteExpiredVerificationTokens(now time.Time) (int64, error)
+}
@@ -0,0 +1,129 @@
+package repository
+
+import (
+	"database/sql"
+	"elotuschallenge/database"
+	"elotuschallenge/models"
+	"strings"
+	"time"
+)
+
+type SQLiteAPIKeyRepository struct{}
+
+func NewSQLiteAPIKeyRepository() IAPIKey {
+	return &SQLiteAPIKeyRepository{}
+}
+
+const apiKeyColumns = "id, user_id, name, prefix, key_hash, scopes, expires_at, last_used_at, revoked_at, created_at"
+
+// CreateAPIKey inserts a new API key and returns it with ID
+func (r *SQLiteAPIKeyRepository) CreateAPIKey(key *models.APIKey) (*models.APIKey, error) {
+	query := `
+		INSERT INTO api_keys (user_id, name, prefix, key_hash, scopes, expires_at, created_at) 
+		VALUES (?, ?, ?, ?, ?, ?, CURRENT_TIMESTAMP)
+	`
+
+	var expiresAt interface{}
+	if key.ExpiresAt != nil {
+		expiresAt = key.ExpiresAt.UTC()
+	}
+
+	result, err := database.DB.Exec(query, key.UserID, key.Name, key.Prefix, key.KeyHash, strings.Join(key.Scopes, " "), expiresAt)
+	if err != nil {
+		return nil, err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+
+	key.ID = int(id)
+	key.CreatedAt = time.Now()
+	return key, nil
+}
+
+// GetAPIKeyByPrefix retrieves an API key by its public prefix
+func (r *SQLiteAPIKeyRepository) GetAPIKeyByPrefix(prefix string) (*models.APIKey, error) {
+	query := "SELECT " + apiKeyColumns + " FROM api_keys WHERE prefix = ?"
+	key, err := scanAPIKey(database.DB.QueryRow(query, prefix))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil // Key not found
+		}
+		return nil, err
+	}
+	return key, nil
+}
+
+// GetAPIKeysByUser retrieves all API keys of a user, including revoked ones
+func (r *SQLiteAPIKeyRepository) GetAPIKeysByUser(userID int) ([]*models.APIKey, error) {
+	query := "SELECT " + apiKeyColumns + " FROM api_keys WHERE user_id = ? ORDER BY created_at DESC, id DESC"
+	rows, err := database.DB.Query(query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := []*models.APIKey{}
+	for rows.Next() {
+		key, err := scanAPIKey(rows)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+
+	return keys, rows.Err()
+}
+
+// RevokeAPIKey revokes an API key of the user, returns false if no such active key exists
+func (r *SQLiteAPIKeyRepository) RevokeAPIKey(keyID int, userID int) (bool, error) {
+	result, err := database.DB.Exec("UPDATE api_keys SET revoked_at = ? WHERE id = ? AND user_id = ? AND revoked_at IS NULL", time.Now().UTC(), keyID, userID)
+	if err != nil {
+		return false, err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return affected == 1, nil
+}
+
+// RevokeUserAPIKeys revokes all active API keys of the user and returns the number of revoked keys
+func (r *SQLiteAPIKeyRepository) RevokeUserAPIKeys(userID int) (int64, error) {
+	result, err := database.DB.Exec("UPDATE api_keys SET revoked_at = ? WHERE user_id = ? AND revoked_at IS NULL", time.Now().UTC(), userID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// UpdateLastUsed records that an API key has just been used
+func (r *SQLiteAPIKeyRepository) UpdateLastUsed(keyID int) error {
+	_, err := database.DB.Exec("UPDATE api_keys SET last_used_at = ? WHERE id = ?", time.Now().UTC(), keyID)
+	return err
+}
+
+// scanAPIKey scans a row selected with apiKeyColumns
+func scanAPIKey(row interface{ Scan(...interface{}) error }) (*models.APIKey, error) {
+	var key models.APIKey
+	var scopes string
+	var expiresAt, lastUsedAt, revokedAt sql.NullTime
+	err := row.Scan(&key.ID, &key.UserID, &key.Name, &key.Prefix, &key.KeyHash, &scopes, &expiresAt, &lastUsedAt, &revokedAt, &key.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	key.Scopes = strings.Fields(scopes)
+	if expiresAt.Valid {
+		key.ExpiresAt = &expiresAt.Time
+	}
+	if lastUsedAt.Valid {
+		key.LastUsedAt = &lastUsedAt.Time
+	}
+	if revokedAt.Valid {
+		key.RevokedAt = &revokedAt.Time
+	}
+	return &key, nil
+}
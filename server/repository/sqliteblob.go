@@ -0,0 +1,97 @@
+package repository
+
+import (
+	"database/sql"
+	"elotuschallenge/database"
+	"elotuschallenge/models"
+)
+
+type SQLiteBlobRepository struct{}
+
+func NewSQLiteBlobRepository() IBlob {
+	return &SQLiteBlobRepository{}
+}
+
+const blobColumns = "sha256, size, storage_backend, storage_key, ref_count, created_at"
+
+// GetBlob retrieves a blob by its digest
+func (r *SQLiteBlobRepository) GetBlob(sha256 string) (*models.Blob, error) {
+	return queryBlob("SELECT "+blobColumns+" FROM blobs WHERE sha256 = ?", sha256)
+}
+
+// CreateBlob records stored content with one reference, content stored concurrently under the same digest
+// gets another reference instead and the blob recorded first is returned. checkContent runs before the
+// transaction commits and makes sure the content of the returned blob is in storage, the blob isn't recorded
+// when it fails.
+func (r *SQLiteBlobRepository) CreateBlob(blob *models.Blob, checkContent func(blob *models.Blob) error) (*models.Blob, error) {
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	query := `
+		INSERT INTO blobs (sha256, size, storage_backend, storage_key, ref_count, created_at)
+		VALUES (?, ?, ?, ?, 1, CURRENT_TIMESTAMP)
+		ON CONFLICT (sha256) DO UPDATE SET ref_count = ref_count + 1
+		RETURNING ` + blobColumns
+	created, err := scanBlob(tx.QueryRow(query, blob.SHA256, blob.Size, blob.StorageBackend, blob.StorageKey))
+	if err != nil {
+		return nil, err
+	}
+	if err := checkContent(created); err != nil {
+		return nil, err
+	}
+	return created, tx.Commit()
+}
+
+// AcquireBlob adds a reference to a blob, returns nil if there is no blob with the digest
+func (r *SQLiteBlobRepository) AcquireBlob(sha256 string) (*models.Blob, error) {
+	return queryBlob("UPDATE blobs SET ref_count = ref_count + 1 WHERE sha256 = ? RETURNING "+blobColumns, sha256)
+}
+
+// ReleaseBlob removes a reference from a blob and returns it with the references left, nil if there is no
+// blob with the digest. The blob is deleted with its last reference and removeContent is called before the
+// transaction commits, so no other process can start using the content while it is removed. Nothing changes
+// when removeContent fails.
+func (r *SQLiteBlobRepository) ReleaseBlob(sha256 string, removeContent func(blob *models.Blob) error) (*models.Blob, error) {
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	query := "UPDATE blobs SET ref_count = ref_count - 1 WHERE sha256 = ? AND ref_count > 0 RETURNING " + blobColumns
+	blob, err := scanBlob(tx.QueryRow(query, sha256))
+	if err != nil || blob == nil {
+		return nil, err
+	}
+
+	if blob.RefCount <= 0 {
+		if _, err := tx.Exec("DELETE FROM blobs WHERE sha256 = ?", sha256); err != nil {
+			return nil, err
+		}
+		if err := removeContent(blob); err != nil {
+			return nil, err
+		}
+	}
+	return blob, tx.Commit()
+}
+
+// queryBlob reads the blob of a query returning blobColumns, nil if there is no row
+func queryBlob(query string, args ...interface{}) (*models.Blob, error) {
+	return scanBlob(database.DB.QueryRow(query, args...))
+}
+
+// scanBlob scans a row of blobColumns, nil if there is no row
+func scanBlob(row interface{ Scan(...interface{}) error }) (*models.Blob, error) {
+	var blob models.Blob
+	err := row.Scan(&blob.SHA256, &blob.Size, &blob.StorageBackend, &blob.StorageKey, &blob.RefCount, &blob.CreatedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil // Blob not found
+		}
+		return nil, err
+	}
+	return &blob, nil
+}
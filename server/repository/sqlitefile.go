@@ -4,6 +4,10 @@ import (
 	"database/sql"
 	"elotuschallenge/database"
 	"elotuschallenge/models"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
 )
 
 type SQLiteFileRepository struct{}
@@ -15,11 +19,11 @@ func NewSQLiteFileRepository() IFile {
 // CreateFile inserts a new file metadata into the database
 func (r *SQLiteFileRepository) CreateFile(file *models.FileMetadata) (*models.FileMetadata, error) {
 	query := `
-		INSERT INTO files (filename, original_name, content_type, size, user_id, upload_path, user_agent, ip_address, created_at) 
-		VALUES (?, ?, ?, ?, ?, ?, ?, ?, CURRENT_TIMESTAMP)
+		INSERT INTO files (filename, original_name, content_type, size, user_id, storage_backend, storage_key, sha256, user_agent, ip_address, created_at) 
+		VALUES (?, ?, ?, ?, ?, ?, ?, NULLIF(?, ''), ?, ?, CURRENT_TIMESTAMP)
 	`
 
-	result, err := database.DB.Exec(query, file.Filename, file.OriginalName, file.ContentType, file.Size, file.UserID, file.UploadPath, file.UserAgent, file.IPAddress)
+	result, err := database.DB.Exec(query, file.Filename, file.OriginalName, file.ContentType, file.Size, file.UserID, file.StorageBackend, file.StorageKey, file.SHA256, file.UserAgent, file.IPAddress)
 	if err != nil {
 		return nil, err
 	}
@@ -33,38 +37,182 @@ func (r *SQLiteFileRepository) CreateFile(file *models.FileMetadata) (*models.Fi
 	return file, nil
 }
 
-// GetFileByID retrieves a file by its ID
+// GetFileByID retrieves a file by its ID, trashed files included
 func (r *SQLiteFileRepository) GetFileByID(fileID int) (*models.FileMetadata, error) {
-	query := "SELECT id, filename, original_name, content_type, size, user_id, upload_path, user_agent, ip_address, created_at FROM files WHERE id = ?"
-	var file models.FileMetadata
-	err := database.DB.QueryRow(query, fileID).Scan(&file.ID, &file.Filename, &file.OriginalName, &file.ContentType, &file.Size, &file.UserID, &file.UploadPath, &file.UserAgent, &file.IPAddress, &file.CreatedAt)
+	query := "SELECT " + fileColumns + " FROM files WHERE id = ?"
+	file, err := scanFile(database.DB.QueryRow(query, fileID))
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, nil // File not found
 		}
 		return nil, err
 	}
-	return &file, nil
+	return file, nil
 }
 
-// GetFilesByUser retrieves all files for a specific user
+// GetFilesByUser retrieves all files for a specific user, trashed files included
 func (r *SQLiteFileRepository) GetFilesByUser(userID int) ([]*models.FileMetadata, error) {
-	query := "SELECT id, filename, original_name, content_type, size, user_id, upload_path, user_agent, ip_address, created_at FROM files WHERE user_id = ? ORDER BY created_at DESC"
+	query := "SELECT " + fileColumns + " FROM files WHERE user_id = ? ORDER BY created_at DESC"
 	rows, err := database.DB.Query(query, userID)
 	if err != nil {
 		return nil, err
 	}
+	return scanFiles(rows)
+}
+
+// TrashFile moves a file of the user to the trash, it returns false if the user has no such file outside the trash
+func (r *SQLiteFileRepository) TrashFile(userID int, fileID int, now time.Time) (bool, error) {
+	result, err := database.DB.Exec("UPDATE files SET deleted_at = ? WHERE id = ? AND user_id = ? AND deleted_at IS NULL",
+		formatFileTime(now), fileID, userID)
+	if err != nil {
+		return false, err
+	}
+	affected, err := result.RowsAffected()
+	return affected > 0, err
+}
+
+// RestoreFile takes a file of the user out of the trash, it returns false if the user has no such file in the trash
+func (r *SQLiteFileRepository) RestoreFile(userID int, fileID int) (bool, error) {
+	result, err := database.DB.Exec("UPDATE files SET deleted_at = NULL WHERE id = ? AND user_id = ? AND deleted_at IS NOT NULL", fileID, userID)
+	if err != nil {
+		return false, err
+	}
+	affected, err := result.RowsAffected()
+	return affected > 0, err
+}
+
+// DeleteTrashedFile permanently deletes a file of the user from the trash and returns it so its content can be
+// removed, nil if the user has no such file in the trash
+func (r *SQLiteFileRepository) DeleteTrashedFile(userID int, fileID int) (*models.FileMetadata, error) {
+	query := "DELETE FROM files WHERE id = ? AND user_id = ? AND deleted_at IS NOT NULL RETURNING " + fileColumns
+	file, err := scanFile(database.DB.QueryRow(query, fileID, userID))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return file, nil
+}
+
+// DeleteFilesTrashedBefore permanently deletes the files trashed before the time and returns them so their content
+// can be removed
+func (r *SQLiteFileRepository) DeleteFilesTrashedBefore(before time.Time) ([]*models.FileMetadata, error) {
+	query := "DELETE FROM files WHERE deleted_at IS NOT NULL AND deleted_at < ? RETURNING " + fileColumns
+	rows, err := database.DB.Query(query, formatFileTime(before))
+	if err != nil {
+		return nil, err
+	}
+	return scanFiles(rows)
+}
+
+// fileSortColumns maps the sort fields of listings to their columns
+var fileSortColumns = map[string]string{
+	models.FileSortCreatedAt: "created_at",
+	models.FileSortSize:      "size",
+	models.FileSortName:      "original_name",
+}
+
+// ListFiles retrieves a page of the files of a user, filtered and sorted in SQL so the indexes on user_id
+// are used. Pages are continued after the cursor with the sort value and ID of the last file of the previous page.
+func (r *SQLiteFileRepository) ListFiles(query models.FileQuery) ([]*models.FileMetadata, error) {
+	column, ok := fileSortColumns[query.SortBy]
+	if !ok {
+		return nil, fmt.Errorf("unknown sort field %q", query.SortBy)
+	}
+
+	conditions := []string{"user_id = ?", "deleted_at IS NULL"}
+	if query.Trashed {
+		conditions[1] = "deleted_at IS NOT NULL"
+	}
+	args := []interface{}{query.UserID}
+	if query.ContentType != "" {
+		conditions = append(conditions, "content_type = ?")
+		args = append(args, query.ContentType)
+	}
+	if query.CreatedAfter != nil {
+		conditions = append(conditions, "created_at >= ?")
+		args = append(args, formatFileTime(*query.CreatedAfter))
+	}
+	if query.CreatedBefore != nil {
+		conditions = append(conditions, "created_at < ?")
+		args = append(args, formatFileTime(*query.CreatedBefore))
+	}
+	if query.NameContains != "" {
+		conditions = append(conditions, `original_name LIKE ? ESCAPE '\'`)
+		args = append(args, "%"+likeEscaper.Replace(query.NameContains)+"%")
+	}
+
+	direction, comparison := "ASC", ">"
+	if query.Descending {
+		direction, comparison = "DESC", "<"
+	}
+	if query.After != nil {
+		var value interface{} = query.After.Value
+		if query.SortBy == models.FileSortSize {
+			size, err := strconv.ParseInt(query.After.Value, 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid size cursor %q: %w", query.After.Value, err)
+			}
+			value = size
+		}
+		conditions = append(conditions, fmt.Sprintf("(%s %s ? OR (%s = ? AND id %s ?))", column, comparison, column, comparison))
+		args = append(args, value, value, query.After.ID)
+	}
+
+	sqlQuery := fmt.Sprintf("SELECT %s FROM files WHERE %s ORDER BY %s %s, id %s LIMIT ?",
+		fileColumns, strings.Join(conditions, " AND "), column, direction, direction)
+	args = append(args, query.Limit)
+
+	rows, err := database.DB.Query(sqlQuery, args...)
+	if err != nil {
+		return nil, err
+	}
+	return scanFiles(rows)
+}
+
+// likeEscaper escapes the wildcards of LIKE patterns so names are matched literally
+var likeEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+
+// FileTimeLayout is the layout of created_at, which is set to CURRENT_TIMESTAMP in UTC
+const FileTimeLayout = "2006-01-02 15:04:05"
+
+// formatFileTime formats a time to be compared with created_at
+func formatFileTime(t time.Time) string {
+	return t.UTC().Format(FileTimeLayout)
+}
+
+// fileColumns are the columns read by scanFile
+const fileColumns = "id, filename, original_name, content_type, size, user_id, storage_backend, storage_key, sha256, user_agent, ip_address, created_at, deleted_at"
+
+// scanFile reads a row of fileColumns
+func scanFile(row interface{ Scan(...interface{}) error }) (*models.FileMetadata, error) {
+	var file models.FileMetadata
+	var sha256 sql.NullString
+	var deletedAt sql.NullTime
+	err := row.Scan(&file.ID, &file.Filename, &file.OriginalName, &file.ContentType, &file.Size, &file.UserID, &file.StorageBackend, &file.StorageKey,
+		&sha256, &file.UserAgent, &file.IPAddress, &file.CreatedAt, &deletedAt)
+	if err != nil {
+		return nil, err
+	}
+	file.SHA256 = sha256.String
+	if deletedAt.Valid {
+		file.DeletedAt = &deletedAt.Time
+	}
+	return &file, nil
+}
+
+// scanFiles reads and closes rows of fileColumns
+func scanFiles(rows *sql.Rows) ([]*models.FileMetadata, error) {
 	defer rows.Close()
 
 	var files []*models.FileMetadata
 	for rows.Next() {
-		var file models.FileMetadata
-		err := rows.Scan(&file.ID, &file.Filename, &file.OriginalName, &file.ContentType, &file.Size, &file.UserID, &file.UploadPath, &file.UserAgent, &file.IPAddress, &file.CreatedAt)
+		file, err := scanFile(rows)
 		if err != nil {
 			return nil, err
 		}
-		files = append(files, &file)
+		files = append(files, file)
 	}
-
-	return files, nil
+	return files, rows.Err()
 }
@@ -0,0 +1,76 @@
+package repository
+
+import (
+	"database/sql"
+	"elotuschallenge/database"
+	"elotuschallenge/models"
+	"time"
+)
+
+type SQLiteLoginAttemptRepository struct{}
+
+func NewSQLiteLoginAttemptRepository() ILoginAttempt {
+	return &SQLiteLoginAttemptRepository{}
+}
+
+// GetLoginAttempt retrieves the failed login counter of a key, nil when there are no failures
+func (r *SQLiteLoginAttemptRepository) GetLoginAttempt(key string) (*models.LoginAttempt, error) {
+	query := "SELECT attempt_key, failures, last_failure_at, locked_until FROM login_attempts WHERE attempt_key = ?"
+
+	attempt := &models.LoginAttempt{}
+	var lockedUntil sql.NullTime
+	err := database.DB.QueryRow(query, key).Scan(&attempt.Key, &attempt.Failures, &attempt.LastFailureAt, &lockedUntil)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+	if lockedUntil.Valid {
+		attempt.LockedUntil = &lockedUntil.Time
+	}
+	return attempt, nil
+}
+
+// RecordFailure increments the failure counter atomically and returns the new count.
+// Counters whose last failure is before windowStart restart from one.
+func (r *SQLiteLoginAttemptRepository) RecordFailure(key string, now time.Time, windowStart time.Time) (int, error) {
+	query := `
+		INSERT INTO login_attempts (attempt_key, failures, last_failure_at)
+		VALUES (?, 1, ?)
+		ON CONFLICT(attempt_key) DO UPDATE SET
+			failures = CASE WHEN last_failure_at < ? THEN 1 ELSE failures + 1 END,
+			last_failure_at = excluded.last_failure_at
+		RETURNING failures
+	`
+
+	var failures int
+	err := database.DB.QueryRow(query, key, now.UTC(), windowStart.UTC()).Scan(&failures)
+	return failures, err
+}
+
+// LockUntil locks the key until the given time
+func (r *SQLiteLoginAttemptRepository) LockUntil(key string, lockedUntil time.Time) error {
+	_, err := database.DB.Exec("UPDATE login_attempts SET locked_until = ? WHERE attempt_key = ?", lockedUntil.UTC(), key)
+	return err
+}
+
+// DeleteLoginAttempt clears the failures and lock of a key
+func (r *SQLiteLoginAttemptRepository) DeleteLoginAttempt(key string) error {
+	_, err := database.DB.Exec("DELETE FROM login_attempts WHERE attempt_key = ?", key)
+	return err
+}
+
+// DeleteStaleLoginAttempts removes counters outside the failure window which are no longer locked
+func (r *SQLiteLoginAttemptRepository) DeleteStaleLoginAttempts(now time.Time, windowStart time.Time) (int64, error) {
+	query := `
+		DELETE FROM login_attempts
+		WHERE last_failure_at < ? AND (locked_until IS NULL OR locked_until <= ?)
+	`
+
+	result, err := database.DB.Exec(query, windowStart.UTC(), now.UTC())
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
@@ -0,0 +1,169 @@
+package repository
+
+import (
+	"database/sql"
+	"elotuschallenge/database"
+	"elotuschallenge/models"
+)
+
+type SQLiteMFARepository struct{}
+
+const totpColumns = "user_id, secret, enabled_at, last_used_step, created_at"
+
+func NewSQLiteMFARepository() IMFA {
+	return &SQLiteMFARepository{}
+}
+
+// GetTOTPSecret retrieves the TOTP enrollment of a user, nil when the user never enrolled
+func (r *SQLiteMFARepository) GetTOTPSecret(userID int) (*models.TOTPSecret, error) {
+	query := "SELECT " + totpColumns + " FROM totp_secrets WHERE user_id = ?"
+
+	secret, err := scanTOTPSecret(database.DB.QueryRow(query, userID))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return secret, nil
+}
+
+// GetTOTPSecrets lists the TOTP enrollments of all users
+func (r *SQLiteMFARepository) GetTOTPSecrets() ([]*models.TOTPSecret, error) {
+	rows, err := database.DB.Query("SELECT " + totpColumns + " FROM totp_secrets ORDER BY user_id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	secrets := []*models.TOTPSecret{}
+	for rows.Next() {
+		secret, err := scanTOTPSecret(rows)
+		if err != nil {
+			return nil, err
+		}
+		secrets = append(secrets, secret)
+	}
+	return secrets, rows.Err()
+}
+
+// SaveTOTPSecret stores a new secret waiting for confirmation, replacing a previous unconfirmed one
+func (r *SQLiteMFARepository) SaveTOTPSecret(userID int, secret string) error {
+	query := `
+		INSERT INTO totp_secrets (user_id, secret, created_at)
+		VALUES (?, ?, CURRENT_TIMESTAMP)
+		ON CONFLICT(user_id) DO UPDATE SET
+			secret = excluded.secret,
+			enabled_at = NULL,
+			last_used_step = 0,
+			created_at = CURRENT_TIMESTAMP
+	`
+
+	_, err := database.DB.Exec(query, userID, secret)
+	return err
+}
+
+// UpdateTOTPSecret replaces the stored form of the secret, e.g. once encrypted, keeping the enrollment state
+func (r *SQLiteMFARepository) UpdateTOTPSecret(userID int, secret string) error {
+	_, err := database.DB.Exec("UPDATE totp_secrets SET secret = ? WHERE user_id = ?", secret, userID)
+	return err
+}
+
+// DeleteTOTP removes the TOTP secret and the recovery codes of the user in one transaction,
+// returns false if the user has no secret
+func (r *SQLiteMFARepository) DeleteTOTP(userID int) (bool, error) {
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec("DELETE FROM totp_secrets WHERE user_id = ?", userID)
+	if err != nil {
+		return false, err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	if _, err := tx.Exec("DELETE FROM mfa_recovery_codes WHERE user_id = ?", userID); err != nil {
+		return false, err
+	}
+	return affected == 1, tx.Commit()
+}
+
+// EnableTOTP marks the secret of the user as confirmed
+func (r *SQLiteMFARepository) EnableTOTP(userID int) error {
+	_, err := database.DB.Exec("UPDATE totp_secrets SET enabled_at = CURRENT_TIMESTAMP WHERE user_id = ?", userID)
+	return err
+}
+
+// UpdateTOTPLastUsedStep records the time step of a used code, returns false if a code of
+// this or a later step was already used
+func (r *SQLiteMFARepository) UpdateTOTPLastUsedStep(userID int, step int64) (bool, error) {
+	result, err := database.DB.Exec("UPDATE totp_secrets SET last_used_step = ? WHERE user_id = ? AND last_used_step < ?", step, userID, step)
+	if err != nil {
+		return false, err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return affected == 1, nil
+}
+
+// ReplaceRecoveryCodes removes the recovery codes of a user and stores the new ones
+func (r *SQLiteMFARepository) ReplaceRecoveryCodes(userID int, codeHashes []string) error {
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("DELETE FROM mfa_recovery_codes WHERE user_id = ?", userID); err != nil {
+		return err
+	}
+	for _, codeHash := range codeHashes {
+		if _, err := tx.Exec("INSERT INTO mfa_recovery_codes (user_id, code_hash) VALUES (?, ?)", userID, codeHash); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// UseRecoveryCode marks an unused recovery code of the user as used, returns false if there is none
+func (r *SQLiteMFARepository) UseRecoveryCode(userID int, codeHash string) (bool, error) {
+	query := `
+		UPDATE mfa_recovery_codes SET used_at = CURRENT_TIMESTAMP
+		WHERE id = (SELECT id FROM mfa_recovery_codes WHERE user_id = ? AND code_hash = ? AND used_at IS NULL LIMIT 1)
+	`
+	result, err := database.DB.Exec(query, userID, codeHash)
+	if err != nil {
+		return false, err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return affected == 1, nil
+}
+
+// CountRecoveryCodes returns the number of unused recovery codes of the user
+func (r *SQLiteMFARepository) CountRecoveryCodes(userID int) (int, error) {
+	var count int
+	err := database.DB.QueryRow("SELECT COUNT(*) FROM mfa_recovery_codes WHERE user_id = ? AND used_at IS NULL", userID).Scan(&count)
+	return count, err
+}
+
+// scanTOTPSecret scans a row of totpColumns
+func scanTOTPSecret(row interface{ Scan(...interface{}) error }) (*models.TOTPSecret, error) {
+	secret := &models.TOTPSecret{}
+	var enabledAt sql.NullTime
+	if err := row.Scan(&secret.UserID, &secret.Secret, &enabledAt, &secret.LastUsedStep, &secret.CreatedAt); err != nil {
+		return nil, err
+	}
+	if enabledAt.Valid {
+		secret.EnabledAt = &enabledAt.Time
+	}
+	return secret, nil
+}
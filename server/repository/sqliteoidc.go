@@ -0,0 +1,133 @@
+package repository
+
+import (
+	"database/sql"
+	"elotuschallenge/database"
+	"elotuschallenge/models"
+	"time"
+)
+
+type SQLiteOIDCRepository struct{}
+
+func NewSQLiteOIDCRepository() IOIDC {
+	return &SQLiteOIDCRepository{}
+}
+
+// CreateState stores a pending OpenID Connect login
+func (r *SQLiteOIDCRepository) CreateState(state *models.OIDCState) error {
+	query := `
+		INSERT INTO oidc_states (state_hash, provider, code_verifier, nonce, use_cookies, expires_at, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, CURRENT_TIMESTAMP)
+	`
+
+	_, err := database.DB.Exec(query, state.StateHash, state.Provider, state.CodeVerifier, state.Nonce, state.UseCookies,
+		state.ExpiresAt.UTC())
+	return err
+}
+
+// ConsumeState deletes a pending login and returns it, nil when not found so a state can only be used once
+func (r *SQLiteOIDCRepository) ConsumeState(stateHash string) (*models.OIDCState, error) {
+	query := `
+		DELETE FROM oidc_states WHERE state_hash = ?
+		RETURNING state_hash, provider, code_verifier, nonce, use_cookies, expires_at, created_at
+	`
+
+	state := &models.OIDCState{}
+	err := database.DB.QueryRow(query, stateHash).Scan(&state.StateHash, &state.Provider, &state.CodeVerifier, &state.Nonce,
+		&state.UseCookies, &state.ExpiresAt, &state.CreatedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return state, nil
+}
+
+// DeleteExpiredStates removes abandoned logins and returns the number of deleted rows
+func (r *SQLiteOIDCRepository) DeleteExpiredStates(now time.Time) (int64, error) {
+	result, err := database.DB.Exec("DELETE FROM oidc_states WHERE expires_at <= ?", now.UTC())
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// GetIdentity retrieves the identity of a provider account, nil when it isn't linked to a user
+func (r *SQLiteOIDCRepository) GetIdentity(issuer, subject string) (*models.UserIdentity, error) {
+	query := "SELECT id, user_id, issuer, subject, email, created_at FROM user_identities WHERE issuer = ? AND subject = ?"
+
+	identity := &models.UserIdentity{}
+	var email sql.NullString
+	err := database.DB.QueryRow(query, issuer, subject).Scan(&identity.ID, &identity.UserID, &identity.Issuer, &identity.Subject,
+		&email, &identity.CreatedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+	identity.Email = email.String
+	return identity, nil
+}
+
+// CreateUserWithIdentity creates a user linked to a provider account in one transaction and returns the user
+// with ID. It returns nil and creates nothing when the provider account is already linked, e.g. by a concurrent
+// first sign in.
+func (r *SQLiteOIDCRepository) CreateUserWithIdentity(user *models.User, identity *models.UserIdentity) (*models.User, error) {
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	err = tx.QueryRow(`
+		INSERT INTO users (username, password_hash, role, status, created_at)
+		VALUES (?, ?, ?, ?, CURRENT_TIMESTAMP)
+		RETURNING id
+	`, user.Username, user.PasswordHash, user.Role, user.Status).Scan(&user.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.QueryRow(`
+		INSERT INTO user_identities (user_id, issuer, subject, email, created_at)
+		VALUES (?, ?, ?, ?, CURRENT_TIMESTAMP)
+		ON CONFLICT (issuer, subject) DO NOTHING
+		RETURNING id
+	`, user.ID, identity.Issuer, identity.Subject, identity.Email).Scan(&identity.ID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+	identity.UserID = user.ID
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// GetUserIdentities lists the provider accounts linked to a user
+func (r *SQLiteOIDCRepository) GetUserIdentities(userID int) ([]*models.UserIdentity, error) {
+	query := "SELECT id, user_id, issuer, subject, email, created_at FROM user_identities WHERE user_id = ? ORDER BY id"
+	rows, err := database.DB.Query(query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	identities := []*models.UserIdentity{}
+	for rows.Next() {
+		identity := &models.UserIdentity{}
+		var email sql.NullString
+		if err := rows.Scan(&identity.ID, &identity.UserID, &identity.Issuer, &identity.Subject, &email, &identity.CreatedAt); err != nil {
+			return nil, err
+		}
+		identity.Email = email.String
+		identities = append(identities, identity)
+	}
+	return identities, rows.Err()
+}
@@ -0,0 +1,59 @@
+package repository
+
+import (
+	"database/sql"
+	"elotuschallenge/database"
+	"elotuschallenge/models"
+)
+
+type SQLiteOutboxRepository struct{}
+
+func NewSQLiteOutboxRepository() IOutbox {
+	return &SQLiteOutboxRepository{}
+}
+
+// CreateNotification appends a notification to the outbox
+func (r *SQLiteOutboxRepository) CreateNotification(notification *models.Notification) (*models.Notification, error) {
+	query := `
+		INSERT INTO outbox (recipient, kind, subject, body, created_at)
+		VALUES (?, ?, ?, ?, CURRENT_TIMESTAMP)
+	`
+
+	result, err := database.DB.Exec(query, notification.Recipient, notification.Kind, notification.Subject, notification.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+
+	notification.ID = int(id)
+	return notification, nil
+}
+
+// GetNotificationsByRecipient retrieves the notifications of a recipient, oldest first
+func (r *SQLiteOutboxRepository) GetNotificationsByRecipient(recipient string) ([]*models.Notification, error) {
+	query := "SELECT id, recipient, kind, subject, body, created_at, sent_at FROM outbox WHERE recipient = ? ORDER BY id"
+	rows, err := database.DB.Query(query, recipient)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	notifications := []*models.Notification{}
+	for rows.Next() {
+		notification := &models.Notification{}
+		var sentAt sql.NullTime
+		if err := rows.Scan(&notification.ID, &notification.Recipient, &notification.Kind, &notification.Subject,
+			&notification.Body, &notification.CreatedAt, &sentAt); err != nil {
+			return nil, err
+		}
+		if sentAt.Valid {
+			notification.SentAt = &sentAt.Time
+		}
+		notifications = append(notifications, notification)
+	}
+	return notifications, rows.Err()
+}
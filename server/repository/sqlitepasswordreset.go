@@ -0,0 +1,82 @@
+package repository
+
+import (
+	"database/sql"
+	"elotuschallenge/database"
+	"elotuschallenge/models"
+	"time"
+)
+
+type SQLitePasswordResetRepository struct{}
+
+func NewSQLitePasswordResetRepository() IPasswordReset {
+	return &SQLitePasswordResetRepository{}
+}
+
+// CreateResetToken inserts a new reset token and returns it with ID
+func (r *SQLitePasswordResetRepository) CreateResetToken(token *models.PasswordResetToken) (*models.PasswordResetToken, error) {
+	query := `
+		INSERT INTO password_reset_tokens (user_id, token_hash, expires_at, created_at)
+		VALUES (?, ?, ?, CURRENT_TIMESTAMP)
+	`
+
+	result, err := database.DB.Exec(query, token.UserID, token.TokenHash, token.ExpiresAt.UTC())
+	if err != nil {
+		return nil, err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+
+	token.ID = int(id)
+	return token, nil
+}
+
+// GetResetTokenByHash retrieves a reset token by its hash, nil when not found
+func (r *SQLitePasswordResetRepository) GetResetTokenByHash(tokenHash string) (*models.PasswordResetToken, error) {
+	query := "SELECT id, user_id, token_hash, expires_at, used_at, created_at FROM password_reset_tokens WHERE token_hash = ?"
+
+	token := &models.PasswordResetToken{}
+	var usedAt sql.NullTime
+	err := database.DB.QueryRow(query, tokenHash).Scan(&token.ID, &token.UserID, &token.TokenHash, &token.ExpiresAt, &usedAt, &token.CreatedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+	if usedAt.Valid {
+		token.UsedAt = &usedAt.Time
+	}
+	return token, nil
+}
+
+// MarkResetTokenUsed marks an unused token as used, returns false if it was already used
+func (r *SQLitePasswordResetRepository) MarkResetTokenUsed(id int) (bool, error) {
+	result, err := database.DB.Exec("UPDATE password_reset_tokens SET used_at = CURRENT_TIMESTAMP WHERE id = ? AND used_at IS NULL", id)
+	if err != nil {
+		return false, err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return affected == 1, nil
+}
+
+// DeleteUserResetTokens removes all reset tokens of a user
+func (r *SQLitePasswordResetRepository) DeleteUserResetTokens(userID int) error {
+	_, err := database.DB.Exec("DELETE FROM password_reset_tokens WHERE user_id = ?", userID)
+	return err
+}
+
+// DeleteExpiredResetTokens removes expired reset tokens and returns the number of deleted rows
+func (r *SQLitePasswordResetRepository) DeleteExpiredResetTokens(now time.Time) (int64, error) {
+	result, err := database.DB.Exec("DELETE FROM password_reset_tokens WHERE expires_at <= ?", now.UTC())
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
@@ -0,0 +1,90 @@
+package repository
+
+import (
+	"database/sql"
+	"elotuschallenge/database"
+	"elotuschallenge/models"
+	"time"
+)
+
+type SQLiteRefreshTokenRepository struct{}
+
+func NewSQLiteRefreshTokenRepository() IRefreshToken {
+	return &SQLiteRefreshTokenRepository{}
+}
+
+// CreateRefreshToken inserts a new refresh token and returns it with ID
+func (r *SQLiteRefreshTokenRepository) CreateRefreshToken(token *models.RefreshToken) (*models.RefreshToken, error) {
+	query := `
+		INSERT INTO refresh_tokens (token_hash, family_id, user_id, expires_at, created_at) 
+		VALUES (?, ?, ?, ?, CURRENT_TIMESTAMP)
+	`
+
+	result, err := database.DB.Exec(query, token.TokenHash, token.FamilyID, token.UserID, token.ExpiresAt.UTC())
+	if err != nil {
+		return nil, err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+
+	token.ID = int(id)
+	return token, nil
+}
+
+// GetRefreshTokenByHash retrieves a refresh token by its hash
+func (r *SQLiteRefreshTokenRepository) GetRefreshTokenByHash(tokenHash string) (*models.RefreshToken, error) {
+	query := "SELECT id, token_hash, family_id, user_id, expires_at, used_at, revoked_at, created_at FROM refresh_tokens WHERE token_hash = ?"
+	var token models.RefreshToken
+	var usedAt, revokedAt sql.NullTime
+	err := database.DB.QueryRow(query, tokenHash).Scan(&token.ID, &token.TokenHash, &token.FamilyID, &token.UserID, &token.ExpiresAt, &usedAt, &revokedAt, &token.CreatedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil // Token not found
+		}
+		return nil, err
+	}
+	if usedAt.Valid {
+		token.UsedAt = &usedAt.Time
+	}
+	if revokedAt.Valid {
+		token.RevokedAt = &revokedAt.Time
+	}
+	return &token, nil
+}
+
+// MarkRefreshTokenUsed marks a token as used, returns false if it was already used by someone else
+func (r *SQLiteRefreshTokenRepository) MarkRefreshTokenUsed(tokenID int) (bool, error) {
+	result, err := database.DB.Exec("UPDATE refresh_tokens SET used_at = ? WHERE id = ? AND used_at IS NULL", time.Now().UTC(), tokenID)
+	if err != nil {
+		return false, err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return affected == 1, nil
+}
+
+// RevokeFamily revokes every refresh token which descends from the same login
+func (r *SQLiteRefreshTokenRepository) RevokeFamily(familyID string) error {
+	_, err := database.DB.Exec("UPDATE refresh_tokens SET revoked_at = ? WHERE family_id = ? AND revoked_at IS NULL", time.Now().UTC(), familyID)
+	return err
+}
+
+// RevokeUserRefreshTokens revokes all refresh tokens of a user
+func (r *SQLiteRefreshTokenRepository) RevokeUserRefreshTokens(userID int) error {
+	_, err := database.DB.Exec("UPDATE refresh_tokens SET revoked_at = ? WHERE user_id = ? AND revoked_at IS NULL", time.Now().UTC(), userID)
+	return err
+}
+
+// DeleteExpiredRefreshTokens removes expired refresh tokens and returns the number of deleted rows
+func (r *SQLiteRefreshTokenRepository) DeleteExpiredRefreshTokens(now time.Time) (int64, error) {
+	result, err := database.DB.Exec("DELETE FROM refresh_tokens WHERE expires_at <= ?", now.UTC())
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
@@ -0,0 +1,44 @@
+package repository
+
+import (
+	"elotuschallenge/database"
+	"time"
+)
+
+type SQLiteRevokedTokenRepository struct{}
+
+func NewSQLiteRevokedTokenRepository() IRevokedToken {
+	return &SQLiteRevokedTokenRepository{}
+}
+
+// RevokeToken stores the token hash until the token would have expired anyway
+func (r *SQLiteRevokedTokenRepository) RevokeToken(tokenHash string, expiresAt time.Time) error {
+	query := `
+		INSERT INTO revoked_tokens (token_hash, revoked_at, expires_at) 
+		VALUES (?, CURRENT_TIMESTAMP, ?)
+		ON CONFLICT(token_hash) DO NOTHING
+	`
+
+	_, err := database.DB.Exec(query, tokenHash, expiresAt.UTC())
+	return err
+}
+
+// IsTokenRevoked checks if a token hash has been revoked
+func (r *SQLiteRevokedTokenRepository) IsTokenRevoked(tokenHash string) (bool, error) {
+	query := "SELECT COUNT(*) FROM revoked_tokens WHERE token_hash = ?"
+	var count int
+	err := database.DB.QueryRow(query, tokenHash).Scan(&count)
+	if err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// DeleteExpiredTokens removes revoked tokens which have already expired and returns the number of deleted rows
+func (r *SQLiteRevokedTokenRepository) DeleteExpiredTokens(now time.Time) (int64, error) {
+	result, err := database.DB.Exec("DELETE FROM revoked_tokens WHERE expires_at <= ?", now.UTC())
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
@@ -0,0 +1,133 @@
+package repository
+
+import (
+	"database/sql"
+	"elotuschallenge/database"
+	"elotuschallenge/models"
+	"time"
+)
+
+type SQLiteSessionRepository struct{}
+
+func NewSQLiteSessionRepository() ISession {
+	return &SQLiteSessionRepository{}
+}
+
+const sessionColumns = "id, user_id, token_id, user_agent, ip_address, expires_at, revoked_at, last_seen_at, created_at"
+
+// SaveSession creates a session or records a new token in it, returns false when the session exists but was
+// revoked or belongs to another user so it isn't brought back
+func (r *SQLiteSessionRepository) SaveSession(session *models.Session) (bool, error) {
+	query := `
+		INSERT INTO sessions (id, user_id, token_id, user_agent, ip_address, expires_at, last_seen_at, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, CURRENT_TIMESTAMP)
+		ON CONFLICT (id) DO UPDATE SET
+			token_id = excluded.token_id,
+			user_agent = excluded.user_agent,
+			ip_address = excluded.ip_address,
+			expires_at = excluded.expires_at,
+			last_seen_at = excluded.last_seen_at
+		WHERE sessions.user_id = excluded.user_id AND sessions.revoked_at IS NULL
+	`
+
+	result, err := database.DB.Exec(query, session.ID, session.UserID, session.TokenID, session.UserAgent, session.IPAddress,
+		session.ExpiresAt.UTC(), session.LastSeenAt.UTC())
+	if err != nil {
+		return false, err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return affected == 1, nil
+}
+
+// GetSession retrieves a session by its ID
+func (r *SQLiteSessionRepository) GetSession(sessionID string) (*models.Session, error) {
+	query := "SELECT " + sessionColumns + " FROM sessions WHERE id = ?"
+	session, err := scanSession(database.DB.QueryRow(query, sessionID))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil // Session not found
+		}
+		return nil, err
+	}
+	return session, nil
+}
+
+// GetActiveUserSessions lists the sessions of a user which are neither revoked nor expired, most recently used first
+func (r *SQLiteSessionRepository) GetActiveUserSessions(userID int, now time.Time) ([]*models.Session, error) {
+	query := "SELECT " + sessionColumns + ` FROM sessions
+		WHERE user_id = ? AND revoked_at IS NULL AND expires_at > ?
+		ORDER BY last_seen_at DESC, created_at DESC`
+
+	rows, err := database.DB.Query(query, userID, now.UTC())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sessions := []*models.Session{}
+	for rows.Next() {
+		session, err := scanSession(rows)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, session)
+	}
+	return sessions, rows.Err()
+}
+
+// TouchSession records the activity of a session, sessions seen since seenBefore are left alone to save writes
+func (r *SQLiteSessionRepository) TouchSession(sessionID, userAgent, ipAddress string, now, seenBefore time.Time) error {
+	query := "UPDATE sessions SET last_seen_at = ?, user_agent = ?, ip_address = ? WHERE id = ? AND last_seen_at < ?"
+	_, err := database.DB.Exec(query, now.UTC(), userAgent, ipAddress, sessionID, seenBefore.UTC())
+	return err
+}
+
+// RevokeSession revokes a session of the user, returns false when the user has no such active session
+func (r *SQLiteSessionRepository) RevokeSession(userID int, sessionID string) (bool, error) {
+	result, err := database.DB.Exec("UPDATE sessions SET revoked_at = ? WHERE id = ? AND user_id = ? AND revoked_at IS NULL",
+		time.Now().UTC(), sessionID, userID)
+	if err != nil {
+		return false, err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return affected == 1, nil
+}
+
+// RevokeUserSessions revokes all sessions of a user
+func (r *SQLiteSessionRepository) RevokeUserSessions(userID int) error {
+	_, err := database.DB.Exec("UPDATE sessions SET revoked_at = ? WHERE user_id = ? AND revoked_at IS NULL", time.Now().UTC(), userID)
+	return err
+}
+
+// DeleteExpiredSessions removes sessions which have expired and returns the number of deleted rows
+func (r *SQLiteSessionRepository) DeleteExpiredSessions(now time.Time) (int64, error) {
+	result, err := database.DB.Exec("DELETE FROM sessions WHERE expires_at <= ?", now.UTC())
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// scanSession reads a session row selected with sessionColumns
+func scanSession(row interface{ Scan(...interface{}) error }) (*models.Session, error) {
+	session := &models.Session{}
+	var userAgent, ipAddress sql.NullString
+	var revokedAt sql.NullTime
+	err := row.Scan(&session.ID, &session.UserID, &session.TokenID, &userAgent, &ipAddress, &session.ExpiresAt, &revokedAt,
+		&session.LastSeenAt, &session.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	session.UserAgent = userAgent.String
+	session.IPAddress = ipAddress.String
+	if revokedAt.Valid {
+		session.RevokedAt = &revokedAt.Time
+	}
+	return session, nil
+}
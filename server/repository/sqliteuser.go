@@ -12,14 +12,23 @@ func NewSQLiteUserRepository() IUser {
 	return &SQLiteUserRepository{}
 }
 
+const userColumns = "id, username, password_hash, role, status, token_version, created_at"
+
 // CreateUser inserts a new user into the database and returns the user with ID
 func (r *SQLiteUserRepository) CreateUser(user *models.User) (*models.User, error) {
 	query := `
-		INSERT INTO users (username, password_hash, created_at) 
-		VALUES (?, ?, CURRENT_TIMESTAMP)
+		INSERT INTO users (username, password_hash, role, status, created_at) 
+		VALUES (?, ?, ?, ?, CURRENT_TIMESTAMP)
 	`
 
-	result, err := database.DB.Exec(query, user.Username, user.PasswordHash)
+	if user.Role == "" {
+		user.Role = models.RoleUser
+	}
+	if user.Status == "" {
+		user.Status = models.StatusActive
+	}
+
+	result, err := database.DB.Exec(query, user.Username, user.PasswordHash, user.Role, user.Status)
 	if err != nil {
 		return nil, err
 	}
@@ -46,14 +55,133 @@ func (r *SQLiteUserRepository) UserExists(username string) (bool, error) {
 
 // GetUserByUsername retrieves a user by username
 func (r *SQLiteUserRepository) GetUserByUsername(username string) (*models.User, error) {
-	query := "SELECT id, username, password_hash FROM users WHERE username = ?"
-	var user models.User
-	err := database.DB.QueryRow(query, username).Scan(&user.ID, &user.Username, &user.PasswordHash)
+	query := "SELECT " + userColumns + " FROM users WHERE username = ?"
+	user, err := scanUser(database.DB.QueryRow(query, username))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil // User not found
+		}
+		return nil, err
+	}
+	return user, nil
+}
+
+// GetUserByID retrieves a user by ID
+func (r *SQLiteUserRepository) GetUserByID(userID int) (*models.User, error) {
+	query := "SELECT " + userColumns + " FROM users WHERE id = ?"
+	user, err := scanUser(database.DB.QueryRow(query, userID))
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, nil // User not found
 		}
 		return nil, err
 	}
+	return user, nil
+}
+
+// GetUsers retrieves all users ordered by ID
+func (r *SQLiteUserRepository) GetUsers() ([]*models.User, error) {
+	rows, err := database.DB.Query("SELECT " + userColumns + " FROM users ORDER BY id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	users := []*models.User{}
+	for rows.Next() {
+		user, err := scanUser(rows)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, user)
+	}
+	return users, rows.Err()
+}
+
+// UpdateUserRole changes the role of a user, returns false if the user doesn't exist
+func (r *SQLiteUserRepository) UpdateUserRole(userID int, role string) (bool, error) {
+	result, err := database.DB.Exec("UPDATE users SET role = ? WHERE id = ?", role, userID)
+	if err != nil {
+		return false, err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return affected == 1, nil
+}
+
+// scanUser scans a row selected with userColumns
+func scanUser(row interface{ Scan(...interface{}) error }) (*models.User, error) {
+	var user models.User
+	err := row.Scan(&user.ID, &user.Username, &user.PasswordHash, &user.Role, &user.Status, &user.TokenVersion, &user.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
 	return &user, nil
 }
+
+// UpdatePasswordHash replaces the password hash of a user
+func (r *SQLiteUserRepository) UpdatePasswordHash(userID int, passwordHash string) error {
+	_, err := database.DB.Exec("UPDATE users SET password_hash = ? WHERE id = ?", passwordHash, userID)
+	return err
+}
+
+// IncrementTokenVersion invalidates all tokens of the user issued with the previous version
+func (r *SQLiteUserRepository) IncrementTokenVersion(userID int) (int, error) {
+	var version int
+	err := database.DB.QueryRow("UPDATE users SET token_version = token_version + 1 WHERE id = ? RETURNING token_version", userID).Scan(&version)
+	return version, err
+}
+
+// UpdateUserStatus changes the account status of a user, returns false if the user doesn't exist
+func (r *SQLiteUserRepository) UpdateUserStatus(userID int, status string) (bool, error) {
+	result, err := database.DB.Exec("UPDATE users SET status = ? WHERE id = ?", status, userID)
+	if err != nil {
+		return false, err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return affected == 1, nil
+}
+
+// userOwnedTables lists the tables with rows belonging to a user, deleted along with the user since the
+// foreign keys don't cascade
+var userOwnedTables = []string{"files", "refresh_tokens", "api_keys", "password_reset_tokens", "verification_tokens",
+	"totp_secrets", "mfa_recovery_codes", "user_identities", "sessions"}
+
+// DeleteUser deletes a user together with all rows belonging to them in one transaction,
+// returns false if the user doesn't exist
+func (r *SQLiteUserRepository) DeleteUser(userID int) (bool, error) {
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	var username string
+	err = tx.QueryRow("DELETE FROM users WHERE id = ? RETURNING username", userID).Scan(&username)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return false, nil
+		}
+		return false, err
+	}
+
+	for _, table := range userOwnedTables {
+		if _, err := tx.Exec("DELETE FROM "+table+" WHERE user_id = ?", userID); err != nil {
+			return false, err
+		}
+	}
+
+	// Messages and failed login counters are keyed by username
+	if _, err := tx.Exec("DELETE FROM outbox WHERE recipient = ?", username); err != nil {
+		return false, err
+	}
+	if _, err := tx.Exec("DELETE FROM login_attempts WHERE attempt_key = ?", "user:"+username); err != nil {
+		return false, err
+	}
+	return true, tx.Commit()
+}
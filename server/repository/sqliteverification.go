@@ -0,0 +1,82 @@
+package repository
+
+import (
+	"database/sql"
+	"elotuschallenge/database"
+	"elotuschallenge/models"
+	"time"
+)
+
+type SQLiteVerificationRepository struct{}
+
+func NewSQLiteVerificationRepository() IVerification {
+	return &SQLiteVerificationRepository{}
+}
+
+// CreateVerificationToken inserts a new verification token and returns it with ID
+func (r *SQLiteVerificationRepository) CreateVerificationToken(token *models.VerificationToken) (*models.VerificationToken, error) {
+	query := `
+		INSERT INTO verification_tokens (user_id, token_hash, expires_at, created_at)
+		VALUES (?, ?, ?, CURRENT_TIMESTAMP)
+	`
+
+	result, err := database.DB.Exec(query, token.UserID, token.TokenHash, token.ExpiresAt.UTC())
+	if err != nil {
+		return nil, err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+
+	token.ID = int(id)
+	return token, nil
+}
+
+// GetVerificationTokenByHash retrieves a verification token by its hash, nil when not found
+func (r *SQLiteVerificationRepository) GetVerificationTokenByHash(tokenHash string) (*models.VerificationToken, error) {
+	query := "SELECT id, user_id, token_hash, expires_at, used_at, created_at FROM verification_tokens WHERE token_hash = ?"
+
+	token := &models.VerificationToken{}
+	var usedAt sql.NullTime
+	err := database.DB.QueryRow(query, tokenHash).Scan(&token.ID, &token.UserID, &token.TokenHash, &token.ExpiresAt, &usedAt, &token.CreatedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+	if usedAt.Valid {
+		token.UsedAt = &usedAt.Time
+	}
+	return token, nil
+}
+
+// MarkVerificationTokenUsed marks an unused token as used, returns false if it was already used
+func (r *SQLiteVerificationRepository) MarkVerificationTokenUsed(id int) (bool, error) {
+	result, err := database.DB.Exec("UPDATE verification_tokens SET used_at = CURRENT_TIMESTAMP WHERE id = ? AND used_at IS NULL", id)
+	if err != nil {
+		return false, err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return affected == 1, nil
+}
+
+// DeleteUserVerificationTokens removes all verification tokens of a user
+func (r *SQLiteVerificationRepository) DeleteUserVerificationTokens(userID int) error {
+	_, err := database.DB.Exec("DELETE FROM verification_tokens WHERE user_id = ?", userID)
+	return err
+}
+
+// DeleteExpiredVerificationTokens removes expired verification tokens and returns the number of deleted rows
+func (r *SQLiteVerificationRepository) DeleteExpiredVerificationTokens(now time.Time) (int64, error) {
+	result, err := database.DB.Exec("DELETE FROM verification_tokens WHERE expires_at <= ?", now.UTC())
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
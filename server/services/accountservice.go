@@ -0,0 +1,179 @@
+package services
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+	"time"
+
+	"elotuschallenge/common"
+	"elotuschallenge/models"
+	"elotuschallenge/repository"
+	"elotuschallenge/storage"
+
+	"github.com/rs/zerolog/log"
+)
+
+// exportDocumentName is the name of the JSON document in the export archive, uploaded files are under files/
+const exportDocumentName = "account.json"
+
+type AccountService struct {
+	userRepo    repository.IUser
+	fileRepo    repository.IFile
+	apiKeyRepo  repository.IAPIKey
+	sessionRepo repository.ISession
+	oidcRepo    repository.IOIDC
+	backends    *storage.Backends
+	blobs       IBlobService
+}
+
+func NewAccountService(userRepo repository.IUser, fileRepo repository.IFile, apiKeyRepo repository.IAPIKey,
+	sessionRepo repository.ISession, oidcRepo repository.IOIDC, backends *storage.Backends, blobs IBlobService) IAccountService {
+	return &AccountService{
+		userRepo:    userRepo,
+		fileRepo:    fileRepo,
+		apiKeyRepo:  apiKeyRepo,
+		sessionRepo: sessionRepo,
+		oidcRepo:    oidcRepo,
+		backends:    backends,
+		blobs:       blobs,
+	}
+}
+
+// DeleteAccount deletes the user with everything they own and removes their uploaded files from storage.
+// Sessions, refresh tokens and API keys are deleted with the user, so all their tokens are rejected.
+func (s *AccountService) DeleteAccount(userID int) error {
+	files, err := s.fileRepo.GetFilesByUser(userID)
+	if err != nil {
+		return err
+	}
+
+	deleted, err := s.userRepo.DeleteUser(userID)
+	if err != nil {
+		return err
+	}
+	if !deleted {
+		return common.ErrUserNotFound
+	}
+
+	// The rows are gone already, files which can't be removed are only logged so the deletion still succeeds
+	for _, file := range files {
+		if err := s.blobs.ReleaseFileContent(file); err != nil {
+			log.Error().Err(err).Int("user_id", userID).Int("file_id", file.ID).Str("backend", file.StorageBackend).Str("key", file.StorageKey).Msg("Failed to remove file of deleted account")
+		}
+	}
+
+	log.Info().Int("user_id", userID).Int("files", len(files)).Msg("Account deleted")
+	return nil
+}
+
+// ExportAccount collects the personal data of the user, the content of their files is added by WriteExportArchive
+func (s *AccountService) ExportAccount(userID int) (*models.AccountExport, error) {
+	user, err := s.userRepo.GetUserByID(userID)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, common.ErrUserNotFound
+	}
+
+	identities, err := s.oidcRepo.GetUserIdentities(userID)
+	if err != nil {
+		return nil, err
+	}
+	apiKeys, err := s.apiKeyRepo.GetAPIKeysByUser(userID)
+	if err != nil {
+		return nil, err
+	}
+	sessions, err := s.sessionRepo.GetActiveUserSessions(userID, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	files, err := s.fileRepo.GetFilesByUser(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	export := &models.AccountExport{
+		ExportedAt: time.Now().UTC(),
+		User:       user,
+		Identities: identities,
+		APIKeys:    apiKeys,
+		Sessions:   sessions,
+		Files:      make([]*models.ExportedFile, 0, len(files)),
+	}
+	if export.APIKeys == nil {
+		export.APIKeys = []*models.APIKey{}
+	}
+	for _, file := range files {
+		exported := &models.ExportedFile{FileMetadata: file}
+		if _, err := s.backends.Stat(file.StorageBackend, file.StorageKey); err == nil {
+			exported.ArchivePath = exportArchivePath(file)
+		} else {
+			log.Warn().Err(err).Int("user_id", userID).Int("file_id", file.ID).Msg("File missing from storage, exported without content")
+		}
+		export.Files = append(export.Files, exported)
+	}
+	return export, nil
+}
+
+// WriteExportArchive streams a ZIP archive with the JSON document of the export followed by the uploaded files
+func (s *AccountService) WriteExportArchive(export *models.AccountExport, w io.Writer) error {
+	archive := zip.NewWriter(w)
+
+	document, err := archive.CreateHeader(&zip.FileHeader{
+		Name:     exportDocumentName,
+		Method:   zip.Deflate,
+		Modified: export.ExportedAt,
+	})
+	if err != nil {
+		return err
+	}
+	encoder := json.NewEncoder(document)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(export); err != nil {
+		return err
+	}
+
+	for _, file := range export.Files {
+		if file.ArchivePath == "" {
+			continue
+		}
+		if err := s.addArchiveFile(archive, file); err != nil {
+			return fmt.Errorf("failed to export file %d: %w", file.ID, err)
+		}
+	}
+	return archive.Close()
+}
+
+// addArchiveFile copies an uploaded file into the archive
+func (s *AccountService) addArchiveFile(archive *zip.Writer, file *models.ExportedFile) error {
+	content, err := s.backends.Get(file.StorageBackend, file.StorageKey)
+	if err != nil {
+		return err
+	}
+	defer content.Close()
+
+	entry, err := archive.CreateHeader(&zip.FileHeader{
+		Name:     file.ArchivePath,
+		Method:   zip.Deflate,
+		Modified: file.CreatedAt,
+	})
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(entry, content)
+	return err
+}
+
+// exportArchivePath names a file in the archive by its ID and original name, stripped of any directories
+func exportArchivePath(file *models.FileMetadata) string {
+	name := path.Base(strings.ReplaceAll(file.OriginalName, "\\", "/"))
+	if name == "." || name == "/" || name == ".." {
+		name = file.Filename
+	}
+	return fmt.Sprintf("files/%d_%s", file.ID, name)
+}
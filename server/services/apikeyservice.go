@@ -0,0 +1,132 @@
+package services
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"strings"
+	"time"
+
+	"elotuschallenge/common"
+	"elotuschallenge/models"
+	"elotuschallenge/repository"
+	"elotuschallenge/utils"
+
+	"github.com/rs/zerolog/log"
+)
+
+// APIKeyPrefix starts every API key so it can be told apart from a JWT
+const APIKeyPrefix = "elk_"
+
+// apiKeyIDLength is the length of the public part identifying a key
+const apiKeyIDLength = 8
+
+// apiKeySecretBytes is the amount of random bytes in the secret part of a key
+const apiKeySecretBytes = 32
+
+type APIKeyService struct {
+	apiKeyRepo repository.IAPIKey
+}
+
+func NewAPIKeyService(apiKeyRepo repository.IAPIKey) IAPIKeyService {
+	return &APIKeyService{
+		apiKeyRepo: apiKeyRepo,
+	}
+}
+
+// CreateAPIKey creates a key for the user and returns the plain key, which is never stored and can't be shown again
+func (s *APIKeyService) CreateAPIKey(userID int, name string, scopes []string, expiresAt *time.Time) (string, *models.APIKey, error) {
+	if strings.TrimSpace(name) == "" {
+		return "", nil, fmt.Errorf("%w: name is required", common.ErrInvalidRequest)
+	}
+	if len(scopes) == 0 {
+		return "", nil, fmt.Errorf("%w: at least one scope is required", common.ErrInvalidRequest)
+	}
+	for _, scope := range scopes {
+		if !isGrantableScope(scope) {
+			return "", nil, fmt.Errorf("%w: %s", common.ErrInvalidScope, scope)
+		}
+	}
+	if expiresAt != nil && !expiresAt.After(time.Now()) {
+		return "", nil, fmt.Errorf("%w: expiry must be in the future", common.ErrInvalidRequest)
+	}
+
+	secret, err := utils.GenerateSecureToken(apiKeySecretBytes)
+	if err != nil {
+		return "", nil, err
+	}
+	prefix := utils.GenerateRandomString(apiKeyIDLength)
+	plainKey := APIKeyPrefix + prefix + "_" + secret
+
+	apiKey, err := s.apiKeyRepo.CreateAPIKey(&models.APIKey{
+		UserID:    userID,
+		Name:      strings.TrimSpace(name),
+		Prefix:    prefix,
+		KeyHash:   utils.HashToken(plainKey),
+		Scopes:    scopes,
+		ExpiresAt: expiresAt,
+	})
+	if err != nil {
+		return "", nil, err
+	}
+
+	return plainKey, apiKey, nil
+}
+
+// ListAPIKeys returns all API keys of the user
+func (s *APIKeyService) ListAPIKeys(userID int) ([]*models.APIKey, error) {
+	return s.apiKeyRepo.GetAPIKeysByUser(userID)
+}
+
+// RevokeAPIKey revokes an API key owned by the user
+func (s *APIKeyService) RevokeAPIKey(userID int, keyID int) error {
+	revoked, err := s.apiKeyRepo.RevokeAPIKey(keyID, userID)
+	if err != nil {
+		return err
+	}
+	if !revoked {
+		return common.ErrAPIKeyNotFound
+	}
+	return nil
+}
+
+// AuthenticateAPIKey returns the stored key matching a plain key if it is active
+func (s *APIKeyService) AuthenticateAPIKey(key string) (*models.APIKey, error) {
+	parts := strings.SplitN(strings.TrimPrefix(key, APIKeyPrefix), "_", 2)
+	if !s.IsAPIKey(key) || len(parts) != 2 || len(parts[0]) != apiKeyIDLength {
+		return nil, common.ErrAPIKeyInvalid
+	}
+
+	apiKey, err := s.apiKeyRepo.GetAPIKeyByPrefix(parts[0])
+	if err != nil {
+		return nil, err
+	}
+	if apiKey == nil || subtle.ConstantTimeCompare([]byte(apiKey.KeyHash), []byte(utils.HashToken(key))) != 1 {
+		return nil, common.ErrAPIKeyInvalid
+	}
+	if apiKey.RevokedAt != nil {
+		return nil, common.ErrAPIKeyRevoked
+	}
+	if apiKey.ExpiresAt != nil && time.Now().After(*apiKey.ExpiresAt) {
+		return nil, common.ErrAPIKeyExpired
+	}
+
+	if err := s.apiKeyRepo.UpdateLastUsed(apiKey.ID); err != nil {
+		log.Error().Err(err).Int("api_key_id", apiKey.ID).Msg("Failed to update API key last use")
+	}
+	return apiKey, nil
+}
+
+// IsAPIKey checks if a bearer token looks like an API key rather than a JWT
+func (s *APIKeyService) IsAPIKey(token string) bool {
+	return strings.HasPrefix(token, APIKeyPrefix)
+}
+
+// isGrantableScope checks if a scope can be granted to an API key
+func isGrantableScope(scope string) bool {
+	for _, grantable := range common.APIKeyScopes {
+		if scope == grantable {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,149 @@
+package services
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"sync"
+
+	"elotuschallenge/models"
+	"elotuschallenge/repository"
+	"elotuschallenge/storage"
+
+	"github.com/rs/zerolog/log"
+)
+
+// blobLockStripes is the number of locks blobs are spread over by the first byte of their digest
+const blobLockStripes = 256
+
+// BlobService shares stored content between files with the same digest. Locks serialize uploads and deletions
+// of a digest within the process, the transactions of the blob repository keep other processes sharing the
+// database from using content while it is removed.
+type BlobService struct {
+	blobRepo repository.IBlob
+	backends *storage.Backends
+	spoolDir string
+	// locks keep a blob from being removed while another file starts using it
+	locks [blobLockStripes]sync.Mutex
+}
+
+// NewBlobService creates the blob service storing new content in the default of the backends, uploads are
+// spooled to files in spoolDir until their digest is known
+func NewBlobService(blobRepo repository.IBlob, backends *storage.Backends, spoolDir string) IBlobService {
+	return &BlobService{
+		blobRepo: blobRepo,
+		backends: backends,
+		spoolDir: spoolDir,
+	}
+}
+
+// StoreBlob computes the digest of the content while spooling it to a temporary file, then stores it unless
+// a blob with the same digest exists already. The returned blob holds a reference for the new file, which
+// is released by ReleaseFileContent.
+func (s *BlobService) StoreBlob(content io.Reader, size int64, contentType string) (*models.Blob, error) {
+	spool, err := os.CreateTemp(s.spoolDir, storage.PartialPrefix+"upload-*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create spool file: %w", err)
+	}
+	defer func() {
+		spool.Close()
+		os.Remove(spool.Name())
+	}()
+
+	hash := sha256.New()
+	written, err := io.Copy(io.MultiWriter(spool, hash), content)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read file content: %w", err)
+	}
+	if written != size {
+		return nil, fmt.Errorf("file upload incomplete: expected %d bytes, read %d bytes", size, written)
+	}
+	digest := hex.EncodeToString(hash.Sum(nil))
+
+	lock := s.lock(digest)
+	lock.Lock()
+	defer lock.Unlock()
+
+	// Content uploaded before is shared
+	blob, err := s.blobRepo.AcquireBlob(digest)
+	if err != nil || blob != nil {
+		return blob, err
+	}
+
+	if _, err := spool.Seek(0, io.SeekStart); err != nil {
+		return nil, fmt.Errorf("failed to rewind spool file: %w", err)
+	}
+	key := blobKey(digest)
+	backend, err := s.backends.Put(key, spool, size, contentType)
+	if err != nil {
+		return nil, err
+	}
+
+	blob, err = s.blobRepo.CreateBlob(&models.Blob{SHA256: digest, Size: size, StorageBackend: backend, StorageKey: key},
+		func(created *models.Blob) error {
+			return s.restoreContent(created, spool, contentType)
+		})
+	if err != nil {
+		// Nothing references the stored content, unless another process recorded it in the meantime
+		if existing, errGet := s.blobRepo.GetBlob(digest); errGet == nil && existing == nil {
+			if errDelete := s.backends.Delete(backend, key); errDelete != nil {
+				log.Error().Err(errDelete).Str("sha256", digest).Msg("Failed to remove blob after save failure")
+			}
+		}
+		return nil, fmt.Errorf("failed to save blob: %w", err)
+	}
+	return blob, nil
+}
+
+// restoreContent stores the spooled content again when the content of a blob is missing. Another process
+// removes the content of a digest when it releases its last reference, which may happen between storing the
+// content here and recording the blob.
+func (s *BlobService) restoreContent(blob *models.Blob, spool *os.File, contentType string) error {
+	_, err := s.backends.Stat(blob.StorageBackend, blob.StorageKey)
+	if err == nil || !errors.Is(err, storage.ErrNotFound) {
+		return err
+	}
+
+	backend, err := s.backends.Backend(blob.StorageBackend)
+	if err != nil {
+		return err
+	}
+	if _, err := spool.Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf("failed to rewind spool file: %w", err)
+	}
+	log.Warn().Str("sha256", blob.SHA256).Msg("Blob content removed concurrently, storing it again")
+	return backend.Put(blob.StorageKey, spool, blob.Size, contentType)
+}
+
+// ReleaseFileContent releases the reference of a deleted file to its content, the content is removed from
+// storage with its last reference. Files uploaded before deduplication own their content.
+func (s *BlobService) ReleaseFileContent(file *models.FileMetadata) error {
+	if file.SHA256 == "" {
+		return s.backends.Delete(file.StorageBackend, file.StorageKey)
+	}
+
+	lock := s.lock(file.SHA256)
+	lock.Lock()
+	defer lock.Unlock()
+
+	_, err := s.blobRepo.ReleaseBlob(file.SHA256, func(blob *models.Blob) error {
+		log.Info().Str("sha256", blob.SHA256).Int64("size", blob.Size).Msg("Unreferenced blob removed")
+		return s.backends.Delete(blob.StorageBackend, blob.StorageKey)
+	})
+	return err
+}
+
+// lock returns the lock of the stripe of a digest
+func (s *BlobService) lock(digest string) *sync.Mutex {
+	stripe, _ := strconv.ParseUint(digest[:2], 16, 8)
+	return &s.locks[stripe%blobLockStripes]
+}
+
+// blobKey is the storage key of content, blobs are spread over directories by the first byte of their digest
+func blobKey(digest string) string {
+	return "sha256/" + digest[:2] + "/" + digest
+}
@@ -1,9 +1,61 @@
 package services
 
+import "encoding/json"
+
+// TokenPurposeMFA marks the token returned by login when the second factor still has to be verified
+const TokenPurposeMFA = "mfa_pending"
+
 // Claims represents the JWT claims structure
 type Claims struct {
-	UserID    int    `json:"user_id"`
-	Username  string `json:"username"`
-	IssuedAt  int64  `json:"iat"`
-	ExpiresAt int64  `json:"exp"`
+	UserID       int      `json:"user_id"`
+	Username     string   `json:"username"`
+	Role         string   `json:"role,omitempty"`
+	TokenVersion int      `json:"ver,omitempty"`     // Older than the user's current version means revoked
+	Purpose      string   `json:"purpose,omitempty"` // Empty for access tokens
+	SessionID    string   `json:"sid,omitempty"`     // Session the token was issued in, revoking it rejects the token
+	ID           string   `json:"jti,omitempty"`
+	Issuer       string   `json:"iss,omitempty"`
+	Audience     Audience `json:"aud,omitempty"`
+	IssuedAt     int64    `json:"iat"`
+	NotBefore    int64    `json:"nbf,omitempty"`
+	ExpiresAt    int64    `json:"exp"`
+}
+
+// Audience is the aud claim, which may be a single string or a list of strings
+type Audience []string
+
+// MarshalJSON encodes a single audience as a string and several as a list
+func (a Audience) MarshalJSON() ([]byte, error) {
+	if len(a) == 1 {
+		return json.Marshal(a[0])
+	}
+	return json.Marshal([]string(a))
+}
+
+// UnmarshalJSON accepts both the string and the list form
+func (a *Audience) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*a = Audience{single}
+		return nil
+	}
+
+	var list []string
+	if err := json.Unmarshal(data, &list); err != nil {
+		return err
+	}
+	*a = Audience(list)
+	return nil
+}
+
+// Contains checks if the audience includes any of the expected values
+func (a Audience) Contains(expected []string) bool {
+	for _, value := range a {
+		for _, want := range expected {
+			if value == want {
+				return true
+			}
+		}
+	}
+	return false
 }
@@ -0,0 +1,64 @@
+package services
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	"elotuschallenge/common"
+	"elotuschallenge/models"
+	"elotuschallenge/repository"
+)
+
+// Page sizes of file listings
+const (
+	DefaultFilePageSize = 20
+	MaxFilePageSize     = 100
+)
+
+// fileCursorToken is the opaque cursor handed to clients, it remembers the order it was made for
+// so it can't be used to continue a listing sorted differently
+type fileCursorToken struct {
+	Sort       string `json:"s"`
+	Descending bool   `json:"d,omitempty"`
+	models.FileCursor
+}
+
+// encodeFileCursor returns the cursor continuing a listing after the file
+func encodeFileCursor(file *models.FileMetadata, sortBy string, descending bool) string {
+	token := fileCursorToken{Sort: sortBy, Descending: descending, FileCursor: models.FileCursor{ID: file.ID}}
+	switch sortBy {
+	case models.FileSortSize:
+		token.Value = strconv.FormatInt(file.Size, 10)
+	case models.FileSortName:
+		token.Value = file.OriginalName
+	default:
+		token.Value = file.CreatedAt.UTC().Format(repository.FileTimeLayout)
+	}
+
+	data, _ := json.Marshal(token)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// decodeFileCursor reads a cursor made by encodeFileCursor for the same order
+func decodeFileCursor(cursor string, sortBy string, descending bool) (*models.FileCursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, fmt.Errorf("%w: malformed cursor", common.ErrInvalidRequest)
+	}
+
+	var token fileCursorToken
+	if err := json.Unmarshal(data, &token); err != nil {
+		return nil, fmt.Errorf("%w: malformed cursor", common.ErrInvalidRequest)
+	}
+	if token.Sort != sortBy || token.Descending != descending {
+		return nil, fmt.Errorf("%w: cursor was made for another sort order", common.ErrInvalidRequest)
+	}
+	if sortBy == models.FileSortSize {
+		if _, err := strconv.ParseInt(token.Value, 10, 64); err != nil {
+			return nil, fmt.Errorf("%w: malformed cursor", common.ErrInvalidRequest)
+		}
+	}
+	return &token.FileCursor, nil
+}
@@ -1,51 +1,38 @@
 package services
 
 import (
+	"errors"
 	"fmt"
 	"io"
-	"os"
 	"path/filepath"
+	"slices"
 	"time"
 
+	"elotuschallenge/common"
 	"elotuschallenge/models"
 	"elotuschallenge/repository"
+	"elotuschallenge/storage"
 	"elotuschallenge/utils"
 
 	"github.com/rs/zerolog/log"
 )
 
 type FileService struct {
-	fileRepo repository.IFile
-	tmpDir   string
+	fileRepo       repository.IFile
+	blobs          IBlobService
+	backends       *storage.Backends
+	trashRetention time.Duration
 }
 
-func NewFileService(fileRepo repository.IFile, tempDir string) IFileService {
-	service := &FileService{
-		fileRepo: fileRepo,
-		tmpDir:   tempDir,
+// NewFileService creates the file service storing uploads with the blob service and reading them from the
+// backends, trashed files are purged trashRetentionSeconds after they were deleted
+func NewFileService(fileRepo repository.IFile, blobs IBlobService, backends *storage.Backends, trashRetentionSeconds int64) IFileService {
+	return &FileService{
+		fileRepo:       fileRepo,
+		blobs:          blobs,
+		backends:       backends,
+		trashRetention: time.Duration(trashRetentionSeconds) * time.Second,
 	}
-
-	errInit := service.Init()
-	if errInit != nil {
-		log.Panic().Err(errInit).Msg("Failed to initialize FileService")
-	}
-	return service
-}
-
-func (s *FileService) Init() error {
-	// Ensure the temporary directory exists
-	if _, err := os.Stat(s.tmpDir); os.IsNotExist(err) {
-		err = os.MkdirAll(s.tmpDir, 0755)
-		if err != nil {
-			log.Error().Err(err).Str("path", s.tmpDir).Msg("Failed to create temporary directory")
-			return fmt.Errorf("failed to create temporary directory: %w", err)
-		}
-		log.Info().Str("path", s.tmpDir).Msg("Temporary directory created")
-	} else {
-		log.Info().Str("path", s.tmpDir).Msg("Temporary directory already exists")
-	}
-
-	return nil
 }
 
 // SaveFileMetadata saves file metadata to database
@@ -58,12 +45,142 @@ func (s *FileService) GetFilesByUser(userID int) ([]*models.FileMetadata, error)
 	return s.fileRepo.GetFilesByUser(userID)
 }
 
+// ListFiles retrieves a page of the files of a user, cursor is the NextCursor of the previous page or empty
+// for the first page. The page size defaults to DefaultFilePageSize and is capped at MaxFilePageSize.
+func (s *FileService) ListFiles(query models.FileQuery, cursor string) (*models.FilePage, error) {
+	if query.SortBy == "" {
+		query.SortBy = models.FileSortCreatedAt
+	}
+	if !slices.Contains(models.FileSorts, query.SortBy) {
+		return nil, fmt.Errorf("%w: sort must be one of %v", common.ErrInvalidRequest, models.FileSorts)
+	}
+	if query.Limit <= 0 {
+		query.Limit = DefaultFilePageSize
+	}
+	query.Limit = min(query.Limit, MaxFilePageSize)
+
+	if cursor != "" {
+		after, err := decodeFileCursor(cursor, query.SortBy, query.Descending)
+		if err != nil {
+			return nil, err
+		}
+		query.After = after
+	}
+
+	// One more file than asked tells whether there is a next page
+	pageSize := query.Limit
+	query.Limit++
+	files, err := s.fileRepo.ListFiles(query)
+	if err != nil {
+		return nil, err
+	}
+
+	page := &models.FilePage{Files: files}
+	if len(files) > pageSize {
+		page.Files = files[:pageSize]
+		page.NextCursor = encodeFileCursor(page.Files[pageSize-1], query.SortBy, query.Descending)
+	}
+	return page, nil
+}
+
 // GetFileByID retrieves a specific file by ID
 func (s *FileService) GetFileByID(fileID int) (*models.FileMetadata, error) {
 	return s.fileRepo.GetFileByID(fileID)
 }
 
-// SaveUploadedFile handles the complete process of saving a file to disk and database
+// OpenUserFile opens a file of the user for reading, files of other users are reported as not found
+func (s *FileService) OpenUserFile(userID int, fileID int) (storage.Object, *models.FileMetadata, error) {
+	metadata, err := s.fileRepo.GetFileByID(fileID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if metadata == nil || metadata.UserID != userID || metadata.DeletedAt != nil {
+		return nil, nil, fmt.Errorf("%w: %d", common.ErrFileNotFound, fileID)
+	}
+
+	file, err := s.backends.Get(metadata.StorageBackend, metadata.StorageKey)
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			log.Error().Int("file_id", fileID).Str("backend", metadata.StorageBackend).Str("key", metadata.StorageKey).Msg("File content missing from storage")
+			return nil, nil, fmt.Errorf("%w: %d content missing", common.ErrFileNotFound, fileID)
+		}
+		return nil, nil, fmt.Errorf("failed to open file: %w", err)
+	}
+	return file, metadata, nil
+}
+
+// TrashFile moves a file of the user to the trash, where it stays until restored or purged
+func (s *FileService) TrashFile(userID int, fileID int) error {
+	trashed, err := s.fileRepo.TrashFile(userID, fileID, time.Now())
+	if err != nil {
+		return err
+	}
+	if !trashed {
+		return fmt.Errorf("%w: %d", common.ErrFileNotFound, fileID)
+	}
+	return nil
+}
+
+// RestoreFile takes a file of the user out of the trash
+func (s *FileService) RestoreFile(userID int, fileID int) error {
+	restored, err := s.fileRepo.RestoreFile(userID, fileID)
+	if err != nil {
+		return err
+	}
+	if !restored {
+		return fmt.Errorf("%w: %d in trash", common.ErrFileNotFound, fileID)
+	}
+	return nil
+}
+
+// DeleteFile permanently deletes a file of the user from the trash, files must be trashed first
+func (s *FileService) DeleteFile(userID int, fileID int) error {
+	file, err := s.fileRepo.DeleteTrashedFile(userID, fileID)
+	if err != nil {
+		return err
+	}
+	if file == nil {
+		return fmt.Errorf("%w: %d in trash", common.ErrFileNotFound, fileID)
+	}
+
+	s.removeFileContent(file, "Trashed file deleted")
+	return nil
+}
+
+// PurgeTrash permanently deletes the files trashed longer than the retention period, it is meant to run
+// periodically and returns the number of purged files
+func (s *FileService) PurgeTrash() (int64, error) {
+	files, err := s.fileRepo.DeleteFilesTrashedBefore(time.Now().Add(-s.trashRetention))
+	if err != nil {
+		return 0, err
+	}
+
+	for _, file := range files {
+		s.removeFileContent(file, "Trashed file purged")
+	}
+	return int64(len(files)), nil
+}
+
+// removeFileContent releases the content of a deleted file, which is removed from storage unless other files
+// share it, and records it in the log. The row is gone already, content which can't be removed is only logged.
+func (s *FileService) removeFileContent(file *models.FileMetadata, msg string) {
+	if err := s.blobs.ReleaseFileContent(file); err != nil {
+		log.Error().Err(err).Int("user_id", file.UserID).Int("file_id", file.ID).Str("backend", file.StorageBackend).Str("key", file.StorageKey).Msg("Failed to remove file content")
+	}
+
+	event := log.Info().
+		Int("user_id", file.UserID).
+		Int("file_id", file.ID).
+		Str("filename", file.Filename).
+		Str("original_name", file.OriginalName).
+		Int64("size", file.Size)
+	if file.DeletedAt != nil {
+		event = event.Time("deleted_at", *file.DeletedAt)
+	}
+	event.Msg(msg)
+}
+
+// SaveUploadedFile handles the complete process of saving a file to storage and database
 func (s *FileService) SaveUploadedFile(file io.Reader, originalFilename string, contentType string, size int64, userID int, userAgent string, ipAddress string) (*models.FileMetadata, error) {
 	// Generate unique filename
 	uniqueFilename := fmt.Sprintf("%s_%s%s",
@@ -71,54 +188,36 @@ func (s *FileService) SaveUploadedFile(file io.Reader, originalFilename string,
 		time.Now().Format("20060102_150405"),
 		filepath.Ext(originalFilename))
 
-	// Create full path in /tmp directory
-	tmpFilePath := filepath.Join(s.tmpDir, uniqueFilename)
-
-	// Create the temporary file
-	tmpFile, err := os.Create(tmpFilePath)
-	if err != nil {
-		log.Error().Err(err).Str("path", tmpFilePath).Msg("Failed to create temporary file")
-		return nil, fmt.Errorf("failed to create temporary file: %w", err)
-	}
-	defer tmpFile.Close()
-
-	// Copy uploaded file content to temporary file
-	bytesWritten, err := io.Copy(tmpFile, file)
+	// Content is stored once per digest, uploading it again only adds a reference
+	blob, err := s.blobs.StoreBlob(file, size, contentType)
 	if err != nil {
-		log.Error().Err(err).Msg("Failed to write file content")
-		// Clean up the temporary file
-		os.Remove(tmpFilePath)
+		log.Error().Err(err).Int64("expected", size).Msg("Failed to store file content")
 		return nil, fmt.Errorf("failed to save file: %w", err)
 	}
 
-	// Verify the written size matches the uploaded size
-	if bytesWritten != size {
-		log.Error().Int64("written", bytesWritten).Int64("expected", size).Msg("File size mismatch")
-		os.Remove(tmpFilePath)
-		return nil, fmt.Errorf("file upload incomplete: expected %d bytes, wrote %d bytes", size, bytesWritten)
-	}
-
 	// Create file metadata
 	fileMetadata := &models.FileMetadata{
-		Filename:     uniqueFilename,
-		OriginalName: originalFilename,
-		ContentType:  contentType,
-		Size:         size,
-		UserID:       userID,
-		UploadPath:   tmpFilePath,
-		UserAgent:    userAgent,
-		IPAddress:    ipAddress,
-		CreatedAt:    time.Now(),
+		Filename:       uniqueFilename,
+		OriginalName:   originalFilename,
+		ContentType:    contentType,
+		Size:           size,
+		UserID:         userID,
+		StorageKey:     blob.StorageKey,
+		StorageBackend: blob.StorageBackend,
+		SHA256:         blob.SHA256,
+		UserAgent:      userAgent,
+		IPAddress:      ipAddress,
+		CreatedAt:      time.Now(),
 	}
 
 	// Save metadata to database
 	savedMetadata, err := s.fileRepo.CreateFile(fileMetadata)
 	if err != nil {
 		log.Error().Err(err).Msg("Failed to save file metadata to database")
-		// Clean up the temporary file if database save fails
-		errRemoveFile := os.Remove(tmpFilePath)
+		// Release the reference to the stored content if database save fails
+		errRemoveFile := s.blobs.ReleaseFileContent(fileMetadata)
 		if errRemoveFile != nil {
-			log.Error().Err(errRemoveFile).Msg("Failed to remove temporary file after metadata save failure")
+			log.Error().Err(errRemoveFile).Msg("Failed to release stored file after metadata save failure")
 		}
 		return nil, fmt.Errorf("failed to save file metadata: %w", err)
 	}
@@ -126,6 +225,8 @@ func (s *FileService) SaveUploadedFile(file io.Reader, originalFilename string,
 	log.Info().
 		Int("user_id", userID).
 		Str("filename", uniqueFilename).
+		Str("sha256", blob.SHA256).
+		Bool("deduplicated", blob.RefCount > 1).
 		Str("original_name", originalFilename).
 		Str("content_type", contentType).
 		Int64("size", size).
@@ -0,0 +1,13 @@
+package services
+
+import (
+	"elotuschallenge/models"
+	"io"
+)
+
+// IAccountService defines the interface for deleting accounts and exporting their data
+type IAccountService interface {
+	DeleteAccount(userID int) error
+	ExportAccount(userID int) (*models.AccountExport, error)
+	WriteExportArchive(export *models.AccountExport, w io.Writer) error
+}
@@ -0,0 +1,15 @@
+package services
+
+import (
+	"elotuschallenge/models"
+	"time"
+)
+
+// IAPIKeyService defines the interface for managing and authenticating API keys
+type IAPIKeyService interface {
+	CreateAPIKey(userID int, name string, scopes []string, expiresAt *time.Time) (string, *models.APIKey, error)
+	ListAPIKeys(userID int) ([]*models.APIKey, error)
+	RevokeAPIKey(userID int, keyID int) error
+	AuthenticateAPIKey(key string) (*models.APIKey, error)
+	IsAPIKey(token string) bool
+}
@@ -0,0 +1,12 @@
+package services
+
+import (
+	"elotuschallenge/models"
+	"io"
+)
+
+// IBlobService defines the interface for storing file content once per SHA-256 digest
+type IBlobService interface {
+	StoreBlob(content io.Reader, size int64, contentType string) (*models.Blob, error)
+	ReleaseFileContent(file *models.FileMetadata) error
+}
@@ -2,12 +2,19 @@ package services
 
 import (
 	"elotuschallenge/models"
+	"elotuschallenge/storage"
 	"io"
 )
 
 type IFileService interface {
 	SaveFileMetadata(metadata *models.FileMetadata) (*models.FileMetadata, error)
 	GetFilesByUser(userID int) ([]*models.FileMetadata, error)
+	ListFiles(query models.FileQuery, cursor string) (*models.FilePage, error)
 	GetFileByID(fileID int) (*models.FileMetadata, error)
+	OpenUserFile(userID int, fileID int) (storage.Object, *models.FileMetadata, error)
+	TrashFile(userID int, fileID int) error
+	RestoreFile(userID int, fileID int) error
+	DeleteFile(userID int, fileID int) error
+	PurgeTrash() (int64, error)
 	SaveUploadedFile(file io.Reader, originalFilename string, contentType string, size int64, userID int, userAgent string, ipAddress string) (*models.FileMetadata, error)
 }
@@ -0,0 +1,12 @@
+package services
+
+import "time"
+
+// ILoginThrottleService defines the interface for limiting password guesses on login
+type ILoginThrottleService interface {
+	CheckLogin(username, clientIP string) (time.Duration, error)
+	RecordFailure(username, clientIP string) (time.Duration, error)
+	RecordSuccess(username string) error
+	UnlockUser(username string) error
+	PurgeStaleAttempts() (int64, error)
+}
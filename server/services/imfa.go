@@ -0,0 +1,13 @@
+package services
+
+// IMFAService defines the interface for TOTP two-factor authentication
+type IMFAService interface {
+	EnrollTOTP(userID int, username string) (secret string, uri string, err error)
+	ConfirmTOTP(userID int, code string) ([]string, error)
+	IsMFAEnabled(userID int) (bool, error)
+	VerifyTOTP(userID int, code string) error
+	UseRecoveryCode(userID int, recoveryCode string) error
+	DisableTOTP(userID int) error
+	RegenerateRecoveryCodes(userID int) ([]string, error)
+	EncryptStoredSecrets() error
+}
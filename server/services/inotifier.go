@@ -0,0 +1,8 @@
+package services
+
+import "elotuschallenge/models"
+
+// INotifier defines the interface for delivering messages to users
+type INotifier interface {
+	Notify(notification *models.Notification) error
+}
@@ -0,0 +1,31 @@
+package services
+
+import "elotuschallenge/models"
+
+// OIDCProviderConfig configures an OpenID Connect provider users can sign in with
+type OIDCProviderConfig struct {
+	// Name identifies the provider in the login URL, e.g. /api/oidc/{name}/login
+	Name string
+	// Issuer is the provider's issuer URL, its discovery document is at /.well-known/openid-configuration
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	// RedirectURL is the callback registered at the provider, /api/oidc/{name}/callback
+	RedirectURL string
+	Scopes      []string
+}
+
+// OIDCLogin is the result of a completed OpenID Connect login
+type OIDCLogin struct {
+	User *models.User
+	// UseCookies tells whether the login was started by a browser asking for a session cookie
+	UseCookies bool
+}
+
+// IOIDCService defines the interface for signing in with external OpenID Connect providers
+type IOIDCService interface {
+	Providers() []string
+	StartLogin(provider string, useCookies bool) (authURL string, state string, err error)
+	CompleteLogin(provider, state, code string) (*OIDCLogin, error)
+	PurgeExpiredStates() (int64, error)
+}
@@ -0,0 +1,12 @@
+package services
+
+import "elotuschallenge/models"
+
+// IPasswordService defines the interface for changing and resetting passwords
+type IPasswordService interface {
+	ChangePassword(userID int, currentPassword, newPassword string) (*models.User, error)
+	VerifyPassword(userID int, password string) (*models.User, error)
+	RequestPasswordReset(username string) error
+	ResetPassword(token, newPassword string) (*models.User, error)
+	PurgeExpiredResetTokens() (int64, error)
+}
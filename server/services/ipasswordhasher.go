@@ -0,0 +1,8 @@
+package services
+
+// IPasswordHasher defines the interface for hashing and verifying user passwords
+type IPasswordHasher interface {
+	Hash(password string) (string, error)
+	Verify(password, hash string) (bool, error)
+	NeedsRehash(hash string) bool
+}
@@ -0,0 +1,12 @@
+package services
+
+import "elotuschallenge/models"
+
+// IRefreshTokenService defines the interface for issuing and rotating refresh tokens
+type IRefreshTokenService interface {
+	IssueRefreshToken(userID int, sessionID string) (string, error)
+	RotateRefreshToken(token string) (string, *models.RefreshToken, error)
+	RevokeRefreshToken(token string, userID int) error
+	RevokeUserRefreshTokens(userID int) error
+	PurgeExpiredRefreshTokens() (int64, error)
+}
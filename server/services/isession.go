@@ -0,0 +1,15 @@
+package services
+
+import "elotuschallenge/models"
+
+// ISessionService defines the interface for tracking and revoking the signed in sessions of users
+type ISessionService interface {
+	NewSessionID() (string, error)
+	RecordToken(session *models.Session) error
+	IsSessionActive(sessionID string) (bool, error)
+	TouchSession(sessionID, userAgent, ipAddress string) error
+	ListSessions(userID int) ([]*models.Session, error)
+	RevokeSession(userID int, sessionID string) error
+	RevokeUserSessions(userID int) error
+	PurgeExpiredSessions() (int64, error)
+}
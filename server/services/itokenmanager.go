@@ -3,7 +3,15 @@ package services
 // ITokenManager defines the interface for token management services
 type ITokenManager interface {
 	GenerateToken(userID int, username string) (string, error)
+	IssueToken(userClaims Claims) (string, error)
+	IssueTokenWithExpiration(userClaims Claims, expirationSeconds int64) (string, error)
 	ValidateToken(tokenString string) (*Claims, error)
+	ValidatePurposeToken(tokenString string, purpose string) (*Claims, error)
 	ExtractTokenFromHeader(authHeader string) string
 	HasValidBearerFormat(authHeader string) bool
+	RevokeToken(tokenString string) error
+	IsTokenRevoked(tokenString string) (bool, error)
+	PurgeExpiredRevocations() (int64, error)
+	SetKeyring(keyring *Keyring)
+	PublicKeys() JWKSet
 }
@@ -10,4 +10,9 @@ type IUserService interface {
 	CreateUser(user *models.User) (*models.User, error)
 	UserExists(username string) (bool, error)
 	GetUserByUsername(username string) (*models.User, error)
+	GetUserByID(userID int) (*models.User, error)
+	SetUserStatus(userID int, status string) error
+	GetUsers() ([]*models.User, error)
+	SetUserRole(userID int, role string) error
+	EnsureAdmin(username, password string) (*models.User, error)
 }
@@ -0,0 +1,11 @@
+package services
+
+import "elotuschallenge/models"
+
+// IVerificationService defines the interface for verifying new accounts
+type IVerificationService interface {
+	SendVerification(user *models.User) error
+	ResendVerification(username string) error
+	VerifyAccount(token string) (*models.User, error)
+	PurgeExpiredVerificationTokens() (int64, error)
+}
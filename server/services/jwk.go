@@ -0,0 +1,106 @@
+package services
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"fmt"
+	"math/big"
+)
+
+// JWK is the JSON Web Key representation of a public key (RFC 7517)
+type JWK struct {
+	KeyType   string `json:"kty"`
+	KeyID     string `json:"kid"`
+	Use       string `json:"use"`
+	Algorithm string `json:"alg"`
+	Curve     string `json:"crv,omitempty"`
+	N         string `json:"n,omitempty"`
+	E         string `json:"e,omitempty"`
+	X         string `json:"x,omitempty"`
+	Y         string `json:"y,omitempty"`
+}
+
+// JWKSet is the document published at /.well-known/jwks.json
+type JWKSet struct {
+	Keys []JWK `json:"keys"`
+}
+
+// publicJWK returns the public part of an asymmetric key as a JWK
+func (k *SigningKey) publicJWK() JWK {
+	jwk := JWK{KeyID: k.ID, Use: "sig", Algorithm: k.Algorithm}
+
+	switch publicKey := k.publicKey.(type) {
+	case *rsa.PublicKey:
+		jwk.KeyType = "RSA"
+		jwk.N = base64.RawURLEncoding.EncodeToString(publicKey.N.Bytes())
+		jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(publicKey.E)).Bytes())
+	case *ecdsa.PublicKey:
+		jwk.KeyType = "EC"
+		jwk.Curve = publicKey.Curve.Params().Name
+		size := (publicKey.Curve.Params().BitSize + 7) / 8
+		jwk.X = base64.RawURLEncoding.EncodeToString(publicKey.X.FillBytes(make([]byte, size)))
+		jwk.Y = base64.RawURLEncoding.EncodeToString(publicKey.Y.FillBytes(make([]byte, size)))
+	case ed25519.PublicKey:
+		jwk.KeyType = "OKP"
+		jwk.Curve = "Ed25519"
+		jwk.X = base64.RawURLEncoding.EncodeToString(publicKey)
+	}
+	return jwk
+}
+
+// verificationKey parses a public JWK into a key which can only verify signatures, the algorithm is taken
+// from alg or inferred from the key type when the key set leaves it out
+func (j JWK) verificationKey() (*SigningKey, error) {
+	var publicKey crypto.PublicKey
+	algorithm := j.Algorithm
+
+	switch j.KeyType {
+	case "RSA":
+		n, errN := base64.RawURLEncoding.DecodeString(j.N)
+		e, errE := base64.RawURLEncoding.DecodeString(j.E)
+		if errN != nil || errE != nil || len(e) == 0 || len(e) > 4 {
+			return nil, fmt.Errorf("invalid RSA key %q", j.KeyID)
+		}
+		publicKey = &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+		if algorithm == "" {
+			algorithm = AlgorithmRS256
+		}
+	case "EC":
+		if j.Curve != elliptic.P256().Params().Name {
+			return nil, fmt.Errorf("unsupported curve %q of key %q", j.Curve, j.KeyID)
+		}
+		x, errX := base64.RawURLEncoding.DecodeString(j.X)
+		y, errY := base64.RawURLEncoding.DecodeString(j.Y)
+		if errX != nil || errY != nil {
+			return nil, fmt.Errorf("invalid EC key %q", j.KeyID)
+		}
+		ecKey := &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		if !ecKey.Curve.IsOnCurve(ecKey.X, ecKey.Y) {
+			return nil, fmt.Errorf("EC key %q is not on its curve", j.KeyID)
+		}
+		publicKey = ecKey
+		if algorithm == "" {
+			algorithm = AlgorithmES256
+		}
+	case "OKP":
+		x, err := base64.RawURLEncoding.DecodeString(j.X)
+		if err != nil || j.Curve != "Ed25519" || len(x) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("invalid OKP key %q", j.KeyID)
+		}
+		publicKey = ed25519.PublicKey(x)
+		if algorithm == "" {
+			algorithm = AlgorithmEdDSA
+		}
+	default:
+		return nil, fmt.Errorf("unsupported key type %q of key %q", j.KeyType, j.KeyID)
+	}
+
+	if err := checkPublicKeyAlgorithm(algorithm, publicKey); err != nil {
+		return nil, err
+	}
+	return &SigningKey{ID: j.KeyID, Algorithm: algorithm, publicKey: publicKey}, nil
+}
@@ -0,0 +1,271 @@
+package services
+
+import (
+	"crypto"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// DefaultKeyID is the key ID of the key built from the environment, tokens without a kid header are verified with it.
+// Keyrings loaded from JWT_KEYS_PATH reject such tokens, even with a key of this ID.
+const DefaultKeyID = "default"
+
+// minKeySecretLength is the minimum length of HS256 secrets loaded from key files
+const minKeySecretLength = 32
+
+// SigningKey is a key used to sign and verify tokens. HS256 keys use Secret, asymmetric keys use PEM
+// encoded keys given inline or as file paths. A retired asymmetric key may only have its public key.
+type SigningKey struct {
+	ID             string     `json:"kid"`
+	Algorithm      string     `json:"alg,omitempty"`
+	Secret         string     `json:"secret,omitempty"`
+	PrivateKey     string     `json:"private_key,omitempty"`
+	PrivateKeyFile string     `json:"private_key_file,omitempty"`
+	PublicKey      string     `json:"public_key,omitempty"`
+	PublicKeyFile  string     `json:"public_key_file,omitempty"`
+	Active         bool       `json:"active"`
+	CreatedAt      time.Time  `json:"created_at"`
+	RetiredAt      *time.Time `json:"retired_at,omitempty"`
+
+	signer    crypto.Signer
+	publicKey crypto.PublicKey
+}
+
+// keyringFile is the format of a keyring file holding several keys
+type keyringFile struct {
+	Keys []*SigningKey `json:"keys"`
+}
+
+// Keyring holds the active signing key and the retired keys still used for verification
+type Keyring struct {
+	active *SigningKey
+	keys   map[string]*SigningKey
+	order  []string
+	// verifiesMissingKeyID is set for keyrings built from the environment, whose key verifies tokens without a kid
+	verifiesMissingKeyID bool
+}
+
+// NewStaticKeyring creates a keyring holding a single HS256 key built from a shared secret
+func NewStaticKeyring(secret string) *Keyring {
+	key := &SigningKey{ID: DefaultKeyID, Algorithm: AlgorithmHS256, Secret: secret, Active: true}
+	return &Keyring{
+		active:               key,
+		keys:                 map[string]*SigningKey{key.ID: key},
+		order:                []string{key.ID},
+		verifiesMissingKeyID: true,
+	}
+}
+
+// NewPrivateKeyKeyring creates a keyring holding a single asymmetric key loaded from a PEM file
+func NewPrivateKeyKeyring(algorithm string, privateKeyFile string) (*Keyring, error) {
+	keyring, err := NewKeyring([]*SigningKey{{
+		ID:             DefaultKeyID,
+		Algorithm:      algorithm,
+		PrivateKeyFile: privateKeyFile,
+		Active:         true,
+	}})
+	if err != nil {
+		return nil, err
+	}
+	keyring.verifiesMissingKeyID = true
+	return keyring, nil
+}
+
+// NewKeyring creates a keyring from keys. The active key is the one flagged active,
+// otherwise the most recently created key which is not retired and can sign.
+func NewKeyring(keys []*SigningKey) (*Keyring, error) {
+	keyring := &Keyring{keys: make(map[string]*SigningKey)}
+
+	for _, key := range keys {
+		if strings.TrimSpace(key.ID) == "" {
+			return nil, fmt.Errorf("signing key without kid")
+		}
+		if _, exists := keyring.keys[key.ID]; exists {
+			return nil, fmt.Errorf("duplicate signing key %s", key.ID)
+		}
+		if err := key.prepare(); err != nil {
+			return nil, fmt.Errorf("signing key %s: %w", key.ID, err)
+		}
+		keyring.keys[key.ID] = key
+		keyring.order = append(keyring.order, key.ID)
+
+		if key.Active {
+			if keyring.active != nil {
+				return nil, fmt.Errorf("signing keys %s and %s are both active", keyring.active.ID, key.ID)
+			}
+			if key.RetiredAt != nil {
+				return nil, fmt.Errorf("signing key %s is both active and retired", key.ID)
+			}
+			if !key.canSign() {
+				return nil, fmt.Errorf("signing key %s is active but has no private key", key.ID)
+			}
+			keyring.active = key
+		}
+	}
+
+	if keyring.active == nil {
+		for _, key := range keys {
+			if key.RetiredAt == nil && key.canSign() && (keyring.active == nil || key.CreatedAt.After(keyring.active.CreatedAt)) {
+				keyring.active = key
+			}
+		}
+	}
+	if keyring.active == nil {
+		return nil, fmt.Errorf("no active signing key")
+	}
+
+	return keyring, nil
+}
+
+// LoadKeyring loads a keyring from a JSON file with a "keys" list, or from a directory with one JSON key per file.
+// Relative key file paths are resolved against the directory of the keyring.
+func LoadKeyring(path string) (*Keyring, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read keyring: %w", err)
+	}
+
+	if !info.IsDir() {
+		var file keyringFile
+		if err := readJSONFile(path, &file); err != nil {
+			return nil, err
+		}
+		for _, key := range file.Keys {
+			key.resolvePaths(filepath.Dir(path))
+		}
+		return NewKeyring(file.Keys)
+	}
+
+	paths, err := filepath.Glob(filepath.Join(path, "*.json"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list keyring directory: %w", err)
+	}
+
+	keys := make([]*SigningKey, 0, len(paths))
+	for _, keyPath := range paths {
+		var key SigningKey
+		if err := readJSONFile(keyPath, &key); err != nil {
+			return nil, err
+		}
+		key.resolvePaths(path)
+		keys = append(keys, &key)
+	}
+	return NewKeyring(keys)
+}
+
+// ActiveKey returns the key used to sign new tokens
+func (k *Keyring) ActiveKey() *SigningKey {
+	return k.active
+}
+
+// Key returns the key with the given ID or nil if it's not in the keyring
+func (k *Keyring) Key(kid string) *SigningKey {
+	return k.keys[kid]
+}
+
+// KeyWithoutID returns the key verifying tokens without a kid header, which were issued before key rotation
+// was introduced, or nil when the keyring was loaded from keyring files
+func (k *Keyring) KeyWithoutID() *SigningKey {
+	if !k.verifiesMissingKeyID {
+		return nil
+	}
+	return k.keys[DefaultKeyID]
+}
+
+// Keys returns all keys in the order they were loaded
+func (k *Keyring) Keys() []*SigningKey {
+	keys := make([]*SigningKey, 0, len(k.order))
+	for _, kid := range k.order {
+		keys = append(keys, k.keys[kid])
+	}
+	return keys
+}
+
+// prepare validates the key and parses its key material
+func (k *SigningKey) prepare() error {
+	if k.Algorithm == "" {
+		k.Algorithm = AlgorithmHS256
+	}
+
+	if k.Algorithm == AlgorithmHS256 {
+		if len(k.Secret) < minKeySecretLength {
+			return fmt.Errorf("secret must be at least %d characters long", minKeySecretLength)
+		}
+		return nil
+	}
+	if !IsAsymmetricAlgorithm(k.Algorithm) {
+		return fmt.Errorf("unsupported signing algorithm %s", k.Algorithm)
+	}
+
+	privatePEM, err := readKeyMaterial(k.PrivateKey, k.PrivateKeyFile)
+	if err != nil {
+		return err
+	}
+	if privatePEM != nil {
+		k.signer, err = parsePrivateKey(privatePEM)
+		if err != nil {
+			return err
+		}
+		k.publicKey = k.signer.Public()
+	} else {
+		publicPEM, err := readKeyMaterial(k.PublicKey, k.PublicKeyFile)
+		if err != nil {
+			return err
+		}
+		if publicPEM == nil {
+			return fmt.Errorf("%s key requires a private or public key", k.Algorithm)
+		}
+		k.publicKey, err = parsePublicKey(publicPEM)
+		if err != nil {
+			return err
+		}
+	}
+
+	return checkPublicKeyAlgorithm(k.Algorithm, k.publicKey)
+}
+
+// canSign checks if the key can be used to sign new tokens
+func (k *SigningKey) canSign() bool {
+	return k.Algorithm == AlgorithmHS256 || k.signer != nil
+}
+
+// resolvePaths makes relative key file paths relative to baseDir
+func (k *SigningKey) resolvePaths(baseDir string) {
+	if k.PrivateKeyFile != "" && !filepath.IsAbs(k.PrivateKeyFile) {
+		k.PrivateKeyFile = filepath.Join(baseDir, k.PrivateKeyFile)
+	}
+	if k.PublicKeyFile != "" && !filepath.IsAbs(k.PublicKeyFile) {
+		k.PublicKeyFile = filepath.Join(baseDir, k.PublicKeyFile)
+	}
+}
+
+// readKeyMaterial returns the inline PEM value or the content of the PEM file, nil if neither is set
+func readKeyMaterial(inline string, path string) ([]byte, error) {
+	if inline != "" {
+		return []byte(inline), nil
+	}
+	if path == "" {
+		return nil, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read key file: %w", err)
+	}
+	return data, nil
+}
+
+// readJSONFile decodes a JSON file into target
+func readJSONFile(path string, target interface{}) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	if err := json.Unmarshal(data, target); err != nil {
+		return fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	return nil
+}
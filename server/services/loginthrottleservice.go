@@ -0,0 +1,118 @@
+package services
+
+import (
+	"fmt"
+	"time"
+
+	"elotuschallenge/common"
+	"elotuschallenge/repository"
+
+	"github.com/rs/zerolog/log"
+)
+
+// LoginThrottleConfig holds the lockout thresholds, an IP is allowed more failures than one
+// username since many users may share it
+type LoginThrottleConfig struct {
+	MaxUserFailures      int
+	MaxIPFailures        int
+	LockoutSeconds       int64
+	MaxLockoutSeconds    int64
+	FailureWindowSeconds int64
+}
+
+type LoginThrottleService struct {
+	loginAttemptRepo repository.ILoginAttempt
+	config           LoginThrottleConfig
+}
+
+func NewLoginThrottleService(loginAttemptRepo repository.ILoginAttempt, config LoginThrottleConfig) ILoginThrottleService {
+	return &LoginThrottleService{
+		loginAttemptRepo: loginAttemptRepo,
+		config:           config,
+	}
+}
+
+// CheckLogin returns ErrLoginLocked and the remaining lock time when the username or the IP is locked
+func (s *LoginThrottleService) CheckLogin(username, clientIP string) (time.Duration, error) {
+	now := time.Now()
+	for _, key := range []string{userAttemptKey(username), ipAttemptKey(clientIP)} {
+		attempt, err := s.loginAttemptRepo.GetLoginAttempt(key)
+		if err != nil {
+			return 0, err
+		}
+		if attempt != nil && attempt.LockedUntil != nil && attempt.LockedUntil.After(now) {
+			return attempt.LockedUntil.Sub(now), fmt.Errorf("%w: %s locked until %s", common.ErrLoginLocked, key, attempt.LockedUntil.Format(time.RFC3339))
+		}
+	}
+	return 0, nil
+}
+
+// RecordFailure counts a failed login for the username and the IP, it returns the lock time
+// when the failure locked either of them
+func (s *LoginThrottleService) RecordFailure(username, clientIP string) (time.Duration, error) {
+	userLock, err := s.recordFailure(userAttemptKey(username), s.config.MaxUserFailures)
+	if err != nil {
+		return 0, err
+	}
+	ipLock, err := s.recordFailure(ipAttemptKey(clientIP), s.config.MaxIPFailures)
+	if err != nil {
+		return 0, err
+	}
+	return max(userLock, ipLock), nil
+}
+
+// RecordSuccess clears the failures of the username, failures of the IP keep counting
+func (s *LoginThrottleService) RecordSuccess(username string) error {
+	return s.loginAttemptRepo.DeleteLoginAttempt(userAttemptKey(username))
+}
+
+// UnlockUser clears the failures and lock of the username
+func (s *LoginThrottleService) UnlockUser(username string) error {
+	return s.loginAttemptRepo.DeleteLoginAttempt(userAttemptKey(username))
+}
+
+// PurgeStaleAttempts removes counters without recent failures, it returns the number of removed counters
+func (s *LoginThrottleService) PurgeStaleAttempts() (int64, error) {
+	now := time.Now()
+	return s.loginAttemptRepo.DeleteStaleLoginAttempts(now, s.windowStart(now))
+}
+
+// recordFailure increments the counter of the key and locks it once it reaches maxFailures.
+// Every further failure doubles the lock up to MaxLockoutSeconds.
+func (s *LoginThrottleService) recordFailure(key string, maxFailures int) (time.Duration, error) {
+	now := time.Now()
+	failures, err := s.loginAttemptRepo.RecordFailure(key, now, s.windowStart(now))
+	if err != nil {
+		return 0, err
+	}
+	if failures < maxFailures {
+		return 0, nil
+	}
+
+	lockout := time.Duration(s.config.LockoutSeconds) * time.Second
+	maxLockout := time.Duration(s.config.MaxLockoutSeconds) * time.Second
+	for i := maxFailures; i < failures && lockout < maxLockout; i++ {
+		lockout *= 2
+	}
+	lockout = min(lockout, maxLockout)
+
+	if err := s.loginAttemptRepo.LockUntil(key, now.Add(lockout)); err != nil {
+		return 0, err
+	}
+
+	log.Warn().Str("key", key).Int("failures", failures).Dur("lockout", lockout).Msg("Login locked after failed attempts")
+	return lockout, nil
+}
+
+// windowStart is the time before which failures are forgotten
+func (s *LoginThrottleService) windowStart(now time.Time) time.Time {
+	return now.Add(-time.Duration(s.config.FailureWindowSeconds) * time.Second)
+}
+
+func userAttemptKey(username string) string {
+	return "user:" + username
+}
+
+func ipAttemptKey(clientIP string) string {
+	return "ip:" + clientIP
+}
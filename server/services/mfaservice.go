@@ -0,0 +1,262 @@
+package services
+
+import (
+	"crypto/rand"
+	"strings"
+	"time"
+
+	"elotuschallenge/common"
+	"elotuschallenge/repository"
+	"elotuschallenge/utils"
+
+	"github.com/rs/zerolog/log"
+)
+
+// recoveryCodeCount is the number of recovery codes generated when 2FA is enabled
+const recoveryCodeCount = 10
+
+// recoveryCodeAlphabet leaves out characters easily confused when typed from paper
+const recoveryCodeAlphabet = "abcdefghjkmnpqrstuvwxyz23456789"
+
+type MFAService struct {
+	mfaRepo repository.IMFA
+	box     *SecretBox
+	issuer  string
+}
+
+func NewMFAService(mfaRepo repository.IMFA, box *SecretBox, issuer string) IMFAService {
+	return &MFAService{
+		mfaRepo: mfaRepo,
+		box:     box,
+		issuer:  issuer,
+	}
+}
+
+// EnrollTOTP generates a new secret for the user, it is used for login only after ConfirmTOTP
+func (s *MFAService) EnrollTOTP(userID int, username string) (string, string, error) {
+	existing, err := s.mfaRepo.GetTOTPSecret(userID)
+	if err != nil {
+		return "", "", err
+	}
+	if existing != nil && existing.EnabledAt != nil {
+		return "", "", common.ErrMFAAlreadyEnabled
+	}
+
+	secret, err := GenerateTOTPSecret()
+	if err != nil {
+		return "", "", err
+	}
+	sealed, err := s.box.Seal(secret)
+	if err != nil {
+		return "", "", err
+	}
+	if err := s.mfaRepo.SaveTOTPSecret(userID, sealed); err != nil {
+		return "", "", err
+	}
+	return secret, TOTPURI(s.issuer, username, secret), nil
+}
+
+// ConfirmTOTP enables 2FA once the user proves the authenticator works, it returns the recovery
+// codes which are shown only once
+func (s *MFAService) ConfirmTOTP(userID int, code string) ([]string, error) {
+	existing, err := s.mfaRepo.GetTOTPSecret(userID)
+	if err != nil {
+		return nil, err
+	}
+	if existing == nil {
+		return nil, common.ErrMFANotEnrolled
+	}
+	if existing.EnabledAt != nil {
+		return nil, common.ErrMFAAlreadyEnabled
+	}
+
+	if err := s.verifyCode(userID, existing.Secret, code); err != nil {
+		return nil, err
+	}
+
+	codes, hashes, err := generateRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+	if err := s.mfaRepo.ReplaceRecoveryCodes(userID, hashes); err != nil {
+		return nil, err
+	}
+	if err := s.mfaRepo.EnableTOTP(userID); err != nil {
+		return nil, err
+	}
+
+	log.Info().Int("user_id", userID).Msg("TOTP two-factor authentication enabled")
+	return codes, nil
+}
+
+// IsMFAEnabled reports whether the user has confirmed a TOTP secret
+func (s *MFAService) IsMFAEnabled(userID int) (bool, error) {
+	existing, err := s.mfaRepo.GetTOTPSecret(userID)
+	if err != nil {
+		return false, err
+	}
+	return existing != nil && existing.EnabledAt != nil, nil
+}
+
+// VerifyTOTP checks a code of the enabled authenticator, each code is accepted once
+func (s *MFAService) VerifyTOTP(userID int, code string) error {
+	existing, err := s.mfaRepo.GetTOTPSecret(userID)
+	if err != nil {
+		return err
+	}
+	if existing == nil || existing.EnabledAt == nil {
+		return common.ErrMFANotEnrolled
+	}
+	return s.verifyCode(userID, existing.Secret, code)
+}
+
+// DisableTOTP turns 2FA off and removes the secret and the recovery codes of the user
+func (s *MFAService) DisableTOTP(userID int) error {
+	deleted, err := s.mfaRepo.DeleteTOTP(userID)
+	if err != nil {
+		return err
+	}
+	if !deleted {
+		return common.ErrMFANotEnrolled
+	}
+
+	log.Info().Int("user_id", userID).Msg("TOTP two-factor authentication disabled")
+	return nil
+}
+
+// RegenerateRecoveryCodes replaces all recovery codes of a user with 2FA enabled, the old ones stop working
+func (s *MFAService) RegenerateRecoveryCodes(userID int) ([]string, error) {
+	enabled, err := s.IsMFAEnabled(userID)
+	if err != nil {
+		return nil, err
+	}
+	if !enabled {
+		return nil, common.ErrMFANotEnrolled
+	}
+
+	codes, hashes, err := generateRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+	if err := s.mfaRepo.ReplaceRecoveryCodes(userID, hashes); err != nil {
+		return nil, err
+	}
+
+	log.Info().Int("user_id", userID).Msg("MFA recovery codes regenerated")
+	return codes, nil
+}
+
+// EncryptStoredSecrets encrypts the TOTP secrets stored in plaintext by older versions
+func (s *MFAService) EncryptStoredSecrets() error {
+	secrets, err := s.mfaRepo.GetTOTPSecrets()
+	if err != nil {
+		return err
+	}
+
+	encrypted := 0
+	for _, secret := range secrets {
+		if IsSealed(secret.Secret) {
+			continue
+		}
+		sealed, err := s.box.Seal(secret.Secret)
+		if err != nil {
+			return err
+		}
+		if err := s.mfaRepo.UpdateTOTPSecret(secret.UserID, sealed); err != nil {
+			return err
+		}
+		encrypted++
+	}
+
+	if encrypted > 0 {
+		log.Info().Int("count", encrypted).Msg("Encrypted plaintext TOTP secrets")
+	}
+	return nil
+}
+
+// UseRecoveryCode consumes one of the user's recovery codes
+func (s *MFAService) UseRecoveryCode(userID int, recoveryCode string) error {
+	used, err := s.mfaRepo.UseRecoveryCode(userID, utils.HashToken(normalizeRecoveryCode(recoveryCode)))
+	if err != nil {
+		return err
+	}
+	if !used {
+		return common.ErrInvalidMFACode
+	}
+
+	remaining, err := s.mfaRepo.CountRecoveryCodes(userID)
+	if err == nil {
+		log.Info().Int("user_id", userID).Int("remaining", remaining).Msg("MFA recovery code used")
+	}
+	return nil
+}
+
+// verifyCode validates the code against the stored secret and records its time step so it can't be replayed
+func (s *MFAService) verifyCode(userID int, storedSecret, code string) error {
+	secret := storedSecret
+	// Secrets of older versions are plaintext until EncryptStoredSecrets runs
+	if IsSealed(storedSecret) {
+		var err error
+		if secret, err = s.box.Open(storedSecret); err != nil {
+			return err
+		}
+	}
+
+	step, ok := ValidateTOTPCode(secret, code, time.Now())
+	if !ok {
+		return common.ErrInvalidMFACode
+	}
+
+	fresh, err := s.mfaRepo.UpdateTOTPLastUsedStep(userID, step)
+	if err != nil {
+		return err
+	}
+	if !fresh {
+		return common.ErrInvalidMFACode
+	}
+	return nil
+}
+
+// generateRecoveryCodes returns recovery codes formatted as xxxxx-xxxxx and their hashes
+func generateRecoveryCodes() ([]string, []string, error) {
+	codes := make([]string, recoveryCodeCount)
+	hashes := make([]string, recoveryCodeCount)
+	for i := range codes {
+		first, err := randomRecoveryChars(5)
+		if err != nil {
+			return nil, nil, err
+		}
+		second, err := randomRecoveryChars(5)
+		if err != nil {
+			return nil, nil, err
+		}
+		codes[i] = first + "-" + second
+		hashes[i] = utils.HashToken(normalizeRecoveryCode(codes[i]))
+	}
+	return codes, hashes, nil
+}
+
+// randomRecoveryChars picks n characters of recoveryCodeAlphabet uniformly
+func randomRecoveryChars(n int) (string, error) {
+	// Bytes above the largest multiple of the alphabet size are skipped to avoid bias
+	limit := byte(256 / len(recoveryCodeAlphabet) * len(recoveryCodeAlphabet))
+	chars := make([]byte, 0, n)
+	random := make([]byte, n*2)
+	for len(chars) < n {
+		if _, err := rand.Read(random); err != nil {
+			return "", err
+		}
+		for _, b := range random {
+			if b < limit && len(chars) < n {
+				chars = append(chars, recoveryCodeAlphabet[int(b)%len(recoveryCodeAlphabet)])
+			}
+		}
+	}
+	return string(chars), nil
+}
+
+// normalizeRecoveryCode ignores case, spaces and dashes
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToLower(code)
+	return strings.NewReplacer("-", "", " ", "").Replace(code)
+}
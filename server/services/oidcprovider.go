@@ -0,0 +1,302 @@
+package services
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"elotuschallenge/common"
+)
+
+// oidcMaxResponseBytes limits the size of documents read from providers
+const oidcMaxResponseBytes = 1 << 20
+
+// oidcClockSkew is the allowed clock difference with providers when checking ID token times
+const oidcClockSkew = time.Minute
+
+// oidcKeysRefreshInterval is the minimum time between two fetches of the provider keys, so tokens
+// with unknown key IDs can't make us hammer the provider
+const oidcKeysRefreshInterval = time.Minute
+
+// oidcDiscovery holds the fields of the provider's discovery document used by the login flow
+type oidcDiscovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// oidcTokenResponse is the response of the provider's token endpoint
+type oidcTokenResponse struct {
+	IDToken          string `json:"id_token"`
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description"`
+}
+
+// IDTokenClaims are the claims of an OpenID Connect ID token used to identify the user
+type IDTokenClaims struct {
+	Issuer            string   `json:"iss"`
+	Subject           string   `json:"sub"`
+	Audience          Audience `json:"aud"`
+	AuthorizedParty   string   `json:"azp,omitempty"`
+	Nonce             string   `json:"nonce"`
+	IssuedAt          int64    `json:"iat"`
+	NotBefore         int64    `json:"nbf,omitempty"`
+	ExpiresAt         int64    `json:"exp"`
+	Email             string   `json:"email,omitempty"`
+	EmailVerified     bool     `json:"email_verified,omitempty"`
+	PreferredUsername string   `json:"preferred_username,omitempty"`
+}
+
+// oidcProvider talks to one OpenID Connect provider, its discovery document and keys are fetched when first needed
+type oidcProvider struct {
+	config OIDCProviderConfig
+	client *http.Client
+
+	mu            sync.Mutex
+	discovery     *oidcDiscovery
+	keys          map[string]*SigningKey
+	keysFetchedAt time.Time
+}
+
+func newOIDCProvider(config OIDCProviderConfig, client *http.Client) *oidcProvider {
+	return &oidcProvider{config: config, client: client}
+}
+
+// authorizationURL builds the URL the browser is sent to, using PKCE with S256
+func (p *oidcProvider) authorizationURL(state, nonce, codeVerifier string) (string, error) {
+	discovery, err := p.discover()
+	if err != nil {
+		return "", err
+	}
+
+	authURL, err := url.Parse(discovery.AuthorizationEndpoint)
+	if err != nil {
+		return "", fmt.Errorf("invalid authorization endpoint of provider %s: %w", p.config.Name, err)
+	}
+
+	query := authURL.Query()
+	query.Set("response_type", "code")
+	query.Set("client_id", p.config.ClientID)
+	query.Set("redirect_uri", p.config.RedirectURL)
+	query.Set("scope", strings.Join(p.config.Scopes, " "))
+	query.Set("state", state)
+	query.Set("nonce", nonce)
+	query.Set("code_challenge", PKCEChallenge(codeVerifier))
+	query.Set("code_challenge_method", "S256")
+	authURL.RawQuery = query.Encode()
+	return authURL.String(), nil
+}
+
+// exchangeCode redeems the authorization code with its PKCE verifier and returns the raw ID token
+func (p *oidcProvider) exchangeCode(code, codeVerifier string) (string, error) {
+	discovery, err := p.discover()
+	if err != nil {
+		return "", err
+	}
+
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", p.config.RedirectURL)
+	form.Set("client_id", p.config.ClientID)
+	form.Set("code_verifier", codeVerifier)
+
+	req, err := http.NewRequest(http.MethodPost, discovery.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set(common.HeaderContentType, "application/x-www-form-urlencoded")
+	if p.config.ClientSecret != "" {
+		req.SetBasicAuth(url.QueryEscape(p.config.ClientID), url.QueryEscape(p.config.ClientSecret))
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("%w: %w", common.ErrOIDCExchangeFailed, err)
+	}
+	defer resp.Body.Close()
+
+	var tokenResponse oidcTokenResponse
+	if err := json.NewDecoder(io.LimitReader(resp.Body, oidcMaxResponseBytes)).Decode(&tokenResponse); err != nil {
+		return "", fmt.Errorf("%w: status %d: %w", common.ErrOIDCExchangeFailed, resp.StatusCode, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("%w: status %d: %s %s", common.ErrOIDCExchangeFailed, resp.StatusCode,
+			tokenResponse.Error, tokenResponse.ErrorDescription)
+	}
+	if tokenResponse.IDToken == "" {
+		return "", fmt.Errorf("%w: no id_token in response", common.ErrOIDCExchangeFailed)
+	}
+	return tokenResponse.IDToken, nil
+}
+
+// verifyIDToken checks the signature of the ID token against the provider keys and its claims
+// against our client and the nonce of the login
+func (p *oidcProvider) verifyIDToken(rawToken, nonce string) (*IDTokenClaims, error) {
+	discovery, err := p.discover()
+	if err != nil {
+		return nil, err
+	}
+
+	parts := strings.Split(rawToken, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("%w: invalid token format", common.ErrOIDCIDTokenInvalid)
+	}
+
+	headerBytes, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid header encoding", common.ErrOIDCIDTokenInvalid)
+	}
+	var header tokenHeader
+	if err := json.Unmarshal(headerBytes, &header); err != nil {
+		return nil, fmt.Errorf("%w: invalid header format", common.ErrOIDCIDTokenInvalid)
+	}
+
+	// Provider tokens are only accepted with their published public keys, never with a shared secret or "none"
+	if !IsAsymmetricAlgorithm(header.Algorithm) {
+		return nil, fmt.Errorf("%w: unsupported algorithm %q", common.ErrOIDCIDTokenInvalid, header.Algorithm)
+	}
+	key, err := p.key(discovery, header.KeyID)
+	if err != nil {
+		return nil, err
+	}
+	if key.Algorithm != header.Algorithm {
+		return nil, fmt.Errorf("%w: algorithm %q for key %s", common.ErrOIDCIDTokenInvalid, header.Algorithm, key.ID)
+	}
+	if !key.verify(parts[0]+"."+parts[1], parts[2]) {
+		return nil, fmt.Errorf("%w: invalid signature", common.ErrOIDCIDTokenInvalid)
+	}
+
+	payloadBytes, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid payload encoding", common.ErrOIDCIDTokenInvalid)
+	}
+	var claims IDTokenClaims
+	if err := json.Unmarshal(payloadBytes, &claims); err != nil {
+		return nil, fmt.Errorf("%w: invalid payload format", common.ErrOIDCIDTokenInvalid)
+	}
+
+	if err := p.validateClaims(&claims, discovery.Issuer, nonce); err != nil {
+		return nil, err
+	}
+	return &claims, nil
+}
+
+// validateClaims checks the ID token claims required by OpenID Connect Core 3.1.3.7
+func (p *oidcProvider) validateClaims(claims *IDTokenClaims, issuer, nonce string) error {
+	now := time.Now()
+	skew := int64(oidcClockSkew / time.Second)
+
+	if claims.Issuer != issuer {
+		return fmt.Errorf("%w: issuer %q", common.ErrOIDCIDTokenInvalid, claims.Issuer)
+	}
+	if claims.Subject == "" {
+		return fmt.Errorf("%w: missing sub", common.ErrOIDCIDTokenInvalid)
+	}
+	if !claims.Audience.Contains([]string{p.config.ClientID}) {
+		return fmt.Errorf("%w: audience %v", common.ErrOIDCIDTokenInvalid, []string(claims.Audience))
+	}
+	if len(claims.Audience) > 1 && claims.AuthorizedParty != p.config.ClientID {
+		return fmt.Errorf("%w: authorized party %q", common.ErrOIDCIDTokenInvalid, claims.AuthorizedParty)
+	}
+	if claims.ExpiresAt == 0 || now.Unix() > claims.ExpiresAt+skew {
+		return fmt.Errorf("%w: expired", common.ErrOIDCIDTokenInvalid)
+	}
+	if now.Unix()+skew < claims.IssuedAt || (claims.NotBefore != 0 && now.Unix()+skew < claims.NotBefore) {
+		return fmt.Errorf("%w: not valid yet", common.ErrOIDCIDTokenInvalid)
+	}
+	if claims.Nonce == "" || subtle.ConstantTimeCompare([]byte(claims.Nonce), []byte(nonce)) != 1 {
+		return fmt.Errorf("%w: nonce mismatch", common.ErrOIDCIDTokenInvalid)
+	}
+	return nil
+}
+
+// discover fetches the discovery document once, failures are retried on the next login
+func (p *oidcProvider) discover() (*oidcDiscovery, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.discovery != nil {
+		return p.discovery, nil
+	}
+
+	var discovery oidcDiscovery
+	if err := p.getJSON(strings.TrimSuffix(p.config.Issuer, "/")+"/.well-known/openid-configuration", &discovery); err != nil {
+		return nil, fmt.Errorf("discovery of provider %s failed: %w", p.config.Name, err)
+	}
+
+	// The issuer of the document must be the configured one, otherwise tokens could be accepted from another provider
+	if discovery.Issuer != p.config.Issuer {
+		return nil, fmt.Errorf("provider %s announced issuer %q instead of %q", p.config.Name, discovery.Issuer, p.config.Issuer)
+	}
+	if discovery.AuthorizationEndpoint == "" || discovery.TokenEndpoint == "" || discovery.JWKSURI == "" {
+		return nil, fmt.Errorf("discovery document of provider %s is incomplete", p.config.Name)
+	}
+
+	p.discovery = &discovery
+	return p.discovery, nil
+}
+
+// key returns the provider key with the ID, fetching the key set again when the key is unknown
+// since providers rotate their keys
+func (p *oidcProvider) key(discovery *oidcDiscovery, kid string) (*SigningKey, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if key, ok := p.keys[kid]; ok {
+		return key, nil
+	}
+	if time.Since(p.keysFetchedAt) < oidcKeysRefreshInterval {
+		return nil, fmt.Errorf("%w: unknown key %q", common.ErrOIDCIDTokenInvalid, kid)
+	}
+
+	var keySet JWKSet
+	if err := p.getJSON(discovery.JWKSURI, &keySet); err != nil {
+		return nil, fmt.Errorf("fetching keys of provider %s failed: %w", p.config.Name, err)
+	}
+
+	// Keys we can't use, e.g. encryption keys, are skipped
+	keys := make(map[string]*SigningKey)
+	for _, jwk := range keySet.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		if key, err := jwk.verificationKey(); err == nil {
+			keys[jwk.KeyID] = key
+		}
+	}
+	p.keys = keys
+	p.keysFetchedAt = time.Now()
+
+	if key, ok := p.keys[kid]; ok {
+		return key, nil
+	}
+	return nil, fmt.Errorf("%w: unknown key %q", common.ErrOIDCIDTokenInvalid, kid)
+}
+
+func (p *oidcProvider) getJSON(documentURL string, target interface{}) error {
+	resp, err := p.client.Get(documentURL)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s returned status %d", documentURL, resp.StatusCode)
+	}
+	return json.NewDecoder(io.LimitReader(resp.Body, oidcMaxResponseBytes)).Decode(target)
+}
+
+// PKCEChallenge returns the S256 code challenge of a PKCE code verifier (RFC 7636)
+func PKCEChallenge(codeVerifier string) string {
+	digest := sha256.Sum256([]byte(codeVerifier))
+	return base64.RawURLEncoding.EncodeToString(digest[:])
+}
@@ -0,0 +1,230 @@
+package services
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"elotuschallenge/common"
+	"elotuschallenge/models"
+	"elotuschallenge/repository"
+	"elotuschallenge/utils"
+
+	"github.com/rs/zerolog/log"
+)
+
+// OIDCStateExpiration is how long the user has to sign in at the provider
+const OIDCStateExpiration = 10 * time.Minute
+
+// oidcRandomBytes is the amount of random bytes in states, nonces and PKCE code verifiers
+const oidcRandomBytes = 32
+
+// oidcUsernameAttempts is how many suffixed usernames are tried when the one of the identity is taken
+const oidcUsernameAttempts = 5
+
+// usernameDisallowed matches the characters removed from usernames taken from identity providers
+var usernameDisallowed = regexp.MustCompile(`[^a-zA-Z0-9._-]+`)
+
+type OIDCService struct {
+	providers map[string]*oidcProvider
+	oidcRepo  repository.IOIDC
+	userRepo  repository.IUser
+}
+
+// NewOIDCService creates the OpenID Connect service for the configured providers, client is used for
+// all requests to the providers
+func NewOIDCService(configs []OIDCProviderConfig, oidcRepo repository.IOIDC, userRepo repository.IUser,
+	client *http.Client) IOIDCService {
+	providers := make(map[string]*oidcProvider, len(configs))
+	for _, config := range configs {
+		providers[config.Name] = newOIDCProvider(config, client)
+	}
+	return &OIDCService{
+		providers: providers,
+		oidcRepo:  oidcRepo,
+		userRepo:  userRepo,
+	}
+}
+
+// Providers returns the names of the configured providers
+func (s *OIDCService) Providers() []string {
+	names := make([]string, 0, len(s.providers))
+	for name := range s.providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// StartLogin stores a new login state and returns the provider URL to send the browser to, along with the
+// state the browser must present again on the callback
+func (s *OIDCService) StartLogin(providerName string, useCookies bool) (string, string, error) {
+	provider, ok := s.providers[providerName]
+	if !ok {
+		return "", "", fmt.Errorf("%w: %s", common.ErrOIDCProviderNotFound, providerName)
+	}
+
+	var values [3]string
+	for i := range values {
+		value, err := utils.GenerateSecureToken(oidcRandomBytes)
+		if err != nil {
+			return "", "", err
+		}
+		values[i] = value
+	}
+	state, nonce, codeVerifier := values[0], values[1], values[2]
+
+	authURL, err := provider.authorizationURL(state, nonce, codeVerifier)
+	if err != nil {
+		return "", "", err
+	}
+
+	// Only the hash of the state is stored, the verifier never leaves the server
+	err = s.oidcRepo.CreateState(&models.OIDCState{
+		StateHash:    utils.HashToken(state),
+		Provider:     providerName,
+		CodeVerifier: codeVerifier,
+		Nonce:        nonce,
+		UseCookies:   useCookies,
+		ExpiresAt:    time.Now().Add(OIDCStateExpiration),
+	})
+	if err != nil {
+		return "", "", err
+	}
+	return authURL, state, nil
+}
+
+// CompleteLogin consumes the login state, redeems the code and verifies the ID token, then returns the user
+// linked to the provider account, creating one on first sign in
+func (s *OIDCService) CompleteLogin(providerName, state, code string) (*OIDCLogin, error) {
+	provider, ok := s.providers[providerName]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", common.ErrOIDCProviderNotFound, providerName)
+	}
+
+	// The state is consumed first so it can't be replayed, even when the rest of the login fails
+	loginState, err := s.oidcRepo.ConsumeState(utils.HashToken(state))
+	if err != nil {
+		return nil, err
+	}
+	if loginState == nil || loginState.Provider != providerName {
+		return nil, common.ErrOIDCStateInvalid
+	}
+	if time.Now().After(loginState.ExpiresAt) {
+		return nil, fmt.Errorf("%w: expired at %s", common.ErrOIDCStateInvalid, loginState.ExpiresAt)
+	}
+
+	idToken, err := provider.exchangeCode(code, loginState.CodeVerifier)
+	if err != nil {
+		return nil, err
+	}
+	claims, err := provider.verifyIDToken(idToken, loginState.Nonce)
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := s.linkedUser(providerName, claims)
+	if err != nil {
+		return nil, err
+	}
+	return &OIDCLogin{User: user, UseCookies: loginState.UseCookies}, nil
+}
+
+// linkedUser returns the user linked to the issuer and subject of the ID token, accounts are never linked
+// by username or email since those can be chosen at the provider
+func (s *OIDCService) linkedUser(providerName string, claims *IDTokenClaims) (*models.User, error) {
+	identity, err := s.oidcRepo.GetIdentity(claims.Issuer, claims.Subject)
+	if err != nil {
+		return nil, err
+	}
+	if identity != nil {
+		return s.identityUser(identity)
+	}
+
+	username, err := s.availableUsername(providerName, claims)
+	if err != nil {
+		return nil, err
+	}
+
+	var email string
+	if claims.EmailVerified {
+		email = claims.Email
+	}
+
+	// Accounts created by single sign-on have no password, one can be set with a password reset
+	user, err := s.oidcRepo.CreateUserWithIdentity(&models.User{
+		Username: username,
+		Role:     models.RoleUser,
+		Status:   models.StatusActive,
+	}, &models.UserIdentity{
+		Issuer:  claims.Issuer,
+		Subject: claims.Subject,
+		Email:   email,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		// Another login of the same provider account created the user first
+		identity, err := s.oidcRepo.GetIdentity(claims.Issuer, claims.Subject)
+		if err != nil {
+			return nil, err
+		}
+		if identity == nil {
+			return nil, fmt.Errorf("identity %s of %s neither created nor found", claims.Subject, claims.Issuer)
+		}
+		return s.identityUser(identity)
+	}
+
+	log.Info().Str("provider", providerName).Int("user_id", user.ID).Str("username", username).Msg("User created by single sign-on")
+	return user, nil
+}
+
+// identityUser returns the user a provider account is linked to
+func (s *OIDCService) identityUser(identity *models.UserIdentity) (*models.User, error) {
+	user, err := s.userRepo.GetUserByID(identity.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, fmt.Errorf("%w: user %d", common.ErrUserNotFound, identity.UserID)
+	}
+	return user, nil
+}
+
+// availableUsername derives a username from the preferred username or the email of the identity,
+// adding a random suffix when it is taken
+func (s *OIDCService) availableUsername(providerName string, claims *IDTokenClaims) (string, error) {
+	base := claims.PreferredUsername
+	if base == "" {
+		base, _, _ = strings.Cut(claims.Email, "@")
+	}
+	base = usernameDisallowed.ReplaceAllString(base, "")
+	if len(base) < 3 {
+		base = providerName + "-user"
+	}
+	if len(base) > 40 {
+		base = base[:40]
+	}
+
+	username := base
+	for attempt := 0; attempt < oidcUsernameAttempts; attempt++ {
+		exists, err := s.userRepo.UserExists(username)
+		if err != nil {
+			return "", err
+		}
+		if !exists {
+			return username, nil
+		}
+		username = base + "-" + strings.ToLower(utils.GenerateRandomString(6))
+	}
+	return "", fmt.Errorf("no available username for %q", base)
+}
+
+// PurgeExpiredStates removes abandoned logins, it is meant to run periodically
+func (s *OIDCService) PurgeExpiredStates() (int64, error) {
+	return s.oidcRepo.DeleteExpiredStates(time.Now())
+}
@@ -0,0 +1,31 @@
+package services
+
+import (
+	"elotuschallenge/models"
+	"elotuschallenge/repository"
+
+	"github.com/rs/zerolog/log"
+)
+
+// OutboxNotifier writes notifications to the outbox table instead of sending them, so the
+// application works without a mail server; a separate process may deliver and mark them sent
+type OutboxNotifier struct {
+	outboxRepo repository.IOutbox
+}
+
+func NewOutboxNotifier(outboxRepo repository.IOutbox) INotifier {
+	return &OutboxNotifier{
+		outboxRepo: outboxRepo,
+	}
+}
+
+// Notify appends the notification to the outbox
+func (n *OutboxNotifier) Notify(notification *models.Notification) error {
+	created, err := n.outboxRepo.CreateNotification(notification)
+	if err != nil {
+		return err
+	}
+
+	log.Info().Int("notification_id", created.ID).Str("recipient", created.Recipient).Str("kind", created.Kind).Msg("Notification written to outbox")
+	return nil
+}
@@ -0,0 +1,171 @@
+package services
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const HashAlgorithmArgon2id = "argon2id"
+const HashAlgorithmBcrypt = "bcrypt"
+
+var ErrUnknownHashFormat = fmt.Errorf("unknown password hash format")
+
+// Argon2idParams holds the argon2id cost parameters, memory is in KiB
+type Argon2idParams struct {
+	Memory      uint32
+	Iterations  uint32
+	Parallelism uint8
+	SaltLength  uint32
+	KeyLength   uint32
+}
+
+// DefaultArgon2idParams follows the OWASP recommended minimum for argon2id
+var DefaultArgon2idParams = Argon2idParams{
+	Memory:      19456,
+	Iterations:  2,
+	Parallelism: 1,
+	SaltLength:  16,
+	KeyLength:   32,
+}
+
+// PasswordHasherConfig selects the algorithm and parameters of new hashes
+type PasswordHasherConfig struct {
+	Algorithm  string
+	Argon2id   Argon2idParams
+	BcryptCost int
+}
+
+// PasswordHasher hashes new passwords with the configured algorithm and verifies
+// both bcrypt and argon2id hashes, recognised by their prefix
+type PasswordHasher struct {
+	config PasswordHasherConfig
+}
+
+func NewPasswordHasher(config PasswordHasherConfig) (IPasswordHasher, error) {
+	switch config.Algorithm {
+	case HashAlgorithmArgon2id:
+		if config.Argon2id.Memory == 0 || config.Argon2id.Iterations == 0 || config.Argon2id.Parallelism == 0 ||
+			config.Argon2id.SaltLength == 0 || config.Argon2id.KeyLength == 0 {
+			return nil, fmt.Errorf("argon2id parameters must be positive")
+		}
+	case HashAlgorithmBcrypt:
+		if config.BcryptCost < bcrypt.MinCost || config.BcryptCost > bcrypt.MaxCost {
+			return nil, fmt.Errorf("bcrypt cost must be between %d and %d", bcrypt.MinCost, bcrypt.MaxCost)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported password hash algorithm %q", config.Algorithm)
+	}
+	return &PasswordHasher{config: config}, nil
+}
+
+// Hash hashes the password with the configured algorithm and parameters
+func (h *PasswordHasher) Hash(password string) (string, error) {
+	if h.config.Algorithm == HashAlgorithmBcrypt {
+		hash, err := bcrypt.GenerateFromPassword([]byte(password), h.config.BcryptCost)
+		return string(hash), err
+	}
+
+	params := h.config.Argon2id
+	salt := make([]byte, params.SaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	key := argon2.IDKey([]byte(password), salt, params.Iterations, params.Memory, params.Parallelism, params.KeyLength)
+	return encodeArgon2id(params, salt, key), nil
+}
+
+// Verify checks the password against a bcrypt or argon2id hash
+func (h *PasswordHasher) Verify(password, hash string) (bool, error) {
+	switch hashAlgorithm(hash) {
+	case HashAlgorithmBcrypt:
+		err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
+		if err == bcrypt.ErrMismatchedHashAndPassword {
+			return false, nil
+		}
+		return err == nil, err
+	case HashAlgorithmArgon2id:
+		params, salt, key, err := decodeArgon2id(hash)
+		if err != nil {
+			return false, err
+		}
+		computed := argon2.IDKey([]byte(password), salt, params.Iterations, params.Memory, params.Parallelism, params.KeyLength)
+		return subtle.ConstantTimeCompare(key, computed) == 1, nil
+	default:
+		return false, ErrUnknownHashFormat
+	}
+}
+
+// NeedsRehash reports whether the hash was made with another algorithm or weaker parameters than configured
+func (h *PasswordHasher) NeedsRehash(hash string) bool {
+	if hashAlgorithm(hash) != h.config.Algorithm {
+		return true
+	}
+
+	if h.config.Algorithm == HashAlgorithmBcrypt {
+		cost, err := bcrypt.Cost([]byte(hash))
+		return err != nil || cost != h.config.BcryptCost
+	}
+
+	params, salt, key, err := decodeArgon2id(hash)
+	if err != nil {
+		return true
+	}
+	current := h.config.Argon2id
+	return params.Memory != current.Memory || params.Iterations != current.Iterations ||
+		params.Parallelism != current.Parallelism || uint32(len(salt)) != current.SaltLength ||
+		uint32(len(key)) != current.KeyLength
+}
+
+// hashAlgorithm recognises the algorithm of a hash from its prefix
+func hashAlgorithm(hash string) string {
+	switch {
+	case strings.HasPrefix(hash, "$argon2id$"):
+		return HashAlgorithmArgon2id
+	case strings.HasPrefix(hash, "$2a$"), strings.HasPrefix(hash, "$2b$"), strings.HasPrefix(hash, "$2y$"):
+		return HashAlgorithmBcrypt
+	default:
+		return ""
+	}
+}
+
+// encodeArgon2id formats the hash in the PHC string format: $argon2id$v=19$m=...,t=...,p=...$salt$key
+func encodeArgon2id(params Argon2idParams, salt, key []byte) string {
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s", argon2.Version,
+		params.Memory, params.Iterations, params.Parallelism,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key))
+}
+
+// decodeArgon2id parses a PHC formatted argon2id hash
+func decodeArgon2id(hash string) (Argon2idParams, []byte, []byte, error) {
+	var params Argon2idParams
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 {
+		return params, nil, nil, fmt.Errorf("%w: malformed argon2id hash", ErrUnknownHashFormat)
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return params, nil, nil, fmt.Errorf("%w: unsupported argon2 version", ErrUnknownHashFormat)
+	}
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.Memory, &params.Iterations, &params.Parallelism); err != nil {
+		return params, nil, nil, fmt.Errorf("%w: malformed argon2id parameters", ErrUnknownHashFormat)
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return params, nil, nil, fmt.Errorf("%w: malformed argon2id salt", ErrUnknownHashFormat)
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil || len(key) == 0 {
+		return params, nil, nil, fmt.Errorf("%w: malformed argon2id key", ErrUnknownHashFormat)
+	}
+	params.SaltLength = uint32(len(salt))
+	params.KeyLength = uint32(len(key))
+	return params, salt, key, nil
+}
@@ -0,0 +1,199 @@
+package services
+
+import (
+	"fmt"
+	"time"
+
+	"elotuschallenge/common"
+	"elotuschallenge/models"
+	"elotuschallenge/repository"
+	"elotuschallenge/utils"
+
+	"github.com/rs/zerolog/log"
+)
+
+// resetTokenBytes is the amount of random bytes in a password reset token
+const resetTokenBytes = 32
+
+type PasswordService struct {
+	userRepo               repository.IUser
+	resetRepo              repository.IPasswordReset
+	apiKeyRepo             repository.IAPIKey
+	hasher                 IPasswordHasher
+	notifier               INotifier
+	sessionService         ISessionService
+	resetExpirationSeconds int64
+}
+
+func NewPasswordService(userRepo repository.IUser, resetRepo repository.IPasswordReset, apiKeyRepo repository.IAPIKey,
+	hasher IPasswordHasher, notifier INotifier, sessionService ISessionService, resetExpirationSeconds int64) IPasswordService {
+	return &PasswordService{
+		userRepo:               userRepo,
+		resetRepo:              resetRepo,
+		apiKeyRepo:             apiKeyRepo,
+		hasher:                 hasher,
+		notifier:               notifier,
+		sessionService:         sessionService,
+		resetExpirationSeconds: resetExpirationSeconds,
+	}
+}
+
+// ChangePassword replaces the password after checking the current one, all tokens of the user are revoked
+func (s *PasswordService) ChangePassword(userID int, currentPassword, newPassword string) (*models.User, error) {
+	user, err := s.VerifyPassword(userID, currentPassword)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.setPassword(user, newPassword); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// VerifyPassword checks the password of a signed in user before a sensitive change
+func (s *PasswordService) VerifyPassword(userID int, password string) (*models.User, error) {
+	user, err := s.userRepo.GetUserByID(userID)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, common.ErrUserNotFound
+	}
+
+	valid, err := s.hasher.Verify(password, user.PasswordHash)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", common.ErrInvalidCredentials, err)
+	}
+	if !valid {
+		return nil, common.ErrInvalidCredentials
+	}
+	return user, nil
+}
+
+// RequestPasswordReset sends a single-use reset token to the user. Unknown usernames are
+// ignored without error so the response doesn't reveal which accounts exist.
+func (s *PasswordService) RequestPasswordReset(username string) error {
+	user, err := s.userRepo.GetUserByUsername(username)
+	if err != nil {
+		return err
+	}
+	if user == nil {
+		log.Info().Str("username", username).Msg("Password reset requested for unknown user")
+		return nil
+	}
+
+	// Only the latest reset token is valid
+	if err := s.resetRepo.DeleteUserResetTokens(user.ID); err != nil {
+		return err
+	}
+
+	token, err := utils.GenerateSecureToken(resetTokenBytes)
+	if err != nil {
+		return err
+	}
+
+	expiresIn := time.Duration(s.resetExpirationSeconds) * time.Second
+	_, err = s.resetRepo.CreateResetToken(&models.PasswordResetToken{
+		UserID:    user.ID,
+		TokenHash: utils.HashToken(token),
+		ExpiresAt: time.Now().Add(expiresIn),
+	})
+	if err != nil {
+		return err
+	}
+
+	return s.notifier.Notify(&models.Notification{
+		Recipient: user.Username,
+		Kind:      models.NotificationPasswordReset,
+		Subject:   "Reset your password",
+		Body:      fmt.Sprintf("Use this token to reset your password, it expires in %s and can be used once:\n\n%s\n", expiresIn, token),
+	})
+}
+
+// ResetPassword consumes a reset token and sets the new password, all tokens of the user are revoked
+func (s *PasswordService) ResetPassword(token, newPassword string) (*models.User, error) {
+	stored, err := s.resetRepo.GetResetTokenByHash(utils.HashToken(token))
+	if err != nil {
+		return nil, err
+	}
+	if stored == nil || stored.UsedAt != nil {
+		return nil, common.ErrResetTokenInvalid
+	}
+	if time.Now().After(stored.ExpiresAt) {
+		return nil, common.ErrResetTokenExpired
+	}
+
+	// Mark as used atomically so the token can't be used twice concurrently
+	marked, err := s.resetRepo.MarkResetTokenUsed(stored.ID)
+	if err != nil {
+		return nil, err
+	}
+	if !marked {
+		return nil, common.ErrResetTokenInvalid
+	}
+
+	user, err := s.userRepo.GetUserByID(stored.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, common.ErrResetTokenInvalid
+	}
+
+	if err := s.setPassword(user, newPassword); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// PurgeExpiredResetTokens removes expired reset tokens, it returns the number of removed tokens
+func (s *PasswordService) PurgeExpiredResetTokens() (int64, error) {
+	return s.resetRepo.DeleteExpiredResetTokens(time.Now())
+}
+
+// setPassword stores the new password hash and revokes every token, API key and reset token of the user
+func (s *PasswordService) setPassword(user *models.User, newPassword string) error {
+	hash, err := s.hasher.Hash(newPassword)
+	if err != nil {
+		return err
+	}
+	if err := s.userRepo.UpdatePasswordHash(user.ID, hash); err != nil {
+		return err
+	}
+	user.PasswordHash = hash
+
+	// Access tokens carry the token version, incrementing it rejects all of them
+	version, err := s.userRepo.IncrementTokenVersion(user.ID)
+	if err != nil {
+		return err
+	}
+	user.TokenVersion = version
+
+	// Sessions are signed out along with their refresh tokens
+	if err := s.sessionService.RevokeUserSessions(user.ID); err != nil {
+		return err
+	}
+	if err := s.resetRepo.DeleteUserResetTokens(user.ID); err != nil {
+		return err
+	}
+
+	// API keys may have been created by whoever knew the old password
+	if _, err := s.apiKeyRepo.RevokeUserAPIKeys(user.ID); err != nil {
+		return err
+	}
+
+	// Let the user know in case someone else changed the password
+	err = s.notifier.Notify(&models.Notification{
+		Recipient: user.Username,
+		Kind:      models.NotificationPasswordChanged,
+		Subject:   "Your password was changed",
+		Body:      "The password of your account was changed and you were signed out everywhere, your API keys were revoked. If this wasn't you, reset your password.\n",
+	})
+	if err != nil {
+		log.Error().Err(err).Int("user_id", user.ID).Msg("Failed to notify password change")
+	}
+
+	log.Info().Int("user_id", user.ID).Int("token_version", version).Msg("Password changed, tokens revoked")
+	return nil
+}
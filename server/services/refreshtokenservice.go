@@ -0,0 +1,121 @@
+package services
+
+import (
+	"fmt"
+	"time"
+
+	"elotuschallenge/common"
+	"elotuschallenge/models"
+	"elotuschallenge/repository"
+	"elotuschallenge/utils"
+
+	"github.com/rs/zerolog/log"
+)
+
+// refreshTokenBytes is the amount of random bytes in an opaque refresh token
+const refreshTokenBytes = 32
+
+type RefreshTokenService struct {
+	refreshTokenRepo  repository.IRefreshToken
+	expirationSeconds int64
+}
+
+func NewRefreshTokenService(refreshTokenRepo repository.IRefreshToken, expirationSeconds int64) IRefreshTokenService {
+	return &RefreshTokenService{
+		refreshTokenRepo:  refreshTokenRepo,
+		expirationSeconds: expirationSeconds,
+	}
+}
+
+// IssueRefreshToken creates a refresh token starting a new token family, the family is named after the session
+// so signing out the session revokes it
+func (s *RefreshTokenService) IssueRefreshToken(userID int, sessionID string) (string, error) {
+	return s.createToken(userID, sessionID)
+}
+
+// RotateRefreshToken consumes a refresh token and returns its replacement together with the consumed token.
+// Presenting an already used token revokes the whole family since it was most likely stolen.
+func (s *RefreshTokenService) RotateRefreshToken(token string) (string, *models.RefreshToken, error) {
+	stored, err := s.refreshTokenRepo.GetRefreshTokenByHash(utils.HashToken(token))
+	if err != nil {
+		return "", nil, err
+	}
+	if stored == nil || stored.RevokedAt != nil {
+		return "", nil, common.ErrRefreshTokenInvalid
+	}
+	if stored.UsedAt != nil {
+		return "", nil, s.handleReuse(stored)
+	}
+	if time.Now().After(stored.ExpiresAt) {
+		return "", nil, common.ErrRefreshTokenExpired
+	}
+
+	// Mark as used atomically so two concurrent rotations cannot both succeed
+	marked, err := s.refreshTokenRepo.MarkRefreshTokenUsed(stored.ID)
+	if err != nil {
+		return "", nil, err
+	}
+	if !marked {
+		return "", nil, s.handleReuse(stored)
+	}
+
+	newToken, err := s.createToken(stored.UserID, stored.FamilyID)
+	if err != nil {
+		return "", nil, err
+	}
+	return newToken, stored, nil
+}
+
+// RevokeRefreshToken revokes the family of a refresh token owned by the user
+func (s *RefreshTokenService) RevokeRefreshToken(token string, userID int) error {
+	stored, err := s.refreshTokenRepo.GetRefreshTokenByHash(utils.HashToken(token))
+	if err != nil {
+		return err
+	}
+	if stored == nil || stored.UserID != userID {
+		return common.ErrRefreshTokenInvalid
+	}
+	return s.refreshTokenRepo.RevokeFamily(stored.FamilyID)
+}
+
+// RevokeUserRefreshTokens revokes every refresh token of a user
+func (s *RefreshTokenService) RevokeUserRefreshTokens(userID int) error {
+	return s.refreshTokenRepo.RevokeUserRefreshTokens(userID)
+}
+
+// PurgeExpiredRefreshTokens deletes refresh tokens which have expired
+func (s *RefreshTokenService) PurgeExpiredRefreshTokens() (int64, error) {
+	return s.refreshTokenRepo.DeleteExpiredRefreshTokens(time.Now())
+}
+
+// handleReuse revokes the family of a reused token
+func (s *RefreshTokenService) handleReuse(stored *models.RefreshToken) error {
+	log.Warn().
+		Int("user_id", stored.UserID).
+		Str("family_id", stored.FamilyID).
+		Msg("Refresh token reuse detected, revoking token family")
+
+	if err := s.refreshTokenRepo.RevokeFamily(stored.FamilyID); err != nil {
+		return fmt.Errorf("%w: %w", common.ErrRefreshTokenReused, err)
+	}
+	return common.ErrRefreshTokenReused
+}
+
+// createToken generates and stores a new refresh token in the given family
+func (s *RefreshTokenService) createToken(userID int, familyID string) (string, error) {
+	token, err := utils.GenerateSecureToken(refreshTokenBytes)
+	if err != nil {
+		return "", err
+	}
+
+	_, err = s.refreshTokenRepo.CreateRefreshToken(&models.RefreshToken{
+		TokenHash: utils.HashToken(token),
+		FamilyID:  familyID,
+		UserID:    userID,
+		ExpiresAt: time.Now().Add(time.Duration(s.expirationSeconds) * time.Second),
+	})
+	if err != nil {
+		return "", err
+	}
+	return token, nil
+}
@@ -0,0 +1,68 @@
+package services
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"strings"
+)
+
+// sealedPrefix marks values encrypted by SecretBox, the version allows changing the scheme later
+const sealedPrefix = "v1:"
+
+// SecretBox encrypts secrets stored in the database with AES-256-GCM, so a leaked database doesn't expose them
+type SecretBox struct {
+	aead cipher.AEAD
+}
+
+// NewSecretBox creates a box with a key derived from a server secret of at least 32 characters
+func NewSecretBox(secret string) (*SecretBox, error) {
+	if len(secret) < 32 {
+		return nil, fmt.Errorf("encryption secret must be at least 32 characters long")
+	}
+	key := sha256.Sum256([]byte(secret))
+	block, err := aes.NewCipher(key[:])
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &SecretBox{aead: aead}, nil
+}
+
+// Seal encrypts a secret with a random nonce
+func (b *SecretBox) Seal(plaintext string) (string, error) {
+	nonce := make([]byte, b.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := b.aead.Seal(nonce, nonce, []byte(plaintext), nil)
+	return sealedPrefix + base64.RawStdEncoding.EncodeToString(sealed), nil
+}
+
+// Open decrypts a value of Seal, it fails when the value was encrypted with another key or altered
+func (b *SecretBox) Open(value string) (string, error) {
+	if !IsSealed(value) {
+		return "", fmt.Errorf("secret is not encrypted")
+	}
+	sealed, err := base64.RawStdEncoding.DecodeString(strings.TrimPrefix(value, sealedPrefix))
+	if err != nil || len(sealed) < b.aead.NonceSize() {
+		return "", fmt.Errorf("invalid encrypted secret")
+	}
+	nonce, ciphertext := sealed[:b.aead.NonceSize()], sealed[b.aead.NonceSize():]
+	plaintext, err := b.aead.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to decrypt secret: %w", err)
+	}
+	return string(plaintext), nil
+}
+
+// IsSealed tells whether a stored value was encrypted by a SecretBox, values stored by older versions are not
+func IsSealed(value string) bool {
+	return strings.HasPrefix(value, sealedPrefix)
+}
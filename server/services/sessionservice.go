@@ -0,0 +1,111 @@
+package services
+
+import (
+	"fmt"
+	"time"
+
+	"elotuschallenge/common"
+	"elotuschallenge/models"
+	"elotuschallenge/repository"
+	"elotuschallenge/utils"
+
+	"github.com/rs/zerolog/log"
+)
+
+// sessionIDBytes is the amount of random bytes in a session ID
+const sessionIDBytes = 16
+
+// maxUserAgentLength caps the user agent stored with a session
+const maxUserAgentLength = 500
+
+// sessionTouchInterval is how often the last activity of a session is written, requests in between skip the write
+const sessionTouchInterval = time.Minute
+
+type SessionService struct {
+	sessionRepo      repository.ISession
+	refreshTokenRepo repository.IRefreshToken
+}
+
+func NewSessionService(sessionRepo repository.ISession, refreshTokenRepo repository.IRefreshToken) ISessionService {
+	return &SessionService{
+		sessionRepo:      sessionRepo,
+		refreshTokenRepo: refreshTokenRepo,
+	}
+}
+
+// NewSessionID generates the ID of a new session, it also names the refresh token family of the session
+func (s *SessionService) NewSessionID() (string, error) {
+	return utils.GenerateSecureToken(sessionIDBytes)
+}
+
+// RecordToken records an access token issued in a session, starting the session on its first token.
+// Revoked sessions are never brought back.
+func (s *SessionService) RecordToken(session *models.Session) error {
+	session.UserAgent = truncateUserAgent(session.UserAgent)
+	session.LastSeenAt = time.Now()
+	saved, err := s.sessionRepo.SaveSession(session)
+	if err != nil {
+		return err
+	}
+	if !saved {
+		return fmt.Errorf("%w: %s", common.ErrSessionRevoked, session.ID)
+	}
+	return nil
+}
+
+// IsSessionActive checks the session exists and is neither revoked nor expired
+func (s *SessionService) IsSessionActive(sessionID string) (bool, error) {
+	session, err := s.sessionRepo.GetSession(sessionID)
+	if err != nil {
+		return false, err
+	}
+	return session != nil && session.RevokedAt == nil && time.Now().Before(session.ExpiresAt), nil
+}
+
+// TouchSession records the client of a request made in the session, at most once per sessionTouchInterval
+func (s *SessionService) TouchSession(sessionID, userAgent, ipAddress string) error {
+	now := time.Now()
+	return s.sessionRepo.TouchSession(sessionID, truncateUserAgent(userAgent), ipAddress, now, now.Add(-sessionTouchInterval))
+}
+
+// ListSessions returns the active sessions of a user
+func (s *SessionService) ListSessions(userID int) ([]*models.Session, error) {
+	return s.sessionRepo.GetActiveUserSessions(userID, time.Now())
+}
+
+// RevokeSession signs out a session of the user, its access tokens are rejected and its refresh tokens revoked
+func (s *SessionService) RevokeSession(userID int, sessionID string) error {
+	revoked, err := s.sessionRepo.RevokeSession(userID, sessionID)
+	if err != nil {
+		return err
+	}
+	if !revoked {
+		return common.ErrSessionNotFound
+	}
+	if err := s.refreshTokenRepo.RevokeFamily(sessionID); err != nil {
+		return err
+	}
+
+	log.Info().Int("user_id", userID).Str("session_id", sessionID).Msg("Session revoked")
+	return nil
+}
+
+// RevokeUserSessions signs out every session of a user along with all refresh tokens
+func (s *SessionService) RevokeUserSessions(userID int) error {
+	if err := s.sessionRepo.RevokeUserSessions(userID); err != nil {
+		return err
+	}
+	return s.refreshTokenRepo.RevokeUserRefreshTokens(userID)
+}
+
+// PurgeExpiredSessions deletes sessions which have expired, it is meant to run periodically
+func (s *SessionService) PurgeExpiredSessions() (int64, error) {
+	return s.sessionRepo.DeleteExpiredSessions(time.Now())
+}
+
+func truncateUserAgent(userAgent string) string {
+	if len(userAgent) > maxUserAgentLength {
+		return userAgent[:maxUserAgentLength]
+	}
+	return userAgent
+}
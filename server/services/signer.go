@@ -0,0 +1,170 @@
+package services
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+)
+
+// Supported JWT signing algorithms
+const (
+	AlgorithmHS256 = "HS256"
+	AlgorithmRS256 = "RS256"
+	AlgorithmES256 = "ES256"
+	AlgorithmEdDSA = "EdDSA"
+)
+
+// minRSAKeyBits is the minimum RSA modulus size accepted for RS256
+const minRSAKeyBits = 2048
+
+// es256ComponentSize is the size of each of r and s in an ES256 signature
+const es256ComponentSize = 32
+
+// IsAsymmetricAlgorithm checks if tokens signed with the algorithm can be verified with a public key
+func IsAsymmetricAlgorithm(algorithm string) bool {
+	return algorithm == AlgorithmRS256 || algorithm == AlgorithmES256 || algorithm == AlgorithmEdDSA
+}
+
+// sign creates the encoded signature of message with the key
+func (k *SigningKey) sign(message string) (string, error) {
+	var signature []byte
+	var err error
+
+	switch k.Algorithm {
+	case AlgorithmHS256:
+		return createSignature(k, message), nil
+	case AlgorithmRS256:
+		digest := sha256.Sum256([]byte(message))
+		signature, err = rsa.SignPKCS1v15(rand.Reader, k.signer.(*rsa.PrivateKey), crypto.SHA256, digest[:])
+	case AlgorithmES256:
+		digest := sha256.Sum256([]byte(message))
+		var r, s *big.Int
+		r, s, err = ecdsa.Sign(rand.Reader, k.signer.(*ecdsa.PrivateKey), digest[:])
+		if err == nil {
+			// JWS uses the fixed size r || s encoding instead of ASN.1
+			signature = make([]byte, 2*es256ComponentSize)
+			r.FillBytes(signature[:es256ComponentSize])
+			s.FillBytes(signature[es256ComponentSize:])
+		}
+	case AlgorithmEdDSA:
+		signature = ed25519.Sign(k.signer.(ed25519.PrivateKey), []byte(message))
+	default:
+		return "", fmt.Errorf("unsupported signing algorithm %s", k.Algorithm)
+	}
+
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+// verify checks the encoded signature of message against the key
+func (k *SigningKey) verify(message string, signatureEncoded string) bool {
+	if k.Algorithm == AlgorithmHS256 {
+		// Compare in constant time so the signature can't be guessed byte by byte
+		return hmac.Equal([]byte(createSignature(k, message)), []byte(signatureEncoded))
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(signatureEncoded)
+	if err != nil {
+		return false
+	}
+
+	switch k.Algorithm {
+	case AlgorithmRS256:
+		digest := sha256.Sum256([]byte(message))
+		return rsa.VerifyPKCS1v15(k.publicKey.(*rsa.PublicKey), crypto.SHA256, digest[:], signature) == nil
+	case AlgorithmES256:
+		if len(signature) != 2*es256ComponentSize {
+			return false
+		}
+		digest := sha256.Sum256([]byte(message))
+		r := new(big.Int).SetBytes(signature[:es256ComponentSize])
+		s := new(big.Int).SetBytes(signature[es256ComponentSize:])
+		return ecdsa.Verify(k.publicKey.(*ecdsa.PublicKey), digest[:], r, s)
+	case AlgorithmEdDSA:
+		return ed25519.Verify(k.publicKey.(ed25519.PublicKey), []byte(message), signature)
+	}
+	return false
+}
+
+// createSignature creates HMAC-SHA256 signature
+func createSignature(key *SigningKey, message string) string {
+	h := hmac.New(sha256.New, []byte(key.Secret))
+	h.Write([]byte(message))
+	return base64.RawURLEncoding.EncodeToString(h.Sum(nil))
+}
+
+// parsePrivateKey parses a PEM encoded PKCS#8, PKCS#1 or SEC 1 private key
+func parsePrivateKey(pemData []byte) (crypto.Signer, error) {
+	block, _ := pem.Decode(pemData)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM block found")
+	}
+
+	if key, err := x509.ParsePKCS8PrivateKey(block.Bytes); err == nil {
+		if signer, ok := key.(crypto.Signer); ok {
+			return signer, nil
+		}
+		return nil, fmt.Errorf("unsupported private key type %T", key)
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	if key, err := x509.ParseECPrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	return nil, fmt.Errorf("unsupported private key format %s", block.Type)
+}
+
+// parsePublicKey parses a PEM encoded PKIX or PKCS#1 public key
+func parsePublicKey(pemData []byte) (crypto.PublicKey, error) {
+	block, _ := pem.Decode(pemData)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM block found")
+	}
+
+	if key, err := x509.ParsePKIXPublicKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	if key, err := x509.ParsePKCS1PublicKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	return nil, fmt.Errorf("unsupported public key format %s", block.Type)
+}
+
+// checkPublicKeyAlgorithm checks that the public key can be used with the algorithm
+func checkPublicKeyAlgorithm(algorithm string, publicKey crypto.PublicKey) error {
+	switch algorithm {
+	case AlgorithmRS256:
+		rsaKey, ok := publicKey.(*rsa.PublicKey)
+		if !ok {
+			return fmt.Errorf("%s requires an RSA key, got %T", algorithm, publicKey)
+		}
+		if rsaKey.N.BitLen() < minRSAKeyBits {
+			return fmt.Errorf("%s requires an RSA key of at least %d bits", algorithm, minRSAKeyBits)
+		}
+	case AlgorithmES256:
+		ecKey, ok := publicKey.(*ecdsa.PublicKey)
+		if !ok || ecKey.Curve != elliptic.P256() {
+			return fmt.Errorf("%s requires a P-256 ECDSA key, got %T", algorithm, publicKey)
+		}
+	case AlgorithmEdDSA:
+		if _, ok := publicKey.(ed25519.PublicKey); !ok {
+			return fmt.Errorf("%s requires an Ed25519 key, got %T", algorithm, publicKey)
+		}
+	default:
+		return fmt.Errorf("unsupported signing algorithm %s", algorithm)
+	}
+	return nil
+}
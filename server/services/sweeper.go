@@ -0,0 +1,35 @@
+package services
+
+import (
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// StartSweeper runs sweep every interval in a background goroutine until the returned stop function is called
+func StartSweeper(name string, interval time.Duration, sweep func() (int64, error)) (stop func()) {
+	ticker := time.NewTicker(interval)
+	done := make(chan struct{})
+
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				removed, err := sweep()
+				if err != nil {
+					log.Error().Err(err).Str("sweeper", name).Msg("Sweep failed")
+					continue
+				}
+				if removed > 0 {
+					log.Info().Str("sweeper", name).Int64("removed", removed).Msg("Sweep completed")
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	log.Info().Str("sweeper", name).Dur("interval", interval).Msg("Sweeper started")
+	return func() { close(done) }
+}
@@ -0,0 +1,52 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+
+	"elotuschallenge/common"
+)
+
+// Errors returned by ValidateToken, each failure wraps one of them so callers can tell why a token was rejected
+var ErrTokenMalformed = fmt.Errorf("malformed token")
+var ErrTokenUnsupportedAlgorithm = fmt.Errorf("unsupported token algorithm")
+var ErrTokenInvalidType = fmt.Errorf("invalid token type")
+var ErrTokenUnknownKey = fmt.Errorf("unknown signing key")
+var ErrTokenRetiredKey = fmt.Errorf("signing key has been retired")
+var ErrTokenInvalidSignature = fmt.Errorf("invalid signature")
+var ErrTokenExpired = fmt.Errorf("token has expired")
+var ErrTokenNotYetValid = fmt.Errorf("token is not valid yet")
+var ErrTokenInvalidIssuer = fmt.Errorf("invalid token issuer")
+var ErrTokenInvalidAudience = fmt.Errorf("invalid token audience")
+var ErrTokenMissingID = fmt.Errorf("token has no ID")
+var ErrTokenInvalidPurpose = fmt.Errorf("invalid token purpose")
+
+// tokenErrorReasons maps validation errors to short reasons for logging
+var tokenErrorReasons = []struct {
+	err    error
+	reason string
+}{
+	{ErrTokenMalformed, "malformed"},
+	{ErrTokenUnsupportedAlgorithm, "unsupported_algorithm"},
+	{ErrTokenInvalidType, "invalid_type"},
+	{ErrTokenUnknownKey, "unknown_key"},
+	{ErrTokenRetiredKey, "retired_key"},
+	{ErrTokenInvalidSignature, "invalid_signature"},
+	{ErrTokenExpired, "expired"},
+	{ErrTokenNotYetValid, "not_yet_valid"},
+	{ErrTokenInvalidIssuer, "invalid_issuer"},
+	{ErrTokenInvalidAudience, "invalid_audience"},
+	{ErrTokenMissingID, "missing_jti"},
+	{ErrTokenInvalidPurpose, "invalid_purpose"},
+	{common.ErrSessionRevoked, "session_revoked"},
+}
+
+// TokenErrorReason returns a short reason for a token validation error, or empty string for other errors
+func TokenErrorReason(err error) string {
+	for _, entry := range tokenErrorReasons {
+		if errors.Is(err, entry.err) {
+			return entry.reason
+		}
+	}
+	return ""
+}
@@ -1,46 +1,100 @@
 package services
 
 import (
-	"crypto/hmac"
-	"crypto/sha256"
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"strings"
+	"sync"
 	"time"
+
+	"elotuschallenge/repository"
+	"elotuschallenge/utils"
 )
 
+// tokenType is the only typ header accepted by ValidateToken
+const tokenType = "JWT"
+
+// TokenManagerConfig holds the settings of issued and accepted tokens
+type TokenManagerConfig struct {
+	ExpirationSeconds int64
+	// Issuer is put in the iss claim and required in validated tokens when set
+	Issuer string
+	// Audience is put in the aud claim and validated tokens must contain one of its values when set
+	Audience []string
+	// LeewaySeconds is the allowed clock skew when checking exp, nbf and iat
+	LeewaySeconds int64
+}
+
 // TokenManager implements ITokenManager using JWT tokens
 type TokenManager struct {
-	secret                 []byte
-	tokenExpirationSeconds int64
+	mu               sync.RWMutex
+	keyring          *Keyring
+	config           TokenManagerConfig
+	revokedTokenRepo repository.IRevokedToken
 }
 
-func NewTokenManager(secret string, tokenExpirationSeconds int64) ITokenManager {
+// tokenHeader represents the JWT header fields used by TokenManager
+type tokenHeader struct {
+	Algorithm string `json:"alg"`
+	Type      string `json:"typ"`
+	KeyID     string `json:"kid,omitempty"`
+}
+
+func NewTokenManager(keyring *Keyring, config TokenManagerConfig, revokedTokenRepo repository.IRevokedToken) ITokenManager {
 	manager := &TokenManager{
-		secret:                 []byte(secret),
-		tokenExpirationSeconds: tokenExpirationSeconds,
+		keyring:          keyring,
+		config:           config,
+		revokedTokenRepo: revokedTokenRepo,
 	}
 	return manager
 }
 
-// GenerateToken creates a new JWT token for the user using HS256
+// SetKeyring replaces the keyring, used to rotate keys without restarting
+func (s *TokenManager) SetKeyring(keyring *Keyring) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.keyring = keyring
+}
+
+// GenerateToken creates a new JWT token for the user signed with the active key
 func (s *TokenManager) GenerateToken(userID int, username string) (string, error) {
-	// Create header
-	header := map[string]interface{}{
-		"alg": "HS256",
-		"typ": "JWT",
+	return s.IssueToken(Claims{UserID: userID, Username: username})
+}
+
+// IssueToken creates a new JWT token carrying the user claims, the registered claims are filled in except a preset jti
+func (s *TokenManager) IssueToken(userClaims Claims) (string, error) {
+	return s.IssueTokenWithExpiration(userClaims, s.config.ExpirationSeconds)
+}
+
+// IssueTokenWithExpiration creates a new JWT token expiring after expirationSeconds, used for short-lived purpose tokens
+func (s *TokenManager) IssueTokenWithExpiration(userClaims Claims, expirationSeconds int64) (string, error) {
+	// Sign with the active key and tell verifiers which key it is
+	key := s.activeKey()
+	header := tokenHeader{
+		Algorithm: key.Algorithm,
+		Type:      tokenType,
+		KeyID:     key.ID,
 	}
 
-	// Create payload with expiration (24 hours)
-	now := time.Now().Unix()
-	payload := Claims{
-		UserID:    userID,
-		Username:  username,
-		IssuedAt:  now,
-		ExpiresAt: now + s.tokenExpirationSeconds,
+	// Callers may pick the jti themselves to record it before the token is handed out
+	payload := userClaims
+	if payload.ID == "" {
+		tokenID, err := utils.GenerateSecureToken(16)
+		if err != nil {
+			return "", err
+		}
+		payload.ID = tokenID
 	}
 
+	// Create payload with expiration
+	now := time.Now().Unix()
+	payload.Issuer = s.config.Issuer
+	payload.Audience = Audience(s.config.Audience)
+	payload.IssuedAt = now
+	payload.NotBefore = now
+	payload.ExpiresAt = now + expirationSeconds
+
 	// Encode header
 	headerBytes, err := json.Marshal(header)
 	if err != nil {
@@ -57,47 +111,111 @@ func (s *TokenManager) GenerateToken(userID int, username string) (string, error
 
 	// Create signature
 	message := headerEncoded + "." + payloadEncoded
-	signature := s.createSignature(message)
+	signature, err := key.sign(message)
+	if err != nil {
+		return "", err
+	}
 
 	// Return complete JWT
 	return message + "." + signature, nil
 }
 
-// ValidateToken validates and parses a JWT token
+// ValidateToken validates and parses a JWT access token. Errors wrap the ErrToken* errors describing the failure.
+// Tokens issued for a purpose, e.g. a pending MFA login, are rejected.
 func (s *TokenManager) ValidateToken(tokenString string) (*Claims, error) {
+	return s.ValidatePurposeToken(tokenString, "")
+}
+
+// ValidatePurposeToken validates and parses a JWT token which must have been issued for the purpose
+func (s *TokenManager) ValidatePurposeToken(tokenString string, purpose string) (*Claims, error) {
+	claims, err := s.parseToken(tokenString)
+	if err != nil {
+		return nil, err
+	}
+	if claims.Purpose != purpose {
+		return nil, fmt.Errorf("%w: %q", ErrTokenInvalidPurpose, claims.Purpose)
+	}
+	return claims, nil
+}
+
+// parseToken verifies the signature and registered claims of a token
+func (s *TokenManager) parseToken(tokenString string) (*Claims, error) {
 	parts := strings.Split(tokenString, ".")
 	if len(parts) != 3 {
-		return nil, fmt.Errorf("invalid token format")
+		return nil, fmt.Errorf("%w: invalid token format", ErrTokenMalformed)
 	}
 
 	headerEncoded, payloadEncoded, signatureProvided := parts[0], parts[1], parts[2]
 
+	// Decode header to find the signing key
+	headerBytes, err := base64.RawURLEncoding.DecodeString(headerEncoded)
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid header encoding", ErrTokenMalformed)
+	}
+
+	var header tokenHeader
+	if err := json.Unmarshal(headerBytes, &header); err != nil {
+		return nil, fmt.Errorf("%w: invalid header format", ErrTokenMalformed)
+	}
+
+	if !strings.EqualFold(header.Type, tokenType) {
+		return nil, fmt.Errorf("%w: %q", ErrTokenInvalidType, header.Type)
+	}
+
+	key, err := s.verificationKey(header.KeyID)
+	if err != nil {
+		return nil, err
+	}
+
+	// The algorithm is bound to the key, a token can't choose a different one (e.g. "none" or HS256 with a public key)
+	if header.Algorithm != key.Algorithm {
+		return nil, fmt.Errorf("%w: %q for key %s", ErrTokenUnsupportedAlgorithm, header.Algorithm, key.ID)
+	}
+
 	// Verify signature
 	message := headerEncoded + "." + payloadEncoded
-	expectedSignature := s.createSignature(message)
-	if signatureProvided != expectedSignature {
-		return nil, fmt.Errorf("invalid signature")
+	if !key.verify(message, signatureProvided) {
+		return nil, ErrTokenInvalidSignature
 	}
 
 	// Decode payload
 	payloadBytes, err := base64.RawURLEncoding.DecodeString(payloadEncoded)
 	if err != nil {
-		return nil, fmt.Errorf("invalid payload encoding")
+		return nil, fmt.Errorf("%w: invalid payload encoding", ErrTokenMalformed)
 	}
 
 	var claims Claims
 	if err := json.Unmarshal(payloadBytes, &claims); err != nil {
-		return nil, fmt.Errorf("invalid payload format")
+		return nil, fmt.Errorf("%w: invalid payload format", ErrTokenMalformed)
 	}
 
-	// Check expiration
-	if time.Now().Unix() > claims.ExpiresAt {
-		return nil, fmt.Errorf("token has expired")
+	if err := s.validateClaims(&claims); err != nil {
+		return nil, err
 	}
 
 	return &claims, nil
 }
 
+// RevokeToken marks a valid token as revoked until it expires
+func (s *TokenManager) RevokeToken(tokenString string) error {
+	// Any valid token can be revoked, whatever its purpose
+	claims, err := s.parseToken(tokenString)
+	if err != nil {
+		return err
+	}
+	return s.revokedTokenRepo.RevokeToken(utils.HashToken(tokenString), time.Unix(claims.ExpiresAt, 0))
+}
+
+// IsTokenRevoked checks if the token has been revoked, e.g. by logging out
+func (s *TokenManager) IsTokenRevoked(tokenString string) (bool, error) {
+	return s.revokedTokenRepo.IsTokenRevoked(utils.HashToken(tokenString))
+}
+
+// PurgeExpiredRevocations deletes revocation entries of tokens which have expired anyway
+func (s *TokenManager) PurgeExpiredRevocations() (int64, error) {
+	return s.revokedTokenRepo.DeleteExpiredTokens(time.Now())
+}
+
 // ExtractTokenFromHeader extracts JWT token from "Bearer <token>" format
 // Returns the token, or empty string if extraction fails
 func (s *TokenManager) ExtractTokenFromHeader(authHeader string) string {
@@ -112,9 +230,90 @@ func (s *TokenManager) HasValidBearerFormat(authHeader string) bool {
 	return len(authHeader) >= 7 && authHeader[:7] == "Bearer "
 }
 
-// createSignature creates HMAC-SHA256 signature
-func (s *TokenManager) createSignature(message string) string {
-	h := hmac.New(sha256.New, s.secret)
-	h.Write([]byte(message))
-	return base64.RawURLEncoding.EncodeToString(h.Sum(nil))
+// PublicKeys returns the public keys of asymmetric keys which may have signed valid tokens
+func (s *TokenManager) PublicKeys() JWKSet {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	set := JWKSet{Keys: []JWK{}}
+	for _, key := range s.keyring.Keys() {
+		if !IsAsymmetricAlgorithm(key.Algorithm) || !s.acceptsKey(key) {
+			continue
+		}
+		set.Keys = append(set.Keys, key.publicJWK())
+	}
+	return set
+}
+
+// validateClaims checks the registered claims, allowing the configured clock skew
+func (s *TokenManager) validateClaims(claims *Claims) error {
+	now := time.Now().Unix()
+	leeway := s.config.LeewaySeconds
+
+	if claims.ExpiresAt == 0 {
+		return fmt.Errorf("%w: missing exp", ErrTokenMalformed)
+	}
+	if now > claims.ExpiresAt+leeway {
+		return ErrTokenExpired
+	}
+	if claims.NotBefore != 0 && now+leeway < claims.NotBefore {
+		return fmt.Errorf("%w: nbf is in the future", ErrTokenNotYetValid)
+	}
+	if now+leeway < claims.IssuedAt {
+		return fmt.Errorf("%w: iat is in the future", ErrTokenNotYetValid)
+	}
+	if s.config.Issuer != "" && claims.Issuer != s.config.Issuer {
+		return fmt.Errorf("%w: %q", ErrTokenInvalidIssuer, claims.Issuer)
+	}
+	if len(s.config.Audience) > 0 && !claims.Audience.Contains(s.config.Audience) {
+		return fmt.Errorf("%w: %v", ErrTokenInvalidAudience, []string(claims.Audience))
+	}
+	if claims.ID == "" {
+		return ErrTokenMissingID
+	}
+	return nil
+}
+
+// activeKey returns the key used to sign new tokens
+func (s *TokenManager) activeKey() *SigningKey {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.keyring.ActiveKey()
+}
+
+// verificationKey returns the key a token was signed with. Retired keys are accepted
+// as long as tokens signed before the retirement may still be valid.
+func (s *TokenManager) verificationKey(kid string) (*SigningKey, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	// Tokens issued before key rotation was introduced have no kid, only the key built from the environment
+	// can have signed them
+	var key *SigningKey
+	if kid == "" {
+		key = s.keyring.KeyWithoutID()
+		if key == nil {
+			return nil, fmt.Errorf("%w: token has no kid", ErrTokenUnknownKey)
+		}
+		kid = key.ID
+	} else {
+		key = s.keyring.Key(kid)
+	}
+	if key == nil {
+		return nil, fmt.Errorf("%w: %q", ErrTokenUnknownKey, kid)
+	}
+
+	if !s.acceptsKey(key) {
+		return nil, fmt.Errorf("%w: %q", ErrTokenRetiredKey, kid)
+	}
+	return key, nil
+}
+
+// acceptsKey checks if tokens signed by the key may still be valid
+func (s *TokenManager) acceptsKey(key *SigningKey) bool {
+	if key.RetiredAt == nil {
+		return true
+	}
+	acceptUntil := key.RetiredAt.Add(time.Duration(s.config.ExpirationSeconds) * time.Second)
+	return !time.Now().After(acceptUntil)
 }
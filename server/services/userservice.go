@@ -1,20 +1,37 @@
 package services
 
 import (
+	"elotuschallenge/common"
 	"elotuschallenge/models"
 	"elotuschallenge/repository"
+	"errors"
 	"fmt"
+	"sync"
 
-	"golang.org/x/crypto/bcrypt"
+	"github.com/rs/zerolog/log"
 )
 
 type UserService struct {
-	userRepo repository.IUser
+	userRepo            repository.IUser
+	hasher              IPasswordHasher
+	requireVerification bool
+	dummyPasswordHash   func() string
 }
 
-func NewUserService(userRepo repository.IUser) IUserService {
+// NewUserService creates the user service, with requireVerification new accounts stay pending until verified
+func NewUserService(userRepo repository.IUser, hasher IPasswordHasher, requireVerification bool) IUserService {
 	return &UserService{
-		userRepo: userRepo,
+		userRepo:            userRepo,
+		hasher:              hasher,
+		requireVerification: requireVerification,
+		// Hash of the same cost as user passwords, generated once when first needed
+		dummyPasswordHash: sync.OnceValue(func() string {
+			hash, err := hasher.Hash("dummy-password")
+			if err != nil {
+				log.Panic().Err(err).Msg("Failed to generate dummy password hash")
+			}
+			return hash
+		}),
 	}
 }
 
@@ -26,22 +43,146 @@ func (s *UserService) LoginUser(username, password string) (*models.User, error)
 		return nil, err
 	}
 	if user == nil {
-		return nil, fmt.Errorf("user not found")
+		// Compare against a dummy hash so unknown usernames take as long as wrong passwords
+		s.hasher.Verify(password, s.dummyPasswordHash())
+		return nil, common.ErrInvalidCredentials
 	}
 
 	// Compare password
-	err = bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password))
+	valid, err := s.hasher.Verify(password, user.PasswordHash)
 	if err != nil {
-		return nil, fmt.Errorf("invalid credentials")
+		return nil, fmt.Errorf("%w: %w", common.ErrInvalidCredentials, err)
+	}
+	if !valid {
+		return nil, common.ErrInvalidCredentials
+	}
+
+	// The status is only revealed to someone knowing the password
+	if err := CheckAccountStatus(user); err != nil {
+		return nil, err
+	}
+
+	// Upgrade hashes made with an older algorithm or weaker parameters while the password is known
+	if s.hasher.NeedsRehash(user.PasswordHash) {
+		s.rehashPassword(user, password)
 	}
 
 	return user, nil
 }
 
+// rehashPassword stores a new hash of the password, failures are only logged since the login already succeeded
+func (s *UserService) rehashPassword(user *models.User, password string) {
+	hash, err := s.hasher.Hash(password)
+	if err != nil {
+		log.Error().Err(err).Int("user_id", user.ID).Msg("Failed to rehash password")
+		return
+	}
+	if err := s.userRepo.UpdatePasswordHash(user.ID, hash); err != nil {
+		log.Error().Err(err).Int("user_id", user.ID).Msg("Failed to store rehashed password")
+		return
+	}
+	user.PasswordHash = hash
+	log.Info().Int("user_id", user.ID).Msg("Password rehashed with current parameters")
+}
+
 // RegisterUser handles user registration with password hashing
 func (s *UserService) RegisterUser(username, password string) (*models.User, error) {
+	status := models.StatusActive
+	if s.requireVerification {
+		status = models.StatusPending
+	}
+	return s.registerUser(username, password, models.RoleUser, status)
+}
+
+// EnsureAdmin creates the admin account if missing, or grants the admin role to an existing account
+func (s *UserService) EnsureAdmin(username, password string) (*models.User, error) {
+	user, err := s.userRepo.GetUserByUsername(username)
+	if err != nil {
+		return nil, err
+	}
+
+	if user == nil {
+		user, err = s.registerUser(username, password, models.RoleAdmin, models.StatusActive)
+		if err != nil {
+			return nil, err
+		}
+		log.Info().Str("username", username).Msg("Admin account created")
+		return user, nil
+	}
+
+	if user.Role != models.RoleAdmin {
+		if err := s.SetUserRole(user.ID, models.RoleAdmin); err != nil {
+			return nil, err
+		}
+		user.Role = models.RoleAdmin
+		log.Info().Str("username", username).Msg("Admin role granted to existing account")
+	}
+	return user, nil
+}
+
+// SetUserRole changes the role of a user
+func (s *UserService) SetUserRole(userID int, role string) error {
+	if !isValidRole(role) {
+		return fmt.Errorf("%w: %s", common.ErrInvalidRole, role)
+	}
+
+	updated, err := s.userRepo.UpdateUserRole(userID, role)
+	if err != nil {
+		return err
+	}
+	if !updated {
+		return common.ErrUserNotFound
+	}
+	return nil
+}
+
+// GetUsers delegates to repository
+func (s *UserService) GetUsers() ([]*models.User, error) {
+	return s.userRepo.GetUsers()
+}
+
+// SetUserStatus changes the account status of a user
+func (s *UserService) SetUserStatus(userID int, status string) error {
+	if !isValidStatus(status) {
+		return fmt.Errorf("%w: %s", common.ErrInvalidStatus, status)
+	}
+
+	updated, err := s.userRepo.UpdateUserStatus(userID, status)
+	if err != nil {
+		return err
+	}
+	if !updated {
+		return common.ErrUserNotFound
+	}
+	return nil
+}
+
+// CheckAccountStatus returns ErrAccountPending or ErrAccountDisabled unless the account is active
+func CheckAccountStatus(user *models.User) error {
+	switch user.Status {
+	case models.StatusPending:
+		return common.ErrAccountPending
+	case models.StatusDisabled:
+		return common.ErrAccountDisabled
+	}
+	return nil
+}
+
+// AccountStatusErrorCode returns the error code of an account status error, or empty string for other errors
+func AccountStatusErrorCode(err error) string {
+	switch {
+	case errors.Is(err, common.ErrAccountPending):
+		return common.ErrCodeAccountPending
+	case errors.Is(err, common.ErrAccountDisabled):
+		return common.ErrCodeAccountDisabled
+	}
+	return ""
+}
+
+// registerUser hashes the password and creates a user with the role and status
+func (s *UserService) registerUser(username, password, role, status string) (*models.User, error) {
 	// Hash password
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	hashedPassword, err := s.hasher.Hash(password)
 	if err != nil {
 		return nil, err
 	}
@@ -49,13 +190,35 @@ func (s *UserService) RegisterUser(username, password string) (*models.User, err
 	// Create user model
 	user := &models.User{
 		Username:     username,
-		PasswordHash: string(hashedPassword),
+		PasswordHash: hashedPassword,
+		Role:         role,
+		Status:       status,
 	}
 
 	// Save to database
 	return s.userRepo.CreateUser(user)
 }
 
+// isValidRole checks if role is one of the known roles
+func isValidRole(role string) bool {
+	for _, known := range models.Roles {
+		if role == known {
+			return true
+		}
+	}
+	return false
+}
+
+// isValidStatus checks if status is one of the known account statuses
+func isValidStatus(status string) bool {
+	for _, known := range models.Statuses {
+		if status == known {
+			return true
+		}
+	}
+	return false
+}
+
 // CreateUser delegates to repository (for internal use)
 func (s *UserService) CreateUser(user *models.User) (*models.User, error) {
 	return s.userRepo.CreateUser(user)
@@ -70,3 +233,8 @@ func (s *UserService) UserExists(username string) (bool, error) {
 func (s *UserService) GetUserByUsername(username string) (*models.User, error) {
 	return s.userRepo.GetUserByUsername(username)
 }
+
+// GetUserByID delegates to repository
+func (s *UserService) GetUserByID(userID int) (*models.User, error) {
+	return s.userRepo.GetUserByID(userID)
+}
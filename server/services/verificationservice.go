@@ -0,0 +1,125 @@
+package services
+
+import (
+	"fmt"
+	"time"
+
+	"elotuschallenge/common"
+	"elotuschallenge/models"
+	"elotuschallenge/repository"
+	"elotuschallenge/utils"
+
+	"github.com/rs/zerolog/log"
+)
+
+// verificationTokenBytes is the amount of random bytes in an account verification token
+const verificationTokenBytes = 32
+
+type VerificationService struct {
+	userRepo          repository.IUser
+	verificationRepo  repository.IVerification
+	notifier          INotifier
+	expirationSeconds int64
+}
+
+func NewVerificationService(userRepo repository.IUser, verificationRepo repository.IVerification, notifier INotifier,
+	expirationSeconds int64) IVerificationService {
+	return &VerificationService{
+		userRepo:          userRepo,
+		verificationRepo:  verificationRepo,
+		notifier:          notifier,
+		expirationSeconds: expirationSeconds,
+	}
+}
+
+// SendVerification sends a single-use verification token to a pending user, replacing previous tokens
+func (s *VerificationService) SendVerification(user *models.User) error {
+	if err := s.verificationRepo.DeleteUserVerificationTokens(user.ID); err != nil {
+		return err
+	}
+
+	token, err := utils.GenerateSecureToken(verificationTokenBytes)
+	if err != nil {
+		return err
+	}
+
+	expiresIn := time.Duration(s.expirationSeconds) * time.Second
+	_, err = s.verificationRepo.CreateVerificationToken(&models.VerificationToken{
+		UserID:    user.ID,
+		TokenHash: utils.HashToken(token),
+		ExpiresAt: time.Now().Add(expiresIn),
+	})
+	if err != nil {
+		return err
+	}
+
+	return s.notifier.Notify(&models.Notification{
+		Recipient: user.Username,
+		Kind:      models.NotificationVerifyAccount,
+		Subject:   "Verify your account",
+		Body:      fmt.Sprintf("Use this token to activate your account, it expires in %s and can be used once:\n\n%s\n", expiresIn, token),
+	})
+}
+
+// ResendVerification sends a new verification token when the user is still pending. Other usernames
+// are ignored without error so the response doesn't reveal which accounts exist.
+func (s *VerificationService) ResendVerification(username string) error {
+	user, err := s.userRepo.GetUserByUsername(username)
+	if err != nil {
+		return err
+	}
+	if user == nil || user.Status != models.StatusPending {
+		log.Info().Str("username", username).Msg("Verification requested for unknown or non pending user")
+		return nil
+	}
+	return s.SendVerification(user)
+}
+
+// VerifyAccount consumes a verification token and activates the pending user
+func (s *VerificationService) VerifyAccount(token string) (*models.User, error) {
+	stored, err := s.verificationRepo.GetVerificationTokenByHash(utils.HashToken(token))
+	if err != nil {
+		return nil, err
+	}
+	if stored == nil || stored.UsedAt != nil {
+		return nil, common.ErrVerificationTokenInvalid
+	}
+	if time.Now().After(stored.ExpiresAt) {
+		return nil, common.ErrVerificationTokenExpired
+	}
+
+	// Mark as used atomically so the token can't be used twice concurrently
+	marked, err := s.verificationRepo.MarkVerificationTokenUsed(stored.ID)
+	if err != nil {
+		return nil, err
+	}
+	if !marked {
+		return nil, common.ErrVerificationTokenInvalid
+	}
+
+	user, err := s.userRepo.GetUserByID(stored.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, common.ErrVerificationTokenInvalid
+	}
+
+	// A disabled account stays disabled
+	if user.Status != models.StatusPending {
+		return nil, CheckAccountStatus(user)
+	}
+
+	if _, err := s.userRepo.UpdateUserStatus(user.ID, models.StatusActive); err != nil {
+		return nil, err
+	}
+	user.Status = models.StatusActive
+
+	log.Info().Int("user_id", user.ID).Msg("Account verified")
+	return user, nil
+}
+
+// PurgeExpiredVerificationTokens removes expired verification tokens, it returns the number of removed tokens
+func (s *VerificationService) PurgeExpiredVerificationTokens() (int64, error) {
+	return s.verificationRepo.DeleteExpiredVerificationTokens(time.Now())
+}
@@ -0,0 +1,296 @@
+package storage
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// S3BackendID identifies objects stored in the S3 bucket
+const S3BackendID = "s3"
+
+// defaultS3Region is used when no region is configured, S3-compatible servers usually accept any region
+const defaultS3Region = "us-east-1"
+
+// S3Config configures an S3-compatible bucket, objects are addressed path style as {Endpoint}/{Bucket}/{key}
+type S3Config struct {
+	Endpoint        string
+	Region          string
+	Bucket          string
+	AccessKeyID     string
+	SecretAccessKey string
+	// Client sends the requests, by default one without an overall timeout so large objects can be streamed
+	Client *http.Client
+}
+
+// S3Storage stores objects in a bucket of an S3-compatible object store
+type S3Storage struct {
+	endpoint *url.URL
+	bucket   string
+	signer   SigV4Signer
+	client   *http.Client
+}
+
+// NewS3Storage creates a storage in the bucket of the config
+func NewS3Storage(config S3Config) (*S3Storage, error) {
+	if config.Endpoint == "" || config.Bucket == "" {
+		return nil, fmt.Errorf("S3 endpoint and bucket are required")
+	}
+	if config.AccessKeyID == "" || config.SecretAccessKey == "" {
+		return nil, fmt.Errorf("S3 access key ID and secret access key are required")
+	}
+	endpoint, err := url.Parse(strings.TrimSuffix(config.Endpoint, "/"))
+	if err != nil || (endpoint.Scheme != "http" && endpoint.Scheme != "https") || endpoint.Host == "" {
+		return nil, fmt.Errorf("invalid S3 endpoint %q", config.Endpoint)
+	}
+
+	region := config.Region
+	if region == "" {
+		region = defaultS3Region
+	}
+	client := config.Client
+	if client == nil {
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.ResponseHeaderTimeout = 30 * time.Second
+		client = &http.Client{Transport: transport}
+	}
+
+	return &S3Storage{
+		endpoint: endpoint,
+		bucket:   config.Bucket,
+		signer: SigV4Signer{
+			AccessKeyID:     config.AccessKeyID,
+			SecretAccessKey: config.SecretAccessKey,
+			Region:          region,
+			Service:         "s3",
+		},
+		client: client,
+	}, nil
+}
+
+func (s *S3Storage) ID() string {
+	return S3BackendID
+}
+
+// Put uploads the object in a single request, the body is streamed so its payload isn't signed
+func (s *S3Storage) Put(key string, r io.Reader, size int64, contentType string) error {
+	if err := validateKey(key); err != nil {
+		return err
+	}
+	header := http.Header{}
+	if contentType != "" {
+		header.Set("Content-Type", contentType)
+	}
+
+	resp, err := s.do(http.MethodPut, key, nil, header, r, size)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// Get returns an object which downloads the content from the position read, so seeking to a byte range
+// only downloads the range
+func (s *S3Storage) Get(key string) (Object, error) {
+	info, err := s.Stat(key)
+	if err != nil {
+		return nil, err
+	}
+	return &s3Object{storage: s, key: key, size: info.Size}, nil
+}
+
+func (s *S3Storage) Stat(key string) (*ObjectInfo, error) {
+	if err := validateKey(key); err != nil {
+		return nil, err
+	}
+	resp, err := s.do(http.MethodHead, key, nil, nil, nil, 0)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body.Close()
+
+	info := &ObjectInfo{Key: key, Size: resp.ContentLength}
+	if modified, err := http.ParseTime(resp.Header.Get("Last-Modified")); err == nil {
+		info.ModTime = modified
+	}
+	return info, nil
+}
+
+// Delete removes the object, S3 reports success for missing objects as well
+func (s *S3Storage) Delete(key string) error {
+	if err := validateKey(key); err != nil {
+		return err
+	}
+	resp, err := s.do(http.MethodDelete, key, nil, nil, nil, 0)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// s3ListResult is the response of ListObjectsV2
+type s3ListResult struct {
+	Contents []struct {
+		Key          string
+		Size         int64
+		LastModified time.Time
+	}
+	IsTruncated           bool
+	NextContinuationToken string
+}
+
+// List follows the continuation tokens of ListObjectsV2 until all keys with the prefix are listed
+func (s *S3Storage) List(prefix string) ([]ObjectInfo, error) {
+	var objects []ObjectInfo
+	query := url.Values{"list-type": {"2"}, "prefix": {prefix}}
+	for {
+		resp, err := s.do(http.MethodGet, "", query, nil, nil, 0)
+		if err != nil {
+			return nil, err
+		}
+		var result s3ListResult
+		err = xml.NewDecoder(resp.Body).Decode(&result)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read S3 listing: %w", err)
+		}
+
+		for _, object := range result.Contents {
+			objects = append(objects, ObjectInfo{Key: object.Key, Size: object.Size, ModTime: object.LastModified})
+		}
+		if !result.IsTruncated || result.NextContinuationToken == "" {
+			break
+		}
+		query.Set("continuation-token", result.NextContinuationToken)
+	}
+
+	sortObjects(objects)
+	return objects, nil
+}
+
+// s3Error is the error document of failed requests
+type s3Error struct {
+	Code    string
+	Message string
+}
+
+// do sends a signed request for the key of the bucket, or the bucket itself for an empty key. Responses
+// with an error status are closed and returned as errors, missing objects as ErrNotFound.
+func (s *S3Storage) do(method string, key string, query url.Values, header http.Header, body io.Reader, size int64) (*http.Response, error) {
+	target := *s.endpoint
+	target.Path = s.endpoint.Path + "/" + s.bucket
+	if key != "" {
+		target.Path += "/" + key
+	}
+	target.RawPath = canonicalURI(target.Path)
+	target.RawQuery = canonicalQuery(query)
+
+	req, err := http.NewRequest(method, target.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+
+	payloadHash := EmptyPayloadHash
+	if body != nil {
+		payloadHash = UnsignedPayload
+		req.ContentLength = size
+		req.Body = io.NopCloser(body)
+		if size == 0 {
+			req.Body = http.NoBody
+		}
+	}
+	s.signer.Sign(req, payloadHash, time.Now())
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("S3 %s %s failed: %w", method, key, err)
+	}
+	if resp.StatusCode < 300 {
+		return resp, nil
+	}
+	defer resp.Body.Close()
+
+	var s3Err s3Error
+	xml.NewDecoder(io.LimitReader(resp.Body, 64<<10)).Decode(&s3Err)
+	if resp.StatusCode == http.StatusNotFound && (s3Err.Code == "" || s3Err.Code == "NoSuchKey") {
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, key)
+	}
+	return nil, fmt.Errorf("S3 %s %s failed with status %d: %s %s", method, key, resp.StatusCode, s3Err.Code, s3Err.Message)
+}
+
+// s3Object reads an object from its position with ranged GET requests, a request is only sent once
+// reading starts and again after seeking elsewhere
+type s3Object struct {
+	storage *S3Storage
+	key     string
+	size    int64
+	offset  int64
+	body    io.ReadCloser
+}
+
+func (o *s3Object) Read(p []byte) (int, error) {
+	if o.offset >= o.size {
+		return 0, io.EOF
+	}
+	if o.body == nil {
+		header := http.Header{"Range": {"bytes=" + strconv.FormatInt(o.offset, 10) + "-"}}
+		resp, err := o.storage.do(http.MethodGet, o.key, nil, header, nil, 0)
+		if err != nil {
+			return 0, err
+		}
+		if resp.StatusCode != http.StatusPartialContent && o.offset > 0 {
+			resp.Body.Close()
+			return 0, fmt.Errorf("S3 GET %s ignored the range from %d", o.key, o.offset)
+		}
+		o.body = resp.Body
+	}
+
+	n, err := o.body.Read(p)
+	o.offset += int64(n)
+	if err == io.EOF && o.offset < o.size {
+		err = io.ErrUnexpectedEOF
+	}
+	return n, err
+}
+
+func (o *s3Object) Seek(offset int64, whence int) (int64, error) {
+	position := offset
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		position += o.offset
+	case io.SeekEnd:
+		position += o.size
+	default:
+		return 0, fmt.Errorf("invalid whence %d", whence)
+	}
+	if position < 0 {
+		return 0, fmt.Errorf("negative position %d", position)
+	}
+
+	if position != o.offset && o.body != nil {
+		o.body.Close()
+		o.body = nil
+	}
+	o.offset = position
+	return position, nil
+}
+
+func (o *s3Object) Close() error {
+	if o.body == nil {
+		return nil
+	}
+	err := o.body.Close()
+	o.body = nil
+	return err
+}
@@ -0,0 +1,131 @@
+package storage
+
+import (
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"time"
+)
+
+// ErrNotFound is returned for keys without an object
+var ErrNotFound = fmt.Errorf("object not found")
+
+// Storage stores uploaded files as blobs under slash separated keys
+type Storage interface {
+	// ID identifies the backend, it is stored with the key of each object
+	ID() string
+	// Put stores size bytes read from r under key, replacing any object stored there
+	Put(key string, r io.Reader, size int64, contentType string) error
+	// Get opens the object stored under key for reading
+	Get(key string) (Object, error)
+	// Stat returns the size and modification time of the object stored under key
+	Stat(key string) (*ObjectInfo, error)
+	// Delete removes the object stored under key, missing objects are ignored
+	Delete(key string) error
+	// List returns the objects with keys starting with prefix, sorted by key
+	List(prefix string) ([]ObjectInfo, error)
+}
+
+// Object is the content of a stored object, it can be seeked so byte ranges can be served
+type Object interface {
+	io.ReadSeekCloser
+}
+
+// ObjectInfo describes a stored object
+type ObjectInfo struct {
+	Key     string
+	Size    int64
+	ModTime time.Time
+}
+
+// Backends stores new objects in the default backend and finds existing objects in the backend which stored
+// them, so files stay readable after the default backend is switched
+type Backends struct {
+	defaultBackend Storage
+	backends       map[string]Storage
+}
+
+// NewBackends creates backends writing to defaultBackend, others are only read from
+func NewBackends(defaultBackend Storage, others ...Storage) *Backends {
+	b := &Backends{
+		defaultBackend: defaultBackend,
+		backends:       map[string]Storage{defaultBackend.ID(): defaultBackend},
+	}
+	for _, backend := range others {
+		if _, exists := b.backends[backend.ID()]; !exists {
+			b.backends[backend.ID()] = backend
+		}
+	}
+	return b
+}
+
+// Default returns the backend new objects are stored in
+func (b *Backends) Default() Storage {
+	return b.defaultBackend
+}
+
+// Backend returns the backend with the ID
+func (b *Backends) Backend(id string) (Storage, error) {
+	backend, ok := b.backends[id]
+	if !ok {
+		return nil, fmt.Errorf("unknown storage backend %q", id)
+	}
+	return backend, nil
+}
+
+// Put stores an object in the default backend and returns the ID of the backend
+func (b *Backends) Put(key string, r io.Reader, size int64, contentType string) (string, error) {
+	if err := b.defaultBackend.Put(key, r, size, contentType); err != nil {
+		return "", err
+	}
+	return b.defaultBackend.ID(), nil
+}
+
+// Get opens an object of the backend with the ID
+func (b *Backends) Get(id string, key string) (Object, error) {
+	backend, err := b.Backend(id)
+	if err != nil {
+		return nil, err
+	}
+	return backend.Get(key)
+}
+
+// Stat describes an object of the backend with the ID
+func (b *Backends) Stat(id string, key string) (*ObjectInfo, error) {
+	backend, err := b.Backend(id)
+	if err != nil {
+		return nil, err
+	}
+	return backend.Stat(key)
+}
+
+// Delete removes an object of the backend with the ID
+func (b *Backends) Delete(id string, key string) error {
+	backend, err := b.Backend(id)
+	if err != nil {
+		return err
+	}
+	return backend.Delete(key)
+}
+
+// validateKey rejects keys which could escape the storage root: keys are relative, slash separated paths
+// without empty, . or .. segments
+func validateKey(key string) error {
+	if key == "" || strings.ContainsAny(key, "\\\x00") {
+		return fmt.Errorf("invalid storage key %q", key)
+	}
+	for _, segment := range strings.Split(key, "/") {
+		if segment == "" || segment == "." || segment == ".." {
+			return fmt.Errorf("invalid storage key %q", key)
+		}
+	}
+	return nil
+}
+
+// sortObjects sorts objects by key
+func sortObjects(objects []ObjectInfo) {
+	slices.SortFunc(objects, func(a, b ObjectInfo) int {
+		return strings.Compare(a.Key, b.Key)
+	})
+}
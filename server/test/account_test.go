@@ -0,0 +1,181 @@
+package test
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"elotuschallenge/common"
+	"elotuschallenge/handler"
+	"elotuschallenge/internal"
+	"elotuschallenge/middleware"
+	"elotuschallenge/test/share"
+)
+
+func TestHandleMe_Delete_RemovesAccountAndFiles(t *testing.T) {
+	token, refreshToken := loginTestUserTokens(t, "deleteduser", "password123")
+	apiKey, _ := createTestAPIKey(t, token, []string{common.ScopeFilesRead})
+	userID := uploadTestFile(t, token)
+	files, _ := internal.FileService.GetFilesByUser(userID)
+	if len(files) != 1 {
+		t.Fatalf("Expected 1 uploaded file, got %d", len(files))
+	}
+	references := blobRefCount(t, files[0].SHA256)
+
+	w := deleteAccountRequest(token)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d. Body: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	if user, _ := internal.UserService.GetUserByID(userID); user != nil {
+		t.Error("Expected user to be deleted")
+	}
+	if remaining, _ := internal.FileService.GetFilesByUser(userID); len(remaining) != 0 {
+		t.Errorf("Expected file rows to be deleted, got %d", len(remaining))
+	}
+	// The test PNG may be uploaded by other tests too, then only their references are left
+	if references == 1 && fileStored(t, files[0]) {
+		t.Error("Expected file to be removed from storage")
+	}
+	if got := blobRefCount(t, files[0].SHA256); got != references-1 {
+		t.Errorf("Expected %d references to the content left, got %d", references-1, got)
+	}
+
+	for name, credential := range map[string]string{"access token": token, "API key": apiKey} {
+		if w := authorizedRequest(credential); w.Code != http.StatusUnauthorized {
+			t.Errorf("Expected %s to be rejected, got %d", name, w.Code)
+		}
+	}
+	if w := refreshRequest(refreshToken); w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected refresh token to be rejected, got %d", w.Code)
+	}
+
+	// The username is free again
+	registerUser(t, "deleteduser", "password123")
+}
+
+func TestHandleMe_Delete_APIKey_Forbidden(t *testing.T) {
+	token := loginTestUser(t, "deletekeyuser", "password123")
+	apiKey, _ := createTestAPIKey(t, token, []string{common.ScopeFilesWrite})
+
+	w := deleteAccountRequest(apiKey)
+
+	if w.Code != http.StatusForbidden {
+		t.Errorf("Expected status %d, got %d", http.StatusForbidden, w.Code)
+	}
+	if w := authorizedRequest(token); w.Code != http.StatusOK {
+		t.Errorf("Expected account to be kept, got %d", w.Code)
+	}
+}
+
+func TestHandleMeExport_ZipWithProfileAndFiles(t *testing.T) {
+	token := loginTestUser(t, "exportuser", "password123")
+	uploadTestFile(t, token)
+
+	w := exportRequest(token)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d. Body: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	if contentType := w.Header().Get(common.HeaderContentType); contentType != common.HeaderValueContentTypeZIP {
+		t.Errorf("Expected content type %s, got %s", common.HeaderValueContentTypeZIP, contentType)
+	}
+
+	archive, err := zip.NewReader(bytes.NewReader(w.Body.Bytes()), int64(w.Body.Len()))
+	if err != nil {
+		t.Fatalf("Failed to open archive: %v", err)
+	}
+	entries := map[string]*zip.File{}
+	for _, entry := range archive.File {
+		entries[entry.Name] = entry
+	}
+
+	var export struct {
+		User struct {
+			Username     string `json:"username"`
+			PasswordHash string `json:"password_hash"`
+		} `json:"user"`
+		Files []struct {
+			OriginalName string `json:"original_name"`
+			ArchivePath  string `json:"archive_path"`
+		} `json:"files"`
+	}
+	if err := json.Unmarshal(readArchiveEntry(t, entries["account.json"]), &export); err != nil {
+		t.Fatalf("Failed to decode account document: %v", err)
+	}
+	if export.User.Username != "exportuser" || export.User.PasswordHash != "" {
+		t.Errorf("Unexpected user in export %+v", export.User)
+	}
+	if len(export.Files) != 1 || export.Files[0].OriginalName != "leaf.png" {
+		t.Fatalf("Expected metadata of the uploaded file, got %+v", export.Files)
+	}
+
+	pngData, _ := share.LoadTestPNG("./test/files/leaf.png")
+	if content := readArchiveEntry(t, entries[export.Files[0].ArchivePath]); !bytes.Equal(content, pngData) {
+		t.Errorf("Expected file content in archive at %q", export.Files[0].ArchivePath)
+	}
+}
+
+func TestHandleMeExport_APIKey_Forbidden(t *testing.T) {
+	token := loginTestUser(t, "exportkeyuser", "password123")
+	apiKey, _ := createTestAPIKey(t, token, []string{common.ScopeFilesRead})
+
+	w := exportRequest(apiKey)
+
+	if w.Code != http.StatusForbidden {
+		t.Errorf("Expected status %d, got %d", http.StatusForbidden, w.Code)
+	}
+}
+
+// uploadTestFile uploads the test PNG and returns the ID of the uploading user
+func uploadTestFile(t *testing.T, token string) int {
+	t.Helper()
+	w := httptest.NewRecorder()
+	middleware.AuthUser(handler.HandleUpload)(w, newPNGUploadRequest(t, token))
+	if w.Code != http.StatusOK && w.Code != http.StatusCreated {
+		t.Fatalf("Failed to upload test file: %s", w.Body.String())
+	}
+
+	claims, err := internal.TokenManager.ValidateToken(token)
+	if err != nil {
+		t.Fatalf("Failed to read token: %v", err)
+	}
+	return claims.UserID
+}
+
+func deleteAccountRequest(token string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodDelete, "/api/me", nil)
+	req.Header.Set(common.HeaderAuthorization, "Bearer "+token)
+	w := httptest.NewRecorder()
+	middleware.AuthUser(handler.HandleMe)(w, req)
+	return w
+}
+
+func exportRequest(token string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, "/api/me/export", nil)
+	req.Header.Set(common.HeaderAuthorization, "Bearer "+token)
+	w := httptest.NewRecorder()
+	middleware.AuthUser(handler.HandleMeExport)(w, req)
+	return w
+}
+
+func readArchiveEntry(t *testing.T, entry *zip.File) []byte {
+	t.Helper()
+	if entry == nil {
+		t.Fatal("Expected entry in archive")
+	}
+	reader, err := entry.Open()
+	if err != nil {
+		t.Fatalf("Failed to open %s: %v", entry.Name, err)
+	}
+	defer reader.Close()
+	content, err := io.ReadAll(reader)
+	if err != nil {
+		t.Fatalf("Failed to read %s: %v", entry.Name, err)
+	}
+	return content
+}
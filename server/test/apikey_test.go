@@ -0,0 +1,155 @@
+package test
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"testing"
+
+	"elotuschallenge/common"
+	"elotuschallenge/handler"
+	"elotuschallenge/middleware"
+	"elotuschallenge/services"
+	"elotuschallenge/test/share"
+	"elotuschallenge/transfer"
+)
+
+func TestAPIKey_FilesWriteScope_CanUpload(t *testing.T) {
+	token := loginTestUser(t, "apikeyuser", "password123")
+
+	key, _ := createTestAPIKey(t, token, []string{common.ScopeFilesWrite})
+	if !strings.HasPrefix(key, services.APIKeyPrefix) {
+		t.Errorf("Expected key to start with '%s', got '%s'", services.APIKeyPrefix, key)
+	}
+
+	w := httptest.NewRecorder()
+	middleware.AuthUser(handler.HandleUpload)(w, newPNGUploadRequest(t, key))
+
+	if w.Code != http.StatusCreated {
+		t.Errorf("Expected status %d, got %d. Body: %s", http.StatusCreated, w.Code, w.Body.String())
+	}
+}
+
+func TestAPIKey_MissingScope_Forbidden(t *testing.T) {
+	token := loginTestUser(t, "apikeyreader", "password123")
+	key, _ := createTestAPIKey(t, token, []string{common.ScopeFilesRead})
+
+	w := httptest.NewRecorder()
+	middleware.AuthUser(handler.HandleUpload)(w, newPNGUploadRequest(t, key))
+
+	if w.Code != http.StatusForbidden {
+		t.Errorf("Expected status %d, got %d", http.StatusForbidden, w.Code)
+	}
+
+	// API keys can't manage API keys either
+	req := httptest.NewRequest(http.MethodGet, "/api/keys", nil)
+	req.Header.Set(common.HeaderAuthorization, "Bearer "+key)
+	w = httptest.NewRecorder()
+	middleware.AuthUser(handler.HandleAPIKeys)(w, req)
+
+	if w.Code != http.StatusForbidden {
+		t.Errorf("Expected status %d, got %d", http.StatusForbidden, w.Code)
+	}
+}
+
+func TestAPIKey_ListAndRevoke_KeyRejected(t *testing.T) {
+	token := loginTestUser(t, "apikeyrevoker", "password123")
+	key, keyID := createTestAPIKey(t, token, []string{common.ScopeFilesWrite})
+
+	// List shows the key without its secret
+	req := httptest.NewRequest(http.MethodGet, "/api/keys", nil)
+	req.Header.Set(common.HeaderAuthorization, "Bearer "+token)
+	w := httptest.NewRecorder()
+	middleware.AuthUser(handler.HandleAPIKeys)(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, w.Code)
+	}
+	if !strings.Contains(w.Body.String(), `"prefix"`) || strings.Contains(w.Body.String(), key) {
+		t.Errorf("Expected listed key with prefix and without secret, got %s", w.Body.String())
+	}
+
+	// Revoke
+	req = httptest.NewRequest(http.MethodDelete, "/api/keys/"+strconv.Itoa(keyID), nil)
+	req.SetPathValue("id", strconv.Itoa(keyID))
+	req.Header.Set(common.HeaderAuthorization, "Bearer "+token)
+	w = httptest.NewRecorder()
+	middleware.AuthUser(handler.HandleAPIKey)(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d. Body: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+
+	// Revoked key is rejected
+	w = httptest.NewRecorder()
+	middleware.AuthUser(handler.HandleUpload)(w, newPNGUploadRequest(t, key))
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status %d, got %d", http.StatusUnauthorized, w.Code)
+	}
+}
+
+func TestAPIKey_InvalidScope_Error(t *testing.T) {
+	token := loginTestUser(t, "apikeybadscope", "password123")
+
+	body, _ := json.Marshal(transfer.CreateAPIKeyRequest{Name: "ci", Scopes: []string{common.ScopeKeysManage}})
+	req := httptest.NewRequest(http.MethodPost, "/api/keys", bytes.NewReader(body))
+	req.Header.Set(common.HeaderAuthorization, "Bearer "+token)
+	w := httptest.NewRecorder()
+	middleware.AuthUser(handler.HandleAPIKeys)(w, req)
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d, got %d", http.StatusBadRequest, w.Code)
+	}
+}
+
+// createTestAPIKey creates an API key with the given scopes, returning the plain key and its ID
+func createTestAPIKey(t *testing.T, token string, scopes []string) (string, int) {
+	body, _ := json.Marshal(transfer.CreateAPIKeyRequest{Name: "ci", Scopes: scopes, ExpiresInSeconds: 3600})
+	req := httptest.NewRequest(http.MethodPost, "/api/keys", bytes.NewReader(body))
+	req.Header.Set(common.HeaderContentType, common.HeaderValueContentTypeJSON)
+	req.Header.Set(common.HeaderAuthorization, "Bearer "+token)
+	w := httptest.NewRecorder()
+
+	middleware.AuthUser(handler.HandleAPIKeys)(w, req)
+
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Failed to create API key: %s", w.Body.String())
+	}
+
+	var response transfer.APIResponse
+	json.NewDecoder(w.Body).Decode(&response)
+	dataMap := response.Data.(map[string]interface{})
+	apiKey := dataMap["api_key"].(map[string]interface{})
+	return dataMap["key"].(string), int(apiKey["id"].(float64))
+}
+
+// newPNGUploadRequest builds an upload request of the test PNG authenticated with the bearer token
+func newPNGUploadRequest(t *testing.T, token string) *http.Request {
+	pngData, err := share.LoadTestPNG("./test/files/leaf.png")
+	if err != nil {
+		t.Fatalf("Failed to load test PNG file: %v", err)
+	}
+
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	partHeader := textproto.MIMEHeader{}
+	partHeader.Set("Content-Disposition", `form-data; name="data"; filename="leaf.png"`)
+	partHeader.Set(common.HeaderContentType, "image/png")
+	part, err := writer.CreatePart(partHeader)
+	if err != nil {
+		t.Fatalf("Failed to create form part: %v", err)
+	}
+	io.Copy(part, bytes.NewReader(pngData))
+	writer.Close()
+
+	req := httptest.NewRequest(http.MethodPost, "/upload", &body)
+	req.Header.Set(common.HeaderContentType, writer.FormDataContentType())
+	req.Header.Set(common.HeaderAuthorization, "Bearer "+token)
+	return req
+}
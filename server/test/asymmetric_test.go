@@ -0,0 +1,159 @@
+package test
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"elotuschallenge/handler"
+	"elotuschallenge/internal"
+	"elotuschallenge/repository"
+	"elotuschallenge/services"
+)
+
+func TestAsymmetricSigning_AllAlgorithms_RoundTrip(t *testing.T) {
+	testCases := []struct {
+		algorithm string
+		key       crypto.Signer
+	}{
+		{services.AlgorithmRS256, mustRSAKey(t)},
+		{services.AlgorithmES256, mustECKey(t)},
+		{services.AlgorithmEdDSA, mustEd25519Key(t)},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.algorithm, func(t *testing.T) {
+			manager := newAsymmetricTokenManager(t, tc.algorithm, tc.key)
+
+			token, err := manager.GenerateToken(42, "asymuser")
+			if err != nil {
+				t.Fatalf("Failed to generate JWT: %v", err)
+			}
+
+			claims, err := manager.ValidateToken(token)
+			if err != nil {
+				t.Fatalf("Failed to validate JWT: %v", err)
+			}
+			if claims.UserID != 42 {
+				t.Errorf("Expected UserID 42, got %d", claims.UserID)
+			}
+
+			// Changing the payload must break the signature
+			parts := strings.Split(token, ".")
+			payload := base64.RawURLEncoding.EncodeToString([]byte(`{"user_id":1,"username":"admin","iat":0,"exp":9999999999}`))
+			if _, err := manager.ValidateToken(parts[0] + "." + payload + "." + parts[2]); err == nil {
+				t.Error("Expected tampered token to be rejected")
+			}
+		})
+	}
+}
+
+func TestPublicKeys_RS256_VerifiesToken(t *testing.T) {
+	rsaKey := mustRSAKey(t)
+	manager := newAsymmetricTokenManager(t, services.AlgorithmRS256, rsaKey)
+
+	token, err := manager.GenerateToken(7, "jwksuser")
+	if err != nil {
+		t.Fatalf("Failed to generate JWT: %v", err)
+	}
+
+	jwks := manager.PublicKeys()
+	if len(jwks.Keys) != 1 {
+		t.Fatalf("Expected 1 public key, got %d", len(jwks.Keys))
+	}
+	jwk := jwks.Keys[0]
+	if jwk.KeyType != "RSA" || jwk.Algorithm != services.AlgorithmRS256 || jwk.KeyID != services.DefaultKeyID {
+		t.Errorf("Unexpected JWK %+v", jwk)
+	}
+
+	// Verify the token signature using only the published key
+	n, _ := base64.RawURLEncoding.DecodeString(jwk.N)
+	e, _ := base64.RawURLEncoding.DecodeString(jwk.E)
+	publicKey := &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+
+	parts := strings.Split(token, ".")
+	signature, _ := base64.RawURLEncoding.DecodeString(parts[2])
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	if err := rsa.VerifyPKCS1v15(publicKey, crypto.SHA256, digest[:], signature); err != nil {
+		t.Errorf("Failed to verify token with published key: %v", err)
+	}
+}
+
+func TestHandleJWKS_SymmetricKey_NoSecretsPublished(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/.well-known/jwks.json", nil)
+	w := httptest.NewRecorder()
+
+	handler.HandleJWKS(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, w.Code)
+	}
+
+	var jwks services.JWKSet
+	if err := json.NewDecoder(w.Body).Decode(&jwks); err != nil {
+		t.Fatalf("Failed to decode JWKS: %v", err)
+	}
+	if jwks.Keys == nil || len(jwks.Keys) != len(internal.TokenManager.PublicKeys().Keys) {
+		t.Errorf("Expected published keys to match token manager, got %+v", jwks.Keys)
+	}
+	if strings.Contains(w.Body.String(), "secret") {
+		t.Error("JWKS must not contain HMAC secrets")
+	}
+}
+
+// newAsymmetricTokenManager creates a token manager signing with the given private key
+func newAsymmetricTokenManager(t *testing.T, algorithm string, key crypto.Signer) services.ITokenManager {
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatalf("Failed to marshal private key: %v", err)
+	}
+	privatePEM := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+
+	keyring, err := services.NewKeyring([]*services.SigningKey{{
+		ID:         services.DefaultKeyID,
+		Algorithm:  algorithm,
+		PrivateKey: string(privatePEM),
+		Active:     true,
+	}})
+	if err != nil {
+		t.Fatalf("Failed to create keyring: %v", err)
+	}
+	return services.NewTokenManager(keyring, services.TokenManagerConfig{ExpirationSeconds: 3600}, repository.NewSQLiteRevokedTokenRepository())
+}
+
+func mustRSAKey(t *testing.T) crypto.Signer {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Failed to generate RSA key: %v", err)
+	}
+	return key
+}
+
+func mustECKey(t *testing.T) crypto.Signer {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate ECDSA key: %v", err)
+	}
+	return key
+}
+
+func mustEd25519Key(t *testing.T) crypto.Signer {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate Ed25519 key: %v", err)
+	}
+	return key
+}
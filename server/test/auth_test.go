@@ -19,8 +19,10 @@ func init() {
 
 func TestAuthMiddleware_ValidToken_Success(t *testing.T) {
 	// Use the global JWT service that matches the middleware
-	userID := 123
 	username := "authuser"
+	registerUser(t, username, "password123")
+	user, _ := internal.UserService.GetUserByUsername(username)
+	userID := user.ID
 
 	// Generate valid token using the standalone JWT service
 	token, err := internal.TokenManager.GenerateToken(userID, username)
@@ -30,23 +32,17 @@ func TestAuthMiddleware_ValidToken_Success(t *testing.T) {
 
 	// Create a test handler that checks context
 	testHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		// Check if user info is in context
-		contextUserID, ok := r.Context().Value("user_id").(int)
+		// Check if the principal is in context
+		principal, ok := middleware.GetPrincipal(r)
 		if !ok {
-			t.Error("Expected user_id in context")
+			t.Error("Expected principal in context")
 			return
 		}
-		if contextUserID != userID {
-			t.Errorf("Expected user_id %d, got %d", userID, contextUserID)
+		if principal.ID != userID {
+			t.Errorf("Expected user ID %d, got %d", userID, principal.ID)
 		}
-
-		contextUsername, ok := r.Context().Value("username").(string)
-		if !ok {
-			t.Error("Expected username in context")
-			return
-		}
-		if contextUsername != username {
-			t.Errorf("Expected username %s, got %s", username, contextUsername)
+		if principal.Username != username {
+			t.Errorf("Expected username %s, got %s", username, principal.Username)
 		}
 
 		w.WriteHeader(http.StatusOK)
@@ -74,6 +70,28 @@ func TestAuthMiddleware_ValidToken_Success(t *testing.T) {
 	}
 }
 
+func TestAuthMiddleware_TokenOfDeletedUser_Unauthorized(t *testing.T) {
+	registerUser(t, "authdeleted", "password123")
+	user, _ := internal.UserService.GetUserByUsername("authdeleted")
+
+	// A token issued outside a session has no session rows to be revoked with
+	token, err := internal.TokenManager.GenerateToken(user.ID, user.Username)
+	if err != nil {
+		t.Fatalf("Failed to generate JWT: %v", err)
+	}
+	if w := authorizedRequest(token); w.Code != http.StatusOK {
+		t.Fatalf("Expected token to be accepted before deletion, got %d", w.Code)
+	}
+
+	if err := internal.AccountService.DeleteAccount(user.ID); err != nil {
+		t.Fatalf("Failed to delete account: %v", err)
+	}
+
+	if w := authorizedRequest(token); w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected token of deleted user to be rejected with %d, got %d", http.StatusUnauthorized, w.Code)
+	}
+}
+
 func TestAuthMiddleware_NoAuthHeader_Error(t *testing.T) {
 	testHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		t.Error("Handler should not be called without auth")
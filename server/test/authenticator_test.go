@@ -0,0 +1,207 @@
+package test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"elotuschallenge/common"
+	"elotuschallenge/handler"
+	"elotuschallenge/middleware"
+)
+
+// headerAuthenticator is an example of an authentication method plugged into the chain
+type headerAuthenticator struct {
+	called *bool
+}
+
+func (headerAuthenticator) Name() string { return "test_header" }
+
+func (a headerAuthenticator) Authenticate(r *http.Request) (*middleware.Principal, error) {
+	if a.called != nil {
+		*a.called = true
+	}
+	if r.Header.Get("X-Test-User") == "" {
+		return nil, nil
+	}
+	return &middleware.Principal{ID: 4242, Username: r.Header.Get("X-Test-User"), AuthMethod: "test_header"}, nil
+}
+
+func TestAuthUser_CustomAuthenticator_FillsPrincipal(t *testing.T) {
+	useAuthenticators(t, middleware.JWTAuthenticator{}, headerAuthenticator{})
+
+	req := httptest.NewRequest(http.MethodGet, "/api/me", nil)
+	req.Header.Set("X-Test-User", "pluggeduser")
+	w := httptest.NewRecorder()
+	middleware.AuthUser(handler.HandleMe)(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d. Body: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	data := decodeMeData(t, w)
+	if data.User.ID != 4242 || data.User.Username != "pluggeduser" || data.AuthMethod != "test_header" {
+		t.Errorf("Expected principal of the custom authenticator, got %+v", data)
+	}
+}
+
+func TestAuthUser_InvalidCredential_StopsChain(t *testing.T) {
+	called := false
+	useAuthenticators(t, middleware.JWTAuthenticator{}, headerAuthenticator{called: &called})
+
+	req := httptest.NewRequest(http.MethodGet, "/api/me", nil)
+	req.Header.Set(common.HeaderAuthorization, "Bearer not-a-token")
+	req.Header.Set("X-Test-User", "pluggeduser")
+	w := httptest.NewRecorder()
+	middleware.AuthUser(handler.HandleMe)(w, req)
+
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status %d, got %d", http.StatusUnauthorized, w.Code)
+	}
+	if called {
+		t.Error("Expected the chain to stop at the invalid token")
+	}
+}
+
+func TestAuthUser_ConfiguredChain_RejectsOtherMethods(t *testing.T) {
+	token := loginTestUser(t, "chainjwtonly", "password123")
+	apiKey, _ := createTestAPIKey(t, token, []string{common.ScopeFilesRead})
+
+	chain, err := middleware.AuthenticatorsByName([]string{"jwt"})
+	if err != nil {
+		t.Fatalf("Failed to build chain: %v", err)
+	}
+	useAuthenticators(t, chain...)
+
+	if w := meRequest(token); w.Code != http.StatusOK {
+		t.Errorf("Expected JWT to be accepted, got %d", w.Code)
+	}
+	if w := meRequest(apiKey); w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected API key to be rejected, got %d", w.Code)
+	}
+}
+
+func TestAuthenticatorsByName_UnknownMethod_Error(t *testing.T) {
+	if _, err := middleware.AuthenticatorsByName([]string{"jwt", "kerberos"}); err == nil {
+		t.Error("Expected error for unknown method")
+	}
+	if _, err := middleware.AuthenticatorsByName([]string{" "}); err == nil {
+		t.Error("Expected error for empty chain")
+	}
+}
+
+func TestAuthUser_ClientCertificate(t *testing.T) {
+	registerUser(t, "certuser", "password123")
+
+	tests := []struct {
+		name       string
+		commonName string
+		verified   bool
+		wantStatus int
+	}{
+		{"verified certificate of user", "certuser", true, http.StatusOK},
+		{"unverified certificate", "certuser", false, http.StatusUnauthorized},
+		{"unknown user", "certnobody", true, http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cert := newClientCertificate(t, tt.commonName)
+			state := &tls.ConnectionState{PeerCertificates: []*x509.Certificate{cert}}
+			if tt.verified {
+				state.VerifiedChains = [][]*x509.Certificate{{cert}}
+			}
+
+			req := httptest.NewRequest(http.MethodGet, "/api/me", nil)
+			req.TLS = state
+			w := httptest.NewRecorder()
+			middleware.AuthUser(handler.HandleMe)(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("Expected status %d, got %d. Body: %s", tt.wantStatus, w.Code, w.Body.String())
+			}
+			if tt.wantStatus == http.StatusOK {
+				data := decodeMeData(t, w)
+				if data.User.Username != "certuser" || data.AuthMethod != common.AuthMethodClientCert {
+					t.Errorf("Unexpected principal %+v", data)
+				}
+			}
+		})
+	}
+}
+
+func TestAuthUser_ClientCertificate_StateChangingRequestsNeedCSRFHeader(t *testing.T) {
+	registerUser(t, "certcsrfuser", "password123")
+	cert := newClientCertificate(t, "certcsrfuser")
+	protected := middleware.AuthUser(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	tests := []struct {
+		name       string
+		method     string
+		csrfHeader string
+		wantStatus int
+	}{
+		{"safe method", http.MethodGet, "", http.StatusOK},
+		{"cross-site form post", http.MethodPost, "", http.StatusForbidden},
+		{"delete without header", http.MethodDelete, "", http.StatusForbidden},
+		{"post with header", http.MethodPost, "1", http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, "/api/files/1", nil)
+			req.TLS = &tls.ConnectionState{PeerCertificates: []*x509.Certificate{cert}, VerifiedChains: [][]*x509.Certificate{{cert}}}
+			if tt.csrfHeader != "" {
+				req.Header.Set(common.HeaderCSRFToken, tt.csrfHeader)
+			}
+			w := httptest.NewRecorder()
+			protected(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Errorf("Expected status %d, got %d. Body: %s", tt.wantStatus, w.Code, w.Body.String())
+			}
+		})
+	}
+}
+
+// useAuthenticators replaces the authenticator chain for the test
+func useAuthenticators(t *testing.T, chain ...middleware.Authenticator) {
+	t.Helper()
+	previous := middleware.Authenticators()
+	middleware.SetAuthenticators(chain...)
+	t.Cleanup(func() { middleware.SetAuthenticators(previous...) })
+}
+
+// newClientCertificate creates a self-signed client certificate with the common name
+func newClientCertificate(t *testing.T, commonName string) *x509.Certificate {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Minute),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("Failed to create certificate: %v", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("Failed to parse certificate: %v", err)
+	}
+	return cert
+}
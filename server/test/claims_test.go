@@ -0,0 +1,138 @@
+package test
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"elotuschallenge/repository"
+	"elotuschallenge/services"
+)
+
+const strictTestSecret = "strict-validation-secret-0123456789"
+
+func TestValidateToken_StrictChecks_TypedErrors(t *testing.T) {
+	manager := newStrictTokenManager()
+	now := time.Now().Unix()
+	validHeader := map[string]interface{}{"alg": "HS256", "typ": "JWT", "kid": services.DefaultKeyID}
+	validClaims := func() map[string]interface{} {
+		return map[string]interface{}{
+			"user_id": 1, "username": "strictuser", "jti": "token-id",
+			"iss": "strict-issuer", "aud": []string{"other-api", "strict-api"},
+			"iat": now, "nbf": now, "exp": now + 60,
+		}
+	}
+	withClaim := func(key string, value interface{}) map[string]interface{} {
+		claims := validClaims()
+		if value == nil {
+			delete(claims, key)
+		} else {
+			claims[key] = value
+		}
+		return claims
+	}
+
+	testCases := []struct {
+		name     string
+		header   map[string]interface{}
+		claims   map[string]interface{}
+		expected error
+	}{
+		{"Valid token", validHeader, validClaims(), nil},
+		{"Single audience string", validHeader, withClaim("aud", "strict-api"), nil},
+		{"Expired within leeway", validHeader, withClaim("exp", now-5), nil},
+		{"Algorithm none", map[string]interface{}{"alg": "none", "typ": "JWT"}, validClaims(), services.ErrTokenUnsupportedAlgorithm},
+		{"Algorithm mismatch", map[string]interface{}{"alg": "RS256", "typ": "JWT"}, validClaims(), services.ErrTokenUnsupportedAlgorithm},
+		{"Wrong type", map[string]interface{}{"alg": "HS256", "typ": "at+jwt"}, validClaims(), services.ErrTokenInvalidType},
+		{"Unknown key", map[string]interface{}{"alg": "HS256", "typ": "JWT", "kid": "missing"}, validClaims(), services.ErrTokenUnknownKey},
+		{"Expired beyond leeway", validHeader, withClaim("exp", now-60), services.ErrTokenExpired},
+		{"Not before in future", validHeader, withClaim("nbf", now+60), services.ErrTokenNotYetValid},
+		{"Issued in future", validHeader, withClaim("iat", now+60), services.ErrTokenNotYetValid},
+		{"Wrong issuer", validHeader, withClaim("iss", "someone-else"), services.ErrTokenInvalidIssuer},
+		{"Wrong audience", validHeader, withClaim("aud", "other-api"), services.ErrTokenInvalidAudience},
+		{"Missing audience", validHeader, withClaim("aud", nil), services.ErrTokenInvalidAudience},
+		{"Missing jti", validHeader, withClaim("jti", nil), services.ErrTokenMissingID},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := manager.ValidateToken(signTestToken(t, tc.header, tc.claims))
+			if tc.expected == nil {
+				if err != nil {
+					t.Errorf("Expected token to be valid, got %v", err)
+				}
+				return
+			}
+			if !errors.Is(err, tc.expected) {
+				t.Errorf("Expected error %v, got %v", tc.expected, err)
+			}
+			if services.TokenErrorReason(err) == "" {
+				t.Errorf("Expected a reason for error %v", err)
+			}
+		})
+	}
+}
+
+func TestGenerateToken_RegisteredClaims_Present(t *testing.T) {
+	manager := newStrictTokenManager()
+
+	token, err := manager.GenerateToken(5, "claimsuser")
+	if err != nil {
+		t.Fatalf("Failed to generate JWT: %v", err)
+	}
+
+	claims, err := manager.ValidateToken(token)
+	if err != nil {
+		t.Fatalf("Failed to validate JWT: %v", err)
+	}
+	if claims.ID == "" {
+		t.Error("Expected jti claim")
+	}
+	if claims.Issuer != "strict-issuer" {
+		t.Errorf("Expected issuer 'strict-issuer', got '%s'", claims.Issuer)
+	}
+	if !claims.Audience.Contains([]string{"strict-api"}) {
+		t.Errorf("Expected audience 'strict-api', got %v", claims.Audience)
+	}
+	if claims.NotBefore == 0 {
+		t.Error("Expected nbf claim")
+	}
+
+	// Every token gets a unique ID
+	other, _ := manager.GenerateToken(5, "claimsuser")
+	otherClaims, _ := manager.ValidateToken(other)
+	if otherClaims.ID == claims.ID {
+		t.Error("Expected unique jti per token")
+	}
+}
+
+// newStrictTokenManager creates a token manager expecting an issuer and audience
+func newStrictTokenManager() services.ITokenManager {
+	return services.NewTokenManager(services.NewStaticKeyring(strictTestSecret), services.TokenManagerConfig{
+		ExpirationSeconds: 3600,
+		Issuer:            "strict-issuer",
+		Audience:          []string{"strict-api"},
+		LeewaySeconds:     30,
+	}, repository.NewSQLiteRevokedTokenRepository())
+}
+
+// signTestToken builds an HS256 signed token from a raw header and claims
+func signTestToken(t *testing.T, header, claims map[string]interface{}) string {
+	headerBytes, err := json.Marshal(header)
+	if err != nil {
+		t.Fatalf("Failed to encode header: %v", err)
+	}
+	claimsBytes, err := json.Marshal(claims)
+	if err != nil {
+		t.Fatalf("Failed to encode claims: %v", err)
+	}
+
+	message := base64.RawURLEncoding.EncodeToString(headerBytes) + "." + base64.RawURLEncoding.EncodeToString(claimsBytes)
+	h := hmac.New(sha256.New, []byte(strictTestSecret))
+	h.Write([]byte(message))
+	return message + "." + base64.RawURLEncoding.EncodeToString(h.Sum(nil))
+}
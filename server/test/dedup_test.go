@@ -0,0 +1,221 @@
+package test
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"elotuschallenge/handler"
+	"elotuschallenge/internal"
+	"elotuschallenge/models"
+	"elotuschallenge/repository"
+	"elotuschallenge/services"
+	"elotuschallenge/storage"
+)
+
+func TestDedup_SameContent_SharesOneBlob(t *testing.T) {
+	firstToken := loginTestUser(t, "dedupfirst", "password123")
+	secondToken := loginTestUser(t, "dedupsecond", "password123")
+	content := []byte("content uploaded three times")
+	sum := sha256.Sum256(content)
+	digest := hex.EncodeToString(sum[:])
+
+	files := []*models.FileMetadata{
+		saveTestFile(t, firstToken, "one.png", content),
+		saveTestFile(t, firstToken, "two.png", content),
+		saveTestFile(t, secondToken, "three.png", content),
+	}
+	for _, file := range files {
+		if file.SHA256 != digest {
+			t.Errorf("Expected digest %s, got %q", digest, file.SHA256)
+		}
+		if file.StorageKey != files[0].StorageKey || file.StorageBackend != files[0].StorageBackend {
+			t.Errorf("Expected all files to share %s, got %s", files[0].StorageKey, file.StorageKey)
+		}
+	}
+	if got := blobRefCount(t, digest); got != 3 {
+		t.Errorf("Expected 3 references, got %d", got)
+	}
+
+	objects, err := internal.FileStorage.Default().List("sha256/")
+	if err != nil {
+		t.Fatalf("Failed to list blobs: %v", err)
+	}
+	stored := 0
+	for _, object := range objects {
+		if strings.HasSuffix(object.Key, digest) {
+			stored++
+		}
+	}
+	if stored != 1 {
+		t.Errorf("Expected the content to be stored once, got %d copies", stored)
+	}
+
+	// The content stays while any file uses it
+	deleteTestFile(t, firstToken, files[0])
+	deleteTestFile(t, secondToken, files[2])
+	if !fileStored(t, files[1]) || blobRefCount(t, digest) != 1 {
+		t.Fatalf("Expected the content to stay for the remaining file, %d references", blobRefCount(t, digest))
+	}
+	if w := fileContentRequest(t, firstToken, files[1].ID, nil); w.Code != http.StatusOK || !bytes.Equal(w.Body.Bytes(), content) {
+		t.Errorf("Expected the remaining file to be downloadable, got status %d", w.Code)
+	}
+
+	deleteTestFile(t, firstToken, files[1])
+	if fileStored(t, files[1]) {
+		t.Error("Expected the content to be removed with its last file")
+	}
+	if blob, _ := repository.NewSQLiteBlobRepository().GetBlob(digest); blob != nil {
+		t.Errorf("Expected the blob to be deleted, got %+v", blob)
+	}
+
+	// Uploading the content again stores it again
+	file := saveTestFile(t, secondToken, "again.png", content)
+	if !fileStored(t, file) || blobRefCount(t, digest) != 1 {
+		t.Errorf("Expected the content to be stored again, %d references", blobRefCount(t, digest))
+	}
+}
+
+func TestDedup_AccountDeletion_KeepsSharedContent(t *testing.T) {
+	leaverToken := loginTestUser(t, "dedupleaver", "password123")
+	stayerToken := loginTestUser(t, "dedupstayer", "password123")
+	content := []byte("content of a deleted account")
+
+	saveTestFile(t, leaverToken, "shared.png", content)
+	kept := saveTestFile(t, stayerToken, "shared.png", content)
+
+	if w := deleteAccountRequest(leaverToken); w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d. Body: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+
+	if got := blobRefCount(t, kept.SHA256); got != 1 {
+		t.Errorf("Expected 1 reference left, got %d", got)
+	}
+	if w := fileContentRequest(t, stayerToken, kept.ID, nil); w.Code != http.StatusOK || !bytes.Equal(w.Body.Bytes(), content) {
+		t.Errorf("Expected the shared file to stay downloadable, got status %d", w.Code)
+	}
+}
+
+func TestDedup_FileWithoutDigest_OwnsContent(t *testing.T) {
+	token := loginTestUser(t, "deduplegacy", "password123")
+	claims, _ := internal.TokenManager.ValidateToken(token)
+
+	// Files uploaded before deduplication have their own content and no digest
+	key := "legacy/old_upload.png"
+	if err := internal.FileStorage.Default().Put(key, bytes.NewReader(downloadContent), int64(len(downloadContent)), "image/png"); err != nil {
+		t.Fatalf("Failed to store legacy content: %v", err)
+	}
+	file, err := internal.FileService.SaveFileMetadata(&models.FileMetadata{
+		Filename:       "old_upload.png",
+		OriginalName:   "old.png",
+		ContentType:    "image/png",
+		Size:           int64(len(downloadContent)),
+		UserID:         claims.UserID,
+		StorageBackend: storage.LocalBackendID,
+		StorageKey:     key,
+	})
+	if err != nil {
+		t.Fatalf("Failed to save legacy file: %v", err)
+	}
+
+	if w := fileContentRequest(t, token, file.ID, nil); w.Code != http.StatusOK {
+		t.Errorf("Expected the legacy file to be downloadable, got status %d", w.Code)
+	}
+	deleteTestFile(t, token, file)
+	if fileStored(t, file) {
+		t.Error("Expected the legacy content to be removed")
+	}
+}
+
+func TestDedup_IncompleteUpload_NothingStored(t *testing.T) {
+	token := loginTestUser(t, "dedupshort", "password123")
+	claims, _ := internal.TokenManager.ValidateToken(token)
+	content := []byte("shorter than announced")
+	sum := sha256.Sum256(content)
+
+	_, err := internal.FileService.SaveUploadedFile(bytes.NewReader(content), "short.png", "image/png", 100, claims.UserID, "test", "127.0.0.1")
+	if err == nil {
+		t.Fatal("Expected incomplete upload to fail")
+	}
+	if blob, _ := repository.NewSQLiteBlobRepository().GetBlob(hex.EncodeToString(sum[:])); blob != nil {
+		t.Errorf("Expected no blob for incomplete content, got %+v", blob)
+	}
+	if files, _ := internal.FileService.GetFilesByUser(claims.UserID); len(files) != 0 {
+		t.Errorf("Expected no file rows, got %d", len(files))
+	}
+}
+
+func TestDedup_ContentRemovedByAnotherProcess_StoredAgain(t *testing.T) {
+	content := []byte("content removed by another process while uploading")
+	sum := sha256.Sum256(content)
+	digest := hex.EncodeToString(sum[:])
+	spoolDir := t.TempDir()
+	backends := internal.FileStorage
+	blobs := services.NewBlobService(removingBlobRepository{IBlob: repository.NewSQLiteBlobRepository(), backends: backends}, backends, spoolDir)
+
+	blob, err := blobs.StoreBlob(bytes.NewReader(content), int64(len(content)), "image/png")
+	if err != nil {
+		t.Fatalf("Failed to store blob: %v", err)
+	}
+	file := &models.FileMetadata{SHA256: digest, StorageBackend: blob.StorageBackend, StorageKey: blob.StorageKey}
+	if !fileStored(t, file) || blobRefCount(t, digest) != 1 {
+		t.Errorf("Expected the content to be stored again for the new blob, %d references", blobRefCount(t, digest))
+	}
+
+	// Uploads are spooled under the storage directory, not the system temp directory
+	if entries, _ := os.ReadDir(spoolDir); len(entries) != 0 {
+		t.Errorf("Expected the spool file to be removed, found %d files", len(entries))
+	}
+	missing := services.NewBlobService(repository.NewSQLiteBlobRepository(), backends, filepath.Join(spoolDir, "missing"))
+	if _, err := missing.StoreBlob(bytes.NewReader(content), int64(len(content)), "image/png"); err == nil {
+		t.Error("Expected upload to fail without its spool directory")
+	}
+
+	if err := blobs.ReleaseFileContent(file); err != nil {
+		t.Fatalf("Failed to release blob: %v", err)
+	}
+	if fileStored(t, file) || blobRefCount(t, digest) != 0 {
+		t.Error("Expected the content to be removed with its last reference")
+	}
+}
+
+// removingBlobRepository removes the content of new blobs from storage right before recording them, as another
+// process releasing the last reference of the same digest would
+type removingBlobRepository struct {
+	repository.IBlob
+	backends *storage.Backends
+}
+
+func (r removingBlobRepository) CreateBlob(blob *models.Blob, checkContent func(blob *models.Blob) error) (*models.Blob, error) {
+	if err := r.backends.Delete(blob.StorageBackend, blob.StorageKey); err != nil {
+		return nil, err
+	}
+	return r.IBlob.CreateBlob(blob, checkContent)
+}
+
+// deleteTestFile trashes a file and deletes it permanently
+func deleteTestFile(t *testing.T, token string, file *models.FileMetadata) {
+	t.Helper()
+	fileChangeRequest(token, http.MethodDelete, "/api/files/", file.ID, handler.HandleFile)
+	if w := fileChangeRequest(token, http.MethodDelete, "/api/trash/", file.ID, handler.HandleTrashedFile); w.Code != http.StatusOK {
+		t.Fatalf("Failed to delete file %d: %s", file.ID, w.Body.String())
+	}
+}
+
+// blobRefCount returns the number of files referencing the content with the digest, 0 without a blob
+func blobRefCount(t *testing.T, digest string) int {
+	t.Helper()
+	blob, err := repository.NewSQLiteBlobRepository().GetBlob(digest)
+	if err != nil {
+		t.Fatalf("Failed to get blob: %v", err)
+	}
+	if blob == nil {
+		return 0
+	}
+	return blob.RefCount
+}
@@ -0,0 +1,196 @@
+package test
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"elotuschallenge/common"
+	"elotuschallenge/handler"
+	"elotuschallenge/internal"
+	"elotuschallenge/middleware"
+	"elotuschallenge/models"
+)
+
+var downloadContent = []byte("0123456789abcdefghijklmnopqrstuvwxyz")
+
+func TestHandleFileContent_StreamsFileWithStoredType(t *testing.T) {
+	token := loginTestUser(t, "downloader", "password123")
+	file := saveTestFile(t, token, "holiday.png", downloadContent)
+
+	w := fileContentRequest(t, token, file.ID, nil)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d. Body: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	if !bytes.Equal(w.Body.Bytes(), downloadContent) {
+		t.Errorf("Expected file content, got %q", w.Body.String())
+	}
+	if got := w.Header().Get(common.HeaderContentType); got != "image/png" {
+		t.Errorf("Expected stored content type, got %q", got)
+	}
+	if got := w.Header().Get(common.HeaderContentDisposition); got != `attachment; filename=holiday.png` {
+		t.Errorf("Expected attachment with original name, got %q", got)
+	}
+	if got := w.Header().Get("Accept-Ranges"); got != "bytes" {
+		t.Errorf("Expected byte ranges to be accepted, got %q", got)
+	}
+	etag := w.Header().Get(common.HeaderETag)
+	if !strings.HasPrefix(etag, `"`) || strings.HasPrefix(etag, "W/") {
+		t.Errorf("Expected strong ETag, got %q", etag)
+	}
+}
+
+func TestHandleFileContent_Range_PartialContent(t *testing.T) {
+	token := loginTestUser(t, "downloadranger", "password123")
+	file := saveTestFile(t, token, "range.png", downloadContent)
+
+	w := fileContentRequest(t, token, file.ID, map[string]string{"Range": "bytes=10-19"})
+
+	if w.Code != http.StatusPartialContent {
+		t.Fatalf("Expected status %d, got %d. Body: %s", http.StatusPartialContent, w.Code, w.Body.String())
+	}
+	if w.Body.String() != "abcdefghij" {
+		t.Errorf("Expected bytes 10-19, got %q", w.Body.String())
+	}
+	if got := w.Header().Get("Content-Range"); got != "bytes 10-19/36" {
+		t.Errorf("Expected content range, got %q", got)
+	}
+
+	// Ranges past the end can't be satisfied
+	w = fileContentRequest(t, token, file.ID, map[string]string{"Range": "bytes=100-200"})
+	if w.Code != http.StatusRequestedRangeNotSatisfiable {
+		t.Errorf("Expected status %d, got %d", http.StatusRequestedRangeNotSatisfiable, w.Code)
+	}
+
+	// A stale If-Range gets the whole file
+	w = fileContentRequest(t, token, file.ID, map[string]string{"Range": "bytes=10-19", "If-Range": `"stale"`})
+	if w.Code != http.StatusOK || !bytes.Equal(w.Body.Bytes(), downloadContent) {
+		t.Errorf("Expected whole file for stale If-Range, got status %d", w.Code)
+	}
+}
+
+func TestHandleFileContent_ConditionalRequests_NotModified(t *testing.T) {
+	token := loginTestUser(t, "downloadcacher", "password123")
+	file := saveTestFile(t, token, "cached.png", downloadContent)
+
+	etag := fileContentRequest(t, token, file.ID, nil).Header().Get(common.HeaderETag)
+
+	w := fileContentRequest(t, token, file.ID, map[string]string{"If-None-Match": etag})
+	if w.Code != http.StatusNotModified {
+		t.Errorf("Expected status %d for matching ETag, got %d", http.StatusNotModified, w.Code)
+	}
+	if w.Body.Len() != 0 {
+		t.Errorf("Expected no body for not modified, got %q", w.Body.String())
+	}
+
+	w = fileContentRequest(t, token, file.ID, map[string]string{"If-None-Match": `"other"`})
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected status %d for other ETag, got %d", http.StatusOK, w.Code)
+	}
+
+	modifiedSince := time.Now().Add(time.Hour).UTC().Format(http.TimeFormat)
+	w = fileContentRequest(t, token, file.ID, map[string]string{"If-Modified-Since": modifiedSince})
+	if w.Code != http.StatusNotModified {
+		t.Errorf("Expected status %d for If-Modified-Since after upload, got %d", http.StatusNotModified, w.Code)
+	}
+}
+
+func TestHandleFileContent_OtherUsersFile_NotFound(t *testing.T) {
+	ownerToken := loginTestUser(t, "downloadowner", "password123")
+	file := saveTestFile(t, ownerToken, "private.png", downloadContent)
+	otherToken := loginTestUser(t, "downloadsnooper", "password123")
+
+	w := fileContentRequest(t, otherToken, file.ID, nil)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected status %d, got %d", http.StatusNotFound, w.Code)
+	}
+
+	w = fileContentRequest(t, ownerToken, 999999, nil)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected status %d for unknown file, got %d", http.StatusNotFound, w.Code)
+	}
+}
+
+func TestHandleFileContent_APIKeyScopes(t *testing.T) {
+	token := loginTestUser(t, "downloadkeyuser", "password123")
+	file := saveTestFile(t, token, "scoped.png", downloadContent)
+
+	writeKey, _ := createTestAPIKey(t, token, []string{common.ScopeFilesWrite})
+	if w := fileContentRequest(t, writeKey, file.ID, nil); w.Code != http.StatusForbidden {
+		t.Errorf("Expected status %d without files:read, got %d", http.StatusForbidden, w.Code)
+	}
+
+	readKey, _ := createTestAPIKey(t, token, []string{common.ScopeFilesRead})
+	if w := fileContentRequest(t, readKey, file.ID, nil); w.Code != http.StatusOK {
+		t.Errorf("Expected status %d with files:read, got %d", http.StatusOK, w.Code)
+	}
+}
+
+func TestHandleFileContent_UnsafeOriginalName_Sanitized(t *testing.T) {
+	token := loginTestUser(t, "downloadnamer", "password123")
+
+	tests := []struct {
+		name     string
+		original string
+		want     string
+	}{
+		{"path", `../../etc/passwd.png`, `attachment; filename=passwd.png`},
+		{"windows path", `C:\Users\me\cat.png`, `attachment; filename=cat.png`},
+		{"header injection", "a\"b\r\nSet-Cookie: x=1.png", `attachment; filename="abSet-Cookie: x=1.png"`},
+		{"unicode", "ảnh.png", `attachment; filename*=utf-8''%E1%BA%A3nh.png`},
+		{"nothing left", "\r\n", `attachment; filename=download`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			file := saveTestFile(t, token, tt.original, downloadContent)
+
+			w := fileContentRequest(t, token, file.ID, nil)
+			if got := w.Header().Get(common.HeaderContentDisposition); got != tt.want {
+				t.Errorf("Expected %q, got %q", tt.want, got)
+			}
+			if got := w.Header().Get(common.HeaderContentTypeOptions); got != "nosniff" {
+				t.Errorf("Expected nosniff, got %q", got)
+			}
+		})
+	}
+}
+
+// saveTestFile stores a PNG file for the owner of the token like an upload does
+func saveTestFile(t *testing.T, token, originalName string, content []byte) *models.FileMetadata {
+	t.Helper()
+	return saveTestFileOfType(t, token, originalName, "image/png", content)
+}
+
+// saveTestFileOfType stores a file with the content type for the owner of the token
+func saveTestFileOfType(t *testing.T, token, originalName, contentType string, content []byte) *models.FileMetadata {
+	t.Helper()
+	claims, err := internal.TokenManager.ValidateToken(token)
+	if err != nil {
+		t.Fatalf("Failed to read token: %v", err)
+	}
+
+	file, err := internal.FileService.SaveUploadedFile(bytes.NewReader(content), originalName, contentType, int64(len(content)), claims.UserID, "test", "127.0.0.1")
+	if err != nil {
+		t.Fatalf("Failed to save test file: %v", err)
+	}
+	return file
+}
+
+func fileContentRequest(t *testing.T, token string, fileID int, headers map[string]string) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodGet, "/api/files/"+strconv.Itoa(fileID)+"/content", nil)
+	req.SetPathValue("id", strconv.Itoa(fileID))
+	req.Header.Set(common.HeaderAuthorization, "Bearer "+token)
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+	w := httptest.NewRecorder()
+	middleware.AuthUser(handler.HandleFileContent)(w, req)
+	return w
+}
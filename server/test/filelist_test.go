@@ -0,0 +1,224 @@
+package test
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"testing"
+
+	"elotuschallenge/common"
+	"elotuschallenge/database"
+	"elotuschallenge/handler"
+	"elotuschallenge/middleware"
+	"elotuschallenge/models"
+	"elotuschallenge/transfer"
+)
+
+func TestHandleFiles_CursorPagination_NewestFirst(t *testing.T) {
+	token := loginTestUser(t, "filelister", "password123")
+
+	var ids []int
+	for i, createdAt := range []string{"2024-01-01 10:00:00", "2024-01-02 10:00:00", "2024-01-03 10:00:00", "2024-01-04 10:00:00", "2024-01-05 10:00:00"} {
+		file := saveTestFile(t, token, "page"+string(rune('a'+i))+".png", downloadContent)
+		setFileCreatedAt(t, file.ID, createdAt)
+		ids = append(ids, file.ID)
+	}
+
+	var listed []int
+	cursor := ""
+	for page := 0; page < 3; page++ {
+		data := listFiles(t, token, url.Values{"limit": {"2"}, "cursor": {cursor}})
+		for _, file := range data.Files {
+			listed = append(listed, file.ID)
+		}
+		cursor = data.NextCursor
+		if page < 2 && cursor == "" {
+			t.Fatalf("Expected a next cursor after page %d", page+1)
+		}
+	}
+	if cursor != "" {
+		t.Errorf("Expected no cursor after the last page, got %q", cursor)
+	}
+
+	want := []int{ids[4], ids[3], ids[2], ids[1], ids[0]}
+	if !slices.Equal(listed, want) {
+		t.Errorf("Expected files %v newest first, got %v", want, listed)
+	}
+}
+
+func TestHandleFiles_SortBySizeAndName_TiesBrokenByID(t *testing.T) {
+	token := loginTestUser(t, "filesorter", "password123")
+
+	small := saveTestFile(t, token, "b.png", []byte("12"))
+	sameA := saveTestFile(t, token, "c.png", []byte("1234"))
+	sameB := saveTestFile(t, token, "a.png", []byte("abcd"))
+	large := saveTestFile(t, token, "d.png", []byte("123456"))
+
+	// One file per page walks through the files of equal size too
+	listed := listAllFileIDs(t, token, url.Values{"sort": {models.FileSortSize}, "order": {"asc"}, "limit": {"1"}})
+	if want := []int{small.ID, sameA.ID, sameB.ID, large.ID}; !slices.Equal(listed, want) {
+		t.Errorf("Expected files %v by size, got %v", want, listed)
+	}
+
+	listed = listAllFileIDs(t, token, url.Values{"sort": {models.FileSortSize}, "limit": {"1"}})
+	if want := []int{large.ID, sameB.ID, sameA.ID, small.ID}; !slices.Equal(listed, want) {
+		t.Errorf("Expected files %v by size descending, got %v", want, listed)
+	}
+
+	listed = listAllFileIDs(t, token, url.Values{"sort": {models.FileSortName}, "order": {"asc"}, "limit": {"3"}})
+	if want := []int{sameB.ID, small.ID, sameA.ID, large.ID}; !slices.Equal(listed, want) {
+		t.Errorf("Expected files %v by name, got %v", want, listed)
+	}
+}
+
+func TestHandleFiles_Filters(t *testing.T) {
+	token := loginTestUser(t, "filefilterer", "password123")
+
+	january := saveTestFileOfType(t, token, "Beach_2024.jpg", "image/jpeg", downloadContent)
+	setFileCreatedAt(t, january.ID, "2024-01-15 08:00:00")
+	february := saveTestFileOfType(t, token, "beach-party.png", "image/png", downloadContent)
+	setFileCreatedAt(t, february.ID, "2024-02-15 08:00:00")
+	march := saveTestFileOfType(t, token, "100% mountain.png", "image/png", downloadContent)
+	setFileCreatedAt(t, march.ID, "2024-03-15 08:00:00")
+
+	tests := []struct {
+		name   string
+		values url.Values
+		want   []int
+	}{
+		{"content type", url.Values{"content_type": {"image/png"}}, []int{march.ID, february.ID}},
+		{"name substring ignores case", url.Values{"name": {"BEACH"}}, []int{february.ID, january.ID}},
+		{"underscore is literal", url.Values{"name": {"h_2"}}, []int{january.ID}},
+		{"percent is literal", url.Values{"name": {"0%"}}, []int{march.ID}},
+		{"created after is inclusive", url.Values{"created_after": {"2024-02-15T08:00:00Z"}}, []int{march.ID, february.ID}},
+		{"created before is exclusive", url.Values{"created_before": {"2024-02-15T08:00:00Z"}}, []int{january.ID}},
+		{"date range with offset", url.Values{"created_after": {"2024-02-01T00:00:00+07:00"}, "created_before": {"2024-03-01T00:00:00Z"}}, []int{february.ID}},
+		{"combined", url.Values{"content_type": {"image/png"}, "name": {"beach"}}, []int{february.ID}},
+		{"no match", url.Values{"name": {"desert"}}, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if listed := listAllFileIDs(t, token, tt.values); !slices.Equal(listed, tt.want) {
+				t.Errorf("Expected files %v, got %v", tt.want, listed)
+			}
+		})
+	}
+}
+
+func TestHandleFiles_OnlyOwnFiles(t *testing.T) {
+	ownerToken := loginTestUser(t, "filelistowner", "password123")
+	saveTestFile(t, ownerToken, "mine.png", downloadContent)
+	otherToken := loginTestUser(t, "filelistother", "password123")
+
+	data := listFiles(t, otherToken, nil)
+	if len(data.Files) != 0 {
+		t.Errorf("Expected no files of other users, got %d", len(data.Files))
+	}
+
+	// API keys need the files:read scope
+	writeKey, _ := createTestAPIKey(t, ownerToken, []string{common.ScopeFilesWrite})
+	if w := fileListRequest(writeKey, nil); w.Code != http.StatusForbidden {
+		t.Errorf("Expected status %d without files:read, got %d", http.StatusForbidden, w.Code)
+	}
+	readKey, _ := createTestAPIKey(t, ownerToken, []string{common.ScopeFilesRead})
+	if data := listFiles(t, readKey, nil); len(data.Files) != 1 {
+		t.Errorf("Expected the owner's file with files:read, got %d files", len(data.Files))
+	}
+}
+
+func TestHandleFiles_InvalidQuery_BadRequest(t *testing.T) {
+	token := loginTestUser(t, "filelistbad", "password123")
+	for i := 0; i < 2; i++ {
+		saveTestFile(t, token, "bad.png", downloadContent)
+	}
+	sizeCursor := listFiles(t, token, url.Values{"sort": {models.FileSortSize}, "limit": {"1"}}).NextCursor
+
+	tests := []struct {
+		name   string
+		values url.Values
+	}{
+		{"unknown sort", url.Values{"sort": {"owner"}}},
+		{"unknown order", url.Values{"order": {"up"}}},
+		{"zero limit", url.Values{"limit": {"0"}}},
+		{"invalid limit", url.Values{"limit": {"ten"}}},
+		{"invalid time", url.Values{"created_after": {"2024-01-01"}}},
+		{"malformed cursor", url.Values{"cursor": {"not a cursor!"}}},
+		{"cursor of another order", url.Values{"cursor": {sizeCursor}}},
+		{"forged size cursor", url.Values{"sort": {models.FileSortSize}, "cursor": {forgeFileCursor(`{"s":"size","d":true,"v":"1 OR 1=1","id":1}`)}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if w := fileListRequest(token, tt.values); w.Code != http.StatusBadRequest {
+				t.Errorf("Expected status %d, got %d. Body: %s", http.StatusBadRequest, w.Code, w.Body.String())
+			}
+		})
+	}
+}
+
+// setFileCreatedAt backdates a file so listings sorted by upload time are predictable
+func setFileCreatedAt(t *testing.T, fileID int, createdAt string) {
+	t.Helper()
+	if _, err := database.DB.Exec("UPDATE files SET created_at = ? WHERE id = ?", createdAt, fileID); err != nil {
+		t.Fatalf("Failed to set created_at: %v", err)
+	}
+}
+
+// listAllFileIDs follows the cursors of a listing to its end
+func listAllFileIDs(t *testing.T, token string, values url.Values) []int {
+	t.Helper()
+	var ids []int
+	for {
+		data := listFiles(t, token, values)
+		for _, file := range data.Files {
+			ids = append(ids, file.ID)
+		}
+		if data.NextCursor == "" {
+			return ids
+		}
+
+		next := url.Values{"cursor": {data.NextCursor}}
+		for key, value := range values {
+			if key != "cursor" {
+				next[key] = value
+			}
+		}
+		values = next
+	}
+}
+
+func listFiles(t *testing.T, token string, values url.Values) transfer.FileListData {
+	t.Helper()
+	return decodeFileList(t, fileListRequest(token, values))
+}
+
+func decodeFileList(t *testing.T, w *httptest.ResponseRecorder) transfer.FileListData {
+	t.Helper()
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d. Body: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+
+	var response struct {
+		Data transfer.FileListData `json:"data"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+		t.Fatalf("Failed to decode file list: %v", err)
+	}
+	return response.Data
+}
+
+func fileListRequest(token string, values url.Values) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, "/api/files?"+values.Encode(), nil)
+	req.Header.Set(common.HeaderAuthorization, "Bearer "+token)
+	w := httptest.NewRecorder()
+	middleware.AuthUser(handler.HandleFiles)(w, req)
+	return w
+}
+
+func forgeFileCursor(token string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(token))
+}
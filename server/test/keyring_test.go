@@ -0,0 +1,192 @@
+package test
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"elotuschallenge/repository"
+	"elotuschallenge/services"
+)
+
+const oldKeySecret = "old-signing-key-0123456789abcdefghij"
+const newKeySecret = "new-signing-key-0123456789abcdefghij"
+
+func TestKeyring_RotatedKey_OldTokensStillValid(t *testing.T) {
+	manager := services.NewTokenManager(mustKeyring(t, &services.SigningKey{ID: "k1", Secret: oldKeySecret, Active: true}), services.TokenManagerConfig{ExpirationSeconds: 3600}, repository.NewSQLiteRevokedTokenRepository())
+
+	oldToken, err := manager.GenerateToken(1, "rotateuser")
+	if err != nil {
+		t.Fatalf("Failed to generate JWT: %v", err)
+	}
+	if kid := tokenKeyID(t, oldToken); kid != "k1" {
+		t.Errorf("Expected kid 'k1', got '%s'", kid)
+	}
+
+	// Rotate: k2 becomes active and k1 is retired
+	retiredAt := time.Now()
+	manager.SetKeyring(mustKeyring(t,
+		&services.SigningKey{ID: "k1", Secret: oldKeySecret, RetiredAt: &retiredAt},
+		&services.SigningKey{ID: "k2", Secret: newKeySecret, Active: true},
+	))
+
+	if _, err := manager.ValidateToken(oldToken); err != nil {
+		t.Errorf("Expected token signed by retired key to be valid, got %v", err)
+	}
+
+	newToken, err := manager.GenerateToken(1, "rotateuser")
+	if err != nil {
+		t.Fatalf("Failed to generate JWT: %v", err)
+	}
+	if kid := tokenKeyID(t, newToken); kid != "k2" {
+		t.Errorf("Expected kid 'k2', got '%s'", kid)
+	}
+	if _, err := manager.ValidateToken(newToken); err != nil {
+		t.Errorf("Expected token signed by active key to be valid, got %v", err)
+	}
+}
+
+func TestKeyring_LongRetiredOrRemovedKey_Error(t *testing.T) {
+	manager := services.NewTokenManager(mustKeyring(t, &services.SigningKey{ID: "k1", Secret: oldKeySecret, Active: true}), services.TokenManagerConfig{ExpirationSeconds: 3600}, repository.NewSQLiteRevokedTokenRepository())
+
+	token, err := manager.GenerateToken(1, "retireduser")
+	if err != nil {
+		t.Fatalf("Failed to generate JWT: %v", err)
+	}
+
+	// Retired longer ago than the token lifetime
+	retiredAt := time.Now().Add(-2 * time.Hour)
+	manager.SetKeyring(mustKeyring(t,
+		&services.SigningKey{ID: "k1", Secret: oldKeySecret, RetiredAt: &retiredAt},
+		&services.SigningKey{ID: "k2", Secret: newKeySecret, Active: true},
+	))
+	if _, err := manager.ValidateToken(token); err == nil {
+		t.Error("Expected token signed by long retired key to be rejected")
+	}
+
+	// Removed from the keyring
+	manager.SetKeyring(mustKeyring(t, &services.SigningKey{ID: "k2", Secret: newKeySecret, Active: true}))
+	if _, err := manager.ValidateToken(token); err == nil {
+		t.Error("Expected token signed by unknown key to be rejected")
+	}
+}
+
+func TestKeyring_TokenWithoutKeyID_OnlyAcceptedByEnvironmentKey(t *testing.T) {
+	now := time.Now().Unix()
+	header := map[string]interface{}{"alg": "HS256", "typ": "JWT"}
+	token := signTestToken(t, header, map[string]interface{}{
+		"user_id": 1, "username": "nokiduser", "jti": "token-id", "iat": now, "nbf": now, "exp": now + 60,
+	})
+	config := services.TokenManagerConfig{ExpirationSeconds: 3600}
+
+	// Tokens issued before key rotation are signed by the key of JWT_SECRET
+	manager := services.NewTokenManager(services.NewStaticKeyring(strictTestSecret), config, repository.NewSQLiteRevokedTokenRepository())
+	if _, err := manager.ValidateToken(token); err != nil {
+		t.Errorf("Expected token without kid to be verified by the environment key, got %v", err)
+	}
+
+	// A keyring file has no such key, even one named like it
+	filePath := filepath.Join(t.TempDir(), "keys.json")
+	data, _ := json.Marshal(map[string]interface{}{"keys": []*services.SigningKey{{ID: services.DefaultKeyID, Secret: strictTestSecret, Active: true}}})
+	if err := os.WriteFile(filePath, data, 0600); err != nil {
+		t.Fatalf("Failed to write keyring file: %v", err)
+	}
+	keyring, err := services.LoadKeyring(filePath)
+	if err != nil {
+		t.Fatalf("Failed to load keyring file: %v", err)
+	}
+	manager.SetKeyring(keyring)
+	if _, err := manager.ValidateToken(token); !errors.Is(err, services.ErrTokenUnknownKey) {
+		t.Errorf("Expected token without kid to be rejected with a keyring file, got %v", err)
+	}
+}
+
+func TestLoadKeyring_DirectoryAndFile_Success(t *testing.T) {
+	retiredAt := time.Now()
+	keys := []*services.SigningKey{
+		{ID: "k1", Secret: oldKeySecret, RetiredAt: &retiredAt},
+		{ID: "k2", Secret: newKeySecret, CreatedAt: time.Now()},
+	}
+
+	// Directory with one key per file
+	dir := t.TempDir()
+	for _, key := range keys {
+		data, _ := json.Marshal(key)
+		if err := os.WriteFile(filepath.Join(dir, key.ID+".json"), data, 0600); err != nil {
+			t.Fatalf("Failed to write key file: %v", err)
+		}
+	}
+
+	keyring, err := services.LoadKeyring(dir)
+	if err != nil {
+		t.Fatalf("Failed to load keyring directory: %v", err)
+	}
+	if keyring.ActiveKey().ID != "k2" {
+		t.Errorf("Expected active key 'k2', got '%s'", keyring.ActiveKey().ID)
+	}
+	if keyring.Key("k1") == nil {
+		t.Error("Expected retired key 'k1' in keyring")
+	}
+
+	// Single keyring file
+	filePath := filepath.Join(t.TempDir(), "keys.json")
+	data, _ := json.Marshal(map[string]interface{}{"keys": keys})
+	if err := os.WriteFile(filePath, data, 0600); err != nil {
+		t.Fatalf("Failed to write keyring file: %v", err)
+	}
+
+	keyring, err = services.LoadKeyring(filePath)
+	if err != nil {
+		t.Fatalf("Failed to load keyring file: %v", err)
+	}
+	if keyring.ActiveKey().ID != "k2" {
+		t.Errorf("Expected active key 'k2', got '%s'", keyring.ActiveKey().ID)
+	}
+}
+
+func TestNewKeyring_InvalidKeys_Error(t *testing.T) {
+	testCases := []struct {
+		name string
+		keys []*services.SigningKey
+	}{
+		{"No keys", nil},
+		{"Missing kid", []*services.SigningKey{{Secret: newKeySecret}}},
+		{"Short secret", []*services.SigningKey{{ID: "k1", Secret: "short"}}},
+		{"Duplicate kid", []*services.SigningKey{{ID: "k1", Secret: oldKeySecret}, {ID: "k1", Secret: newKeySecret}}},
+		{"Two active keys", []*services.SigningKey{{ID: "k1", Secret: oldKeySecret, Active: true}, {ID: "k2", Secret: newKeySecret, Active: true}}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, err := services.NewKeyring(tc.keys); err == nil {
+				t.Error("Expected keyring creation to fail")
+			}
+		})
+	}
+}
+
+// mustKeyring creates a keyring from keys or fails the test
+func mustKeyring(t *testing.T, keys ...*services.SigningKey) *services.Keyring {
+	keyring, err := services.NewKeyring(keys)
+	if err != nil {
+		t.Fatalf("Failed to create keyring: %v", err)
+	}
+	return keyring
+}
+
+// tokenKeyID returns the kid header of a token
+func tokenKeyID(t *testing.T, token string) string {
+	headerBytes, err := base64.RawURLEncoding.DecodeString(strings.Split(token, ".")[0])
+	if err != nil {
+		t.Fatalf("Failed to decode token header: %v", err)
+	}
+	var header map[string]interface{}
+	json.Unmarshal(headerBytes, &header)
+	kid, _ := header["kid"].(string)
+	return kid
+}
@@ -0,0 +1,144 @@
+package test
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"elotuschallenge/common"
+	"elotuschallenge/handler"
+	"elotuschallenge/internal"
+	"elotuschallenge/middleware"
+	"elotuschallenge/models"
+	"elotuschallenge/repository"
+	"elotuschallenge/services"
+	"elotuschallenge/transfer"
+)
+
+func TestHandleLogin_RepeatedFailures_LockedUntilAdminUnlock(t *testing.T) {
+	registerUser(t, "lockoutuser", "password123")
+	const clientIP = "198.51.100.10"
+
+	for i := 0; i < 4; i++ {
+		if w := loginFromIP("lockoutuser", "wrongpassword", clientIP); w.Code != http.StatusUnauthorized {
+			t.Fatalf("Attempt %d: expected status %d, got %d", i+1, http.StatusUnauthorized, w.Code)
+		}
+	}
+
+	// The fifth failure locks the account
+	w := loginFromIP("lockoutuser", "wrongpassword", clientIP)
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("Expected status %d, got %d", http.StatusTooManyRequests, w.Code)
+	}
+
+	// Even the right password is rejected while locked, from any IP
+	w = loginFromIP("lockoutuser", "password123", "198.51.100.11")
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("Expected status %d, got %d", http.StatusTooManyRequests, w.Code)
+	}
+	retryAfter, err := strconv.Atoi(w.Header().Get(common.HeaderRetryAfter))
+	if err != nil || retryAfter <= 0 {
+		t.Errorf("Expected positive Retry-After header, got '%s'", w.Header().Get(common.HeaderRetryAfter))
+	}
+
+	// Admin unlocks the account
+	if _, err := internal.UserService.EnsureAdmin("lockoutadmin", "password123"); err != nil {
+		t.Fatalf("Failed to create admin: %v", err)
+	}
+	adminToken, _ := loginExistingUser(t, "lockoutadmin", "password123")
+	user, _ := internal.UserService.GetUserByUsername("lockoutuser")
+
+	id := strconv.Itoa(user.ID)
+	req := httptest.NewRequest(http.MethodPost, "/api/admin/users/"+id+"/unlock", nil)
+	req.SetPathValue("id", id)
+	req.Header.Set(common.HeaderAuthorization, "Bearer "+adminToken)
+	w = httptest.NewRecorder()
+	middleware.AuthUser(middleware.RequireRole(models.RoleAdmin, handler.HandleAdminUserUnlock))(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d. Body: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+
+	if w := loginFromIP("lockoutuser", "password123", clientIP); w.Code != http.StatusOK {
+		t.Errorf("Expected status %d after unlock, got %d", http.StatusOK, w.Code)
+	}
+}
+
+func TestHandleLogin_UnknownUserAndWrongPassword_SameResponse(t *testing.T) {
+	registerUser(t, "lockoutknown", "password123")
+
+	unknown := loginFromIP("lockoutnobody", "password123", "198.51.100.20")
+	wrong := loginFromIP("lockoutknown", "wrongpassword", "198.51.100.21")
+
+	if unknown.Code != http.StatusUnauthorized || wrong.Code != http.StatusUnauthorized {
+		t.Fatalf("Expected status %d for both, got %d and %d", http.StatusUnauthorized, unknown.Code, wrong.Code)
+	}
+
+	var unknownResponse, wrongResponse transfer.APIResponse
+	json.NewDecoder(unknown.Body).Decode(&unknownResponse)
+	json.NewDecoder(wrong.Body).Decode(&wrongResponse)
+	if unknownResponse.Message != common.ErrMsgInvalidCredentials || wrongResponse.Message != common.ErrMsgInvalidCredentials {
+		t.Errorf("Expected message '%s' for both, got '%s' and '%s'", common.ErrMsgInvalidCredentials, unknownResponse.Message, wrongResponse.Message)
+	}
+}
+
+func TestHandleLogin_ManyUsernamesFromOneIP_IPLocked(t *testing.T) {
+	registerUser(t, "lockoutipvictim", "password123")
+	const clientIP = "198.51.100.30"
+
+	locked := false
+	for i := 0; i < 20 && !locked; i++ {
+		w := loginFromIP(fmt.Sprintf("lockoutspray%d", i), "password123", clientIP)
+		locked = w.Code == http.StatusTooManyRequests
+	}
+	if !locked {
+		t.Fatal("Expected the IP to be locked after many failures")
+	}
+
+	// Other users from the same IP are rejected, the same user elsewhere is not
+	if w := loginFromIP("lockoutipvictim", "password123", clientIP); w.Code != http.StatusTooManyRequests {
+		t.Errorf("Expected status %d from locked IP, got %d", http.StatusTooManyRequests, w.Code)
+	}
+	if w := loginFromIP("lockoutipvictim", "password123", "198.51.100.31"); w.Code != http.StatusOK {
+		t.Errorf("Expected status %d from another IP, got %d", http.StatusOK, w.Code)
+	}
+}
+
+func TestLoginThrottle_FurtherFailures_LockoutDoubles(t *testing.T) {
+	throttle := services.NewLoginThrottleService(repository.NewSQLiteLoginAttemptRepository(), services.LoginThrottleConfig{
+		MaxUserFailures:      2,
+		MaxIPFailures:        100,
+		LockoutSeconds:       10,
+		MaxLockoutSeconds:    25,
+		FailureWindowSeconds: 900,
+	})
+
+	expected := []time.Duration{0, 10 * time.Second, 20 * time.Second, 25 * time.Second}
+	for i, want := range expected {
+		lockout, err := throttle.RecordFailure("lockoutbackoff", "198.51.100.40")
+		if err != nil {
+			t.Fatalf("Failed to record failure: %v", err)
+		}
+		if lockout != want {
+			t.Errorf("Failure %d: expected lockout %v, got %v", i+1, want, lockout)
+		}
+	}
+
+	if _, err := throttle.CheckLogin("lockoutbackoff", "198.51.100.41"); err == nil {
+		t.Error("Expected locked username to be rejected")
+	}
+}
+
+func loginFromIP(username, password, clientIP string) *httptest.ResponseRecorder {
+	body, _ := json.Marshal(transfer.LoginRequest{Username: username, Password: password})
+	req := httptest.NewRequest(http.MethodPost, "/api/login", bytes.NewReader(body))
+	req.Header.Set(common.HeaderContentType, common.HeaderValueContentTypeJSON)
+	req.Header.Set("X-Forwarded-For", clientIP)
+	w := httptest.NewRecorder()
+	handler.HandleLogin(w, req)
+	return w
+}
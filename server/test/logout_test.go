@@ -0,0 +1,91 @@
+package test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"elotuschallenge/common"
+	"elotuschallenge/handler"
+	"elotuschallenge/internal"
+	"elotuschallenge/middleware"
+	"elotuschallenge/repository"
+	"elotuschallenge/transfer"
+	"elotuschallenge/utils"
+)
+
+func TestHandleLogout_ValidToken_TokenRejectedAfterwards(t *testing.T) {
+	token := loginTestUser(t, "logoutuser", "password123")
+
+	// Logout with the token
+	req := httptest.NewRequest(http.MethodPost, "/api/logout", nil)
+	req.Header.Set(common.HeaderAuthorization, "Bearer "+token)
+	w := httptest.NewRecorder()
+
+	middleware.AuthUser(handler.HandleLogout)(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d. Body: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+
+	var response transfer.APIResponse
+	json.NewDecoder(w.Body).Decode(&response)
+	if response.Message != common.MsgLogoutSuccess {
+		t.Errorf("Expected message '%s', got '%s'", common.MsgLogoutSuccess, response.Message)
+	}
+
+	// The same token must not be accepted anymore
+	testHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("Handler should not be called with revoked token")
+	})
+	req = httptest.NewRequest(http.MethodGet, "/protected", nil)
+	req.Header.Set(common.HeaderAuthorization, "Bearer "+token)
+	w = httptest.NewRecorder()
+
+	middleware.AuthUser(testHandler)(w, req)
+
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status %d, got %d", http.StatusUnauthorized, w.Code)
+	}
+}
+
+func TestHandleLogout_NoAuthToken_Error(t *testing.T) {
+	req := httptest.NewRequest(http.MethodPost, "/api/logout", nil)
+	w := httptest.NewRecorder()
+
+	middleware.AuthUser(handler.HandleLogout)(w, req)
+
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status %d, got %d", http.StatusUnauthorized, w.Code)
+	}
+}
+
+func TestPurgeExpiredRevocations_RemovesOnlyExpired(t *testing.T) {
+	repo := repository.NewSQLiteRevokedTokenRepository()
+	expiredHash := utils.HashToken("expired-token")
+	activeHash := utils.HashToken("active-token")
+
+	if err := repo.RevokeToken(expiredHash, time.Now().Add(-time.Hour)); err != nil {
+		t.Fatalf("Failed to revoke token: %v", err)
+	}
+	if err := repo.RevokeToken(activeHash, time.Now().Add(time.Hour)); err != nil {
+		t.Fatalf("Failed to revoke token: %v", err)
+	}
+
+	removed, err := internal.TokenManager.PurgeExpiredRevocations()
+	if err != nil {
+		t.Fatalf("Failed to purge revocations: %v", err)
+	}
+	if removed < 1 {
+		t.Errorf("Expected at least 1 removed row, got %d", removed)
+	}
+
+	if revoked, _ := repo.IsTokenRevoked(expiredHash); revoked {
+		t.Error("Expected expired revocation to be purged")
+	}
+	if revoked, _ := repo.IsTokenRevoked(activeHash); !revoked {
+		t.Error("Expected active revocation to be kept")
+	}
+}
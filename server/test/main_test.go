@@ -26,6 +26,13 @@ func setup() {
 	// Setup: Use a test database
 	os.Setenv("DB_PATH", ":memory:")
 
+	// Store uploaded files in a directory removed after the tests
+	tempDir, err := os.MkdirTemp("", "elotuschallenge-test-")
+	if err != nil {
+		panic("Failed to create test storage directory: " + err.Error())
+	}
+	os.Setenv("TEMP_DIR", tempDir)
+
 	// Initialize test database
 	if err := database.InitDB(); err != nil {
 		panic("Failed to initialize test database: " + err.Error())
@@ -36,4 +43,5 @@ func setup() {
 func cleanup() {
 	// Cleanup
 	database.CloseDB()
+	os.RemoveAll(os.Getenv("TEMP_DIR"))
 }
@@ -0,0 +1,245 @@
+package test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+
+	"elotuschallenge/common"
+	"elotuschallenge/handler"
+	"elotuschallenge/internal"
+	"elotuschallenge/middleware"
+	"elotuschallenge/models"
+	"elotuschallenge/services"
+	"elotuschallenge/transfer"
+)
+
+func TestHandleMe_JWT_ReturnsUser(t *testing.T) {
+	token := loginTestUser(t, "meuser", "password123")
+
+	w := meRequest(token)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d. Body: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	data := decodeMeData(t, w)
+	if data.User.Username != "meuser" || data.User.ID == 0 || data.User.Role != models.RoleUser {
+		t.Errorf("Unexpected user %+v", data.User)
+	}
+	if data.AuthMethod != common.AuthMethodJWT {
+		t.Errorf("Expected auth method %q, got %q", common.AuthMethodJWT, data.AuthMethod)
+	}
+}
+
+func TestHandleMe_APIKey_ReturnsScopes(t *testing.T) {
+	token := loginTestUser(t, "mekeyuser", "password123")
+	apiKey, _ := createTestAPIKey(t, token, []string{common.ScopeFilesRead})
+
+	w := meRequest(apiKey)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d. Body: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	data := decodeMeData(t, w)
+	if data.User.Username != "mekeyuser" || data.AuthMethod != common.AuthMethodAPIKey {
+		t.Errorf("Unexpected response %+v", data)
+	}
+	if len(data.Scopes) != 1 || data.Scopes[0] != common.ScopeFilesRead {
+		t.Errorf("Expected scopes [%s], got %v", common.ScopeFilesRead, data.Scopes)
+	}
+}
+
+func TestHandleMe_NoToken_Unauthorized(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/api/me", nil)
+	w := httptest.NewRecorder()
+
+	middleware.AuthUser(handler.HandleMe)(w, req)
+
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status %d, got %d", http.StatusUnauthorized, w.Code)
+	}
+}
+
+func TestHandleTokenIntrospect_ActiveToken_ReturnsClaims(t *testing.T) {
+	adminToken := loginIntrospectionAdmin(t, "introspectadmin")
+	token := loginTestUser(t, "introspected", "password123")
+
+	w := introspectRequest(adminToken, token)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d. Body: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	if w.Header().Get(common.HeaderCacheControl) != "no-store" {
+		t.Error("Expected introspection response not to be cached")
+	}
+
+	response := decodeIntrospection(t, w)
+	claims, _ := internal.TokenManager.ValidateToken(token)
+	if !response.Active || response.TokenType != "access_token" {
+		t.Fatalf("Expected active access token, got %+v", response)
+	}
+	if response.Subject != strconv.Itoa(claims.UserID) || response.Username != "introspected" || response.Role != models.RoleUser {
+		t.Errorf("Unexpected identity in %+v", response)
+	}
+	if response.ExpiresAt != claims.ExpiresAt || response.ID != claims.ID || response.Issuer != claims.Issuer {
+		t.Errorf("Expected claims of the token, got %+v", response)
+	}
+}
+
+func TestHandleTokenIntrospect_InactiveTokens(t *testing.T) {
+	adminToken := loginIntrospectionAdmin(t, "introspectinactive")
+
+	revokedToken := loginTestUser(t, "introspectrevoked", "password123")
+	if err := internal.TokenManager.RevokeToken(revokedToken); err != nil {
+		t.Fatalf("Failed to revoke token: %v", err)
+	}
+
+	oldVersionToken := loginTestUser(t, "introspectrotated", "password123")
+	if w := changePasswordRequest(oldVersionToken, "password123", "newpassword123"); w.Code != http.StatusOK {
+		t.Fatalf("Failed to change password: %s", w.Body.String())
+	}
+
+	mfaToken, err := internal.TokenManager.IssueTokenWithExpiration(services.Claims{
+		UserID:   1,
+		Username: "introspectmfa",
+		Purpose:  services.TokenPurposeMFA,
+	}, 60)
+	if err != nil {
+		t.Fatalf("Failed to issue MFA token: %v", err)
+	}
+
+	tests := []struct {
+		name  string
+		token string
+	}{
+		{"revoked", revokedToken},
+		{"password changed", oldVersionToken},
+		{"MFA token", mfaToken},
+		{"garbage", "not-a-token"},
+		{"unknown API key", "elk_unknown_secret"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := introspectRequest(adminToken, tt.token)
+
+			if w.Code != http.StatusOK {
+				t.Fatalf("Expected status %d, got %d. Body: %s", http.StatusOK, w.Code, w.Body.String())
+			}
+			if strings.TrimSpace(w.Body.String()) != `{"active":false}` {
+				t.Errorf("Expected only active false, got %s", w.Body.String())
+			}
+		})
+	}
+}
+
+func TestHandleTokenIntrospect_APIKey_ReturnsScope(t *testing.T) {
+	adminToken := loginIntrospectionAdmin(t, "introspectkeyadmin")
+	userToken := loginTestUser(t, "introspectkeyuser", "password123")
+	apiKey, _ := createTestAPIKey(t, userToken, []string{common.ScopeFilesRead, common.ScopeFilesWrite})
+
+	response := decodeIntrospection(t, introspectRequest(adminToken, apiKey))
+
+	if !response.Active || response.TokenType != common.AuthMethodAPIKey || response.Username != "introspectkeyuser" {
+		t.Fatalf("Expected active API key, got %+v", response)
+	}
+	if response.Scope != "files:read files:write" {
+		t.Errorf("Expected space separated scopes, got %q", response.Scope)
+	}
+	if response.ExpiresAt == 0 {
+		t.Error("Expected expiry of the API key")
+	}
+}
+
+func TestHandleTokenIntrospect_Callers(t *testing.T) {
+	adminToken := loginIntrospectionAdmin(t, "introspectcaller")
+	userToken := loginTestUser(t, "introspectnotadmin", "password123")
+	scopedKey, _ := createTestAPIKey(t, adminToken, []string{common.ScopeTokensIntrospect})
+	unscopedKey, _ := createTestAPIKey(t, adminToken, []string{common.ScopeFilesRead})
+	userKey, _ := createTestAPIKey(t, userToken, []string{common.ScopeTokensIntrospect})
+
+	tests := []struct {
+		name       string
+		caller     string
+		wantStatus int
+	}{
+		{"normal user", userToken, http.StatusForbidden},
+		{"normal user API key with scope", userKey, http.StatusForbidden},
+		{"admin API key without scope", unscopedKey, http.StatusForbidden},
+		{"admin API key with scope", scopedKey, http.StatusOK},
+		{"admin", adminToken, http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := introspectRequest(tt.caller, userToken)
+			if w.Code != tt.wantStatus {
+				t.Errorf("Expected status %d, got %d. Body: %s", tt.wantStatus, w.Code, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestHandleTokenIntrospect_MissingToken_BadRequest(t *testing.T) {
+	adminToken := loginIntrospectionAdmin(t, "introspectmissing")
+
+	w := introspectRequest(adminToken, "")
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d, got %d", http.StatusBadRequest, w.Code)
+	}
+}
+
+func loginIntrospectionAdmin(t *testing.T, username string) string {
+	t.Helper()
+	if _, err := internal.UserService.EnsureAdmin(username, "password123"); err != nil {
+		t.Fatalf("Failed to create admin: %v", err)
+	}
+	token, _ := loginExistingUser(t, username, "password123")
+	return token
+}
+
+func meRequest(token string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, "/api/me", nil)
+	req.Header.Set(common.HeaderAuthorization, "Bearer "+token)
+	w := httptest.NewRecorder()
+	middleware.AuthUser(handler.HandleMe)(w, req)
+	return w
+}
+
+func introspectRequest(callerToken, token string) *httptest.ResponseRecorder {
+	form := url.Values{}
+	if token != "" {
+		form.Set("token", token)
+	}
+	req := httptest.NewRequest(http.MethodPost, "/api/token/introspect", strings.NewReader(form.Encode()))
+	req.Header.Set(common.HeaderContentType, "application/x-www-form-urlencoded")
+	req.Header.Set(common.HeaderAuthorization, "Bearer "+callerToken)
+	w := httptest.NewRecorder()
+	middleware.AuthUser(handler.HandleTokenIntrospect)(w, req)
+	return w
+}
+
+func decodeMeData(t *testing.T, w *httptest.ResponseRecorder) transfer.MeData {
+	t.Helper()
+	var response struct {
+		Data transfer.MeData `json:"data"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	return response.Data
+}
+
+func decodeIntrospection(t *testing.T, w *httptest.ResponseRecorder) transfer.IntrospectionResponse {
+	t.Helper()
+	var response transfer.IntrospectionResponse
+	if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	return response
+}
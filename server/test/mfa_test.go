@@ -0,0 +1,317 @@
+package test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"elotuschallenge/common"
+	"elotuschallenge/handler"
+	"elotuschallenge/internal"
+	"elotuschallenge/middleware"
+	"elotuschallenge/repository"
+	"elotuschallenge/services"
+	"elotuschallenge/transfer"
+)
+
+func TestTOTPCode_RFC6238Vectors_Match(t *testing.T) {
+	// Secret "12345678901234567890" of RFC 6238 appendix B, codes truncated to 6 digits
+	secret := "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+	vectors := map[int64]string{
+		59:         "287082",
+		1111111109: "081804",
+		1234567890: "005924",
+		2000000000: "279037",
+	}
+
+	for unix, expected := range vectors {
+		code, err := services.TOTPCode(secret, time.Unix(unix, 0))
+		if err != nil {
+			t.Fatalf("Failed to compute code: %v", err)
+		}
+		if code != expected {
+			t.Errorf("At %d: expected %s, got %s", unix, expected, code)
+		}
+	}
+
+	// Codes of the neighbouring time steps are accepted for clock drift
+	previous, _ := services.TOTPCode(secret, time.Unix(1234567890-30, 0))
+	if _, ok := services.ValidateTOTPCode(secret, previous, time.Unix(1234567890, 0)); !ok {
+		t.Error("Expected code of the previous time step to be accepted")
+	}
+	old, _ := services.TOTPCode(secret, time.Unix(1234567890-90, 0))
+	if _, ok := services.ValidateTOTPCode(secret, old, time.Unix(1234567890, 0)); ok {
+		t.Error("Expected code three time steps old to be rejected")
+	}
+}
+
+func TestLoginMFA_TOTPAndRecoveryCodes_Success(t *testing.T) {
+	token := loginTestUser(t, "mfauser", "password123")
+
+	// Enroll
+	w := mfaRequest(t, handler.HandleTOTPEnroll, token, nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d. Body: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	var enroll struct {
+		Data transfer.TOTPEnrollData `json:"data"`
+	}
+	json.NewDecoder(w.Body).Decode(&enroll)
+	if !strings.HasPrefix(enroll.Data.URI, "otpauth://totp/") || !strings.Contains(enroll.Data.URI, "secret="+enroll.Data.Secret) {
+		t.Errorf("Expected otpauth URI with the secret, got %s", enroll.Data.URI)
+	}
+
+	// Confirm, a wrong code doesn't enable 2FA
+	if w := mfaRequest(t, handler.HandleTOTPConfirm, token, transfer.TOTPConfirmRequest{Code: "000000"}); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d for wrong code, got %d", http.StatusBadRequest, w.Code)
+	}
+	code, _ := services.TOTPCode(enroll.Data.Secret, time.Now())
+	w = mfaRequest(t, handler.HandleTOTPConfirm, token, transfer.TOTPConfirmRequest{Code: code})
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d. Body: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	var confirm struct {
+		Data transfer.TOTPConfirmData `json:"data"`
+	}
+	json.NewDecoder(w.Body).Decode(&confirm)
+	if len(confirm.Data.RecoveryCodes) != 10 {
+		t.Fatalf("Expected 10 recovery codes, got %d", len(confirm.Data.RecoveryCodes))
+	}
+
+	// Login now stops at the second factor, the MFA token isn't an access token
+	mfaToken := loginMFAPending(t, "mfauser", "password123")
+	if w := authorizedRequest(mfaToken); w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected MFA token to be rejected as access token, got %d", w.Code)
+	}
+
+	// The code used for confirmation can't be replayed, the next one works
+	if w := loginMFARequest(transfer.LoginMFARequest{MFAToken: mfaToken, Code: code}); w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected replayed code to be rejected, got %d", w.Code)
+	}
+	nextCode, _ := services.TOTPCode(enroll.Data.Secret, time.Now().Add(30*time.Second))
+	w = loginMFARequest(transfer.LoginMFARequest{MFAToken: mfaToken, Code: nextCode})
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d. Body: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	accessToken, _ := parseLoginTokens(t, w)
+	if w := authorizedRequest(accessToken); w.Code != http.StatusOK {
+		t.Errorf("Expected access token to be accepted, got %d", w.Code)
+	}
+
+	// The MFA token is single-use
+	if w := loginMFARequest(transfer.LoginMFARequest{MFAToken: mfaToken, RecoveryCode: confirm.Data.RecoveryCodes[0]}); w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected used MFA token to be rejected, got %d", w.Code)
+	}
+
+	// Recovery codes work once, ignoring case and dashes
+	recoveryCode := strings.ToUpper(strings.ReplaceAll(confirm.Data.RecoveryCodes[0], "-", ""))
+	mfaToken = loginMFAPending(t, "mfauser", "password123")
+	if w := loginMFARequest(transfer.LoginMFARequest{MFAToken: mfaToken, RecoveryCode: recoveryCode}); w.Code != http.StatusOK {
+		t.Errorf("Expected recovery code to be accepted, got %d", w.Code)
+	}
+	mfaToken = loginMFAPending(t, "mfauser", "password123")
+	if w := loginMFARequest(transfer.LoginMFARequest{MFAToken: mfaToken, RecoveryCode: recoveryCode}); w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected used recovery code to be rejected, got %d", w.Code)
+	}
+}
+
+func TestTOTPEnroll_SecretEncryptedAtRest(t *testing.T) {
+	token := loginTestUser(t, "mfasealeduser", "password123")
+	secret := enrollTestTOTP(t, token)
+
+	user, _ := internal.UserService.GetUserByUsername("mfasealeduser")
+	userID := user.ID
+	stored, err := repository.NewSQLiteMFARepository().GetTOTPSecret(userID)
+	if err != nil || stored == nil {
+		t.Fatalf("Failed to read stored secret: %v", err)
+	}
+	if !services.IsSealed(stored.Secret) || strings.Contains(stored.Secret, secret) {
+		t.Errorf("Expected the stored secret to be encrypted, got %s", stored.Secret)
+	}
+
+	// Secrets stored in plaintext by older versions keep working and are encrypted at startup
+	if err := repository.NewSQLiteMFARepository().UpdateTOTPSecret(userID, secret); err != nil {
+		t.Fatalf("Failed to store plaintext secret: %v", err)
+	}
+	code, _ := services.TOTPCode(secret, time.Now().Add(30*time.Second))
+	mfaToken := loginMFAPending(t, "mfasealeduser", "password123")
+	if w := loginMFARequest(transfer.LoginMFARequest{MFAToken: mfaToken, Code: code}); w.Code != http.StatusOK {
+		t.Errorf("Expected code of plaintext secret to be accepted, got %d", w.Code)
+	}
+	if err := internal.EncryptTOTPSecrets(); err != nil {
+		t.Fatalf("Failed to encrypt secrets: %v", err)
+	}
+	stored, _ = repository.NewSQLiteMFARepository().GetTOTPSecret(userID)
+	if !services.IsSealed(stored.Secret) {
+		t.Errorf("Expected plaintext secret to be encrypted, got %s", stored.Secret)
+	}
+}
+
+func TestSecretBox_WrongKeyOrAltered_Error(t *testing.T) {
+	box, err := services.NewSecretBox("first-encryption-key-0123456789abcdef")
+	if err != nil {
+		t.Fatalf("Failed to create box: %v", err)
+	}
+	sealed, _ := box.Seal("JBSWY3DPEHPK3PXP")
+	if opened, err := box.Open(sealed); err != nil || opened != "JBSWY3DPEHPK3PXP" {
+		t.Fatalf("Expected secret back, got %q, %v", opened, err)
+	}
+
+	other, _ := services.NewSecretBox("other-encryption-key-0123456789abcdef")
+	if _, err := other.Open(sealed); err == nil {
+		t.Error("Expected secret of another key to be rejected")
+	}
+	flipped := byte('A')
+	if sealed[len(sealed)-5] == 'A' {
+		flipped = 'B'
+	}
+	altered := sealed[:len(sealed)-5] + string(flipped) + sealed[len(sealed)-4:]
+	if _, err := box.Open(altered); err == nil {
+		t.Error("Expected altered secret to be rejected")
+	}
+	if _, err := services.NewSecretBox("short"); err == nil {
+		t.Error("Expected short key to be rejected")
+	}
+}
+
+func TestTOTPDisable_PasswordAndCodeRequired(t *testing.T) {
+	token := loginTestUser(t, "mfadisableuser", "password123")
+	apiKey, _ := createTestAPIKey(t, token, []string{common.ScopeFilesRead})
+	secret := enrollTestTOTP(t, token)
+	code, _ := services.TOTPCode(secret, time.Now().Add(30*time.Second))
+
+	tests := []struct {
+		name       string
+		token      string
+		payload    transfer.MFAReauthRequest
+		wantStatus int
+	}{
+		{"API key", apiKey, transfer.MFAReauthRequest{Password: "password123", Code: code}, http.StatusForbidden},
+		{"missing code", token, transfer.MFAReauthRequest{Password: "password123"}, http.StatusBadRequest},
+		{"wrong password", token, transfer.MFAReauthRequest{Password: "wrongpassword", Code: code}, http.StatusUnauthorized},
+		{"wrong code", token, transfer.MFAReauthRequest{Password: "password123", Code: "000000"}, http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if w := mfaRequest(t, handler.HandleTOTPDisable, tt.token, tt.payload); w.Code != tt.wantStatus {
+				t.Errorf("Expected status %d, got %d. Body: %s", tt.wantStatus, w.Code, w.Body.String())
+			}
+		})
+	}
+
+	w := mfaRequest(t, handler.HandleTOTPDisable, token, transfer.MFAReauthRequest{Password: "password123", Code: code})
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d. Body: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+
+	// Login no longer asks for a code, disabling again is an error
+	w = loginFromIP("mfadisableuser", "password123", "198.51.100.71")
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, w.Code)
+	}
+	if accessToken, _ := parseLoginTokens(t, w); accessToken == "" {
+		t.Error("Expected tokens without second factor")
+	}
+	if w := mfaRequest(t, handler.HandleTOTPDisable, token, transfer.MFAReauthRequest{Password: "password123", Code: code}); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d, got %d", http.StatusBadRequest, w.Code)
+	}
+}
+
+func TestRecoveryCodesRegenerate_OldCodesRevoked(t *testing.T) {
+	token := loginTestUser(t, "mfaregenuser", "password123")
+	secret := enrollTestTOTP(t, token)
+	code, _ := services.TOTPCode(secret, time.Now().Add(30*time.Second))
+
+	// The recovery codes of the confirmation are replaced
+	codes := regenerateTestRecoveryCodes(t, token, transfer.MFAReauthRequest{Password: "password123", Code: code})
+
+	// A new recovery code can stand in for the TOTP code
+	newCodes := regenerateTestRecoveryCodes(t, token, transfer.MFAReauthRequest{Password: "password123", RecoveryCode: codes[0]})
+	if w := mfaRequest(t, handler.HandleRecoveryCodesRegenerate, token, transfer.MFAReauthRequest{Password: "password123", RecoveryCode: codes[1]}); w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected replaced recovery code to be rejected, got %d", w.Code)
+	}
+
+	mfaToken := loginMFAPending(t, "mfaregenuser", "password123")
+	if w := loginMFARequest(transfer.LoginMFARequest{MFAToken: mfaToken, RecoveryCode: newCodes[0]}); w.Code != http.StatusOK {
+		t.Errorf("Expected new recovery code to be accepted, got %d", w.Code)
+	}
+}
+
+// enrollTestTOTP enables 2FA for the user of the token and returns the secret
+func enrollTestTOTP(t *testing.T, token string) string {
+	t.Helper()
+	w := mfaRequest(t, handler.HandleTOTPEnroll, token, nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d. Body: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	var enroll struct {
+		Data transfer.TOTPEnrollData `json:"data"`
+	}
+	json.NewDecoder(w.Body).Decode(&enroll)
+
+	code, _ := services.TOTPCode(enroll.Data.Secret, time.Now())
+	if w := mfaRequest(t, handler.HandleTOTPConfirm, token, transfer.TOTPConfirmRequest{Code: code}); w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d. Body: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	return enroll.Data.Secret
+}
+
+// regenerateTestRecoveryCodes replaces the recovery codes and returns the new ones
+func regenerateTestRecoveryCodes(t *testing.T, token string, payload transfer.MFAReauthRequest) []string {
+	t.Helper()
+	w := mfaRequest(t, handler.HandleRecoveryCodesRegenerate, token, payload)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d. Body: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	var response struct {
+		Data transfer.TOTPConfirmData `json:"data"`
+	}
+	json.NewDecoder(w.Body).Decode(&response)
+	if len(response.Data.RecoveryCodes) != 10 {
+		t.Fatalf("Expected 10 recovery codes, got %d", len(response.Data.RecoveryCodes))
+	}
+	return response.Data.RecoveryCodes
+}
+
+func mfaRequest(t *testing.T, handle http.HandlerFunc, token string, payload interface{}) *httptest.ResponseRecorder {
+	var body []byte
+	if payload != nil {
+		body, _ = json.Marshal(payload)
+	}
+	req := httptest.NewRequest(http.MethodPost, "/api/mfa/totp", bytes.NewReader(body))
+	req.Header.Set(common.HeaderAuthorization, "Bearer "+token)
+	w := httptest.NewRecorder()
+	middleware.AuthUser(handle)(w, req)
+	return w
+}
+
+func loginMFARequest(payload transfer.LoginMFARequest) *httptest.ResponseRecorder {
+	body, _ := json.Marshal(payload)
+	req := httptest.NewRequest(http.MethodPost, "/api/login/mfa", bytes.NewReader(body))
+	req.Header.Set("X-Forwarded-For", "198.51.100.70")
+	w := httptest.NewRecorder()
+	handler.HandleLoginMFA(w, req)
+	return w
+}
+
+// loginMFAPending logs in a user with 2FA enabled and returns the MFA token
+func loginMFAPending(t *testing.T, username, password string) string {
+	t.Helper()
+	w := loginFromIP(username, password, "198.51.100.70")
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, w.Code)
+	}
+
+	var response struct {
+		Data transfer.MFARequiredData `json:"data"`
+	}
+	json.NewDecoder(w.Body).Decode(&response)
+	if !response.Data.MFARequired || response.Data.MFAToken == "" {
+		t.Fatalf("Expected MFA to be required, got %+v", response.Data)
+	}
+	return response.Data.MFAToken
+}
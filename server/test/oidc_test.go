@@ -0,0 +1,556 @@
+package test
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"elotuschallenge/common"
+	"elotuschallenge/handler"
+	"elotuschallenge/internal"
+	"elotuschallenge/models"
+	"elotuschallenge/repository"
+	"elotuschallenge/services"
+	"elotuschallenge/transfer"
+)
+
+const fakeOIDCClientID = "elotus-test-client"
+const fakeOIDCClientSecret = "elotus-test-secret"
+const fakeOIDCRedirectURL = "http://localhost:8080/api/oidc/fake/callback"
+
+// fakeOIDCKey is shared by the fake providers since generating RSA keys is slow
+var fakeOIDCKey = sync.OnceValue(func() *rsa.PrivateKey {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		panic(err)
+	}
+	return key
+})
+
+// fakeOIDCProvider is an in-process OpenID Connect provider signing in the user set in its fields
+type fakeOIDCProvider struct {
+	server *httptest.Server
+	key    *rsa.PrivateKey
+
+	mu    sync.Mutex
+	codes map[string]fakeOIDCCode
+
+	// Identity of the user signing in at the provider
+	subject           string
+	email             string
+	preferredUsername string
+	// editClaims changes the ID token claims before signing, to issue invalid tokens
+	editClaims func(claims map[string]interface{})
+	// signingKey signs ID tokens instead of the published key when set
+	signingKey *rsa.PrivateKey
+}
+
+// fakeOIDCCode is an authorization code with the request it was issued for
+type fakeOIDCCode struct {
+	challenge   string
+	nonce       string
+	redirectURI string
+}
+
+// useFakeOIDCProvider starts a fake provider and configures it as the "fake" provider until the test ends
+func useFakeOIDCProvider(t *testing.T, subject, preferredUsername string) *fakeOIDCProvider {
+	t.Helper()
+	provider := &fakeOIDCProvider{
+		key:               fakeOIDCKey(),
+		codes:             make(map[string]fakeOIDCCode),
+		subject:           subject,
+		email:             preferredUsername + "@example.com",
+		preferredUsername: preferredUsername,
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", provider.handleDiscovery)
+	mux.HandleFunc("/authorize", provider.handleAuthorize)
+	mux.HandleFunc("/token", provider.handleToken)
+	mux.HandleFunc("/jwks", provider.handleJWKS)
+	provider.server = httptest.NewServer(mux)
+	t.Cleanup(provider.server.Close)
+
+	previous := internal.OIDCService
+	internal.OIDCService = services.NewOIDCService([]services.OIDCProviderConfig{{
+		Name:         "fake",
+		Issuer:       provider.server.URL,
+		ClientID:     fakeOIDCClientID,
+		ClientSecret: fakeOIDCClientSecret,
+		RedirectURL:  fakeOIDCRedirectURL,
+		Scopes:       []string{"openid", "profile", "email"},
+	}}, repository.NewSQLiteOIDCRepository(), repository.NewSQLiteUserRepository(), provider.server.Client())
+	t.Cleanup(func() { internal.OIDCService = previous })
+
+	return provider
+}
+
+func (p *fakeOIDCProvider) handleDiscovery(w http.ResponseWriter, r *http.Request) {
+	json.NewEncoder(w).Encode(map[string]string{
+		"issuer":                 p.server.URL,
+		"authorization_endpoint": p.server.URL + "/authorize",
+		"token_endpoint":         p.server.URL + "/token",
+		"jwks_uri":               p.server.URL + "/jwks",
+	})
+}
+
+// handleAuthorize signs the user in right away and redirects back with a code
+func (p *fakeOIDCProvider) handleAuthorize(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	if query.Get("client_id") != fakeOIDCClientID || query.Get("response_type") != "code" ||
+		query.Get("code_challenge_method") != "S256" || query.Get("code_challenge") == "" {
+		http.Error(w, "invalid authorization request", http.StatusBadRequest)
+		return
+	}
+
+	code := base64.RawURLEncoding.EncodeToString([]byte(time.Now().String() + query.Get("state")))
+	p.mu.Lock()
+	p.codes[code] = fakeOIDCCode{
+		challenge:   query.Get("code_challenge"),
+		nonce:       query.Get("nonce"),
+		redirectURI: query.Get("redirect_uri"),
+	}
+	p.mu.Unlock()
+
+	callback, _ := url.Parse(query.Get("redirect_uri"))
+	callbackQuery := url.Values{"code": {code}, "state": {query.Get("state")}}
+	callback.RawQuery = callbackQuery.Encode()
+	http.Redirect(w, r, callback.String(), http.StatusFound)
+}
+
+// handleToken redeems a code once, checking the client secret and the PKCE verifier
+func (p *fakeOIDCProvider) handleToken(w http.ResponseWriter, r *http.Request) {
+	clientID, clientSecret, _ := r.BasicAuth()
+	if clientID != fakeOIDCClientID || clientSecret != fakeOIDCClientSecret {
+		writeFakeOIDCError(w, "invalid_client")
+		return
+	}
+
+	p.mu.Lock()
+	code, ok := p.codes[r.PostFormValue("code")]
+	delete(p.codes, r.PostFormValue("code"))
+	p.mu.Unlock()
+	if !ok || code.redirectURI != r.PostFormValue("redirect_uri") {
+		writeFakeOIDCError(w, "invalid_grant")
+		return
+	}
+	if services.PKCEChallenge(r.PostFormValue("code_verifier")) != code.challenge {
+		writeFakeOIDCError(w, "invalid_grant")
+		return
+	}
+
+	now := time.Now().Unix()
+	claims := map[string]interface{}{
+		"iss":                p.server.URL,
+		"sub":                p.subject,
+		"aud":                fakeOIDCClientID,
+		"nonce":              code.nonce,
+		"iat":                now,
+		"exp":                now + 300,
+		"email":              p.email,
+		"email_verified":     true,
+		"preferred_username": p.preferredUsername,
+	}
+	if p.editClaims != nil {
+		p.editClaims(claims)
+	}
+
+	json.NewEncoder(w).Encode(map[string]string{
+		"access_token": "provider-access-token",
+		"token_type":   "Bearer",
+		"id_token":     p.signIDToken(claims),
+	})
+}
+
+func (p *fakeOIDCProvider) handleJWKS(w http.ResponseWriter, r *http.Request) {
+	json.NewEncoder(w).Encode(services.JWKSet{Keys: []services.JWK{{
+		KeyType:   "RSA",
+		KeyID:     "fake-key",
+		Use:       "sig",
+		Algorithm: services.AlgorithmRS256,
+		N:         base64.RawURLEncoding.EncodeToString(p.key.N.Bytes()),
+		E:         base64.RawURLEncoding.EncodeToString(big.NewInt(int64(p.key.E)).Bytes()),
+	}}})
+}
+
+func (p *fakeOIDCProvider) signIDToken(claims map[string]interface{}) string {
+	headerBytes, _ := json.Marshal(map[string]string{"alg": services.AlgorithmRS256, "typ": "JWT", "kid": "fake-key"})
+	claimsBytes, _ := json.Marshal(claims)
+	message := base64.RawURLEncoding.EncodeToString(headerBytes) + "." + base64.RawURLEncoding.EncodeToString(claimsBytes)
+
+	key := p.key
+	if p.signingKey != nil {
+		key = p.signingKey
+	}
+	digest := sha256.Sum256([]byte(message))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	if err != nil {
+		panic(err)
+	}
+	return message + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func writeFakeOIDCError(w http.ResponseWriter, code string) {
+	w.Header().Set(common.HeaderContentType, common.HeaderValueContentTypeJSON)
+	w.WriteHeader(http.StatusBadRequest)
+	json.NewEncoder(w).Encode(map[string]string{"error": code})
+}
+
+// authorize follows the authorization URL at the fake provider and returns the callback query
+func (p *fakeOIDCProvider) authorize(t *testing.T, authURL string) url.Values {
+	t.Helper()
+	client := *p.server.Client()
+	client.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		return http.ErrUseLastResponse
+	}
+	resp, err := client.Get(authURL)
+	if err != nil {
+		t.Fatalf("Failed to authorize at fake provider: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusFound {
+		t.Fatalf("Expected fake provider to redirect, got status %d", resp.StatusCode)
+	}
+	callback, err := url.Parse(resp.Header.Get("Location"))
+	if err != nil {
+		t.Fatalf("Invalid callback URL: %v", err)
+	}
+	return callback.Query()
+}
+
+func TestHandleOIDCLogin_RedirectsWithPKCE(t *testing.T) {
+	provider := useFakeOIDCProvider(t, "subject-redirect", "ssoredirect")
+
+	w := oidcLoginRequest("fake", false)
+
+	if w.Code != http.StatusFound {
+		t.Fatalf("Expected status %d, got %d. Body: %s", http.StatusFound, w.Code, w.Body.String())
+	}
+	location, _ := url.Parse(w.Header().Get("Location"))
+	query := location.Query()
+	if location.Host != mustParseURL(t, provider.server.URL).Host || location.Path != "/authorize" {
+		t.Errorf("Expected redirect to the authorization endpoint, got %s", location)
+	}
+	if query.Get("code_challenge_method") != "S256" || query.Get("code_challenge") == "" {
+		t.Errorf("Expected S256 code challenge, got %q", query.Encode())
+	}
+	if query.Get("state") == "" || query.Get("nonce") == "" {
+		t.Error("Expected state and nonce in authorization request")
+	}
+	if query.Get("redirect_uri") != fakeOIDCRedirectURL || query.Get("scope") != "openid profile email" {
+		t.Errorf("Unexpected redirect_uri or scope: %q", query.Encode())
+	}
+}
+
+func TestHandleOIDCLogin_UnknownProvider_NotFound(t *testing.T) {
+	useFakeOIDCProvider(t, "subject-unknown", "ssounknown")
+
+	w := oidcLoginRequest("other", false)
+
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected status %d, got %d", http.StatusNotFound, w.Code)
+	}
+}
+
+func TestHandleOIDCCallback_FirstLoginCreatesUserThenLinks(t *testing.T) {
+	provider := useFakeOIDCProvider(t, "subject-link", "ssolink")
+
+	w := oidcSignIn(t, provider, false)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d. Body: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	firstUserID, firstUsername := oidcLoginUser(t, w)
+	if firstUsername != "ssolink" {
+		t.Errorf("Expected username from preferred_username, got %q", firstUsername)
+	}
+
+	// A new login of the same subject signs in the same user, even if the provider username changed
+	provider.preferredUsername = "ssolink-renamed"
+	w = oidcSignIn(t, provider, false)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d. Body: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	secondUserID, _ := oidcLoginUser(t, w)
+	if secondUserID != firstUserID {
+		t.Errorf("Expected subject to be linked to user %d, got %d", firstUserID, secondUserID)
+	}
+}
+
+func TestHandleOIDCCallback_ReturnsUsableTokens(t *testing.T) {
+	provider := useFakeOIDCProvider(t, "subject-tokens", "ssotokens")
+
+	w := oidcSignIn(t, provider, false)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d. Body: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+
+	accessToken, refreshToken := parseLoginTokens(t, w)
+	if refreshToken == "" {
+		t.Error("Expected a refresh token")
+	}
+	if w := authorizedRequest(accessToken); w.Code != http.StatusOK {
+		t.Errorf("Expected access token to be accepted, got status %d", w.Code)
+	}
+}
+
+func TestHandleOIDCCallback_UsernameTaken_DoesNotLinkLocalAccount(t *testing.T) {
+	registerUser(t, "ssotaken", "password123")
+	provider := useFakeOIDCProvider(t, "subject-taken", "ssotaken")
+
+	w := oidcSignIn(t, provider, false)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d. Body: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+
+	localUser, _ := internal.UserService.GetUserByUsername("ssotaken")
+	userID, username := oidcLoginUser(t, w)
+	if userID == localUser.ID || username == "ssotaken" {
+		t.Errorf("Expected a new account, got user %d %q", userID, username)
+	}
+}
+
+func TestHandleOIDCCallback_UseCookies_SetsSessionCookie(t *testing.T) {
+	provider := useFakeOIDCProvider(t, "subject-cookie", "ssocookie")
+
+	w := oidcSignIn(t, provider, true)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d. Body: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	sessionCookies(t, w)
+}
+
+func TestHandleOIDCCallback_StateReplay_Rejected(t *testing.T) {
+	provider := useFakeOIDCProvider(t, "subject-replay", "ssoreplay")
+
+	callback, cookies := provider.startLogin(t, false)
+	if w := oidcCallbackRequest("fake", callback, cookies); w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d. Body: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+
+	w := oidcCallbackRequest("fake", callback, cookies)
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected replayed state to be rejected with %d, got %d", http.StatusUnauthorized, w.Code)
+	}
+}
+
+func TestHandleOIDCCallback_CodeOfAnotherLogin_RejectedByPKCE(t *testing.T) {
+	provider := useFakeOIDCProvider(t, "subject-pkce", "ssopkce")
+
+	// An attacker injects the code of their own login into the victim's callback
+	victim, victimCookies := provider.startLogin(t, false)
+	attacker, _ := provider.startLogin(t, false)
+	victim.Set("code", attacker.Get("code"))
+
+	w := oidcCallbackRequest("fake", victim, victimCookies)
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status %d, got %d. Body: %s", http.StatusUnauthorized, w.Code, w.Body.String())
+	}
+}
+
+func TestHandleOIDCCallback_OtherBrowser_Rejected(t *testing.T) {
+	provider := useFakeOIDCProvider(t, "subject-csrf", "ssocsrf")
+
+	// An attacker signs in at the provider with their own account and sends the callback URL to the victim,
+	// whose browser has no state cookie or the one of another login
+	callback, _ := provider.startLogin(t, true)
+	_, otherCookies := provider.startLogin(t, true)
+
+	for name, cookies := range map[string][]*http.Cookie{"no state cookie": nil, "state cookie of another login": otherCookies} {
+		w := oidcCallbackRequest("fake", callback, cookies)
+		if w.Code != http.StatusUnauthorized {
+			t.Errorf("Expected callback with %s to be rejected with %d, got %d", name, http.StatusUnauthorized, w.Code)
+		}
+		for _, cookie := range w.Result().Cookies() {
+			if cookie.Name == common.CookieSession && cookie.Value != "" {
+				t.Errorf("Expected no session cookie with %s", name)
+			}
+		}
+	}
+	if exists, _ := internal.UserService.UserExists("ssocsrf"); exists {
+		t.Error("Expected no user to be created from a callback of another browser")
+	}
+}
+
+func TestHandleOIDCCallback_ClearsStateCookie(t *testing.T) {
+	provider := useFakeOIDCProvider(t, "subject-statecookie", "ssostatecookie")
+
+	login := oidcLoginRequest("fake", false)
+	var stateCookie *http.Cookie
+	for _, cookie := range login.Result().Cookies() {
+		if cookie.Name == common.CookieOIDCState {
+			stateCookie = cookie
+		}
+	}
+	if stateCookie == nil || !stateCookie.HttpOnly || stateCookie.SameSite != http.SameSiteLaxMode || stateCookie.Path != "/api/oidc/fake/callback" {
+		t.Fatalf("Expected an HttpOnly SameSite=Lax state cookie scoped to the callback, got %+v", stateCookie)
+	}
+
+	w := oidcCallbackRequest("fake", provider.authorize(t, login.Header().Get("Location")), []*http.Cookie{stateCookie})
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d. Body: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	for _, cookie := range w.Result().Cookies() {
+		if cookie.Name == common.CookieOIDCState && cookie.MaxAge >= 0 {
+			t.Errorf("Expected state cookie to be cleared, got %+v", cookie)
+		}
+	}
+}
+
+func TestOIDCRepository_CreateUserWithIdentity_LinkedConcurrently(t *testing.T) {
+	repo := repository.NewSQLiteOIDCRepository()
+	identity := func() *models.UserIdentity {
+		return &models.UserIdentity{Issuer: "https://sso.example.com", Subject: "subject-race"}
+	}
+
+	first, err := repo.CreateUserWithIdentity(&models.User{Username: "ssorace", Role: models.RoleUser, Status: models.StatusActive}, identity())
+	if err != nil || first == nil {
+		t.Fatalf("Expected user to be created, got %v, %v", first, err)
+	}
+
+	// A second first sign in of the same provider account creates neither the identity nor the user
+	second, err := repo.CreateUserWithIdentity(&models.User{Username: "ssorace-2", Role: models.RoleUser, Status: models.StatusActive}, identity())
+	if err != nil || second != nil {
+		t.Fatalf("Expected nothing to be created for a linked identity, got %v, %v", second, err)
+	}
+	if exists, _ := internal.UserService.UserExists("ssorace-2"); exists {
+		t.Error("Expected the user of the conflicting identity to be rolled back")
+	}
+	if linked, _ := repo.GetIdentity("https://sso.example.com", "subject-race"); linked == nil || linked.UserID != first.ID {
+		t.Errorf("Expected identity linked to user %d, got %+v", first.ID, linked)
+	}
+}
+
+func TestHandleOIDCCallback_InvalidIDToken_Rejected(t *testing.T) {
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+
+	tests := []struct {
+		name       string
+		editClaims func(claims map[string]interface{})
+		signingKey *rsa.PrivateKey
+	}{
+		{name: "wrong audience", editClaims: func(claims map[string]interface{}) { claims["aud"] = "other-client" }},
+		{name: "wrong issuer", editClaims: func(claims map[string]interface{}) { claims["iss"] = "https://evil.example.com" }},
+		{name: "wrong nonce", editClaims: func(claims map[string]interface{}) { claims["nonce"] = "replayed" }},
+		{name: "expired", editClaims: func(claims map[string]interface{}) { claims["exp"] = time.Now().Add(-time.Hour).Unix() }},
+		{name: "missing subject", editClaims: func(claims map[string]interface{}) { delete(claims, "sub") }},
+		{name: "unknown signing key", signingKey: otherKey},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			provider := useFakeOIDCProvider(t, "subject-invalid", "ssoinvalid")
+			provider.editClaims = tt.editClaims
+			provider.signingKey = tt.signingKey
+
+			w := oidcSignIn(t, provider, false)
+			if w.Code != http.StatusUnauthorized {
+				t.Errorf("Expected status %d, got %d. Body: %s", http.StatusUnauthorized, w.Code, w.Body.String())
+			}
+		})
+	}
+
+	if exists, _ := internal.UserService.UserExists("ssoinvalid"); exists {
+		t.Error("Expected no user to be created from invalid ID tokens")
+	}
+}
+
+func TestHandleOIDCCallback_ProviderError_Unauthorized(t *testing.T) {
+	useFakeOIDCProvider(t, "subject-denied", "ssodenied")
+
+	w := oidcCallbackRequest("fake", url.Values{"error": {"access_denied"}}, nil)
+
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status %d, got %d", http.StatusUnauthorized, w.Code)
+	}
+}
+
+func TestHandleOIDCProviders_ListsConfiguredProviders(t *testing.T) {
+	useFakeOIDCProvider(t, "subject-list", "ssolist")
+
+	req := httptest.NewRequest(http.MethodGet, "/api/oidc/providers", nil)
+	w := httptest.NewRecorder()
+	handler.HandleOIDCProviders(w, req)
+
+	var response struct {
+		Data transfer.OIDCProvidersData `json:"data"`
+	}
+	json.NewDecoder(w.Body).Decode(&response)
+	if len(response.Data.Providers) != 1 || response.Data.Providers[0] != "fake" {
+		t.Errorf("Expected providers [fake], got %v", response.Data.Providers)
+	}
+}
+
+// oidcSignIn goes through the whole login at the fake provider and returns the callback response
+func oidcSignIn(t *testing.T, provider *fakeOIDCProvider, useCookies bool) *httptest.ResponseRecorder {
+	t.Helper()
+	callback, cookies := provider.startLogin(t, useCookies)
+	return oidcCallbackRequest("fake", callback, cookies)
+}
+
+// startLogin starts a login in a browser and signs in at the fake provider, it returns the callback query
+// and the cookies of the browser
+func (p *fakeOIDCProvider) startLogin(t *testing.T, useCookies bool) (url.Values, []*http.Cookie) {
+	t.Helper()
+	w := oidcLoginRequest("fake", useCookies)
+	if w.Code != http.StatusFound {
+		t.Fatalf("Failed to start OIDC login: %s", w.Body.String())
+	}
+	return p.authorize(t, w.Header().Get("Location")), w.Result().Cookies()
+}
+
+func oidcLoginRequest(provider string, useCookies bool) *httptest.ResponseRecorder {
+	target := "/api/oidc/" + provider + "/login"
+	if useCookies {
+		target += "?use_cookies=true"
+	}
+	req := httptest.NewRequest(http.MethodGet, target, nil)
+	req.SetPathValue("provider", provider)
+	w := httptest.NewRecorder()
+	handler.HandleOIDCLogin(w, req)
+	return w
+}
+
+func oidcCallbackRequest(provider string, query url.Values, cookies []*http.Cookie) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, "/api/oidc/"+provider+"/callback?"+query.Encode(), nil)
+	for _, cookie := range cookies {
+		req.AddCookie(cookie)
+	}
+	req.SetPathValue("provider", provider)
+	w := httptest.NewRecorder()
+	handler.HandleOIDCCallback(w, req)
+	return w
+}
+
+// oidcLoginUser returns the user of a login response without consuming the body
+func oidcLoginUser(t *testing.T, w *httptest.ResponseRecorder) (int, string) {
+	t.Helper()
+	var response struct {
+		Data transfer.LoginData `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	return response.Data.Auth.User.ID, response.Data.Auth.User.Username
+}
+
+func mustParseURL(t *testing.T, rawURL string) *url.URL {
+	t.Helper()
+	parsed, err := url.Parse(rawURL)
+	if err != nil {
+		t.Fatalf("Invalid URL %q: %v", rawURL, err)
+	}
+	return parsed
+}
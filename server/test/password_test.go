@@ -0,0 +1,182 @@
+package test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"elotuschallenge/common"
+	"elotuschallenge/handler"
+	"elotuschallenge/internal"
+	"elotuschallenge/middleware"
+	"elotuschallenge/models"
+	"elotuschallenge/repository"
+	"elotuschallenge/services"
+	"elotuschallenge/transfer"
+)
+
+func TestHandleChangePassword_ValidRequest_OldTokensRevoked(t *testing.T) {
+	oldToken, oldRefreshToken := loginTestUserTokens(t, "pwchangeuser", "password123")
+	apiKey, _ := createTestAPIKey(t, oldToken, []string{common.ScopeFilesRead})
+
+	// Wrong current password
+	w := changePasswordRequest(oldToken, "wrongpassword", "newpassword456")
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("Expected status %d, got %d", http.StatusUnauthorized, w.Code)
+	}
+
+	w = changePasswordRequest(oldToken, "password123", "newpassword456")
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d. Body: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	newToken, _ := parseLoginTokens(t, w)
+
+	// Tokens issued before the change are rejected, the returned token works
+	if w := authorizedRequest(oldToken); w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected old token to be rejected, got %d", w.Code)
+	}
+	if w := refreshRequest(oldRefreshToken); w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected old refresh token to be rejected, got %d", w.Code)
+	}
+	if w := authorizedRequest(apiKey); w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected API key to be revoked, got %d", w.Code)
+	}
+	if w := authorizedRequest(newToken); w.Code != http.StatusOK {
+		t.Errorf("Expected new token to be accepted, got %d", w.Code)
+	}
+
+	// Only the new password logs in
+	if w := loginFromIP("pwchangeuser", "password123", "198.51.100.60"); w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected old password to be rejected, got %d", w.Code)
+	}
+	if w := loginFromIP("pwchangeuser", "newpassword456", "198.51.100.60"); w.Code != http.StatusOK {
+		t.Errorf("Expected new password to be accepted, got %d", w.Code)
+	}
+}
+
+func TestHandleChangePassword_RepeatedWrongPasswords_Locked(t *testing.T) {
+	token := loginTestUser(t, "pwchangeguess", "password123")
+
+	for i := 0; i < 4; i++ {
+		if w := changePasswordRequest(token, "wrongpassword", "newpassword456"); w.Code != http.StatusUnauthorized {
+			t.Fatalf("Attempt %d: expected status %d, got %d", i+1, http.StatusUnauthorized, w.Code)
+		}
+	}
+
+	// The guesses count like failed logins, the fifth one locks the account
+	if w := changePasswordRequest(token, "wrongpassword", "newpassword456"); w.Code != http.StatusTooManyRequests {
+		t.Fatalf("Expected status %d, got %d", http.StatusTooManyRequests, w.Code)
+	}
+	if w := changePasswordRequest(token, "password123", "newpassword456"); w.Code != http.StatusTooManyRequests {
+		t.Errorf("Expected the right password to be rejected while locked, got %d", w.Code)
+	}
+	if w := loginFromIP("pwchangeguess", "password123", "198.51.100.61"); w.Code != http.StatusTooManyRequests {
+		t.Errorf("Expected login to be locked too, got %d", w.Code)
+	}
+}
+
+func TestHandleChangePassword_APIKey_Forbidden(t *testing.T) {
+	token := loginTestUser(t, "pwchangekeyuser", "password123")
+	key, _ := createTestAPIKey(t, token, []string{common.ScopeFilesWrite})
+
+	if w := changePasswordRequest(key, "password123", "newpassword456"); w.Code != http.StatusForbidden {
+		t.Errorf("Expected status %d, got %d", http.StatusForbidden, w.Code)
+	}
+}
+
+func TestPasswordReset_TokenFromOutbox_SingleUse(t *testing.T) {
+	oldToken, _ := loginTestUserTokens(t, "pwresetuser", "password123")
+
+	// Known and unknown usernames get the same response
+	known := passwordResetRequest("pwresetuser")
+	unknown := passwordResetRequest("pwresetnobody")
+	if known.Code != http.StatusAccepted || unknown.Code != http.StatusAccepted {
+		t.Fatalf("Expected status %d for both, got %d and %d", http.StatusAccepted, known.Code, unknown.Code)
+	}
+
+	resetToken := latestResetToken(t, "pwresetuser")
+
+	if w := resetPasswordRequest(resetToken, "resetpassword789"); w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d. Body: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+
+	// The token is single-use
+	if w := resetPasswordRequest(resetToken, "anotherpassword"); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected reused reset token to be rejected, got %d", w.Code)
+	}
+
+	if w := authorizedRequest(oldToken); w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected token issued before the reset to be rejected, got %d", w.Code)
+	}
+	if w := loginFromIP("pwresetuser", "resetpassword789", "198.51.100.61"); w.Code != http.StatusOK {
+		t.Errorf("Expected new password to be accepted, got %d", w.Code)
+	}
+
+	// The user is told about the change
+	notifications, _ := repository.NewSQLiteOutboxRepository().GetNotificationsByRecipient("pwresetuser")
+	if last := notifications[len(notifications)-1]; last.Kind != models.NotificationPasswordChanged {
+		t.Errorf("Expected last notification '%s', got '%s'", models.NotificationPasswordChanged, last.Kind)
+	}
+}
+
+func TestPasswordReset_ExpiredOrUnknownToken_Error(t *testing.T) {
+	registerUser(t, "pwresetexpired", "password123")
+	hasher := mustPasswordHasher(t, services.PasswordHasherConfig{Algorithm: services.HashAlgorithmArgon2id, Argon2id: services.DefaultArgon2idParams})
+	passwordService := services.NewPasswordService(repository.NewSQLiteUserRepository(), repository.NewSQLitePasswordResetRepository(),
+		repository.NewSQLiteAPIKeyRepository(), hasher, internal.Notifier, internal.SessionService, 0)
+
+	if err := passwordService.RequestPasswordReset("pwresetexpired"); err != nil {
+		t.Fatalf("Failed to request reset: %v", err)
+	}
+	if _, err := passwordService.ResetPassword(latestResetToken(t, "pwresetexpired"), "newpassword456"); err != common.ErrResetTokenExpired {
+		t.Errorf("Expected %v, got %v", common.ErrResetTokenExpired, err)
+	}
+
+	if w := resetPasswordRequest("unknown-reset-token", "newpassword456"); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d, got %d", http.StatusBadRequest, w.Code)
+	}
+}
+
+func changePasswordRequest(token, currentPassword, newPassword string) *httptest.ResponseRecorder {
+	body, _ := json.Marshal(transfer.ChangePasswordRequest{CurrentPassword: currentPassword, NewPassword: newPassword})
+	req := httptest.NewRequest(http.MethodPost, "/api/password", bytes.NewReader(body))
+	req.Header.Set(common.HeaderAuthorization, "Bearer "+token)
+	w := httptest.NewRecorder()
+	middleware.AuthUser(handler.HandleChangePassword)(w, req)
+	return w
+}
+
+func passwordResetRequest(username string) *httptest.ResponseRecorder {
+	body, _ := json.Marshal(transfer.PasswordResetRequest{Username: username})
+	req := httptest.NewRequest(http.MethodPost, "/api/password/reset/request", bytes.NewReader(body))
+	w := httptest.NewRecorder()
+	handler.HandlePasswordResetRequest(w, req)
+	return w
+}
+
+func resetPasswordRequest(token, newPassword string) *httptest.ResponseRecorder {
+	body, _ := json.Marshal(transfer.ResetPasswordRequest{Token: token, NewPassword: newPassword})
+	req := httptest.NewRequest(http.MethodPost, "/api/password/reset", bytes.NewReader(body))
+	w := httptest.NewRecorder()
+	handler.HandlePasswordReset(w, req)
+	return w
+}
+
+// latestResetToken reads the reset token of the last password reset notification in the outbox
+func latestResetToken(t *testing.T, username string) string {
+	t.Helper()
+	return latestNotificationToken(t, username, models.NotificationPasswordReset)
+}
+
+// authorizedRequest calls a handler behind AuthUser which always succeeds once authenticated
+func authorizedRequest(token string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set(common.HeaderAuthorization, "Bearer "+token)
+	w := httptest.NewRecorder()
+	middleware.AuthUser(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})(w, req)
+	return w
+}
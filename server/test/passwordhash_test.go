@@ -0,0 +1,104 @@
+package test
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"elotuschallenge/internal"
+	"elotuschallenge/models"
+	"elotuschallenge/services"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestPasswordHasher_Argon2id_VerifiesAndDetectsParameterChanges(t *testing.T) {
+	hasher := mustPasswordHasher(t, services.PasswordHasherConfig{
+		Algorithm: services.HashAlgorithmArgon2id,
+		Argon2id:  services.DefaultArgon2idParams,
+	})
+
+	hash, err := hasher.Hash("password123")
+	if err != nil {
+		t.Fatalf("Failed to hash password: %v", err)
+	}
+	if !strings.HasPrefix(hash, "$argon2id$v=19$m=19456,t=2,p=1$") {
+		t.Errorf("Expected PHC formatted argon2id hash, got %s", hash)
+	}
+
+	if valid, err := hasher.Verify("password123", hash); err != nil || !valid {
+		t.Errorf("Expected password to match, got %v, %v", valid, err)
+	}
+	if valid, _ := hasher.Verify("wrongpassword", hash); valid {
+		t.Error("Expected wrong password not to match")
+	}
+	if hasher.NeedsRehash(hash) {
+		t.Error("Expected hash with current parameters not to need a rehash")
+	}
+
+	// Raising the cost makes existing hashes outdated
+	stronger := services.DefaultArgon2idParams
+	stronger.Iterations++
+	strongerHasher := mustPasswordHasher(t, services.PasswordHasherConfig{Algorithm: services.HashAlgorithmArgon2id, Argon2id: stronger})
+	if !strongerHasher.NeedsRehash(hash) {
+		t.Error("Expected hash with weaker parameters to need a rehash")
+	}
+
+	if _, err := hasher.Verify("password123", "plaintext"); err == nil {
+		t.Error("Expected unknown hash format to be an error")
+	}
+}
+
+func TestPasswordHasher_Bcrypt_VerifiedAndUpgraded(t *testing.T) {
+	bcryptHash, _ := bcrypt.GenerateFromPassword([]byte("password123"), bcrypt.MinCost)
+
+	hasher := mustPasswordHasher(t, services.PasswordHasherConfig{
+		Algorithm: services.HashAlgorithmArgon2id,
+		Argon2id:  services.DefaultArgon2idParams,
+	})
+	if valid, err := hasher.Verify("password123", string(bcryptHash)); err != nil || !valid {
+		t.Errorf("Expected bcrypt hash to be verified, got %v, %v", valid, err)
+	}
+	if !hasher.NeedsRehash(string(bcryptHash)) {
+		t.Error("Expected bcrypt hash to need a rehash to argon2id")
+	}
+
+	if _, err := services.NewPasswordHasher(services.PasswordHasherConfig{Algorithm: "md5"}); err == nil {
+		t.Error("Expected unsupported algorithm to be an error")
+	}
+}
+
+func TestLoginUser_BcryptHash_RehashedToArgon2id(t *testing.T) {
+	bcryptHash, _ := bcrypt.GenerateFromPassword([]byte("password123"), bcrypt.DefaultCost)
+	_, err := internal.UserService.CreateUser(&models.User{
+		Username:     "legacybcryptuser",
+		PasswordHash: string(bcryptHash),
+		Role:         models.RoleUser,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+
+	if w := loginFromIP("legacybcryptuser", "password123", "198.51.100.50"); w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, w.Code)
+	}
+
+	user, _ := internal.UserService.GetUserByUsername("legacybcryptuser")
+	if !strings.HasPrefix(user.PasswordHash, "$argon2id$") {
+		t.Fatalf("Expected password to be rehashed with argon2id, got %s", user.PasswordHash)
+	}
+
+	// The new hash keeps working
+	if w := loginFromIP("legacybcryptuser", "password123", "198.51.100.50"); w.Code != http.StatusOK {
+		t.Errorf("Expected status %d with rehashed password, got %d", http.StatusOK, w.Code)
+	}
+}
+
+func mustPasswordHasher(t *testing.T, config services.PasswordHasherConfig) services.IPasswordHasher {
+	t.Helper()
+	hasher, err := services.NewPasswordHasher(config)
+	if err != nil {
+		t.Fatalf("Failed to create password hasher: %v", err)
+	}
+	return hasher
+}
@@ -0,0 +1,104 @@
+package test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"elotuschallenge/common"
+	"elotuschallenge/handler"
+	"elotuschallenge/middleware"
+	"elotuschallenge/models"
+)
+
+func TestAuthUser_JWT_StoresTypedPrincipal(t *testing.T) {
+	token := loginTestUser(t, "principaluser", "password123")
+
+	req := httptest.NewRequest(http.MethodGet, "/protected", nil)
+	req.Header.Set(common.HeaderAuthorization, "Bearer "+token)
+	w := httptest.NewRecorder()
+
+	var principal *middleware.Principal
+	middleware.AuthUser(func(w http.ResponseWriter, r *http.Request) {
+		principal, _ = middleware.GetPrincipal(r)
+
+		// Nothing is stored under the plain string keys other packages could use too
+		for _, key := range []string{"user_id", "username", "role", "auth_method"} {
+			if value := r.Context().Value(key); value != nil {
+				t.Errorf("Expected no value under %q, got %v", key, value)
+			}
+		}
+		w.WriteHeader(http.StatusOK)
+	})(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d. Body: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	if principal == nil {
+		t.Fatal("Expected principal in context")
+	}
+	if principal.ID == 0 || principal.Username != "principaluser" {
+		t.Errorf("Expected principal of principaluser, got %+v", principal)
+	}
+	if !principal.HasRole(models.RoleUser) || principal.HasRole(models.RoleAdmin) {
+		t.Errorf("Expected only role %q, got %v", models.RoleUser, principal.Roles)
+	}
+	if principal.AuthMethod != common.AuthMethodJWT || principal.SessionID == "" || principal.TokenID == "" {
+		t.Errorf("Expected JWT principal with session and token ID, got %+v", principal)
+	}
+	if !principal.HasScope(common.ScopeFilesWrite) {
+		t.Error("Expected signed in user to be unrestricted by scopes")
+	}
+}
+
+func TestAuthUser_APIKey_PrincipalLimitedToScopes(t *testing.T) {
+	token := loginTestUser(t, "principalkeyuser", "password123")
+	key, _ := createTestAPIKey(t, token, []string{common.ScopeFilesRead})
+
+	req := httptest.NewRequest(http.MethodGet, "/protected", nil)
+	req.Header.Set(common.HeaderAuthorization, "Bearer "+key)
+	w := httptest.NewRecorder()
+
+	var principal *middleware.Principal
+	middleware.AuthUser(func(w http.ResponseWriter, r *http.Request) {
+		principal, _ = middleware.GetPrincipal(r)
+		w.WriteHeader(http.StatusOK)
+	})(w, req)
+
+	if principal == nil {
+		t.Fatalf("Expected principal in context, got status %d", w.Code)
+	}
+	if !principal.IsAPIKey() || principal.TokenID == "" || principal.SessionID != "" {
+		t.Errorf("Expected API key principal with prefix and without session, got %+v", principal)
+	}
+	if !principal.HasScope(common.ScopeFilesRead) || principal.HasScope(common.ScopeFilesWrite) {
+		t.Errorf("Expected only scope %q, got %v", common.ScopeFilesRead, principal.Scopes)
+	}
+}
+
+func TestPrincipalFromContext_Missing(t *testing.T) {
+	if _, ok := middleware.PrincipalFromContext(context.Background()); ok {
+		t.Error("Expected no principal in empty context")
+	}
+
+	// A principal stored by another package under a string key isn't picked up
+	ctx := context.WithValue(context.Background(), "user_id", 1)
+	if _, ok := middleware.PrincipalFromContext(ctx); ok {
+		t.Error("Expected no principal from string key")
+	}
+
+	ctx = middleware.WithPrincipal(context.Background(), &middleware.Principal{ID: 7, Username: "someone"})
+	if principal, ok := middleware.PrincipalFromContext(ctx); !ok || principal.ID != 7 {
+		t.Errorf("Expected stored principal, got %+v", principal)
+	}
+}
+
+func TestHandleUpload_WithoutPrincipal_Unauthorized(t *testing.T) {
+	w := httptest.NewRecorder()
+	handler.HandleUpload(w, httptest.NewRequest(http.MethodPost, "/api/upload", nil))
+
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status %d, got %d", http.StatusUnauthorized, w.Code)
+	}
+}
@@ -0,0 +1,115 @@
+package test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"elotuschallenge/common"
+	"elotuschallenge/handler"
+	"elotuschallenge/transfer"
+)
+
+func TestHandleRefreshToken_ValidToken_Rotates(t *testing.T) {
+	_, refreshToken := loginTestUserTokens(t, "refreshuser", "password123")
+
+	w := refreshRequest(refreshToken)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d. Body: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+
+	accessToken, rotatedToken := parseLoginTokens(t, w)
+	if accessToken == "" {
+		t.Error("Expected non-empty access token")
+	}
+	if rotatedToken == "" || rotatedToken == refreshToken {
+		t.Error("Expected refresh token to be rotated")
+	}
+
+	// The rotated token can be used once more
+	if w := refreshRequest(rotatedToken); w.Code != http.StatusOK {
+		t.Errorf("Expected status %d, got %d", http.StatusOK, w.Code)
+	}
+}
+
+func TestHandleRefreshToken_ReusedToken_RevokesFamily(t *testing.T) {
+	_, refreshToken := loginTestUserTokens(t, "reuseuser", "password123")
+
+	w := refreshRequest(refreshToken)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, w.Code)
+	}
+	_, rotatedToken := parseLoginTokens(t, w)
+
+	// Presenting the old token again is a reuse
+	if w := refreshRequest(refreshToken); w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status %d for reused token, got %d", http.StatusUnauthorized, w.Code)
+	}
+
+	// The whole family is revoked, including the token issued by the legitimate rotation
+	if w := refreshRequest(rotatedToken); w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status %d for token of revoked family, got %d", http.StatusUnauthorized, w.Code)
+	}
+}
+
+func TestHandleRefreshToken_UnknownToken_Error(t *testing.T) {
+	w := refreshRequest("not-a-real-refresh-token")
+
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status %d, got %d", http.StatusUnauthorized, w.Code)
+	}
+
+	var response transfer.APIResponse
+	json.NewDecoder(w.Body).Decode(&response)
+	if response.Message != common.ErrMsgInvalidRefreshToken {
+		t.Errorf("Expected message '%s', got '%s'", common.ErrMsgInvalidRefreshToken, response.Message)
+	}
+}
+
+// refreshRequest calls the refresh token handler with the given refresh token
+func refreshRequest(refreshToken string) *httptest.ResponseRecorder {
+	body, _ := json.Marshal(transfer.RefreshTokenRequest{RefreshToken: refreshToken})
+	req := httptest.NewRequest(http.MethodPost, "/api/token/refresh", bytes.NewReader(body))
+	req.Header.Set(common.HeaderContentType, common.HeaderValueContentTypeJSON)
+	w := httptest.NewRecorder()
+
+	handler.HandleRefreshToken(w, req)
+	return w
+}
+
+// loginTestUserTokens registers and logs in a test user, returning the access and refresh tokens
+func loginTestUserTokens(t *testing.T, username, password string) (string, string) {
+	registerUser(t, username, password)
+	return loginExistingUser(t, username, password)
+}
+
+// loginExistingUser logs in an already registered user, returning the access and refresh tokens
+func loginExistingUser(t *testing.T, username, password string) (string, string) {
+	body, _ := json.Marshal(transfer.LoginRequest{Username: username, Password: password})
+	req := httptest.NewRequest(http.MethodPost, "/login", bytes.NewReader(body))
+	req.Header.Set(common.HeaderContentType, common.HeaderValueContentTypeJSON)
+	w := httptest.NewRecorder()
+
+	handler.HandleLogin(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Failed to login test user: %s", w.Body.String())
+	}
+	return parseLoginTokens(t, w)
+}
+
+// parseLoginTokens extracts the access and refresh tokens from a login response
+func parseLoginTokens(t *testing.T, w *httptest.ResponseRecorder) (string, string) {
+	var response transfer.APIResponse
+	if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+
+	dataMap := response.Data.(map[string]interface{})
+	authMap := dataMap["auth"].(map[string]interface{})
+	accessToken, _ := authMap["token"].(string)
+	refreshToken, _ := authMap["refresh_token"].(string)
+	return accessToken, refreshToken
+}
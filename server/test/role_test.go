@@ -0,0 +1,137 @@
+package test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"elotuschallenge/common"
+	"elotuschallenge/handler"
+	"elotuschallenge/internal"
+	"elotuschallenge/middleware"
+	"elotuschallenge/models"
+	"elotuschallenge/transfer"
+)
+
+func TestRequireRole_Admin_CanListUsers(t *testing.T) {
+	if _, err := internal.UserService.EnsureAdmin("roleadmin", "password123"); err != nil {
+		t.Fatalf("Failed to create admin: %v", err)
+	}
+	token, _ := loginExistingUser(t, "roleadmin", "password123")
+
+	claims, err := internal.TokenManager.ValidateToken(token)
+	if err != nil {
+		t.Fatalf("Failed to validate admin token: %v", err)
+	}
+	if claims.Role != models.RoleAdmin {
+		t.Errorf("Expected role claim '%s', got '%s'", models.RoleAdmin, claims.Role)
+	}
+
+	w := adminUsersRequest(token)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d. Body: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	if !strings.Contains(w.Body.String(), `"roleadmin"`) || strings.Contains(w.Body.String(), "password") {
+		t.Errorf("Expected user list without password hashes, got %s", w.Body.String())
+	}
+}
+
+func TestRequireRole_NormalUserAndAPIKey_Forbidden(t *testing.T) {
+	token := loginTestUser(t, "rolenormal", "password123")
+
+	w := adminUsersRequest(token)
+	if w.Code != http.StatusForbidden {
+		t.Errorf("Expected status %d for normal user, got %d", http.StatusForbidden, w.Code)
+	}
+
+	// An admin's API key doesn't carry the admin role
+	if _, err := internal.UserService.EnsureAdmin("rolekeyadmin", "password123"); err != nil {
+		t.Fatalf("Failed to create admin: %v", err)
+	}
+	adminToken, _ := loginExistingUser(t, "rolekeyadmin", "password123")
+	key, _ := createTestAPIKey(t, adminToken, []string{common.ScopeFilesRead})
+
+	w = adminUsersRequest(key)
+	if w.Code != http.StatusForbidden {
+		t.Errorf("Expected status %d for API key, got %d", http.StatusForbidden, w.Code)
+	}
+}
+
+func TestHandleAdminUserRole_Promote_NewTokenIsAdmin(t *testing.T) {
+	if _, err := internal.UserService.EnsureAdmin("rolepromoter", "password123"); err != nil {
+		t.Fatalf("Failed to create admin: %v", err)
+	}
+	adminToken, _ := loginExistingUser(t, "rolepromoter", "password123")
+
+	registerUser(t, "rolepromoted", "password123")
+	user, err := internal.UserService.GetUserByUsername("rolepromoted")
+	if err != nil || user == nil {
+		t.Fatalf("Failed to load user: %v", err)
+	}
+	if user.Role != models.RoleUser {
+		t.Errorf("Expected default role '%s', got '%s'", models.RoleUser, user.Role)
+	}
+
+	// Unknown roles are rejected
+	if w := setRoleRequest(adminToken, user.ID, "superuser"); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d for unknown role, got %d", http.StatusBadRequest, w.Code)
+	}
+
+	// Unknown users are not found
+	if w := setRoleRequest(adminToken, 999999, models.RoleAdmin); w.Code != http.StatusNotFound {
+		t.Errorf("Expected status %d for unknown user, got %d", http.StatusNotFound, w.Code)
+	}
+
+	if w := setRoleRequest(adminToken, user.ID, models.RoleAdmin); w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d. Body: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+
+	// The role is picked up by new tokens
+	token, _ := loginExistingUser(t, "rolepromoted", "password123")
+	if w := adminUsersRequest(token); w.Code != http.StatusOK {
+		t.Errorf("Expected promoted user to access admin routes, got %d", w.Code)
+	}
+}
+
+func TestHandleAdminUserRole_Demote_TokenLosesAdminRights(t *testing.T) {
+	if _, err := internal.UserService.EnsureAdmin("roledemoted", "password123"); err != nil {
+		t.Fatalf("Failed to create admin: %v", err)
+	}
+	token, _ := loginExistingUser(t, "roledemoted", "password123")
+	if w := adminUsersRequest(token); w.Code != http.StatusOK {
+		t.Fatalf("Expected admin to access admin routes, got %d", w.Code)
+	}
+
+	user, _ := internal.UserService.GetUserByUsername("roledemoted")
+	if err := internal.UserService.SetUserRole(user.ID, models.RoleUser); err != nil {
+		t.Fatalf("Failed to demote user: %v", err)
+	}
+
+	// The token still carries the admin role claim, the current role of the user is what counts
+	if w := adminUsersRequest(token); w.Code != http.StatusForbidden {
+		t.Errorf("Expected demoted admin's token to be forbidden, got %d", w.Code)
+	}
+}
+
+func adminUsersRequest(token string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, "/api/admin/users", nil)
+	req.Header.Set(common.HeaderAuthorization, "Bearer "+token)
+	w := httptest.NewRecorder()
+	middleware.AuthUser(middleware.RequireRole(models.RoleAdmin, handler.HandleAdminUsers))(w, req)
+	return w
+}
+
+func setRoleRequest(token string, userID int, role string) *httptest.ResponseRecorder {
+	body, _ := json.Marshal(transfer.SetRoleRequest{Role: role})
+	id := strconv.Itoa(userID)
+	req := httptest.NewRequest(http.MethodPut, "/api/admin/users/"+id+"/role", bytes.NewReader(body))
+	req.SetPathValue("id", id)
+	req.Header.Set(common.HeaderAuthorization, "Bearer "+token)
+	w := httptest.NewRecorder()
+	middleware.AuthUser(middleware.RequireRole(models.RoleAdmin, handler.HandleAdminUserRole))(w, req)
+	return w
+}
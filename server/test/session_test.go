@@ -0,0 +1,210 @@
+package test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"elotuschallenge/common"
+	"elotuschallenge/handler"
+	"elotuschallenge/middleware"
+	"elotuschallenge/transfer"
+)
+
+func TestHandleLogin_UseCookies_SetsSessionAndCSRFCookies(t *testing.T) {
+	registerUser(t, "sessionuser", "password123")
+
+	w := cookieLogin(t, "sessionuser", "password123")
+
+	session, csrf := sessionCookies(t, w)
+	if !session.HttpOnly || !session.Secure || session.SameSite != http.SameSiteStrictMode {
+		t.Errorf("Expected HttpOnly, Secure and SameSite=Strict session cookie, got %+v", session)
+	}
+	if csrf.HttpOnly {
+		t.Error("Expected CSRF cookie to be readable by scripts")
+	}
+
+	var response transfer.APIResponse
+	json.NewDecoder(w.Body).Decode(&response)
+	authMap := response.Data.(map[string]interface{})["auth"].(map[string]interface{})
+	if _, ok := authMap["token"]; ok {
+		t.Error("Expected no token in the body of a cookie login")
+	}
+	if _, ok := authMap["refresh_token"]; ok {
+		t.Error("Expected no refresh token in the body of a cookie login")
+	}
+	if authMap["csrf_token"] != csrf.Value {
+		t.Errorf("Expected CSRF token %q in body, got %v", csrf.Value, authMap["csrf_token"])
+	}
+}
+
+func TestAuthUser_SessionCookie_SafeMethodWithoutCSRF(t *testing.T) {
+	registerUser(t, "sessionget", "password123")
+	session, _ := sessionCookies(t, cookieLogin(t, "sessionget", "password123"))
+
+	req := httptest.NewRequest(http.MethodGet, "/protected", nil)
+	req.AddCookie(session)
+	w := httptest.NewRecorder()
+
+	var authMethod string
+	middleware.AuthUser(func(w http.ResponseWriter, r *http.Request) {
+		if principal, ok := middleware.GetPrincipal(r); ok {
+			authMethod = principal.AuthMethod
+		}
+		w.WriteHeader(http.StatusOK)
+	})(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d. Body: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	if authMethod != common.AuthMethodCookie {
+		t.Errorf("Expected auth method %q, got %q", common.AuthMethodCookie, authMethod)
+	}
+}
+
+func TestAuthUser_SessionCookie_StateChangingRequiresCSRF(t *testing.T) {
+	registerUser(t, "sessioncsrf", "password123")
+	session, csrf := sessionCookies(t, cookieLogin(t, "sessioncsrf", "password123"))
+
+	tests := []struct {
+		name       string
+		header     string
+		cookie     *http.Cookie
+		wantStatus int
+	}{
+		{"missing header", "", csrf, http.StatusForbidden},
+		{"missing cookie", csrf.Value, nil, http.StatusForbidden},
+		{"mismatched header", "forged", csrf, http.StatusForbidden},
+		{"token of another session", "forged", &http.Cookie{Name: common.CookieCSRF, Value: "forged"}, http.StatusForbidden},
+		{"matching header", csrf.Value, csrf, http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/protected", nil)
+			req.AddCookie(session)
+			if tt.cookie != nil {
+				req.AddCookie(tt.cookie)
+			}
+			if tt.header != "" {
+				req.Header.Set(common.HeaderCSRFToken, tt.header)
+			}
+			w := httptest.NewRecorder()
+
+			middleware.AuthUser(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusOK)
+			})(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Errorf("Expected status %d, got %d. Body: %s", tt.wantStatus, w.Code, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestAuthUser_AuthorizationHeader_NoCSRFRequired(t *testing.T) {
+	token := loginTestUser(t, "sessionbearer", "password123")
+
+	req := httptest.NewRequest(http.MethodPost, "/protected", nil)
+	req.Header.Set(common.HeaderAuthorization, "Bearer "+token)
+	w := httptest.NewRecorder()
+
+	middleware.AuthUser(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected status %d, got %d. Body: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+}
+
+func TestHandleLogout_SessionCookie_RevokesAndClearsCookies(t *testing.T) {
+	registerUser(t, "sessionlogout", "password123")
+	session, csrf := sessionCookies(t, cookieLogin(t, "sessionlogout", "password123"))
+
+	req := httptest.NewRequest(http.MethodPost, "/api/logout", nil)
+	req.AddCookie(session)
+	req.AddCookie(csrf)
+	req.Header.Set(common.HeaderCSRFToken, csrf.Value)
+	w := httptest.NewRecorder()
+
+	middleware.AuthUser(handler.HandleLogout)(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d. Body: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	for _, cookie := range w.Result().Cookies() {
+		if cookie.MaxAge >= 0 {
+			t.Errorf("Expected cookie %q to be cleared, got MaxAge %d", cookie.Name, cookie.MaxAge)
+		}
+	}
+
+	// The revoked session cookie must not be accepted anymore
+	req = httptest.NewRequest(http.MethodGet, "/protected", nil)
+	req.AddCookie(session)
+	w = httptest.NewRecorder()
+
+	middleware.AuthUser(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("Handler should not be called with revoked session")
+	})(w, req)
+
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status %d, got %d", http.StatusUnauthorized, w.Code)
+	}
+}
+
+func TestHandleChangePassword_SessionCookie_ReissuesCookies(t *testing.T) {
+	registerUser(t, "sessionpassword", "password123")
+	session, csrf := sessionCookies(t, cookieLogin(t, "sessionpassword", "password123"))
+
+	body, _ := json.Marshal(transfer.ChangePasswordRequest{CurrentPassword: "password123", NewPassword: "newpassword123"})
+	req := httptest.NewRequest(http.MethodPost, "/api/password", bytes.NewReader(body))
+	req.AddCookie(session)
+	req.AddCookie(csrf)
+	req.Header.Set(common.HeaderCSRFToken, csrf.Value)
+	w := httptest.NewRecorder()
+
+	middleware.AuthUser(handler.HandleChangePassword)(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d. Body: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	newSession, _ := sessionCookies(t, w)
+	if newSession.Value == session.Value {
+		t.Error("Expected a new session cookie after the password change")
+	}
+}
+
+// cookieLogin signs in asking for a session cookie instead of tokens
+func cookieLogin(t *testing.T, username, password string) *httptest.ResponseRecorder {
+	body, _ := json.Marshal(transfer.LoginRequest{Username: username, Password: password, UseCookies: true})
+	req := httptest.NewRequest(http.MethodPost, "/api/login", bytes.NewReader(body))
+	req.Header.Set(common.HeaderContentType, common.HeaderValueContentTypeJSON)
+	w := httptest.NewRecorder()
+
+	handler.HandleLogin(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Failed to login with cookies: %s", w.Body.String())
+	}
+	return w
+}
+
+// sessionCookies returns the session and CSRF cookies set by a response
+func sessionCookies(t *testing.T, w *httptest.ResponseRecorder) (*http.Cookie, *http.Cookie) {
+	var session, csrf *http.Cookie
+	for _, cookie := range w.Result().Cookies() {
+		switch cookie.Name {
+		case common.CookieSession:
+			session = cookie
+		case common.CookieCSRF:
+			csrf = cookie
+		}
+	}
+	if session == nil || csrf == nil {
+		t.Fatalf("Expected session and CSRF cookies, got %v", w.Result().Cookies())
+	}
+	return session, csrf
+}
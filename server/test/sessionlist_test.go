@@ -0,0 +1,226 @@
+package test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"elotuschallenge/common"
+	"elotuschallenge/handler"
+	"elotuschallenge/internal"
+	"elotuschallenge/middleware"
+	"elotuschallenge/repository"
+	"elotuschallenge/transfer"
+)
+
+func TestHandleSessions_ListsSessionsOfUser(t *testing.T) {
+	registerUser(t, "sessionlister", "password123")
+	laptopToken, _ := loginWithUserAgent(t, "sessionlister", "password123", "Laptop/1.0")
+	loginWithUserAgent(t, "sessionlister", "password123", "Phone/2.0")
+	loginTestUser(t, "sessionother", "password123")
+
+	w := sessionsRequest(http.MethodGet, laptopToken)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d. Body: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	sessions := decodeSessions(t, w)
+	if len(sessions) != 2 {
+		t.Fatalf("Expected 2 sessions, got %+v", sessions)
+	}
+
+	claims, _ := internal.TokenManager.ValidateToken(laptopToken)
+	userAgents := map[string]bool{}
+	for _, session := range sessions {
+		userAgents[session.UserAgent] = true
+		if session.Current != (session.ID == claims.SessionID) {
+			t.Errorf("Expected only the session of the token to be current, got %+v", session)
+		}
+		if session.IPAddress == "" || session.CreatedAt.IsZero() || session.LastSeenAt.IsZero() {
+			t.Errorf("Expected client and times to be recorded, got %+v", session)
+		}
+	}
+	if !userAgents["Laptop/1.0"] || !userAgents["Phone/2.0"] {
+		t.Errorf("Expected user agents of both logins, got %v", userAgents)
+	}
+}
+
+func TestHandleSession_Revoke_SignsOutSession(t *testing.T) {
+	registerUser(t, "sessionrevoker", "password123")
+	keptToken, _ := loginExistingUser(t, "sessionrevoker", "password123")
+	lostToken, lostRefreshToken := loginExistingUser(t, "sessionrevoker", "password123")
+	lostClaims, _ := internal.TokenManager.ValidateToken(lostToken)
+
+	w := revokeSessionRequest(keptToken, lostClaims.SessionID)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d. Body: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	if w := authorizedRequest(lostToken); w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected token of revoked session to be rejected, got %d", w.Code)
+	}
+	if w := refreshRequest(lostRefreshToken); w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected refresh token of revoked session to be rejected, got %d", w.Code)
+	}
+	if w := authorizedRequest(keptToken); w.Code != http.StatusOK {
+		t.Errorf("Expected other session to stay signed in, got %d", w.Code)
+	}
+	if sessions := decodeSessions(t, sessionsRequest(http.MethodGet, keptToken)); len(sessions) != 1 || !sessions[0].Current {
+		t.Errorf("Expected only the current session left, got %+v", sessions)
+	}
+}
+
+func TestHandleSession_OtherUsersSession_NotFound(t *testing.T) {
+	token := loginTestUser(t, "sessionsnooper", "password123")
+	victimToken := loginTestUser(t, "sessionvictim", "password123")
+	victimClaims, _ := internal.TokenManager.ValidateToken(victimToken)
+
+	w := revokeSessionRequest(token, victimClaims.SessionID)
+
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected status %d, got %d", http.StatusNotFound, w.Code)
+	}
+	if w := authorizedRequest(victimToken); w.Code != http.StatusOK {
+		t.Errorf("Expected session of the other user to stay signed in, got %d", w.Code)
+	}
+}
+
+func TestHandleSessions_RevokeAll_SignsOutEverySession(t *testing.T) {
+	registerUser(t, "sessionrevokeall", "password123")
+	firstToken, firstRefreshToken := loginExistingUser(t, "sessionrevokeall", "password123")
+	secondToken, _ := loginExistingUser(t, "sessionrevokeall", "password123")
+
+	w := sessionsRequest(http.MethodDelete, firstToken)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d. Body: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	for _, token := range []string{firstToken, secondToken} {
+		if w := authorizedRequest(token); w.Code != http.StatusUnauthorized {
+			t.Errorf("Expected token to be rejected, got %d", w.Code)
+		}
+	}
+	if w := refreshRequest(firstRefreshToken); w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected refresh token to be rejected, got %d", w.Code)
+	}
+
+	// Signing in again starts a fresh session
+	token, _ := loginExistingUser(t, "sessionrevokeall", "password123")
+	if sessions := decodeSessions(t, sessionsRequest(http.MethodGet, token)); len(sessions) != 1 {
+		t.Errorf("Expected only the new session, got %+v", sessions)
+	}
+}
+
+func TestHandleRefreshToken_KeepsSession(t *testing.T) {
+	registerUser(t, "sessionrefresher", "password123")
+	otherToken, _ := loginExistingUser(t, "sessionrefresher", "password123")
+	token, refreshToken := loginExistingUser(t, "sessionrefresher", "password123")
+	claims, _ := internal.TokenManager.ValidateToken(token)
+
+	w := refreshRequest(refreshToken)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Failed to refresh: %s", w.Body.String())
+	}
+	newToken, _ := parseLoginTokens(t, w)
+	newClaims, _ := internal.TokenManager.ValidateToken(newToken)
+
+	if newClaims.SessionID != claims.SessionID {
+		t.Errorf("Expected refreshed token in session %s, got %s", claims.SessionID, newClaims.SessionID)
+	}
+	// A session is one row per login, it records the latest token instead of a row per token
+	if sessions := decodeSessions(t, sessionsRequest(http.MethodGet, newToken)); len(sessions) != 2 {
+		t.Errorf("Expected refresh to keep one session per login, got %+v", sessions)
+	}
+	session, err := repository.NewSQLiteSessionRepository().GetSession(claims.SessionID)
+	if err != nil || session == nil || session.TokenID != newClaims.ID {
+		t.Errorf("Expected the session to record the refreshed token %s, got %+v", newClaims.ID, session)
+	}
+
+	// Revoking the session rejects every token issued in it, not only the latest
+	if w := authorizedRequest(token); w.Code != http.StatusOK {
+		t.Errorf("Expected the earlier token of the session to stay valid, got %d", w.Code)
+	}
+	if w := revokeSessionRequest(otherToken, claims.SessionID); w.Code != http.StatusOK {
+		t.Fatalf("Failed to revoke session: %s", w.Body.String())
+	}
+	for _, revoked := range []string{token, newToken} {
+		if w := authorizedRequest(revoked); w.Code != http.StatusUnauthorized {
+			t.Errorf("Expected token of the revoked session to be rejected, got %d", w.Code)
+		}
+	}
+}
+
+func TestHandleLogout_EndsSession(t *testing.T) {
+	registerUser(t, "sessionsignout", "password123")
+	keptToken, _ := loginExistingUser(t, "sessionsignout", "password123")
+	loggedOutToken, _ := loginExistingUser(t, "sessionsignout", "password123")
+
+	req := httptest.NewRequest(http.MethodPost, "/api/logout", nil)
+	req.Header.Set(common.HeaderAuthorization, "Bearer "+loggedOutToken)
+	w := httptest.NewRecorder()
+	middleware.AuthUser(handler.HandleLogout)(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Failed to logout: %s", w.Body.String())
+	}
+
+	if sessions := decodeSessions(t, sessionsRequest(http.MethodGet, keptToken)); len(sessions) != 1 || !sessions[0].Current {
+		t.Errorf("Expected logged out session to be gone, got %+v", sessions)
+	}
+}
+
+func TestHandleSessions_APIKey_Forbidden(t *testing.T) {
+	token := loginTestUser(t, "sessionkeyuser", "password123")
+	apiKey, _ := createTestAPIKey(t, token, []string{common.ScopeFilesRead})
+
+	w := sessionsRequest(http.MethodGet, apiKey)
+
+	if w.Code != http.StatusForbidden {
+		t.Errorf("Expected status %d, got %d", http.StatusForbidden, w.Code)
+	}
+}
+
+// loginWithUserAgent logs in an already registered user from a client with the given user agent
+func loginWithUserAgent(t *testing.T, username, password, userAgent string) (string, string) {
+	body, _ := json.Marshal(transfer.LoginRequest{Username: username, Password: password})
+	req := httptest.NewRequest(http.MethodPost, "/api/login", bytes.NewReader(body))
+	req.Header.Set(common.HeaderContentType, common.HeaderValueContentTypeJSON)
+	req.Header.Set(common.HeaderUserAgent, userAgent)
+	w := httptest.NewRecorder()
+
+	handler.HandleLogin(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Failed to login test user: %s", w.Body.String())
+	}
+	return parseLoginTokens(t, w)
+}
+
+func sessionsRequest(method, token string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, "/api/sessions", nil)
+	req.Header.Set(common.HeaderAuthorization, "Bearer "+token)
+	w := httptest.NewRecorder()
+	middleware.AuthUser(handler.HandleSessions)(w, req)
+	return w
+}
+
+func revokeSessionRequest(token, sessionID string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodDelete, "/api/sessions/"+sessionID, nil)
+	req.SetPathValue("id", sessionID)
+	req.Header.Set(common.HeaderAuthorization, "Bearer "+token)
+	w := httptest.NewRecorder()
+	middleware.AuthUser(handler.HandleSession)(w, req)
+	return w
+}
+
+func decodeSessions(t *testing.T, w *httptest.ResponseRecorder) []transfer.SessionInfo {
+	t.Helper()
+	var response struct {
+		Data transfer.SessionListData `json:"data"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	return response.Data.Sessions
+}
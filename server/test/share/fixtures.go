@@ -2,6 +2,7 @@ package share
 
 import (
 	"elotuschallenge/models"
+	"elotuschallenge/repository"
 	"elotuschallenge/services"
 	"fmt"
 	"time"
@@ -29,5 +30,8 @@ func CreateTestUsers(count int) []*models.User {
 
 // CreateTestJWTService creates a JWT service for testing
 func CreateTestJWTService() services.ITokenManager {
-	return services.NewTokenManager("test-secret-key", 24*60*60) // 24 hours expiration
+	return services.NewTokenManager(services.NewStaticKeyring("test-secret-key"), services.TokenManagerConfig{
+		ExpirationSeconds: 24 * 60 * 60, // 24 hours expiration
+		Issuer:            "elotus-challenge-test",
+	}, repository.NewSQLiteRevokedTokenRepository())
 }
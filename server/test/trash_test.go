@@ -0,0 +1,170 @@
+package test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"elotuschallenge/common"
+	"elotuschallenge/database"
+	"elotuschallenge/handler"
+	"elotuschallenge/internal"
+	"elotuschallenge/middleware"
+	"elotuschallenge/models"
+)
+
+func TestTrash_TrashAndRestore(t *testing.T) {
+	token := loginTestUser(t, "trashuser", "password123")
+	file := saveTestFile(t, token, "trashed.png", downloadContent)
+
+	if w := fileChangeRequest(token, http.MethodDelete, "/api/files/", file.ID, handler.HandleFile); w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d. Body: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+
+	// Trashed files leave the listing and can't be downloaded, but stay in storage
+	if files := listFiles(t, token, nil).Files; len(files) != 0 {
+		t.Errorf("Expected no files outside the trash, got %d", len(files))
+	}
+	trash := trashList(t, token)
+	if len(trash) != 1 || trash[0].ID != file.ID || trash[0].DeletedAt == nil {
+		t.Fatalf("Expected the file with deleted_at in the trash, got %+v", trash)
+	}
+	if w := fileContentRequest(t, token, file.ID, nil); w.Code != http.StatusNotFound {
+		t.Errorf("Expected status %d downloading a trashed file, got %d", http.StatusNotFound, w.Code)
+	}
+	if !fileStored(t, file) {
+		t.Error("Expected trashed file to stay in storage")
+	}
+
+	// Trashing twice finds nothing to trash
+	if w := fileChangeRequest(token, http.MethodDelete, "/api/files/", file.ID, handler.HandleFile); w.Code != http.StatusNotFound {
+		t.Errorf("Expected status %d trashing again, got %d", http.StatusNotFound, w.Code)
+	}
+
+	if w := fileChangeRequest(token, http.MethodPost, "/api/trash/", file.ID, handler.HandleTrashRestore); w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d restoring, got %d. Body: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	if files := listFiles(t, token, nil).Files; len(files) != 1 || files[0].DeletedAt != nil {
+		t.Errorf("Expected the restored file to be listed, got %+v", files)
+	}
+	if len(trashList(t, token)) != 0 {
+		t.Error("Expected empty trash after restoring")
+	}
+	if w := fileContentRequest(t, token, file.ID, nil); w.Code != http.StatusOK {
+		t.Errorf("Expected status %d downloading a restored file, got %d", http.StatusOK, w.Code)
+	}
+}
+
+func TestTrash_PermanentDelete_RemovesContent(t *testing.T) {
+	token := loginTestUser(t, "trashdeleter", "password123")
+	// Content shared with other files would stay in storage
+	file := saveTestFile(t, token, "gone.png", []byte("trashdeleter content"))
+
+	// Files are deleted permanently from the trash only
+	if w := fileChangeRequest(token, http.MethodDelete, "/api/trash/", file.ID, handler.HandleTrashedFile); w.Code != http.StatusNotFound {
+		t.Errorf("Expected status %d deleting a file outside the trash, got %d", http.StatusNotFound, w.Code)
+	}
+
+	fileChangeRequest(token, http.MethodDelete, "/api/files/", file.ID, handler.HandleFile)
+	if w := fileChangeRequest(token, http.MethodDelete, "/api/trash/", file.ID, handler.HandleTrashedFile); w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d. Body: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+
+	if fileStored(t, file) {
+		t.Error("Expected file content to be removed")
+	}
+	if metadata, _ := internal.FileService.GetFileByID(file.ID); metadata != nil {
+		t.Error("Expected file metadata to be deleted")
+	}
+	if w := fileChangeRequest(token, http.MethodPost, "/api/trash/", file.ID, handler.HandleTrashRestore); w.Code != http.StatusNotFound {
+		t.Errorf("Expected status %d restoring a deleted file, got %d", http.StatusNotFound, w.Code)
+	}
+}
+
+func TestTrash_PurgeAfterRetention(t *testing.T) {
+	token := loginTestUser(t, "trashpurger", "password123")
+	expired := saveTestFile(t, token, "expired.png", []byte("trashpurger content"))
+	recent := saveTestFile(t, token, "recent.png", downloadContent)
+	kept := saveTestFile(t, token, "kept.png", downloadContent)
+
+	fileChangeRequest(token, http.MethodDelete, "/api/files/", expired.ID, handler.HandleFile)
+	fileChangeRequest(token, http.MethodDelete, "/api/files/", recent.ID, handler.HandleFile)
+	if _, err := database.DB.Exec("UPDATE files SET deleted_at = ? WHERE id = ?", "2000-01-01 00:00:00", expired.ID); err != nil {
+		t.Fatalf("Failed to backdate trashed file: %v", err)
+	}
+
+	purged, err := internal.FileService.PurgeTrash()
+	if err != nil {
+		t.Fatalf("Failed to purge trash: %v", err)
+	}
+	if purged < 1 {
+		t.Errorf("Expected the expired file to be purged, got %d", purged)
+	}
+
+	if metadata, _ := internal.FileService.GetFileByID(expired.ID); metadata != nil {
+		t.Error("Expected expired file metadata to be purged")
+	}
+	if fileStored(t, expired) {
+		t.Error("Expected expired file content to be removed")
+	}
+
+	// Files trashed within the retention period and files in use are kept
+	trash := trashList(t, token)
+	if len(trash) != 1 || trash[0].ID != recent.ID {
+		t.Errorf("Expected only the recently trashed file in the trash, got %+v", trash)
+	}
+	if files := listFiles(t, token, nil).Files; len(files) != 1 || files[0].ID != kept.ID {
+		t.Errorf("Expected the file in use to be kept, got %+v", files)
+	}
+}
+
+func TestTrash_OtherUsersAndScopes(t *testing.T) {
+	ownerToken := loginTestUser(t, "trashowner", "password123")
+	file := saveTestFile(t, ownerToken, "owned.png", downloadContent)
+	otherToken := loginTestUser(t, "trashsnooper", "password123")
+
+	if w := fileChangeRequest(otherToken, http.MethodDelete, "/api/files/", file.ID, handler.HandleFile); w.Code != http.StatusNotFound {
+		t.Errorf("Expected status %d trashing a file of another user, got %d", http.StatusNotFound, w.Code)
+	}
+
+	// Changing files needs files:write
+	readKey, _ := createTestAPIKey(t, ownerToken, []string{common.ScopeFilesRead})
+	if w := fileChangeRequest(readKey, http.MethodDelete, "/api/files/", file.ID, handler.HandleFile); w.Code != http.StatusForbidden {
+		t.Errorf("Expected status %d without files:write, got %d", http.StatusForbidden, w.Code)
+	}
+	writeKey, _ := createTestAPIKey(t, ownerToken, []string{common.ScopeFilesWrite})
+	if w := fileChangeRequest(writeKey, http.MethodDelete, "/api/files/", file.ID, handler.HandleFile); w.Code != http.StatusOK {
+		t.Errorf("Expected status %d with files:write, got %d", http.StatusOK, w.Code)
+	}
+
+	if w := fileChangeRequest(otherToken, http.MethodPost, "/api/trash/", file.ID, handler.HandleTrashRestore); w.Code != http.StatusNotFound {
+		t.Errorf("Expected status %d restoring a file of another user, got %d", http.StatusNotFound, w.Code)
+	}
+	if trash := trashList(t, otherToken); len(trash) != 0 {
+		t.Errorf("Expected no files in the trash of another user, got %d", len(trash))
+	}
+}
+
+// trashList returns the first page of the trash
+func trashList(t *testing.T, token string) []*models.FileMetadata {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodGet, "/api/trash", nil)
+	req.Header.Set(common.HeaderAuthorization, "Bearer "+token)
+	w := httptest.NewRecorder()
+	middleware.AuthUser(handler.HandleTrash)(w, req)
+	return decodeFileList(t, w).Files
+}
+
+func fileChangeRequest(token, method, prefix string, fileID int, handle http.HandlerFunc) *httptest.ResponseRecorder {
+	path := prefix + strconv.Itoa(fileID)
+	if method == http.MethodPost {
+		path += "/restore"
+	}
+	req := httptest.NewRequest(method, path, nil)
+	req.SetPathValue("id", strconv.Itoa(fileID))
+	req.Header.Set(common.HeaderAuthorization, "Bearer "+token)
+	w := httptest.NewRecorder()
+	middleware.AuthUser(handle)(w, req)
+	return w
+}
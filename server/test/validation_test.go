@@ -0,0 +1,218 @@
+package test
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/textproto"
+	"strings"
+	"testing"
+
+	"elotuschallenge/common"
+	"elotuschallenge/handler"
+	"elotuschallenge/middleware"
+	"elotuschallenge/transfer"
+	"elotuschallenge/validation"
+
+	"golang.org/x/image/bmp"
+	"golang.org/x/image/tiff"
+)
+
+const validSVG = `<?xml version="1.0"?><svg xmlns="http://www.w3.org/2000/svg" width="4" height="4"><rect width="4" height="4"/></svg>`
+
+func TestHandleUpload_SniffedImages_StoredWithDetectedType(t *testing.T) {
+	token := loginTestUser(t, "sniffuploader", "password123")
+	pngData := encodeTestImage(t, png.Encode)
+
+	tests := []struct {
+		name     string
+		declared string
+		content  []byte
+		want     string
+	}{
+		{"png", "image/png", pngData, "image/png"},
+		{"no declared type", "", pngData, "image/png"},
+		{"generic declared type", "application/octet-stream", pngData, "image/png"},
+		{"declared type with parameters", "IMAGE/PNG; name=leaf.png", pngData, "image/png"},
+		{"jpeg alias", "image/jpg", encodeTestImage(t, func(w io.Writer, m image.Image) error { return jpeg.Encode(w, m, nil) }), "image/jpeg"},
+		{"gif", "image/gif", encodeTestImage(t, func(w io.Writer, m image.Image) error { return gif.Encode(w, m, nil) }), "image/gif"},
+		{"bmp", "image/bmp", encodeTestImage(t, bmp.Encode), "image/bmp"},
+		{"tiff", "image/tiff", encodeTestImage(t, func(w io.Writer, m image.Image) error { return tiff.Encode(w, m, nil) }), "image/tiff"},
+		{"svg", "image/svg+xml", []byte(validSVG), "image/svg+xml"},
+		{"svg after a comment", "image/svg+xml", []byte(`<!-- Created by an editor --><svg xmlns="http://www.w3.org/2000/svg"/>`), "image/svg+xml"},
+		{"svg root after the sniffed bytes", "", []byte(`<?xml version="1.0"?><!--` + strings.Repeat(" license ", 80) + `--><svg xmlns="http://www.w3.org/2000/svg"/>`), "image/svg+xml"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := imageUploadRequest(token, "image", tt.declared, tt.content)
+			if w.Code != http.StatusCreated {
+				t.Fatalf("Expected status %d, got %d. Body: %s", http.StatusCreated, w.Code, w.Body.String())
+			}
+
+			var response struct {
+				Data transfer.UploadResponse `json:"data"`
+			}
+			if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+			if got := response.Data.FileInfo.ContentType; got != tt.want {
+				t.Errorf("Expected stored type %q, got %q", tt.want, got)
+			}
+			if got := response.Data.FileInfo.Size; got != int64(len(tt.content)) {
+				t.Errorf("Expected the whole content to be stored after validation, got %d of %d bytes", got, len(tt.content))
+			}
+		})
+	}
+}
+
+func TestHandleUpload_InvalidContent_Rejected(t *testing.T) {
+	token := loginTestUser(t, "sniffrejecter", "password123")
+	pngData := encodeTestImage(t, png.Encode)
+
+	tests := []struct {
+		name     string
+		declared string
+		content  []byte
+	}{
+		{"text labelled png", "image/png", []byte("This is not an image")},
+		{"html labelled png", "image/png", []byte("<html><body><svg></svg></body></html>")},
+		{"png labelled jpeg", "image/jpeg", pngData},
+		{"svg labelled png", "image/png", []byte(validSVG)},
+		{"truncated png", "image/png", pngData[:len(pngData)/2]},
+		{"png signature only", "image/png", []byte("\x89PNG\r\n\x1a\n")},
+		{"webp header only", "image/webp", []byte("RIFF\x24\x00\x00\x00WEBPVP8 \x18\x00\x00\x00garbage")},
+		{"svg which isn't xml", "image/svg+xml", []byte(`<svg xmlns="http://www.w3.org/2000/svg"><rect></svg>`)},
+		{"svg inside another root", "image/svg+xml", []byte(`<?xml version="1.0"?><doc><svg xmlns="http://www.w3.org/2000/svg"/></doc>`)},
+		{"text mentioning svg", "image/svg+xml", []byte(`Draw it with <svg> elements`)},
+		{"empty", "image/png", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if w := imageUploadRequest(token, "bad.png", tt.declared, tt.content); w.Code != http.StatusBadRequest {
+				t.Errorf("Expected status %d, got %d. Body: %s", http.StatusBadRequest, w.Code, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestValidationPipeline_ChecksInOrder(t *testing.T) {
+	pngData := encodeTestImage(t, png.Encode)
+
+	// Each check reads the content from the start
+	var seen []string
+	record := func(name string) validation.Check {
+		return func(upload *validation.Upload) error {
+			head := make([]byte, 4)
+			io.ReadFull(upload.Content, head)
+			seen = append(seen, name+":"+string(head[1:4]))
+			return nil
+		}
+	}
+	pipeline := validation.NewPipeline(record("first"), validation.SniffContentType(validation.ImageContentTypes), record("second"))
+
+	upload := &validation.Upload{Content: bytes.NewReader(pngData), Size: int64(len(pngData))}
+	if err := pipeline.Validate(upload); err != nil {
+		t.Fatalf("Expected valid upload, got %v", err)
+	}
+	if want := []string{"first:PNG", "second:PNG"}; len(seen) != 2 || seen[0] != want[0] || seen[1] != want[1] {
+		t.Errorf("Expected checks %v, got %v", want, seen)
+	}
+	if upload.DetectedType != validation.ContentTypePNG {
+		t.Errorf("Expected detected type to be recorded, got %q", upload.DetectedType)
+	}
+	if position, _ := upload.Content.Seek(0, io.SeekCurrent); position != 0 {
+		t.Errorf("Expected content rewound after validation, at %d", position)
+	}
+
+	// Checks after a failing one don't run
+	seen = nil
+	failing := func(upload *validation.Upload) error { return common.ErrFileContentType }
+	err := validation.NewPipeline(failing, record("after")).Validate(&validation.Upload{Content: bytes.NewReader(pngData)})
+	if !errors.Is(err, common.ErrFileContentType) || len(seen) != 0 {
+		t.Errorf("Expected the pipeline to stop at the failing check, got %v after running %v", err, seen)
+	}
+}
+
+func TestValidationPipeline_DecodeImage_MaxPixels(t *testing.T) {
+	pngData := encodeTestImage(t, png.Encode) // 4x4
+
+	for maxPixels, valid := range map[int]bool{16: true, 15: false} {
+		pipeline := validation.NewPipeline(validation.SniffContentType(validation.ImageContentTypes), validation.DecodeImage(maxPixels, 1))
+		err := pipeline.Validate(&validation.Upload{Content: bytes.NewReader(pngData), Size: int64(len(pngData))})
+		if valid && err != nil {
+			t.Errorf("Expected a 4x4 image to be valid with %d pixels, got %v", maxPixels, err)
+		}
+		if !valid && !errors.Is(err, common.ErrInvalidImage) {
+			t.Errorf("Expected a 4x4 image to be rejected with %d pixels, got %v", maxPixels, err)
+		}
+	}
+}
+
+func TestValidationPipeline_DecodeImage_16BitImagesCountTwice(t *testing.T) {
+	var buffer bytes.Buffer
+	if err := png.Encode(&buffer, image.NewRGBA64(image.Rect(0, 0, 4, 4))); err != nil {
+		t.Fatalf("Failed to encode test image: %v", err)
+	}
+	pngData := buffer.Bytes()
+
+	// A 4x4 image of 16-bit channels decodes to as many bytes as 32 pixels of 8-bit RGBA
+	for maxPixels, valid := range map[int]bool{32: true, 16: false} {
+		pipeline := validation.NewPipeline(validation.SniffContentType(validation.ImageContentTypes), validation.DecodeImage(maxPixels, 1))
+		err := pipeline.Validate(&validation.Upload{Content: bytes.NewReader(pngData), Size: int64(len(pngData))})
+		if valid && err != nil {
+			t.Errorf("Expected a 16-bit 4x4 image to be valid with %d pixels, got %v", maxPixels, err)
+		}
+		if !valid && !errors.Is(err, common.ErrInvalidImage) {
+			t.Errorf("Expected a 16-bit 4x4 image to be rejected with %d pixels, got %v", maxPixels, err)
+		}
+	}
+}
+
+// encodeTestImage encodes a 4x4 gradient with the encoder
+func encodeTestImage(t *testing.T, encode func(io.Writer, image.Image) error) []byte {
+	t.Helper()
+	img := image.NewRGBA(image.Rect(0, 0, 4, 4))
+	for x := 0; x < 4; x++ {
+		for y := 0; y < 4; y++ {
+			img.Set(x, y, color.RGBA{R: uint8(x * 60), G: uint8(y * 60), B: 128, A: 255})
+		}
+	}
+
+	var buffer bytes.Buffer
+	if err := encode(&buffer, img); err != nil {
+		t.Fatalf("Failed to encode test image: %v", err)
+	}
+	return buffer.Bytes()
+}
+
+// imageUploadRequest uploads content declared with the content type, no Content-Type is sent when it is empty
+func imageUploadRequest(token, filename, declaredType string, content []byte) *httptest.ResponseRecorder {
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	partHeader := textproto.MIMEHeader{}
+	partHeader.Set("Content-Disposition", `form-data; name="data"; filename="`+filename+`"`)
+	if declaredType != "" {
+		partHeader.Set(common.HeaderContentType, declaredType)
+	}
+	part, _ := writer.CreatePart(partHeader)
+	part.Write(content)
+	writer.Close()
+
+	req := httptest.NewRequest(http.MethodPost, "/upload", &body)
+	req.Header.Set(common.HeaderContentType, writer.FormDataContentType())
+	req.Header.Set(common.HeaderAuthorization, "Bearer "+token)
+	w := httptest.NewRecorder()
+	middleware.AuthUser(handler.HandleUpload)(w, req)
+	return w
+}
@@ -0,0 +1,143 @@
+package test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"elotuschallenge/common"
+	"elotuschallenge/handler"
+	"elotuschallenge/internal"
+	"elotuschallenge/middleware"
+	"elotuschallenge/models"
+	"elotuschallenge/repository"
+	"elotuschallenge/services"
+	"elotuschallenge/transfer"
+)
+
+func TestVerification_PendingAccount_ActivatedWithToken(t *testing.T) {
+	requireVerification(t)
+	registerUser(t, "verifypending", "password123")
+
+	// Pending accounts can't sign in, even with the right password
+	w := loginFromIP("verifypending", "password123", "198.51.100.80")
+	assertErrorCode(t, w, http.StatusForbidden, common.ErrCodeAccountPending)
+
+	// A wrong password doesn't reveal the status
+	if w := loginFromIP("verifypending", "wrongpassword", "198.51.100.80"); w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status %d for wrong password, got %d", http.StatusUnauthorized, w.Code)
+	}
+
+	token := latestNotificationToken(t, "verifypending", models.NotificationVerifyAccount)
+	if w := verifyAccountRequest(token); w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d. Body: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+
+	// The token is single-use
+	if w := verifyAccountRequest(token); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected used token to be rejected, got %d", w.Code)
+	}
+	if w := loginFromIP("verifypending", "password123", "198.51.100.80"); w.Code != http.StatusOK {
+		t.Errorf("Expected verified account to sign in, got %d", w.Code)
+	}
+}
+
+func TestVerification_Resend_ReplacesToken(t *testing.T) {
+	requireVerification(t)
+	registerUser(t, "verifyresend", "password123")
+	firstToken := latestNotificationToken(t, "verifyresend", models.NotificationVerifyAccount)
+
+	body, _ := json.Marshal(transfer.ResendVerificationRequest{Username: "verifyresend"})
+	req := httptest.NewRequest(http.MethodPost, "/api/verify/resend", bytes.NewReader(body))
+	w := httptest.NewRecorder()
+	handler.HandleResendVerification(w, req)
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("Expected status %d, got %d", http.StatusAccepted, w.Code)
+	}
+
+	if w := verifyAccountRequest(firstToken); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected replaced token to be rejected, got %d", w.Code)
+	}
+	secondToken := latestNotificationToken(t, "verifyresend", models.NotificationVerifyAccount)
+	if w := verifyAccountRequest(secondToken); w.Code != http.StatusOK {
+		t.Errorf("Expected new token to be accepted, got %d", w.Code)
+	}
+}
+
+func TestAccountStatus_Disabled_TokensAndKeysRejected(t *testing.T) {
+	token, refreshToken := loginTestUserTokens(t, "statusdisabled", "password123")
+	key, _ := createTestAPIKey(t, token, []string{common.ScopeFilesWrite})
+
+	if _, err := internal.UserService.EnsureAdmin("statusadmin", "password123"); err != nil {
+		t.Fatalf("Failed to create admin: %v", err)
+	}
+	adminToken, _ := loginExistingUser(t, "statusadmin", "password123")
+	user, _ := internal.UserService.GetUserByUsername("statusdisabled")
+
+	id := strconv.Itoa(user.ID)
+	body, _ := json.Marshal(transfer.SetStatusRequest{Status: models.StatusDisabled})
+	req := httptest.NewRequest(http.MethodPut, "/api/admin/users/"+id+"/status", bytes.NewReader(body))
+	req.SetPathValue("id", id)
+	req.Header.Set(common.HeaderAuthorization, "Bearer "+adminToken)
+	w := httptest.NewRecorder()
+	middleware.AuthUser(middleware.RequireRole(models.RoleAdmin, handler.HandleAdminUserStatus))(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d. Body: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+
+	assertErrorCode(t, authorizedRequest(token), http.StatusForbidden, common.ErrCodeAccountDisabled)
+	assertErrorCode(t, authorizedRequest(key), http.StatusForbidden, common.ErrCodeAccountDisabled)
+	assertErrorCode(t, refreshRequest(refreshToken), http.StatusForbidden, common.ErrCodeAccountDisabled)
+	assertErrorCode(t, loginFromIP("statusdisabled", "password123", "198.51.100.81"), http.StatusForbidden, common.ErrCodeAccountDisabled)
+}
+
+// requireVerification makes new accounts pending for the duration of the test
+func requireVerification(t *testing.T) {
+	t.Helper()
+	hasher := mustPasswordHasher(t, services.PasswordHasherConfig{Algorithm: services.HashAlgorithmArgon2id, Argon2id: services.DefaultArgon2idParams})
+	previous := internal.UserService
+	internal.UserService = services.NewUserService(repository.NewSQLiteUserRepository(), hasher, true)
+	t.Cleanup(func() { internal.UserService = previous })
+}
+
+func verifyAccountRequest(token string) *httptest.ResponseRecorder {
+	body, _ := json.Marshal(transfer.VerifyAccountRequest{Token: token})
+	req := httptest.NewRequest(http.MethodPost, "/api/verify", bytes.NewReader(body))
+	w := httptest.NewRecorder()
+	handler.HandleVerifyAccount(w, req)
+	return w
+}
+
+// latestNotificationToken reads the token on the last line of the latest notification of the kind
+func latestNotificationToken(t *testing.T, username, kind string) string {
+	t.Helper()
+	notifications, err := repository.NewSQLiteOutboxRepository().GetNotificationsByRecipient(username)
+	if err != nil {
+		t.Fatalf("Failed to read outbox: %v", err)
+	}
+	for i := len(notifications) - 1; i >= 0; i-- {
+		if notifications[i].Kind == kind {
+			lines := strings.Split(strings.TrimSpace(notifications[i].Body), "\n")
+			return lines[len(lines)-1]
+		}
+	}
+	t.Fatalf("No %s notification for %s", kind, username)
+	return ""
+}
+
+func assertErrorCode(t *testing.T, w *httptest.ResponseRecorder, status int, code string) {
+	t.Helper()
+	if w.Code != status {
+		t.Errorf("Expected status %d, got %d. Body: %s", status, w.Code, w.Body.String())
+		return
+	}
+	var response transfer.APIResponse
+	json.NewDecoder(w.Body).Decode(&response)
+	if response.Code != code {
+		t.Errorf("Expected error code '%s', got '%s'", code, response.Code)
+	}
+}
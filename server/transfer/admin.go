@@ -0,0 +1,18 @@
+package transfer
+
+import "elotuschallenge/models"
+
+// UserListData contains the users of the system
+type UserListData struct {
+	Users []*models.User `json:"users"`
+}
+
+// SetRoleRequest represents the role change request payload
+type SetRoleRequest struct {
+	Role string `json:"role"`
+}
+
+// SetStatusRequest represents the account status change request payload
+type SetStatusRequest struct {
+	Status string `json:"status"`
+}
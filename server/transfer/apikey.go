@@ -0,0 +1,22 @@
+package transfer
+
+import "elotuschallenge/models"
+
+// CreateAPIKeyRequest represents the API key creation request payload
+type CreateAPIKeyRequest struct {
+	Name   string   `json:"name"`
+	Scopes []string `json:"scopes"`
+	// ExpiresInSeconds is optional, keys without expiry are valid until revoked
+	ExpiresInSeconds int64 `json:"expires_in_seconds"`
+}
+
+// CreateAPIKeyData contains the created key, the plain key is only returned once
+type CreateAPIKeyData struct {
+	Key    string         `json:"key"`
+	APIKey *models.APIKey `json:"api_key"`
+}
+
+// APIKeyListData contains the API keys of a user
+type APIKeyListData struct {
+	APIKeys []*models.APIKey `json:"api_keys"`
+}
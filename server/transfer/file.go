@@ -0,0 +1,10 @@
+package transfer
+
+import "elotuschallenge/models"
+
+// FileListData contains a page of the files of a user, NextCursor continues the listing and is omitted
+// on the last page
+type FileListData struct {
+	Files      []*models.FileMetadata `json:"files"`
+	NextCursor string                 `json:"next_cursor,omitempty"`
+}
@@ -2,6 +2,7 @@ package transfer
 
 // LoginRequest represents the login request payload
 type LoginRequest struct {
-	Username string `json:"username"`
-	Password string `json:"password"`
+	Username   string `json:"username"`
+	Password   string `json:"password"`
+	UseCookies bool   `json:"use_cookies,omitempty"`
 }
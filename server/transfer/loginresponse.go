@@ -2,11 +2,27 @@ package transfer
 
 // LoginResponse represents the login response payload
 type LoginResponse struct {
-	Token string   `json:"token"`
-	User  UserInfo `json:"user"`
+	Token        string   `json:"token,omitempty"`
+	RefreshToken string   `json:"refresh_token,omitempty"`
+	CSRFToken    string   `json:"csrf_token,omitempty"`
+	User         UserInfo `json:"user"`
 }
 
 // LoginData contains the login response data
 type LoginData struct {
 	Auth LoginResponse `json:"auth"`
 }
+
+// MFARequiredData is returned by login instead of tokens when two-factor authentication is enabled
+type MFARequiredData struct {
+	MFARequired bool   `json:"mfa_required"`
+	MFAToken    string `json:"mfa_token"`
+}
+
+// LoginMFARequest exchanges the MFA token and a TOTP code or a recovery code for tokens
+type LoginMFARequest struct {
+	MFAToken     string `json:"mfa_token"`
+	Code         string `json:"code,omitempty"`
+	RecoveryCode string `json:"recovery_code,omitempty"`
+	UseCookies   bool   `json:"use_cookies,omitempty"`
+}
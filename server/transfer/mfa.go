@@ -0,0 +1,25 @@
+package transfer
+
+// TOTPEnrollData contains the new TOTP secret and its otpauth:// URI for authenticator apps
+type TOTPEnrollData struct {
+	Secret string `json:"secret"`
+	URI    string `json:"otpauth_uri"`
+}
+
+// TOTPConfirmRequest represents the request enabling TOTP with a code of the authenticator
+type TOTPConfirmRequest struct {
+	Code string `json:"code"`
+}
+
+// MFAReauthRequest proves the user still has the password and the second factor before 2FA is
+// disabled or its recovery codes are replaced, a recovery code can be given instead of the code
+type MFAReauthRequest struct {
+	Password     string `json:"password"`
+	Code         string `json:"code"`
+	RecoveryCode string `json:"recovery_code"`
+}
+
+// TOTPConfirmData contains the recovery codes, they are only returned once
+type TOTPConfirmData struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
@@ -0,0 +1,6 @@
+package transfer
+
+// OIDCProvidersData lists the names of the configured identity providers
+type OIDCProvidersData struct {
+	Providers []string `json:"providers"`
+}
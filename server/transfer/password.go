@@ -0,0 +1,18 @@
+package transfer
+
+// ChangePasswordRequest represents the password change request payload
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"current_password"`
+	NewPassword     string `json:"new_password"`
+}
+
+// PasswordResetRequest represents the request asking for a password reset token
+type PasswordResetRequest struct {
+	Username string `json:"username"`
+}
+
+// ResetPasswordRequest represents the request setting a new password with a reset token
+type ResetPasswordRequest struct {
+	Token       string `json:"token"`
+	NewPassword string `json:"new_password"`
+}
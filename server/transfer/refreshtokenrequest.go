@@ -0,0 +1,11 @@
+package transfer
+
+// RefreshTokenRequest represents the token refresh request payload
+type RefreshTokenRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+// LogoutRequest represents the optional logout request payload
+type LogoutRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
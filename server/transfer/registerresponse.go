@@ -8,4 +8,6 @@ type RegisterData struct {
 type UserInfo struct {
 	ID       int    `json:"id"`
 	Username string `json:"username"`
+	Role     string `json:"role,omitempty"`
+	Status   string `json:"status,omitempty"`
 }
@@ -0,0 +1,36 @@
+package transfer
+
+import (
+	"time"
+
+	"elotuschallenge/models"
+)
+
+// SessionInfo describes a signed in session, Current marks the session of the request
+type SessionInfo struct {
+	ID         string    `json:"id"`
+	UserAgent  string    `json:"user_agent"`
+	IPAddress  string    `json:"ip_address"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastSeenAt time.Time `json:"last_seen_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+	Current    bool      `json:"current"`
+}
+
+// SessionListData contains the active sessions of a user
+type SessionListData struct {
+	Sessions []SessionInfo `json:"sessions"`
+}
+
+// NewSessionInfo describes a session, currentSessionID is the session of the request
+func NewSessionInfo(session *models.Session, currentSessionID string) SessionInfo {
+	return SessionInfo{
+		ID:         session.ID,
+		UserAgent:  session.UserAgent,
+		IPAddress:  session.IPAddress,
+		CreatedAt:  session.CreatedAt,
+		LastSeenAt: session.LastSeenAt,
+		ExpiresAt:  session.ExpiresAt,
+		Current:    session.ID == currentSessionID,
+	}
+}
@@ -0,0 +1,11 @@
+package transfer
+
+// VerifyAccountRequest represents the account verification request payload
+type VerifyAccountRequest struct {
+	Token string `json:"token"`
+}
+
+// ResendVerificationRequest represents the request sending a new verification token
+type ResendVerificationRequest struct {
+	Username string `json:"username"`
+}
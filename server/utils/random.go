@@ -2,6 +2,7 @@ package utils
 
 import (
 	"crypto/rand"
+	"encoding/base64"
 	"fmt"
 	"math/big"
 )
@@ -24,3 +25,12 @@ func GenerateRandomString(length int) string {
 
 	return string(result)
 }
+
+// GenerateSecureToken generates a URL safe token from the given number of cryptographically random bytes
+func GenerateSecureToken(byteLength int) (string, error) {
+	buffer := make([]byte, byteLength)
+	if _, err := rand.Read(buffer); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buffer), nil
+}
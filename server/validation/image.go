@@ -0,0 +1,232 @@
+package validation
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+	"mime"
+	"net/http"
+	"slices"
+	"strings"
+
+	"elotuschallenge/common"
+
+	// Decoders of the raster formats in ImageContentTypes
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+
+	_ "golang.org/x/image/bmp"
+	_ "golang.org/x/image/tiff"
+	_ "golang.org/x/image/webp"
+)
+
+// Image content types accepted for upload
+const (
+	ContentTypeJPEG = "image/jpeg"
+	ContentTypePNG  = "image/png"
+	ContentTypeGIF  = "image/gif"
+	ContentTypeWebP = "image/webp"
+	ContentTypeBMP  = "image/bmp"
+	ContentTypeTIFF = "image/tiff"
+	ContentTypeSVG  = "image/svg+xml"
+)
+
+// ImageContentTypes are the image types accepted for upload
+var ImageContentTypes = []string{ContentTypeJPEG, ContentTypePNG, ContentTypeGIF, ContentTypeWebP, ContentTypeBMP, ContentTypeTIFF, ContentTypeSVG}
+
+// imageFormats are the names image.Decode reports for the raster content types
+var imageFormats = map[string]string{
+	ContentTypeJPEG: "jpeg",
+	ContentTypePNG:  "png",
+	ContentTypeGIF:  "gif",
+	ContentTypeWebP: "webp",
+	ContentTypeBMP:  "bmp",
+	ContentTypeTIFF: "tiff",
+}
+
+// contentTypeAliases are declared types naming the same format as a detected type
+var contentTypeAliases = map[string]string{
+	"image/jpg":      ContentTypeJPEG,
+	"image/pjpeg":    ContentTypeJPEG,
+	"image/x-png":    ContentTypePNG,
+	"image/x-ms-bmp": ContentTypeBMP,
+}
+
+// sniffLength is how much of the content is looked at to detect its type, as http.DetectContentType does
+const sniffLength = 512
+
+// SniffContentType detects the type of an upload from its first bytes and rejects types which aren't allowed,
+// whatever type the client declared
+func SniffContentType(allowed []string) Check {
+	return func(upload *Upload) error {
+		head := make([]byte, sniffLength)
+		n, err := io.ReadFull(upload.Content, head)
+		if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, io.ErrUnexpectedEOF) {
+			return fmt.Errorf("failed to read upload: %w", err)
+		}
+
+		upload.DetectedType = detectContentType(head[:n])
+		if slices.Contains(xmlCandidateTypes, upload.DetectedType) {
+			// The root element of an SVG may come after comments or a doctype longer than the sniffed bytes
+			if _, err := upload.Content.Seek(0, io.SeekStart); err != nil {
+				return fmt.Errorf("failed to rewind upload: %w", err)
+			}
+			if xmlRootElement(upload.Content) == "svg" {
+				upload.DetectedType = ContentTypeSVG
+			}
+		}
+		if !slices.Contains(allowed, upload.DetectedType) {
+			return fmt.Errorf("%w: %s", common.ErrFileContentType, upload.DetectedType)
+		}
+		return nil
+	}
+}
+
+// MatchDeclaredType rejects uploads whose declared type differs from the type detected by SniffContentType.
+// A missing or generic declared type matches any content.
+func MatchDeclaredType(upload *Upload) error {
+	declared := normalizeContentType(upload.DeclaredType)
+	if declared == "" || declared == "application/octet-stream" {
+		return nil
+	}
+	if alias, ok := contentTypeAliases[declared]; ok {
+		declared = alias
+	}
+	if declared != upload.DetectedType {
+		return fmt.Errorf("%w: declared %s, detected %s", common.ErrContentTypeMismatch, declared, upload.DetectedType)
+	}
+	return nil
+}
+
+// DecodeImage decodes the whole image detected by SniffContentType to prove it is valid. Raster images larger
+// than maxPixels, or needing more memory than maxPixels 8-bit RGBA pixels, are rejected from their header before
+// decoding. At most maxConcurrent images are decoded at once, the others wait. SVGs must be well-formed XML with
+// an svg root.
+func DecodeImage(maxPixels, maxConcurrent int) Check {
+	decodeSlots := make(chan struct{}, max(maxConcurrent, 1))
+	maxBytes := int64(maxPixels) * 4
+
+	return func(upload *Upload) error {
+		if upload.DetectedType == ContentTypeSVG {
+			return decodeSVG(upload.Content)
+		}
+
+		format, ok := imageFormats[upload.DetectedType]
+		if !ok {
+			return fmt.Errorf("%w: no decoder for %s", common.ErrInvalidImage, upload.DetectedType)
+		}
+
+		config, configFormat, err := image.DecodeConfig(upload.Content)
+		if err != nil {
+			return fmt.Errorf("%w: %v", common.ErrInvalidImage, err)
+		}
+		if configFormat != format {
+			return fmt.Errorf("%w: %s content decoded as %s", common.ErrInvalidImage, upload.DetectedType, configFormat)
+		}
+		if config.Width <= 0 || config.Height <= 0 || config.Width > maxPixels/config.Height {
+			return fmt.Errorf("%w: %dx%d exceeds %d pixels", common.ErrInvalidImage, config.Width, config.Height, maxPixels)
+		}
+		// 16-bit images take twice the memory of 8-bit ones once decoded
+		if decodedBytes := int64(config.Width) * int64(config.Height) * bytesPerPixel(config.ColorModel); decodedBytes > maxBytes {
+			return fmt.Errorf("%w: %dx%d needs %d bytes decoded, more than %d", common.ErrInvalidImage, config.Width, config.Height, decodedBytes, maxBytes)
+		}
+
+		decodeSlots <- struct{}{}
+		defer func() { <-decodeSlots }()
+
+		if _, err := upload.Content.Seek(0, io.SeekStart); err != nil {
+			return fmt.Errorf("failed to rewind upload: %w", err)
+		}
+		if _, _, err := image.Decode(upload.Content); err != nil {
+			return fmt.Errorf("%w: %v", common.ErrInvalidImage, err)
+		}
+		return nil
+	}
+}
+
+// xmlCandidateTypes are the types http.DetectContentType reports for SVGs, depending on what comes before the root
+// element, e.g. text/html for a leading comment
+var xmlCandidateTypes = []string{"text/xml", "text/plain", "text/html"}
+
+// detectContentType sniffs the type of content from its first bytes. http.DetectContentType knows the raster
+// formats but TIFF, SVGs are told apart by SniffContentType from their root element.
+func detectContentType(head []byte) string {
+	if bytes.HasPrefix(head, []byte("II*\x00")) || bytes.HasPrefix(head, []byte("MM\x00*")) {
+		return ContentTypeTIFF
+	}
+	return normalizeContentType(http.DetectContentType(head))
+}
+
+// xmlRootElement returns the name of the first element of an XML document, skipping the declaration, comments and
+// doctype. It is empty when the content isn't XML.
+func xmlRootElement(content io.Reader) string {
+	decoder := xml.NewDecoder(content)
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			return ""
+		}
+		switch token := token.(type) {
+		case xml.StartElement:
+			return token.Name.Local
+		case xml.CharData:
+			if len(bytes.TrimSpace(token)) > 0 {
+				return ""
+			}
+		}
+	}
+}
+
+// bytesPerPixel is the memory image.Decode needs per pixel of the color model, unknown models are counted as 16-bit RGBA
+func bytesPerPixel(model color.Model) int64 {
+	if _, ok := model.(color.Palette); ok {
+		return 1
+	}
+	switch model {
+	case color.GrayModel, color.AlphaModel:
+		return 1
+	case color.Gray16Model, color.Alpha16Model:
+		return 2
+	case color.YCbCrModel:
+		return 3
+	case color.RGBAModel, color.NRGBAModel, color.NYCbCrAModel, color.CMYKModel:
+		return 4
+	}
+	return 8
+}
+
+// decodeSVG parses the whole document, its root element must be svg
+func decodeSVG(content io.Reader) error {
+	decoder := xml.NewDecoder(content)
+	root := ""
+	for {
+		token, err := decoder.Token()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("%w: %v", common.ErrInvalidImage, err)
+		}
+		if element, ok := token.(xml.StartElement); ok && root == "" {
+			root = element.Name.Local
+		}
+	}
+	if root != "svg" {
+		return fmt.Errorf("%w: SVG root element is %q", common.ErrInvalidImage, root)
+	}
+	return nil
+}
+
+// normalizeContentType returns the lowercase media type without parameters
+func normalizeContentType(contentType string) string {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return strings.ToLower(strings.TrimSpace(contentType))
+	}
+	return mediaType
+}
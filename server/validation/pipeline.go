@@ -0,0 +1,49 @@
+package validation
+
+import (
+	"fmt"
+	"io"
+)
+
+// Upload is a file being validated, checks may record what they learn about it for the checks after them
+type Upload struct {
+	Filename     string
+	DeclaredType string // Content-Type sent by the client, may be empty
+	Size         int64
+	Content      io.ReadSeeker
+	DetectedType string // Content type sniffed from the content by SniffContentType
+}
+
+// Check validates one aspect of an upload, it reads the content from the start
+type Check func(upload *Upload) error
+
+// Pipeline runs checks on uploads in order
+type Pipeline struct {
+	checks []Check
+}
+
+// NewPipeline creates a pipeline running the checks in the given order
+func NewPipeline(checks ...Check) *Pipeline {
+	return &Pipeline{checks: checks}
+}
+
+// Validate runs the checks until one fails. The content is rewound before each check and after the last one,
+// so it can be stored once validated.
+func (p *Pipeline) Validate(upload *Upload) error {
+	for _, check := range p.checks {
+		if err := rewind(upload); err != nil {
+			return err
+		}
+		if err := check(upload); err != nil {
+			return err
+		}
+	}
+	return rewind(upload)
+}
+
+func rewind(upload *Upload) error {
+	if _, err := upload.Content.Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf("failed to rewind upload: %w", err)
+	}
+	return nil
+}